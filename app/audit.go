@@ -0,0 +1,273 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Audit actions.
+const (
+	AuditUserCreated           = "user.created"
+	AuditUserUpdated           = "user.updated"
+	AuditUserPasswordChanged   = "user.password_changed"
+	AuditUserDeleted           = "user.deleted"
+	AuditUserRestored          = "user.restored"
+	AuditUserRoleAdded         = "user.role_added"
+	AuditUserRoleRemoved       = "user.role_removed"
+	AuditUserPermissionAdded   = "user.permission_added"
+	AuditUserPermissionRemoved = "user.permission_removed"
+	AuditUserDataExported      = "user.data_exported"
+	AuditUserErased            = "user.erased"
+	AuditRoleCreated           = "role.created"
+	AuditRoleUpdated           = "role.updated"
+	AuditRoleDeleted           = "role.deleted"
+	AuditRoleRestored          = "role.restored"
+	AuditRolePermissionAdded   = "role.permission_added"
+	AuditRolePermissionRemoved = "role.permission_removed"
+	AuditWebhookCreated        = "webhook.created"
+	AuditWebhookUpdated        = "webhook.updated"
+	AuditWebhookDeleted        = "webhook.deleted"
+	AuditDeletedPurged         = "deleted.purged"
+	AuditKeysRotated           = "keys.rotated"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser    = "user"
+	AuditTargetRole    = "role"
+	AuditTargetWebhook = "webhook"
+)
+
+// AuditEntry is a record of a change in the append-only audit log. Entries
+// are chained, the hash of every entry covers the hash of the previous one
+// so changing or removing an entry breaks the chain. Hashes are keyed with a
+// key held by the server, those who can write the database but don't have
+// the key can't compute the hashes of changed entries.
+type AuditEntry struct {
+	ID         int64        `db:"audit_id" json:"id"`
+	Created    int64        `db:"audit_created" json:"created"`
+	ActorID    string       `db:"audit_actor_id" json:"actor_id"`
+	RequestID  string       `db:"audit_request_id" json:"request_id"`
+	IP         string       `db:"audit_ip" json:"ip"`
+	Action     string       `db:"audit_action" json:"action"`
+	TargetType string       `db:"audit_target_type" json:"target_type"`
+	TargetID   string       `db:"audit_target_id" json:"target_id"`
+	Changes    AuditChanges `db:"audit_changes" json:"changes"`
+	PrevHash   string       `db:"audit_prev_hash" json:"prev_hash"`
+	Hash       string       `db:"audit_hash" json:"hash"`
+}
+
+// auditPersonalFields hold personal data, the log keeps keyed hashes of
+// their values. Changes of the fields still show and equal values have equal
+// hashes, but nothing is left in the log once the user is erased.
+var auditPersonalFields = []string{"email", "full_name"}
+
+// NewAuditEntry returns the entry for the action on the target made by the
+// actor stored in ctx, changes are the fields that differ between the JSON
+// encodings of before and after. Personal fields are hashed with key.
+func NewAuditEntry(ctx context.Context, key []byte, action, targetType, targetID string, before, after any) (*AuditEntry, error) {
+	changes, err := auditDiff(key, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	actor := AuditActorFromContext(ctx)
+	return &AuditEntry{
+		ActorID:    actor.UserID,
+		RequestID:  actor.RequestID,
+		IP:         actor.IP,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    changes,
+	}, nil
+}
+
+// ComputeHash returns the hex encoded HMAC-SHA256 of the previous hash and
+// the entry content keyed with key.
+func (e *AuditEntry) ComputeHash(key []byte) (string, error) {
+	changes := e.Changes
+	if changes == nil {
+		changes = AuditChanges{}
+	}
+
+	content, err := json.Marshal(struct {
+		Created    int64        `json:"created"`
+		ActorID    string       `json:"actor_id"`
+		RequestID  string       `json:"request_id"`
+		IP         string       `json:"ip"`
+		Action     string       `json:"action"`
+		TargetType string       `json:"target_type"`
+		TargetID   string       `json:"target_id"`
+		Changes    AuditChanges `json:"changes"`
+	}{
+		Created:    e.Created,
+		ActorID:    e.ActorID,
+		RequestID:  e.RequestID,
+		IP:         e.IP,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Changes:    changes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(e.PrevHash))
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// AuditChange holds JSON values of a field before and after the change.
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditChanges maps field names to their changes, it is stored as JSON.
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (c *AuditChanges) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into audit changes", src)
+	}
+}
+
+// auditDiff compares top level fields of before and after, either of them
+// can be nil. Passwords and secrets never end up in the log, personal fields
+// only as hashes keyed with key.
+func auditDiff(key []byte, before, after any) (AuditChanges, error) {
+	old, err := auditFields(key, before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := auditFields(key, after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := AuditChanges{}
+	for name, value := range old {
+		if !bytes.Equal(value, current[name]) {
+			changes[name] = AuditChange{Before: value, After: current[name]}
+		}
+	}
+	for name, value := range current {
+		if _, ok := old[name]; !ok {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func auditFields(key []byte, v any) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "password")
+	delete(fields, "secret")
+
+	for name, value := range fields {
+		if string(value) == "null" {
+			delete(fields, name)
+		}
+	}
+	for _, name := range auditPersonalFields {
+		if value, ok := fields[name]; ok {
+			fields[name] = personalDataHash(key, name, value)
+		}
+	}
+	return fields, nil
+}
+
+// personalDataHash returns the JSON string of the keyed hash of the value of
+// the field.
+func personalDataHash(key []byte, name string, value json.RawMessage) json.RawMessage {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + ":"))
+	mac.Write(value)
+	return json.RawMessage(`"hmac-sha256:` + hex.EncodeToString(mac.Sum(nil)) + `"`)
+}
+
+// AuditHeadMAC returns the hex encoded HMAC-SHA256 of the id and the hash of
+// the newest entry keyed with key. The head is stored with it, so entries
+// deleted from the end of the log are detected.
+func AuditHeadMAC(key []byte, entryID int64, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("head:" + strconv.FormatInt(entryID, 10) + ":" + hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AuditActor identifies who makes the change.
+type AuditActor struct {
+	UserID    string
+	RequestID string
+	IP        string
+}
+
+type auditActorContextKey struct{}
+
+// ContextWithAuditActor returns the copy of ctx carrying the actor, changes
+// made with the returned context are logged on behalf of the actor.
+func ContextWithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorContextKey{}, actor)
+}
+
+// AuditActorFromContext returns the actor stored in ctx, changes without an
+// actor are made by the system.
+func AuditActorFromContext(ctx context.Context) AuditActor {
+	actor, _ := ctx.Value(auditActorContextKey{}).(AuditActor)
+	return actor
+}
+
+// AuditVerification is the result of the audit log hash chain check.
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Entries int64 `json:"entries"`
+	// BrokenAt is the ID of the first entry that doesn't match the chain.
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	// Truncated is set when the last entry isn't the head recorded with the
+	// newest entry, entries were deleted from the end of the log.
+	Truncated bool `json:"truncated,omitempty"`
+	// Head is the hash of the last verified entry. Kept outside of the
+	// database, it can be compared with the head of later checks.
+	Head string `json:"head,omitempty"`
+}
@@ -0,0 +1,18 @@
+package app
+
+import "context"
+
+// Backup is a consistent snapshot of the database.
+type Backup struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Compressed bool   `json:"compressed"`
+	Created    int64  `json:"created"`
+}
+
+// BackupService takes database backups.
+type BackupService interface {
+	// Backup writes a snapshot of the database, verifies it and removes
+	// backups exceeding the configured number to keep.
+	Backup(ctx context.Context) (Backup, error)
+}
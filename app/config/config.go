@@ -0,0 +1,399 @@
+// Package config loads the configuration of commands in layers, each
+// overriding the one before: defaults, a YAML or TOML file, APP_*
+// environment variables and command line flags.
+//
+// A configuration is a struct of settings and sections, which are structs
+// too. Tags of the fields describe the settings:
+//
+//	yaml     key in the file, "-" when the setting is a flag only
+//	cli      flag of the setting, as parsed by mcli
+//	default  value when no layer sets it
+//	enum     comma separated values the setting accepts
+//	minimum  least value of a number
+//	maximum  greatest value of a number
+//	secret   "true" redacts the value when printed, "dsn" only the password
+//	         in the data source name
+//	reload   "true" when the setting can change while the app runs
+//
+// The environment variable of a setting is EnvPrefix followed by its keys in
+// upper case joined by _, like APP_SERVER_PORT for port in section server.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables of settings.
+const EnvPrefix = "APP_"
+
+// FileNames are the names of files Find looks for, in order.
+var FileNames = []string{"config.yaml", "config.yml", "config.toml"}
+
+// Validator is implemented by configurations with rules which tags can't
+// express, like settings which depend on each other.
+type Validator interface {
+	Validate() error
+}
+
+// Find returns the config file in dir, or "" when there is none.
+func Find(dir string) (string, error) {
+	var found []string
+	for _, name := range FileNames {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err == nil {
+			found = append(found, file)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("found config files %s, keep only one", strings.Join(found, ", "))
+	}
+	if len(found) == 0 {
+		return "", nil
+	}
+	return found[0], nil
+}
+
+// Load fills v, a pointer to a configuration, with the layers and validates
+// it. flags is a configuration of the same type parsed by mcli, fs the flag
+// set mcli returned; only flags set on the command line override the other
+// layers. file is skipped when it is "", lookupEnv is usually os.LookupEnv.
+func Load(v any, file string, lookupEnv func(string) (string, bool), flags any, fs *flag.FlagSet) error {
+	if err := SetDefaults(v); err != nil {
+		return err
+	}
+	if file != "" {
+		if err := ReadFile(file, v); err != nil {
+			return err
+		}
+	}
+	if err := ReadEnv(v, lookupEnv); err != nil {
+		return err
+	}
+	if flags != nil && fs != nil {
+		copyFlags(v, flags, fs)
+	}
+	return Validate(v)
+}
+
+// SetDefaults sets the settings of v to the values of their default tags.
+func SetDefaults(v any) error {
+	return walk(v, func(s setting) error {
+		value, ok := s.field.Tag.Lookup("default")
+		if !ok {
+			return nil
+		}
+		if err := setString(s.value, value); err != nil {
+			return fmt.Errorf("default of %s: %w", s.key(), err)
+		}
+		return nil
+	})
+}
+
+// ReadFile decodes the YAML or TOML file, told by its extension, into v.
+// Keys which aren't settings of v are an error, typos would be ignored
+// otherwise.
+func ReadFile(file string, v any) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	switch ext := filepath.Ext(file); ext {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML is decoded as YAML so the keys of the settings are
+		// declared once, by the yaml tags
+		var doc map[string]any
+		if _, err = toml.Decode(string(data), &doc); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config file format %q", file, ext)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// a file without settings is empty to the decoder
+	if err = decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// ReadEnv sets the settings of v which have an environment variable.
+func ReadEnv(v any, lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	err := walk(v, func(s setting) error {
+		if s.path == nil {
+			return nil
+		}
+		name := s.env()
+		value, ok := lookupEnv(name)
+		if !ok {
+			return nil
+		}
+		if err := setString(s.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// copyFlags copies the settings of flags set on the command line to v.
+func copyFlags(v, flags any, fs *flag.FlagSet) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	dst := reflect.ValueOf(v).Elem()
+	walk(flags, func(s setting) error {
+		for _, name := range s.flags() {
+			if set[name] {
+				dst.FieldByIndex(s.index).Set(s.value)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Validate checks the settings of v against their enum, minimum and
+// maximum tags, then v itself when it is a Validator.
+func Validate(v any) error {
+	var errs []error
+	walk(v, func(s setting) error {
+		if err := s.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.key(), err))
+		}
+		return nil
+	})
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setting is a field of a configuration which isn't a section.
+type setting struct {
+	// path are the keys of the setting, nil when it isn't in the file.
+	path  []string
+	index []int
+	field reflect.StructField
+	value reflect.Value
+}
+
+// key returns the keys of the setting joined by dots, or its flag when it
+// isn't in the file.
+func (s setting) key() string {
+	if s.path == nil {
+		if flags := s.flags(); len(flags) > 0 {
+			return "--" + flags[len(flags)-1]
+		}
+		return s.field.Name
+	}
+	return strings.Join(s.path, ".")
+}
+
+// env returns the environment variable of the setting.
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.Join(s.path, "_"))
+}
+
+// flags returns the names of the flags of the setting, without dashes.
+func (s setting) flags() []string {
+	names, _ := parseCLITag(s.field.Tag.Get("cli"))
+	return names
+}
+
+func (s setting) validate() error {
+	if enum, ok := s.field.Tag.Lookup("enum"); ok && s.value.Kind() == reflect.String {
+		values := strings.Split(enum, ",")
+		if !slices.Contains(values, s.value.String()) {
+			return fmt.Errorf("must be one of %s, got %q", strings.Join(values, ", "), s.value.String())
+		}
+	}
+
+	number, ok := toFloat(s.value)
+	if !ok {
+		return nil
+	}
+	if min, ok := s.field.Tag.Lookup("minimum"); ok {
+		if limit, err := strconv.ParseFloat(min, 64); err == nil && number < limit {
+			return fmt.Errorf("must be at least %s, got %v", min, s.value)
+		}
+	}
+	if max, ok := s.field.Tag.Lookup("maximum"); ok {
+		if limit, err := strconv.ParseFloat(max, 64); err == nil && number > limit {
+			return fmt.Errorf("must be at most %s, got %v", max, s.value)
+		}
+	}
+	return nil
+}
+
+// walk calls fn for each setting of v, a pointer to a configuration, in the
+// order of the fields.
+func walk(v any, fn func(setting) error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct, got %T", v)
+	}
+	return walkStruct(rv.Elem(), []string{}, nil, fn)
+}
+
+func walkStruct(rv reflect.Value, path []string, index []int, fn func(setting) error) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldIndex := append(index[:len(index):len(index)], i)
+
+		name, inline := yamlKey(field)
+		fieldPath := path
+		if path != nil && !inline {
+			fieldPath = append(path[:len(path):len(path)], name)
+		}
+		if name == "-" {
+			fieldPath = nil
+		}
+
+		if isSection(field.Type) {
+			if err := walkStruct(rv.Field(i), fieldPath, fieldIndex, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(setting{path: fieldPath, index: fieldIndex, field: field, value: rv.Field(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlKey returns the key of the field in the file and whether its settings
+// are inlined into the parent section, like those of embedded structs.
+func yamlKey(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("yaml")
+	name, options, _ := strings.Cut(tag, ",")
+	if strings.Contains(options, "inline") || (tag == "" && field.Anonymous) {
+		return "", true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
+
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setString parses s into the setting, the same way as flags are.
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// toFloat returns the value of a number setting.
+func toFloat(v reflect.Value) (float64, bool) {
+	if v.Type() == durationType {
+		return 0, false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// parseCLITag returns the names of the flags, without dashes, and the
+// description of a cli tag like "-p, --port  Port to listen on".
+func parseCLITag(tag string) ([]string, string) {
+	var names []string
+	rest := strings.TrimSpace(tag)
+	for rest != "" {
+		token, after, _ := strings.Cut(rest, " ")
+		token = strings.TrimSuffix(token, ",")
+		switch {
+		case strings.HasPrefix(token, "#"):
+			// modifiers of mcli
+		case strings.HasPrefix(token, "-"):
+			names = append(names, strings.TrimLeft(token, "-"))
+		default:
+			return names, rest
+		}
+		rest = strings.TrimSpace(after)
+	}
+	return names, ""
+}
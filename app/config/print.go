@@ -0,0 +1,43 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the values of secrets.
+const redacted = "xxxxx"
+
+// dsnPassword matches the password of key=value data source names.
+var dsnPassword = regexp.MustCompile(`(?i)\b(password)=('[^']*'|\S+)`)
+
+// Redact returns a copy of v, a pointer to a configuration, with the values
+// of secrets replaced.
+func Redact[T any](v *T) *T {
+	c := *v
+	walk(&c, func(s setting) error {
+		if s.value.Kind() == reflect.String && s.field.Tag.Get("secret") != "" {
+			s.value.SetString(s.format(s.value))
+		}
+		return nil
+	})
+	return &c
+}
+
+// redactDSN replaces the password of a data source name, written as a URL
+// or as key=value pairs.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}="+redacted)
+}
+
+// Marshal encodes v, a pointer to a configuration, as YAML which can be used
+// as a config file. Secrets should be redacted first.
+func Marshal(v any) ([]byte, error) {
+	return yaml.Marshal(v)
+}
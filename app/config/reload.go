@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is a setting which differs between two configurations.
+type Change struct {
+	Key        string
+	Old        string
+	New        string
+	Reloadable bool
+}
+
+// Diff returns the settings of the file which differ between before and
+// after, pointers to configurations of the same type. Values of secrets are
+// redacted.
+func Diff(before, after any) []Change {
+	old := reflect.ValueOf(before).Elem()
+	var changes []Change
+	walk(after, func(s setting) error {
+		if s.path == nil {
+			return nil
+		}
+		value := old.FieldByIndex(s.index)
+		if reflect.DeepEqual(value.Interface(), s.value.Interface()) {
+			return nil
+		}
+		changes = append(changes, Change{
+			Key:        s.key(),
+			Old:        s.format(value),
+			New:        s.format(s.value),
+			Reloadable: s.reloadable(),
+		})
+		return nil
+	})
+	return changes
+}
+
+// CopyReloadable copies the settings which can change while the app runs
+// from src to dst, pointers to configurations of the same type.
+func CopyReloadable(dst, src any) {
+	to := reflect.ValueOf(dst).Elem()
+	walk(src, func(s setting) error {
+		if s.reloadable() {
+			to.FieldByIndex(s.index).Set(s.value)
+		}
+		return nil
+	})
+}
+
+func (s setting) reloadable() bool {
+	return s.field.Tag.Get("reload") == "true"
+}
+
+// format returns the value of the setting as written in the file, redacted
+// when it is a secret.
+func (s setting) format(value reflect.Value) string {
+	if value.Kind() == reflect.String && value.String() != "" {
+		switch s.field.Tag.Get("secret") {
+		case "true":
+			return redacted
+		case "dsn":
+			return redactDSN(value.String())
+		}
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/swaggest/jsonschema-go"
+)
+
+// Schema returns the JSON schema of config files of v, a pointer to a
+// configuration. The descriptions of settings are those of their flags.
+func Schema(v any) ([]byte, error) {
+	// the reflector inlines embedded structs only without a name, yaml
+	// needs them tagged with ,inline
+	inline := make(map[string]string)
+	walkTypes(reflect.TypeOf(v), func(field reflect.StructField) {
+		if _, ok := yamlKey(field); ok && field.Anonymous {
+			inline[field.Name] = ""
+		}
+	})
+
+	var reflector jsonschema.Reflector
+	schema, err := reflector.Reflect(v,
+		jsonschema.PropertyNameTag("yaml"),
+		func(rc *jsonschema.ReflectContext) {
+			rc.PropertyNameMapping = inline
+		},
+		jsonschema.InlineRefs,
+		jsonschema.InterceptSchema(func(params jsonschema.InterceptSchemaParams) (bool, error) {
+			// durations are written like 1m30s
+			if params.Value.Type() != durationType || params.Processed {
+				return false, nil
+			}
+			params.Schema.WithType(jsonschema.String.Type()).
+				WithPattern(`^(-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+|0)$`)
+			return true, nil
+		}),
+		jsonschema.InterceptProp(func(params jsonschema.InterceptPropParams) error {
+			if !params.Processed {
+				return nil
+			}
+			if _, description := parseCLITag(params.Field.Tag.Get("cli")); description != "" {
+				params.PropertySchema.WithDescription(description)
+			}
+			if params.PropertySchema.Type != nil && params.PropertySchema.Type.SimpleTypes != nil &&
+				*params.PropertySchema.Type.SimpleTypes == jsonschema.Object {
+				params.PropertySchema.WithAdditionalProperties(jsonschema.SchemaOrBool{TypeBoolean: new(bool)})
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	schema.WithSchema("http://json-schema.org/draft-07/schema#")
+	schema.WithAdditionalProperties(jsonschema.SchemaOrBool{TypeBoolean: new(bool)})
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// walkTypes calls fn for the fields of the struct t and of its sections.
+func walkTypes(t reflect.Type, fn func(reflect.StructField)) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fn(field)
+		if isSection(field.Type) {
+			walkTypes(field.Type, fn)
+		}
+	}
+}
@@ -31,6 +31,9 @@ type User struct {
 	Active     bool     `db:"user_active" json:"active"`
 	Created    int64    `db:"user_created" json:"created,readOnly"`
 	Modified   *int64   `db:"user_modified" json:"modified,readOnly"`
+	Version    int64    `db:"user_version" json:"version,readOnly"`
+	DeletedAt  *int64   `db:"user_deleted_at" json:"deleted_at,readOnly"`
+	ErasedAt   *int64   `db:"user_erased_at" json:"erased_at,readOnly"`
 	Email      Email    `db:"user_email" json:"email"`
 	FullName   string   `db:"user_full_name" json:"full_name"`
 	IsAdmin    bool     `db:"user_is_admin" json:"is_admin"`
@@ -56,6 +59,20 @@ func (u *User) Validate() error {
 	return nil
 }
 
+// ValidateProfile validates the user without the password, which is only
+// required on create and otherwise changed on its own.
+func (u *User) ValidateProfile() error {
+	if err := u.Email.Validate(); err != nil {
+		return err
+	}
+
+	if u.FullName == "" {
+		return ErrFieldIsMandatory("full_name")
+	}
+
+	return nil
+}
+
 func (a *User) SetID(id any) {
 	a.ID = id.(string)
 }
@@ -72,15 +89,34 @@ func (a *User) SetModified(val int64) {
 	a.Modified = &val
 }
 
+func (a *User) GetVersion() int64 {
+	return a.Version
+}
+
 func (u *User) Generator() (func() any, error) {
 	return generator()
 }
 
+type UserSearchResult struct {
+	User
+	Rank      float64       `db:"search_rank" json:"rank"`
+	Highlight UserHighlight `db:"highlight" json:"highlight"`
+}
+
+// UserHighlight holds user fields escaped for HTML with the matched terms
+// wrapped in <mark></mark> tags.
+type UserHighlight struct {
+	FullName string `db:"full_name" json:"full_name"`
+	Email    string `db:"email" json:"email"`
+}
+
 type Role struct {
-	ID       string `db:"role_id" json:"id"`
-	Name     string `db:"role_name" json:"name"`
-	Created  int64  `db:"role_created" json:"created,readOnly" readOnly:"true"`
-	Modified *int64 `db:"role_modified" json:"modified,readOnly" readOnly:"true"`
+	ID        string `db:"role_id" json:"id"`
+	Name      string `db:"role_name" json:"name"`
+	Created   int64  `db:"role_created" json:"created,readOnly" readOnly:"true"`
+	Modified  *int64 `db:"role_modified" json:"modified,readOnly" readOnly:"true"`
+	Version   int64  `db:"role_version" json:"version,readOnly" readOnly:"true"`
+	DeletedAt *int64 `db:"role_deleted_at" json:"deleted_at,readOnly" readOnly:"true"`
 }
 
 func (r *Role) Validate() error {
@@ -106,6 +142,10 @@ func (r *Role) SetModified(val int64) {
 	r.Modified = &val
 }
 
+func (r *Role) GetVersion() int64 {
+	return r.Version
+}
+
 func (r *Role) Generator() (func() any, error) {
 	return generator()
 }
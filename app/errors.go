@@ -25,13 +25,15 @@ type Status string
 // Different applications can have very different status code requirements so
 // these should be expanded as needed (or introduce subcodes).
 const (
-	StatusConflict        Status = "conflict"
-	StatusInternal        Status = "internal"
-	StatusInvalid         Status = "invalid"
-	StatusNotFound        Status = "not_found"
-	StatusNotImplemented  Status = "not_implemented"
-	StatusUnauthenticated Status = "unauthenticated"
-	StatusUnauthorized    Status = "unauthorized"
+	StatusConflict           Status = "conflict"
+	StatusInternal           Status = "internal"
+	StatusInvalid            Status = "invalid"
+	StatusNotFound           Status = "not_found"
+	StatusNotImplemented     Status = "not_implemented"
+	StatusPreconditionFailed Status = "precondition_failed"
+	StatusUnauthenticated    Status = "unauthenticated"
+	StatusUnauthorized       Status = "unauthorized"
+	StatusUnsupportedMedia   Status = "unsupported_media_type"
 )
 
 // Error represents an application-specific error. Application errors can be
@@ -60,6 +62,11 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("app error: code=%s, message=%s", e.Status, e.Message)
 }
 
+// Unwrap returns the source error, so errors.Is and errors.As can inspect it.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // ErrorStatus unwraps an application error and returns its code.
 // Non-application errors always return StatusInternal.
 func ErrorStatus(err error) Status {
@@ -202,6 +209,12 @@ func ErrNotImplemented(format string, args ...interface{}) error {
 	return Errorf(StatusNotImplemented, format, args...)
 }
 
+// ErrPreconditionFailed is a helper function to return a precondition_failed
+// error with a given code and formatted message.
+func ErrPreconditionFailed(format string, args ...interface{}) error {
+	return Errorf(StatusPreconditionFailed, format, args...)
+}
+
 // ErrUnauthenticated is a helper function to return unauthenticated error
 // with a given code and formatted message.
 func ErrUnauthenticated(format string, args ...interface{}) error {
@@ -214,6 +227,12 @@ func ErrUnauthorized(format string, args ...interface{}) error {
 	return Errorf(StatusUnauthorized, format, args...)
 }
 
+// ErrUnsupportedMedia is a helper function to return unsupported_media_type
+// error with a given code and formatted message.
+func ErrUnsupportedMedia(format string, args ...interface{}) error {
+	return Errorf(StatusUnsupportedMedia, format, args...)
+}
+
 // ErrFieldIsMandatory is a helper function to return error
 // with a given mandatory field.
 func ErrFieldIsMandatory(field string) error {
@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event types.
+const (
+	EventUserCreated    = "user.created"
+	EventUserUpdated    = "user.updated"
+	EventUserDeleted    = "user.deleted"
+	EventUserRestored   = "user.restored"
+	EventUserErased     = "user.erased"
+	EventRoleCreated    = "role.created"
+	EventRoleUpdated    = "role.updated"
+	EventRoleDeleted    = "role.deleted"
+	EventRoleRestored   = "role.restored"
+	EventLoginSucceeded = "login.succeeded"
+	EventLoginFailed    = "login.failed"
+)
+
+// Event aggregate types.
+const (
+	AggregateUser  = "user"
+	AggregateRole  = "role"
+	AggregateLogin = "login"
+)
+
+// Event is a domain event, events are stored in the outbox in the same
+// transaction as the change and dispatched to sinks afterwards.
+type Event struct {
+	ID            int64        `db:"event_id" json:"id"`
+	Type          string       `db:"event_type" json:"type"`
+	AggregateType string       `db:"event_aggregate_type" json:"aggregate_type"`
+	AggregateID   string       `db:"event_aggregate_id" json:"aggregate_id"`
+	Payload       EventPayload `db:"event_payload" json:"payload"`
+	Created       int64        `db:"event_created" json:"created"`
+}
+
+// EventPayload is the JSON encoded payload of the event, for user and role
+// events it is the aggregate after the change.
+type EventPayload []byte
+
+func (p EventPayload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+func (p *EventPayload) UnmarshalJSON(data []byte) error {
+	*p = append((*p)[:0], data...)
+	return nil
+}
+
+func (p EventPayload) Value() (driver.Value, error) {
+	return string(p), nil
+}
+
+func (p *EventPayload) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*p = EventPayload(v)
+	case []byte:
+		*p = append((*p)[:0], v...)
+	default:
+		return fmt.Errorf("cannot scan %T into event payload", src)
+	}
+	return nil
+}
+
+// LoginEvent is the payload of login events.
+type LoginEvent struct {
+	UserID string `json:"user_id,omitempty"`
+	Email  string `json:"email"`
+	Reason string `json:"reason,omitempty"`
+	IP     string `json:"ip,omitempty"`
+}
+
+// EventSink receives dispatched events. Events are delivered at least once,
+// sinks should be ready to get the same event again.
+type EventSink interface {
+	Name() string
+	Publish(ctx context.Context, event Event) error
+}
+
+// EventStore is the outbox the dispatcher reads events from.
+type EventStore interface {
+	// PendingEvents returns up to limit not dispatched events with ID
+	// greater than afterID, ordered by ID.
+	PendingEvents(ctx context.Context, afterID int64, limit int) ([]Event, error)
+	MarkEventsDispatched(ctx context.Context, ids ...int64) error
+	PurgeDispatchedEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// DispatcherConfig configures the event dispatcher.
+type DispatcherConfig struct {
+	// Interval between outbox polls.
+	Interval time.Duration
+	// BatchSize is the number of events read from the outbox at once.
+	BatchSize int
+	// Retention of dispatched events, 0 keeps them forever.
+	Retention time.Duration
+}
+
+// Dispatcher delivers events from the outbox to the sinks. When a sink fails
+// the event stays in the outbox and later events of the same aggregate are
+// held back, so every aggregate's events arrive in order. Only one
+// dispatcher should run per database.
+type Dispatcher struct {
+	store  EventStore
+	sinks  []EventSink
+	config DispatcherConfig
+
+	running atomic.Bool
+	// pollErr is the error of the last poll of the outbox, nil when it
+	// succeeded.
+	pollErr atomic.Pointer[error]
+}
+
+// NewDispatcher returns the dispatcher publishing events to the sinks in the
+// given order, an event goes to the next sink once the previous one is done
+// with it. Sinks which may be slow or fail should come last.
+func NewDispatcher(store EventStore, config DispatcherConfig, sinks ...EventSink) *Dispatcher {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	return &Dispatcher{
+		store:  store,
+		sinks:  sinks,
+		config: config,
+	}
+}
+
+// Start runs the dispatcher in the task until ctx is done.
+func (d *Dispatcher) Start(ctx context.Context, task *Task) {
+	d.running.Store(true)
+	task.Background(func() {
+		defer d.running.Store(false)
+
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			err := d.Dispatch(ctx)
+			d.pollErr.Store(&err)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Err(err).Msg("Failed to dispatch events")
+			}
+
+			if d.config.Retention > 0 {
+				_, err := d.store.PurgeDispatchedEvents(ctx, time.Now().Add(-d.config.Retention))
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Err(err).Msg("Failed to purge dispatched events")
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Check is a health check probe, it fails when the dispatcher doesn't run or
+// its last poll of the outbox failed.
+func (d *Dispatcher) Check(context.Context) error {
+	if !d.running.Load() {
+		return errors.New("dispatcher is not running")
+	}
+	if err := d.pollErr.Load(); err != nil && *err != nil {
+		return fmt.Errorf("last poll failed: %w", *err)
+	}
+	return nil
+}
+
+// Dispatch delivers all pending events once.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	type aggregate struct {
+		typ, id string
+	}
+
+	var (
+		afterID int64
+		blocked = map[aggregate]bool{}
+	)
+
+	for {
+		events, err := d.store.PendingEvents(ctx, afterID, d.config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		dispatched := make([]int64, 0, len(events))
+		for _, event := range events {
+			afterID = event.ID
+
+			key := aggregate{event.AggregateType, event.AggregateID}
+			if blocked[key] {
+				continue
+			}
+
+			if err := d.publish(ctx, event); err != nil {
+				blocked[key] = true
+				log.Warn().Err(err).Int64("event", event.ID).Str("type", event.Type).
+					Msg("Event delivery failed, will retry")
+				continue
+			}
+			dispatched = append(dispatched, event.ID)
+		}
+
+		if len(dispatched) > 0 {
+			if err = d.store.MarkEventsDispatched(ctx, dispatched...); err != nil {
+				return err
+			}
+		}
+
+		if len(events) < d.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) publish(ctx context.Context, event Event) error {
+	for _, sink := range d.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			return fmt.Errorf("sink %s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// LogEventSink writes events to the application log.
+type LogEventSink struct{}
+
+func (LogEventSink) Name() string {
+	return "log"
+}
+
+func (LogEventSink) Publish(ctx context.Context, event Event) error {
+	log.Debug().
+		Int64("event", event.ID).
+		Str("type", event.Type).
+		Str("aggregate", event.AggregateType+"/"+event.AggregateID).
+		Msg("Event dispatched")
+	return nil
+}
@@ -3,6 +3,9 @@ package app
 type UserFilter struct {
 	ID    string
 	Email *string
+	// Version, when set, restricts changes to the user stored with this
+	// version.
+	Version int64
 }
 
 func (f UserFilter) String() string {
@@ -21,6 +24,9 @@ func (f UserFilter) String() string {
 type IDOrNameFilter struct {
 	ID   string
 	Name string
+	// Version, when set, restricts changes to the row stored with this
+	// version.
+	Version int64
 }
 
 func (f IDOrNameFilter) String() string {
@@ -37,3 +43,32 @@ type PermissionFilter struct {
 	UserID string
 	RoleID string
 }
+
+type UserSearchFilter struct {
+	Query  string
+	Limit  int
+	Offset int
+}
+
+func (f UserSearchFilter) String() string {
+	return "query = " + f.Query
+}
+
+// AuditFilter selects audit log entries, empty fields match all entries.
+// From and To are unix times, To is exclusive.
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       int64
+	To         int64
+	Limit      int
+	Offset     int
+}
+
+type WebhookDeliveryFilter struct {
+	WebhookID string
+	Limit     int
+	Offset    int
+}
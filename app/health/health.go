@@ -0,0 +1,140 @@
+// Package health checks whether the app and the components it depends on
+// can serve requests.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout of probes which don't set their own.
+const DefaultTimeout = 2 * time.Second
+
+// Statuses of checks and reports.
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+	// StatusDraining is reported once the server stops, load balancers
+	// should stop sending requests to it.
+	StatusDraining = "draining"
+)
+
+// Check is a probe of a component, like a database connection.
+type Check struct {
+	Name string
+	// Timeout after which the probe fails, 0 is DefaultTimeout.
+	Timeout time.Duration
+	// Probe returns nil when the component works, it should give up when
+	// ctx is done.
+	Probe func(ctx context.Context) error
+}
+
+// Result of a check.
+type Result struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report of all checks, Checks is empty when the registry is draining.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+// Registry holds the checks of the app, it is safe for concurrent use.
+type Registry struct {
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	checks []Check
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds checks run by Check.
+func (r *Registry) Register(checks ...Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, checks...)
+}
+
+// Drain makes the reports fail with StatusDraining from now on.
+func (r *Registry) Drain() {
+	r.draining.Store(true)
+}
+
+// Check runs all checks at once and reports their results in the order they
+// are registered. The report is failing when any check fails.
+func (r *Registry) Check(ctx context.Context) Report {
+	if r.draining.Load() {
+		return Report{Status: StatusDraining}
+	}
+
+	r.mu.Lock()
+	checks := r.checks
+	r.mu.Unlock()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make([]Result, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+// run runs the probe of the check, a probe which doesn't return in time is
+// left running and reported as failing.
+func run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Probe(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := Result{
+		Name:     check.Name,
+		Status:   StatusOK,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
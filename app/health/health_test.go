@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Check(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	failed := func(context.Context) error { return errors.New("connection refused") }
+	stuck := func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	type result struct {
+		Name, Status, Error string
+	}
+	tests := []struct {
+		name       string
+		checks     []Check
+		drain      bool
+		wantStatus string
+		want       []result
+	}{
+		{
+			name:       "no checks",
+			wantStatus: StatusOK,
+		},
+		{
+			name:       "all pass",
+			checks:     []Check{{Name: "db", Probe: ok}, {Name: "queue", Probe: ok}},
+			wantStatus: StatusOK,
+			want:       []result{{"db", StatusOK, ""}, {"queue", StatusOK, ""}},
+		},
+		{
+			name:       "one fails",
+			checks:     []Check{{Name: "db", Probe: failed}, {Name: "queue", Probe: ok}},
+			wantStatus: StatusFailing,
+			want:       []result{{"db", StatusFailing, "connection refused"}, {"queue", StatusOK, ""}},
+		},
+		{
+			name:       "probe times out",
+			checks:     []Check{{Name: "db", Timeout: 10 * time.Millisecond, Probe: stuck}},
+			wantStatus: StatusFailing,
+			want:       []result{{"db", StatusFailing, "timed out after 10ms"}},
+		},
+		{
+			name:       "draining",
+			checks:     []Check{{Name: "db", Probe: ok}},
+			drain:      true,
+			wantStatus: StatusDraining,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.Register(tt.checks...)
+			if tt.drain {
+				r.Drain()
+			}
+
+			report := r.Check(context.Background())
+			if report.Status != tt.wantStatus {
+				t.Errorf("Check() status = %s, want %s", report.Status, tt.wantStatus)
+			}
+			var got []result
+			for _, r := range report.Checks {
+				got = append(got, result{r.Name, r.Status, r.Error})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+	"github.com/swaggest/openapi-go/openapi3"
+)
+
+func (s *Server) backupHandler() http.HandlerFunc {
+	// define openapi operation
+	opBackup := createSecureOperation("admin", "backupDatabase",
+		"Write a verified snapshot of the database to the backup dir, admins only")
+
+	success := s.createAPIResponses(&opBackup, app.Backup{})
+	handleError(s.reflector.SetJSONResponse(&opBackup, new(ErrorResponse), http.StatusNotImplemented))
+	handleError(s.reflector.Spec.AddOperation(routes.backup.method, routes.backup.getOAPI(), opBackup))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.backups == nil {
+			s.error(w, r, app.ErrNotImplemented("backups are not supported by the database driver"))
+			return
+		}
+
+		backup, err := s.backups.Backup(r.Context())
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, backup)
+	}
+}
+
+func (s *Server) reloadConfigHandler() http.HandlerFunc {
+	// define openapi operation
+	opReload := createSecureOperation("admin", "reloadConfig",
+		"Read the config again and apply the settings which don't need a restart, admins only")
+
+	success := s.createAPIResponses(&opReload, app.ConfigReload{})
+	handleError(s.reflector.SetJSONResponse(&opReload, new(ErrorResponse), http.StatusNotImplemented))
+	handleError(s.reflector.Spec.AddOperation(routes.reloadConfig.method, routes.reloadConfig.getOAPI(), opReload))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.reloader == nil {
+			s.error(w, r, app.ErrNotImplemented("config reload is not supported"))
+			return
+		}
+
+		reload, err := s.reloader.Reload(r.Context())
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, reload)
+	}
+}
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+)
+
+// transferMimeTypes maps transfer formats to content types.
+var transferMimeTypes = map[string]string{
+	app.FormatNDJSON: mimeNDJSON,
+	app.FormatCSV:    mimeCSV,
+}
+
+func (s *Server) exportHandler() http.HandlerFunc {
+	// define openapi operation
+	opExport := createSecureOperation("admin", "exportRecords",
+		"Export roles and users with their roles, permissions and password hashes, admins only")
+	opExport.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramFormat},
+	}
+
+	handleError(s.reflector.SetStringResponse(&opExport, http.StatusOK, mimeNDJSON))
+	handleError(s.reflector.SetStringResponse(&opExport, http.StatusOK, mimeCSV))
+	handleError(s.reflector.SetJSONResponse(&opExport, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.SetJSONResponse(&opExport, new(ErrorResponse), http.StatusUnauthorized))
+	handleError(s.reflector.SetJSONResponse(&opExport, new(ErrorResponse), http.StatusForbidden))
+	handleError(s.reflector.Spec.AddOperation(routes.exportRecords.method, routes.exportRecords.getOAPI(), opExport))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get(paramFormat.Name)
+		if format == "" {
+			format = app.FormatNDJSON
+		}
+		contentType, ok := transferMimeTypes[format]
+		if !ok {
+			s.error(w, r, app.ErrInvalid("%s must be %s or %s", paramFormat.Name, app.FormatNDJSON, app.FormatCSV))
+			return
+		}
+
+		records, err := s.store.ExportRecords(r.Context())
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export.%s"`, format))
+		if err = app.EncodeRecords(w, format, records); err != nil {
+			// the response has started, the error can only be logged
+			logging.Ctx(r.Context(), logging.HTTP).Error().Err(err).Msg("failed to write export")
+		}
+	}
+}
+
+func (s *Server) importHandler() http.HandlerFunc {
+	const maxBytes = 32 << 20
+
+	// define openapi operation
+	opImport := createSecureOperation("admin", "importRecords",
+		"Import roles and users, existing ones are skipped or updated depending on the mode, admins only")
+	opImport.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramFormat},
+		{Parameter: paramMode},
+		{Parameter: paramDryRun},
+	}
+
+	handleError(s.reflector.SetRequest(&opImport, []app.TransferRecord{}, routes.importRecords.method))
+	content := opImport.RequestBody.RequestBody.Content
+	content[mimeNDJSON] = content[mimeJSON]
+	content[mimeCSV] = openapi3.MediaType{
+		Schema: &openapi3.SchemaOrRef{Schema: &openapi3.Schema{Type: ptr.From(openapi3.SchemaTypeString)}},
+	}
+	delete(content, mimeJSON)
+
+	success := s.updateAPIResponses(&opImport, app.ImportReport{})
+	handleError(s.reflector.Spec.AddOperation(routes.importRecords.method, routes.importRecords.getOAPI(), opImport))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+
+		format := qs.Get(paramFormat.Name)
+		if format == "" {
+			format = app.FormatNDJSON
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == mimeCSV {
+				format = app.FormatCSV
+			}
+		}
+
+		options := app.ImportOptions{Mode: qs.Get(paramMode.Name)}
+		if options.Mode == "" {
+			options.Mode = app.ConflictSkip
+		}
+
+		var err error
+		options.DryRun, err = readBool(qs, paramDryRun.Name, false)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		if err = options.Validate(); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		records, errs, err := app.DecodeRecords(http.MaxBytesReader(w, r.Body, maxBytes), format)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				err = app.ErrInvalid("body must not be larger than %d bytes", maxBytes)
+			}
+			s.error(w, r, err)
+			return
+		}
+
+		report, err := s.store.ImportRecords(r.Context(), records, options)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		report.AddErrors(errs...)
+
+		JSON(w, success, report)
+	}
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+type reloaderFunc func(ctx context.Context) (app.ConfigReload, error)
+
+func (f reloaderFunc) Reload(ctx context.Context) (app.ConfigReload, error) {
+	return f(ctx)
+}
+
+func TestServer_reloadConfigHandler(t *testing.T) {
+	changes := []app.ConfigChange{
+		{Key: "log.level", Old: "info", New: "debug", Applied: true},
+		{Key: "http.port", Old: "4444", New: "8080"},
+	}
+	tests := []struct {
+		name     string
+		reloader app.ConfigReloader
+		wantCode int
+		want     []app.ConfigChange
+	}{
+		{
+			name: "reloaded",
+			reloader: reloaderFunc(func(context.Context) (app.ConfigReload, error) {
+				return app.ConfigReload{File: "config.yaml", Changes: changes}, nil
+			}),
+			wantCode: http.StatusCreated,
+			want:     changes,
+		},
+		{
+			name: "invalid config",
+			reloader: reloaderFunc(func(context.Context) (app.ConfigReload, error) {
+				return app.ConfigReload{}, app.ErrInvalid("log.level: must be one of trace, debug, info, warn, error")
+			}),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "not supported",
+			wantCode: http.StatusNotImplemented,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{reflector: newReflector(), reloader: tt.reloader}
+
+			w := httptest.NewRecorder()
+			s.reloadConfigHandler()(w, httptest.NewRequest(routes.reloadConfig.method, routes.reloadConfig.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("POST %s = %d, want %d: %s", routes.reloadConfig.path, w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.want == nil {
+				return
+			}
+
+			var got app.ConfigReload
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Changes, tt.want) {
+				t.Errorf("changes = %+v, want %+v", got.Changes, tt.want)
+			}
+		})
+	}
+}
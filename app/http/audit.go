@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/swaggest/openapi-go/openapi3"
+)
+
+func (s *Server) auditHandler() http.HandlerFunc {
+	// define openapi operation
+	opAudit := createSecureOperation("audit", "listAuditEntries", "List audit log entries, newest first")
+	opAudit.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramActorID},
+		{Parameter: paramAction},
+		{Parameter: paramTargetType},
+		{Parameter: paramTargetID},
+		{Parameter: paramFrom},
+		{Parameter: paramTo},
+		{Parameter: paramLimit},
+		{Parameter: paramOffset},
+	}
+
+	success := s.getAPIResponses(&opAudit, []app.AuditEntry{})
+	handleError(s.reflector.SetJSONResponse(&opAudit, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.Spec.AddOperation(routes.audit.method, routes.audit.getOAPI(), opAudit))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		qs := r.URL.Query()
+
+		limit, offset, err := readPage(qs)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		from, err := readInt(qs, paramFrom.Name, 0)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		to, err := readInt(qs, paramTo.Name, 0)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		entries, err := s.store.FindAuditEntries(ctx, app.AuditFilter{
+			ActorID:    qs.Get(paramActorID.Name),
+			Action:     qs.Get(paramAction.Name),
+			TargetType: qs.Get(paramTargetType.Name),
+			TargetID:   qs.Get(paramTargetID.Name),
+			From:       int64(from),
+			To:         int64(to),
+			Limit:      limit,
+			Offset:     offset,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, entries)
+	}
+}
+
+func (s *Server) verifyAuditHandler() http.HandlerFunc {
+	// define openapi operation
+	opVerify := createSecureOperation("audit", "verifyAuditLog", "Verify the audit log hash chain")
+
+	success := s.getAPIResponses(&opVerify, app.AuditVerification{})
+	handleError(s.reflector.Spec.AddOperation(routes.verifyAudit.method, routes.verifyAudit.getOAPI(), opVerify))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := s.store.VerifyAuditLog(r.Context())
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, result)
+	}
+}
@@ -35,9 +35,13 @@ func (s *Server) loginHandler() http.HandlerFunc {
 
 		authUser, err := s.authenticator.Authenticate(r.Context(), in)
 		if err != nil {
+			if app.ErrorStatus(err) == app.StatusUnauthenticated {
+				s.metrics.logins.Inc(loginFailed)
+			}
 			s.error(w, r, err)
 			return
 		}
+		s.metrics.logins.Inc(loginSucceeded)
 
 		jwtBytes, expiry, err := s.jwt.Generate(&authUser)
 		if err != nil {
@@ -2,9 +2,12 @@ package http
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/tracing"
 	"github.com/enverbisevac/libs/httputil"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type HTTP interface {
@@ -32,7 +35,7 @@ func (r *Client) Login(ctx context.Context, input *app.Credentials) (string, err
 		return "", err
 	}
 
-	if err := r.client.Post(ctx, routes.login.path, input, &res); err != nil {
+	if err := r.client.Post(ctx, routes.login.path, input, &res, withTraceContext()); err != nil {
 		return "", err
 	}
 
@@ -49,9 +52,17 @@ func (r *Client) CreateUser(ctx context.Context, input *app.UserAggregate) error
 	}
 
 	if err := r.client.Post(ctx, routes.createUser.path, input, res,
-		httputil.WithAuthHeader("Bearer "+r.token)); err != nil {
+		httputil.WithAuthHeader("Bearer "+r.token), withTraceContext()); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// withTraceContext propagates the trace of the request context to the
+// server in the traceparent header.
+func withTraceContext() httputil.RequestOptionFunc {
+	return func(r *http.Request) {
+		tracing.Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+	}
+}
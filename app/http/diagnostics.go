@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/enverbisevac/go-project/version"
+	"github.com/julienschmidt/httprouter"
+)
+
+// started is when the process started, it tells the uptime.
+var started = time.Now()
+
+// DiagnosticsInfo describes the build and the runtime of the server.
+type DiagnosticsInfo struct {
+	Revision   string            `json:"revision"`
+	GoVersion  string            `json:"go_version"`
+	Path       string            `json:"path"`
+	Settings   map[string]string `json:"settings"`
+	Deps       map[string]string `json:"deps"`
+	Started    int64             `json:"started"`
+	Uptime     string            `json:"uptime"`
+	NumCPU     int               `json:"num_cpu"`
+	GOMAXPROCS int               `json:"gomaxprocs"`
+	Goroutines int               `json:"goroutines"`
+	HeapAlloc  uint64            `json:"heap_alloc"`
+	HeapSys    uint64            `json:"heap_sys"`
+	NumGC      uint32            `json:"num_gc"`
+}
+
+func (s *Server) diagnosticsInfoHandler() http.HandlerFunc {
+	const success = http.StatusOK
+	opInfo := createOperation("diagnostics", "info", "Build and runtime info of the server")
+
+	handleError(s.reflector.SetRequest(&opInfo, nil, routes.diagnosticsInfo.method))
+	statusCode := s.getAPIResponses(&opInfo, new(DiagnosticsInfo))
+	handleError(s.reflector.Spec.AddOperation(routes.diagnosticsInfo.method, routes.diagnosticsInfo.getOAPI(), opInfo))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := DiagnosticsInfo{
+			Revision:   version.Get(),
+			GoVersion:  runtime.Version(),
+			Settings:   map[string]string{},
+			Deps:       map[string]string{},
+			Started:    started.Unix(),
+			Uptime:     time.Since(started).Round(time.Second).String(),
+			NumCPU:     runtime.NumCPU(),
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+			Goroutines: runtime.NumGoroutine(),
+		}
+		if build, ok := debug.ReadBuildInfo(); ok {
+			info.Path = build.Path
+			for _, setting := range build.Settings {
+				info.Settings[setting.Key] = setting.Value
+			}
+			for _, dep := range build.Deps {
+				info.Deps[dep.Path] = dep.Version
+			}
+		}
+
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		info.HeapAlloc = stats.HeapAlloc
+		info.HeapSys = stats.HeapSys
+		info.NumGC = stats.NumGC
+
+		if err := JSON(w, statusCode, info); err != nil {
+			s.error(w, r, err)
+		}
+	}
+}
+
+// pprofHandler serves the profiles of net/http/pprof, like
+// /debug/pprof/heap or /debug/pprof/goroutine?debug=2.
+func (s *Server) pprofHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch name := httprouter.ParamsFromContext(r.Context()).ByName("name"); name {
+		case "/cmdline":
+			pprof.Cmdline(w, r)
+		case "/profile", "/trace":
+			// the profile is written when it ends, the write timeout of
+			// the server would cut it off
+			seconds, _ := strconv.Atoi(r.URL.Query().Get("seconds"))
+			if seconds <= 0 {
+				seconds = 30
+			}
+			deadline := time.Now().Add(time.Duration(seconds)*time.Second + s.config.WriteTimeout)
+			if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+				s.error(w, r, err)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, nil))
+
+			if name == "/profile" {
+				pprof.Profile(w, r)
+			} else {
+				pprof.Trace(w, r)
+			}
+		case "/symbol":
+			pprof.Symbol(w, r)
+		default:
+			// the index serves named profiles too
+			pprof.Index(w, r)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestServer_pprofHandler(t *testing.T) {
+	s := &Server{}
+	mux := httprouter.New()
+	mux.Handler(routes.pprof.method, routes.pprof.path, s.pprofHandler())
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"index", "/debug/pprof/", "goroutine"},
+		{"named profile", "/debug/pprof/goroutine?debug=1", "goroutine profile: total"},
+		{"cmdline", "/debug/pprof/cmdline", ".test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("GET %s = %d, want %q in %.200s", tt.path, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_diagnosticsInfoHandler(t *testing.T) {
+	s := &Server{reflector: newReflector()}
+
+	w := httptest.NewRecorder()
+	s.diagnosticsInfoHandler()(w, httptest.NewRequest(http.MethodGet, routes.diagnosticsInfo.path, nil))
+
+	var info DiagnosticsInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || info.GoVersion != runtime.Version() || info.Goroutines == 0 || info.Revision == "" {
+		t.Errorf("info = %d %+v", w.Code, info)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"net/http"
 
 	"github.com/enverbisevac/go-project/app"
-	"github.com/rs/zerolog/log"
+	"github.com/enverbisevac/go-project/app/logging"
 )
 
 func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
@@ -50,11 +50,12 @@ func (s *Server) error(w http.ResponseWriter, r *http.Request, err error) {
 	}
 	// Extract error code & message.
 	code, message, payload := app.ErrorStatus(err), app.ErrorMessage(err), app.ErrorPayload(err)
+	setRequestStatus(r, code)
 
 	// Log & report internal errors.
 	if code == app.StatusInternal {
 		fmterr := fmt.Errorf("%v, internal: %w", err, app.SourceError(err))
-		log.Err(fmterr).Stack().Send()
+		logging.Ctx(r.Context(), logging.HTTP).Err(fmterr).Stack().Send()
 	}
 
 	// Print user message to response based on reqeust accept header.
@@ -80,13 +81,15 @@ type ErrorResponse struct {
 
 // lookup of application error codes to HTTP status codes.
 var codes = map[app.Status]int{
-	app.StatusConflict:        http.StatusConflict,
-	app.StatusInvalid:         http.StatusBadRequest,
-	app.StatusNotFound:        http.StatusNotFound,
-	app.StatusNotImplemented:  http.StatusNotImplemented,
-	app.StatusUnauthenticated: http.StatusUnauthorized,
-	app.StatusUnauthorized:    http.StatusForbidden,
-	app.StatusInternal:        http.StatusInternalServerError,
+	app.StatusConflict:           http.StatusConflict,
+	app.StatusInvalid:            http.StatusBadRequest,
+	app.StatusNotFound:           http.StatusNotFound,
+	app.StatusNotImplemented:     http.StatusNotImplemented,
+	app.StatusPreconditionFailed: http.StatusPreconditionFailed,
+	app.StatusUnauthenticated:    http.StatusUnauthorized,
+	app.StatusUnauthorized:       http.StatusForbidden,
+	app.StatusUnsupportedMedia:   http.StatusUnsupportedMediaType,
+	app.StatusInternal:           http.StatusInternalServerError,
 }
 
 // ErrorStatusCode returns the associated HTTP status code for a APP error code.
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+// etag formats a row version as a strong entity tag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch returns the version required by the If-Match request header.
+// Zero is returned when the header is missing or "*", the request then
+// applies to any version.
+func ifMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case value == "" || value == "*":
+		return 0, nil
+	case strings.Contains(value, ","):
+		return 0, app.ErrInvalid("If-Match with multiple entity tags is not supported")
+	case strings.HasPrefix(value, "W/"):
+		// weak tags never match with the strong comparison If-Match requires
+		return 0, app.ErrPreconditionFailed("weak entity tag %s does not match", value)
+	}
+
+	tag, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, `"`) {
+		return 0, app.ErrInvalid("If-Match header is not a valid entity tag")
+	}
+
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, app.ErrPreconditionFailed("entity tag %s does not match", value)
+	}
+	return version, nil
+}
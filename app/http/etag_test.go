@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+func Test_ifMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		want       int64
+		wantStatus app.Status
+	}{
+		{
+			name: "header is missing",
+		},
+		{
+			name:   "any version",
+			header: "*",
+		},
+		{
+			name:   "etag returned by get",
+			header: etag(3),
+			want:   3,
+		},
+		{
+			name:       "weak etag",
+			header:     `W/"3"`,
+			wantStatus: app.StatusPreconditionFailed,
+		},
+		{
+			name:       "unknown etag",
+			header:     `"abc"`,
+			wantStatus: app.StatusPreconditionFailed,
+		},
+		{
+			name:       "unquoted etag",
+			header:     "3",
+			wantStatus: app.StatusInvalid,
+		},
+		{
+			name:       "multiple etags",
+			header:     `"3", "4"`,
+			wantStatus: app.StatusInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/users/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			got, err := ifMatch(r)
+			if status := app.ErrorStatus(err); status != tt.wantStatus {
+				t.Fatalf("ifMatch() error = %v, want status %q", err, tt.wantStatus)
+			}
+			if got != tt.want {
+				t.Errorf("ifMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
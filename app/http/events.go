@@ -0,0 +1,256 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/goccy/go-json"
+	"github.com/swaggest/openapi-go/openapi3"
+)
+
+const (
+	defaultEventBuffer    = 1000
+	defaultEventHeartbeat = 15 * time.Second
+)
+
+// eventPermissions maps aggregates streamed to clients to the permission
+// needed to view them.
+var eventPermissions = map[string]string{
+	app.AggregateUser: app.PermissionViewUser,
+	app.AggregateRole: app.PermissionViewRole,
+}
+
+// eventStream is the event sink feeding /events clients. It keeps the last
+// events in a bounded buffer so reconnecting clients can resume from the
+// last event they got.
+type eventStream struct {
+	mu      sync.Mutex
+	size    int
+	events  []app.Event
+	first   uint64 // sequence number of events[0]
+	clients map[chan struct{}]struct{}
+	done    chan struct{}
+}
+
+func newEventStream(size int) *eventStream {
+	return &eventStream{
+		size:    size,
+		events:  make([]app.Event, 0, size),
+		clients: map[chan struct{}]struct{}{},
+		done:    make(chan struct{}),
+	}
+}
+
+func (es *eventStream) Name() string {
+	return "sse"
+}
+
+// Publish buffers the event and wakes up the clients.
+func (es *eventStream) Publish(ctx context.Context, event app.Event) error {
+	if _, ok := eventPermissions[event.AggregateType]; !ok {
+		return nil
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if len(es.events) == es.size {
+		copy(es.events, es.events[1:])
+		es.events = es.events[:len(es.events)-1]
+		es.first++
+	}
+	es.events = append(es.events, event)
+
+	for notify := range es.clients {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// subscribe returns the channel notified about new events and the sequence
+// number to read from. With lastEventID the client gets buffered events
+// published after that event, otherwise only new ones.
+func (es *eventStream) subscribe(lastEventID *int64) (chan struct{}, uint64) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	notify := make(chan struct{}, 1)
+	es.clients[notify] = struct{}{}
+
+	next := es.first + uint64(len(es.events))
+	if lastEventID != nil {
+		next = es.resumeAfter(*lastEventID)
+	}
+	return notify, next
+}
+
+// resumeAfter returns the sequence number following the event. Events can be
+// dispatched out of ID order, so when the event is no longer buffered the
+// client resumes from the first event with a greater ID.
+func (es *eventStream) resumeAfter(id int64) uint64 {
+	for i := len(es.events) - 1; i >= 0; i-- {
+		if es.events[i].ID == id {
+			return es.first + uint64(i) + 1
+		}
+	}
+	for i, event := range es.events {
+		if event.ID > id {
+			return es.first + uint64(i)
+		}
+	}
+	return es.first + uint64(len(es.events))
+}
+
+func (es *eventStream) unsubscribe(notify chan struct{}) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	delete(es.clients, notify)
+}
+
+// since returns events from the sequence number on and the next sequence
+// number, events dropped from the buffer are skipped.
+func (es *eventStream) since(seq uint64) ([]app.Event, uint64) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if seq < es.first {
+		seq = es.first
+	}
+	next := es.first + uint64(len(es.events))
+	if seq >= next {
+		return nil, next
+	}
+	return append([]app.Event(nil), es.events[seq-es.first:]...), next
+}
+
+// Close disconnects all clients.
+func (es *eventStream) Close() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	select {
+	case <-es.done:
+	default:
+		close(es.done)
+	}
+}
+
+// Events returns the sink streaming events to /events clients, it should be
+// registered with the event dispatcher.
+func (s *Server) Events() app.EventSink {
+	return s.events
+}
+
+func (s *Server) eventsHandler() http.HandlerFunc {
+	// define openapi operation
+	opEvents := createSecureOperation("events", "streamEvents",
+		"Stream user and role changes the caller can view as server-sent events")
+	opEvents.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramLastEventID},
+	}
+
+	handleError(s.reflector.SetStringResponse(&opEvents, http.StatusOK, "text/event-stream"))
+	handleError(s.reflector.SetJSONResponse(&opEvents, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.SetJSONResponse(&opEvents, new(ErrorResponse), http.StatusUnauthorized))
+	handleError(s.reflector.Spec.AddOperation(routes.events.method, routes.events.getOAPI(), opEvents))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		session := contextGetAuthUser(r)
+
+		var lastEventID *int64
+		if value := r.Header.Get(paramLastEventID.Name); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				s.error(w, r, app.ErrInvalid("%s must be an integer value", paramLastEventID.Name))
+				return
+			}
+			lastEventID = &id
+		}
+
+		// the stream outlives the server write timeout
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			s.error(w, r, app.ErrInternal("streaming is not supported", err))
+			return
+		}
+
+		notify, seq := s.events.subscribe(lastEventID)
+		defer s.events.unsubscribe(notify)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		heartbeat := time.NewTicker(s.config.EventHeartbeat)
+		defer heartbeat.Stop()
+
+		// send buffered events right away when resuming
+		if lastEventID != nil {
+			notify <- struct{}{}
+		}
+
+		for {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.events.done:
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case <-notify:
+				var events []app.Event
+				events, seq = s.events.since(seq)
+				for _, event := range events {
+					if !s.canView(ctx, session, event) {
+						continue
+					}
+					if err := writeEvent(w, event); err != nil {
+						logging.Ctx(r.Context(), logging.HTTP).Debug().Err(err).Msg("Event stream closed")
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// canView reports whether the session is authorized to view the aggregate
+// of the event.
+func (s *Server) canView(ctx context.Context, session app.Session, event app.Event) bool {
+	permission, ok := eventPermissions[event.AggregateType]
+	if !ok {
+		return false
+	}
+
+	ok, err := s.authorizer.Authorize(ctx, session, app.PermissionCheck{
+		Permission: permission,
+		ResourceID: &event.AggregateID,
+	})
+	return err == nil && ok
+}
+
+func writeEvent(w http.ResponseWriter, event app.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+type authorizerFunc func(session app.Session, permission app.PermissionCheck) bool
+
+func (f authorizerFunc) Authorize(ctx context.Context, session app.Session, permissions ...app.PermissionCheck) (bool, error) {
+	for _, permission := range permissions {
+		if !f(session, permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func Test_eventStream_resume(t *testing.T) {
+	es := newEventStream(3)
+	for _, id := range []int64{1, 2, 4, 3, 5} {
+		es.Publish(context.Background(), app.Event{ID: id, AggregateType: app.AggregateUser})
+	}
+	es.Publish(context.Background(), app.Event{ID: 6, AggregateType: app.AggregateLogin})
+
+	id := func(v int64) *int64 { return &v }
+	tests := []struct {
+		name        string
+		lastEventID *int64
+		want        []int64
+	}{
+		{"new events only", nil, nil},
+		{"after buffered event", id(4), []int64{3, 5}},
+		{"after last event", id(5), nil},
+		{"after dropped event", id(2), []int64{4, 3, 5}},
+		{"after unknown event", id(100), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notify, seq := es.subscribe(tt.lastEventID)
+			defer es.unsubscribe(notify)
+
+			events, _ := es.since(seq)
+			var got []int64
+			for _, event := range events {
+				got = append(got, event.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_eventsHandler(t *testing.T) {
+	s := &Server{
+		config: Config{EventHeartbeat: 20 * time.Millisecond},
+		authorizer: authorizerFunc(func(session app.Session, permission app.PermissionCheck) bool {
+			return *permission.ResourceID != "hidden"
+		}),
+		events:    newEventStream(10),
+		reflector: newReflector(),
+	}
+	handler := s.eventsHandler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, contextSetAuthUser(r, &app.AuthUser{ID: "viewer"}))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	s.events.Publish(ctx, app.Event{ID: 1, Type: app.EventUserCreated, AggregateType: app.AggregateUser, AggregateID: "u1"})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	s.events.Publish(ctx, app.Event{ID: 2, Type: app.EventUserUpdated, AggregateType: app.AggregateUser, AggregateID: "hidden"})
+	s.events.Publish(ctx, app.Event{ID: 3, Type: app.EventRoleCreated, AggregateType: app.AggregateRole, AggregateID: "r1"})
+
+	var (
+		ids        []string
+		heartbeats int
+		lines      = bufio.NewScanner(resp.Body)
+	)
+	for len(ids) < 2 || heartbeats == 0 {
+		if !lines.Scan() {
+			t.Fatalf("stream ended, err = %v", lines.Err())
+		}
+		switch line := lines.Text(); {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		case line == ": heartbeat":
+			heartbeats++
+		}
+	}
+	if want := []string{"1", "3"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("event ids = %v, want %v", ids, want)
+	}
+
+	// closing the stream ends the response
+	s.events.Close()
+	if _, err = io.Copy(io.Discard, resp.Body); err != nil {
+		t.Errorf("reading closed stream error = %v", err)
+	}
+}
@@ -3,22 +3,22 @@ package http
 import (
 	"net/http"
 
+	"github.com/enverbisevac/go-project/app/logging"
 	"github.com/enverbisevac/go-project/assets"
-	"github.com/rs/zerolog/log"
 )
 
 func (s *Server) index(w http.ResponseWriter, r *http.Request) {
 	index := "index.html"
-	t, ok := assets.Templates[index]
+	t, ok := assets.Template(index)
 	if !ok {
-		log.Warn().Str("template", index).Msg("not found")
+		logging.Ctx(r.Context(), logging.HTTP).Warn().Str("template", index).Msg("not found")
 		return
 	}
 
 	data := make(map[string]interface{})
 
 	if err := t.Execute(w, data); err != nil {
-		log.Err(err).Stack().Send()
+		logging.Ctx(r.Context(), logging.HTTP).Err(err).Stack().Send()
 	}
 }
 
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/metrics"
+	"github.com/enverbisevac/go-project/app/tracing"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// routeUnmatched labels requests which don't match a route, raw paths would
+// make a series of every URL scanned by a crawler.
+const routeUnmatched = "unmatched"
+
+// Results of logins.
+const (
+	loginSucceeded = "succeeded"
+	loginFailed    = "failed"
+)
+
+// requestBuckets are upper bounds of the request duration histogram in
+// seconds.
+var requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// httpMetrics are the metrics of requests served by the server.
+type httpMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	logins   *metrics.Counter
+}
+
+func newHTTPMetrics(registry *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: registry.Counter("http_requests_total",
+			"Requests by route template, HTTP status code and app error status, empty when the request succeeded.",
+			"method", "route", "code", "status"),
+		duration: registry.Histogram("http_request_duration_seconds",
+			"Duration of requests by route template.",
+			requestBuckets, "method", "route"),
+		logins: registry.Counter("logins_total",
+			"Logins by result.",
+			"result"),
+	}
+}
+
+// requestMetrics is what is learned about a request while it is served, the
+// route is set when the router matches it, the status when it fails.
+type requestMetrics struct {
+	route  string
+	status app.Status
+}
+
+type requestMetricsContextKey struct{}
+
+func contextGetRequestMetrics(ctx context.Context) *requestMetrics {
+	m, _ := ctx.Value(requestMetricsContextKey{}).(*requestMetrics)
+	return m
+}
+
+// instrument records the requests in the metrics and traces them. The span
+// of a request continues the trace of the traceparent header, the request
+// logger is extended with its IDs.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		method := metricsMethod(r.Method)
+		m := &requestMetrics{route: routeUnmatched}
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		ctx := tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+		))
+		ctx = tracing.ContextWithLogger(ctx)
+		ctx = context.WithValue(ctx, requestMetricsContextKey{}, m)
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		code := recorder.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		s.metrics.requests.Inc(method, m.route, strconv.Itoa(code), string(m.status))
+		s.metrics.duration.Observe(time.Since(start).Seconds(), method, m.route)
+
+		span.SetName(method + " " + m.route)
+		span.SetAttributes(semconv.HTTPRoute(m.route), semconv.HTTPResponseStatusCode(code))
+		if m.status != "" {
+			span.SetAttributes(attribute.String("app.status", string(m.status)))
+		}
+		// client errors are failures of the client, not of the server
+		if code >= http.StatusInternalServerError {
+			span.SetStatus(otelcodes.Error, http.StatusText(code))
+		}
+		span.End()
+	})
+}
+
+// metricsMethod returns the method of a request, methods the app doesn't
+// serve are reported as OTHER to bound the number of series.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// setRequestRoute labels the metrics of the request with the route template.
+func setRequestRoute(r *http.Request, route string) {
+	if m := contextGetRequestMetrics(r.Context()); m != nil {
+		m.route = route
+	}
+}
+
+// setRequestStatus labels the metrics of the request with the app error
+// status.
+func setRequestStatus(r *http.Request, status app.Status) {
+	if m := contextGetRequestMetrics(r.Context()); m != nil {
+		m.status = status
+	}
+}
+
+// router is a httprouter.Router which labels the metrics of the requests with
+// the path of the matched route. httprouter doesn't tell which route matched.
+type router struct {
+	*httprouter.Router
+}
+
+func (rt *router) Handler(method, path string, handler http.Handler) {
+	rt.Router.Handler(method, path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setRequestRoute(r, path)
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func (rt *router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rt.Handler(method, path, handler)
+}
+
+// statusRecorder records the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the flusher of event streams.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requireMetricsAuth allows scrapers with the metrics credentials, they are
+// not users of the app.
+func (s *Server) requireMetricsAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(s.config.MetricsUsername)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(s.config.MetricsPassword)) != 1 {
+			s.basicAuthRequired(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/metrics"
+	"github.com/enverbisevac/go-project/app/tracing"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServer_instrument(t *testing.T) {
+	registry := metrics.NewRegistry()
+	s := &Server{
+		config:   Config{MetricsUsername: "scraper", MetricsPassword: "secret"},
+		registry: registry,
+		metrics:  newHTTPMetrics(registry),
+	}
+
+	mux := &router{Router: httprouter.New()}
+	mux.NotFound = http.HandlerFunc(s.notFound)
+	mux.Handler(http.MethodGet, "/users/:id", staticParam(paramID.Name,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.error(w, r, app.ErrNotFound("user not found"))
+		}),
+		map[string]http.Handler{
+			"search": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("[]"))
+			}),
+		},
+	))
+	mux.Handler(http.MethodGet, "/metrics", s.requireMetricsAuth(registry))
+	handler := s.instrument(mux)
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/search", "/unknown/1"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/metrics without credentials status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.SetBasicAuth("scraper", "secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("/metrics status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/:id",code="404",status="not_found"} 2`,
+		`http_requests_total{method="GET",route="/users/search",code="200",status=""} 1`,
+		`http_requests_total{method="GET",route="unmatched",code="404",status="not_found"} 1`,
+		`http_requests_total{method="GET",route="/metrics",code="403",status="unauthorized"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`,
+	} {
+		if !strings.Contains(w.Body.String(), want+"\n") {
+			t.Errorf("/metrics misses %s, got\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestServer_instrument_trace(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	registry := metrics.NewRegistry()
+	s := &Server{registry: registry, metrics: newHTTPMetrics(registry)}
+
+	var logs bytes.Buffer
+	mux := &router{Router: httprouter.New()}
+	mux.Handler(http.MethodPut, "/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "update")
+		span.End()
+		zerolog.Ctx(r.Context()).Info().Msg("updated")
+	}))
+	handler := s.instrument(mux)
+
+	r := httptest.NewRequest(http.MethodPut, "/users/1", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r = r.WithContext(zerolog.New(&logs).WithContext(r.Context()))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(ended))
+	}
+	child, server := ended[0], ended[1]
+	if server.Name() != "PUT /users/:id" {
+		t.Errorf("span name = %q, want %q", server.Name(), "PUT /users/:id")
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("span parent = %s, want the span of traceparent", got)
+	}
+	if child.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("handler span parent = %s, want %s", child.Parent().SpanID(), server.SpanContext().SpanID())
+	}
+
+	want := `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"` + server.SpanContext().SpanID().String() + `"`
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %s, want %s", logs.String(), want)
+	}
+}
@@ -3,10 +3,13 @@ package http
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/enverbisevac/go-project/app"
 	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -29,7 +32,8 @@ func (s *Server) authenticate(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Authorization")
 
 		token := r.Header.Get("Authorization")
-		if token == "" {
+		// basic credentials are checked by the routes accepting them
+		if token == "" || strings.HasPrefix(token, "Basic ") {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -45,6 +49,27 @@ func (s *Server) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// auditActor stores who makes the request in the context, changes made by
+// the request are logged on their behalf.
+func (s *Server) auditActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := app.AuditActor{
+			IP: r.RemoteAddr,
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			actor.IP = host
+		}
+		if user := contextGetAuthUser(r); user != nil {
+			actor.UserID = user.UserID()
+		}
+		if id, ok := hlog.IDFromRequest(r); ok {
+			actor.RequestID = id.String()
+		}
+
+		next.ServeHTTP(w, r.WithContext(app.ContextWithAuditActor(r.Context(), actor)))
+	})
+}
+
 func (s *Server) requireAuthUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authenticatedUser := contextGetAuthUser(r)
@@ -82,6 +107,29 @@ func (s *Server) authorize(next http.Handler, permission string, resourceParamNa
 	})
 }
 
+// requireAdmin allows only administrators, permissions granted to other
+// users don't matter.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := contextGetAuthUser(r)
+
+		if session == nil {
+			s.authzRequired(w, r)
+			return
+		}
+
+		user, err := s.store.GetUser(r.Context(), app.UserFilter{
+			ID: session.UserID(),
+		})
+		if err != nil || !user.IsAdmin {
+			s.authzRequired(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) requireBasicAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username, plaintextPassword, ok := r.BasicAuth()
@@ -108,6 +156,15 @@ func (s *Server) requireBasicAuth(next http.Handler) http.Handler {
 	})
 }
 
+// queryStats counts database statements of the request, they are reported
+// in the access log.
+func (s *Server) queryStats(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, _ := app.ContextWithQueryStats(r.Context())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (s *Server) loggerHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		l := log.With().Logger()
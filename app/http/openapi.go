@@ -15,7 +15,35 @@ const (
 	apiKey      = "apiKey"
 )
 
-var paramID = createParam("id", openapi3.ParameterInPath, true, openapi3.SchemaTypeString)
+var (
+	paramID     = createParam("id", openapi3.ParameterInPath, true, openapi3.SchemaTypeString)
+	paramQuery  = createParam("q", openapi3.ParameterInQuery, true, openapi3.SchemaTypeString)
+	paramLimit  = createParam("limit", openapi3.ParameterInQuery, false, openapi3.SchemaTypeInteger)
+	paramOffset = createParam("offset", openapi3.ParameterInQuery, false, openapi3.SchemaTypeInteger)
+
+	paramRole       = createParam("role", openapi3.ParameterInPath, true, openapi3.SchemaTypeString)
+	paramPermission = createParam("permission", openapi3.ParameterInPath, true, openapi3.SchemaTypeString)
+	paramResourceID = createParam("resource_id", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+
+	paramActorID    = createParam("actor_id", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+	paramAction     = createParam("action", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+	paramTargetType = createParam("target_type", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+	paramTargetID   = createParam("target_id", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+	paramFrom       = createParam("from", openapi3.ParameterInQuery, false, openapi3.SchemaTypeInteger)
+	paramTo         = createParam("to", openapi3.ParameterInQuery, false, openapi3.SchemaTypeInteger)
+
+	paramDelivery = createParam("delivery", openapi3.ParameterInPath, true, openapi3.SchemaTypeInteger)
+
+	paramFormat = createParam("format", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+	paramMode   = createParam("mode", openapi3.ParameterInQuery, false, openapi3.SchemaTypeString)
+	paramDryRun = createParam("dry_run", openapi3.ParameterInQuery, false, openapi3.SchemaTypeBoolean)
+
+	// If-Match carries the ETag returned by GET to guard against lost updates.
+	paramIfMatch = createParam("If-Match", openapi3.ParameterInHeader, false, openapi3.SchemaTypeString)
+
+	// Last-Event-ID resumes the event stream after the last received event.
+	paramLastEventID = createParam("Last-Event-ID", openapi3.ParameterInHeader, false, openapi3.SchemaTypeInteger)
+)
 
 func newReflector() *openapi3.Reflector {
 	reflector := openapi3.Reflector{}
@@ -146,6 +174,12 @@ func (s *Server) updateAPIResponses(operation *openapi3.Operation, output any) i
 	return statusCode
 }
 
+// preconditionAPIResponse documents the response returned when the If-Match
+// header doesn't match the current version.
+func (s *Server) preconditionAPIResponse(operation *openapi3.Operation) {
+	handleError(s.reflector.SetJSONResponse(operation, new(ErrorResponse), http.StatusPreconditionFailed))
+}
+
 func (s *Server) deleteAPIResponses(operation *openapi3.Operation) int {
 	const statusCode = http.StatusNoContent
 	handleError(s.reflector.SetJSONResponse(operation, nil, statusCode))
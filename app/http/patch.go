@@ -0,0 +1,87 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/enverbisevac/go-project/app"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/goccy/go-json"
+	"github.com/swaggest/openapi-go/openapi3"
+)
+
+const (
+	mimeJSON       = "application/json"
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// patchOperation is a JSON Patch (RFC 6902) operation, used only for the
+// openapi spec.
+type patchOperation struct {
+	Op    string `json:"op" required:"true" enum:"add,remove,replace,move,copy,test"`
+	Path  string `json:"path" required:"true"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// setPatchRequest documents PATCH request bodies, a merge patch of input or
+// a list of JSON Patch operations.
+func (s *Server) setPatchRequest(operation *openapi3.Operation, input any) {
+	handleError(s.reflector.SetRequest(operation, []patchOperation{}, http.MethodPatch))
+	content := operation.RequestBody.RequestBody.Content
+	content[mimeJSONPatch] = content[mimeJSON]
+
+	handleError(s.reflector.SetRequest(operation, input, http.MethodPatch))
+	content[mimeMergePatch] = content[mimeJSON]
+	delete(content, mimeJSON)
+}
+
+// applyPatch applies the request body, a JSON Merge Patch (RFC 7396) or
+// JSON Patch (RFC 6902) depending on the content type, to the JSON encoding
+// of current and decodes the result into dst.
+func applyPatch(w http.ResponseWriter, r *http.Request, current, dst any) error {
+	const maxBytes = 1_048_576
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != mimeMergePatch && mediaType != mimeJSONPatch {
+		return app.ErrUnsupportedMedia("content type must be %s or %s", mimeMergePatch, mimeJSONPatch)
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		return app.ErrInvalid("failed to read body", err)
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return app.ErrInternal("failed to encode current document", err)
+	}
+
+	switch mediaType {
+	case mimeMergePatch:
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	case mimeJSONPatch:
+		var operations jsonpatch.Patch
+		operations, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			doc, err = operations.Apply(doc)
+		}
+	}
+	switch {
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return app.ErrConflict("patch test operation failed", err)
+	case err != nil:
+		return app.ErrInvalid("body contains invalid patch: %s", err.Error(), err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(dst); err != nil {
+		return app.ErrInvalid("patched document is not valid: %s", err.Error(), err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+func Test_applyPatch(t *testing.T) {
+	current := app.RoleAggregate{
+		Role: app.Role{
+			ID:   "1",
+			Name: "Editors",
+		},
+		Permissions: []app.PermissionCheck{
+			{Permission: app.PermissionViewUser},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		contentType     string
+		body            string
+		wantStatus      app.Status
+		wantName        string
+		wantPermissions int
+	}{
+		{
+			name:            "merge patch",
+			contentType:     mimeMergePatch,
+			body:            `{"name": "Writers"}`,
+			wantName:        "Writers",
+			wantPermissions: 1,
+		},
+		{
+			name:        "merge patch removes permissions",
+			contentType: mimeMergePatch + "; charset=utf-8",
+			body:        `{"permissions": null}`,
+			wantName:    "Editors",
+		},
+		{
+			name:        "json patch",
+			contentType: mimeJSONPatch,
+			body: `[
+				{"op": "test", "path": "/name", "value": "Editors"},
+				{"op": "replace", "path": "/name", "value": "Writers"},
+				{"op": "add", "path": "/permissions/-", "value": {"permission": "update_user"}}
+			]`,
+			wantName:        "Writers",
+			wantPermissions: 2,
+		},
+		{
+			name:        "json patch test fails",
+			contentType: mimeJSONPatch,
+			body:        `[{"op": "test", "path": "/name", "value": "Writers"}]`,
+			wantStatus:  app.StatusConflict,
+		},
+		{
+			name:        "json patch with invalid path",
+			contentType: mimeJSONPatch,
+			body:        `[{"op": "remove", "path": "/permissions/5"}]`,
+			wantStatus:  app.StatusInvalid,
+		},
+		{
+			name:        "unknown field",
+			contentType: mimeMergePatch,
+			body:        `{"color": "red"}`,
+			wantStatus:  app.StatusInvalid,
+		},
+		{
+			name:        "plain json",
+			contentType: mimeJSON,
+			body:        `{"name": "Writers"}`,
+			wantStatus:  app.StatusUnsupportedMedia,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/roles/1", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			got := app.RoleAggregate{}
+			err := applyPatch(httptest.NewRecorder(), r, current, &got)
+			if status := app.ErrorStatus(err); status != tt.wantStatus {
+				t.Fatalf("applyPatch() error = %v, want status %q", err, tt.wantStatus)
+			}
+			if err != nil {
+				return
+			}
+			if got.Name != tt.wantName {
+				t.Errorf("applyPatch() name = %q, want %q", got.Name, tt.wantName)
+			}
+			if len(got.Permissions) != tt.wantPermissions {
+				t.Errorf("applyPatch() permissions = %v, want %d", got.Permissions, tt.wantPermissions)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/enverbisevac/go-project/app"
+	"github.com/julienschmidt/httprouter"
 )
 
 func (s *Server) permissionsHandler() http.HandlerFunc {
@@ -20,3 +21,17 @@ func (s *Server) permissionsHandler() http.HandlerFunc {
 		}
 	}
 }
+
+// permissionCheck reads the permission from the path and its optional
+// resource from the query string.
+func permissionCheck(r *http.Request) app.PermissionCheck {
+	params := httprouter.ParamsFromContext(r.Context())
+	check := app.PermissionCheck{
+		Permission: params.ByName(paramPermission.Name),
+	}
+	if qs := r.URL.Query(); qs.Has(paramResourceID.Name) {
+		resourceID := qs.Get(paramResourceID.Name)
+		check.ResourceID = &resourceID
+	}
+	return check
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/julienschmidt/httprouter"
+	"github.com/swaggest/openapi-go/openapi3"
+)
+
+func (s *Server) exportUserDataHandler() http.HandlerFunc {
+	// define openapi operation
+	opExport := createSecureOperation("users", "exportUserData",
+		"Export all data stored about the user, deleted users included")
+	opExport.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+	}
+
+	success := s.getAPIResponses(&opExport, app.UserDataExport{})
+	handleError(s.reflector.Spec.AddOperation(routes.exportUserData.method, routes.exportUserData.getOAPI(), opExport))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		id := params.ByName(paramID.Name)
+
+		data, err := s.store.ExportUserData(r.Context(), id)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s.json"`, id))
+		JSON(w, success, data)
+	}
+}
+
+func (s *Server) eraseUserHandler() http.HandlerFunc {
+	// define openapi operation
+	opErase := createSecureOperation("users", "eraseUser",
+		"Irreversibly erase personal data of the user, the user is anonymized and deleted")
+	opErase.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+	}
+
+	success := s.deleteAPIResponses(&opErase)
+	handleError(s.reflector.Spec.AddOperation(routes.eraseUser.method, routes.eraseUser.getOAPI(), opErase))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if err := s.store.EraseUser(r.Context(), params.ByName(paramID.Name)); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// readInt returns the integer value of the query parameter key or
+// defaultValue when the parameter is missing.
+func readInt(qs url.Values, key string, defaultValue int) (int, error) {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return defaultValue, app.ErrInvalid("%s must be a positive integer value", key)
+	}
+
+	return i, nil
+}
+
+// readBool returns the boolean value of the query parameter key or
+// defaultValue when the parameter is missing.
+func readBool(qs url.Values, key string, defaultValue bool) (bool, error) {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return defaultValue, app.ErrInvalid("%s must be true or false", key)
+	}
+
+	return b, nil
+}
+
+// readPage returns limit and offset query parameters, limit is capped
+// to maxPageLimit.
+func readPage(qs url.Values) (int, int, error) {
+	limit, err := readInt(qs, "limit", defaultPageLimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit == 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset, err := readInt(qs, "offset", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return limit, offset, nil
+}
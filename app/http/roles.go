@@ -77,6 +77,7 @@ func (s *Server) getRoleHandler() http.HandlerFunc {
 			return
 		}
 
+		w.Header().Set("ETag", etag(role.Version))
 		JSON(w, success, &role)
 	}
 }
@@ -86,9 +87,11 @@ func (s *Server) updateRoleHandler() http.HandlerFunc {
 	opUpdate := createSecureOperation("roles", "updateRole", "Update existing role")
 	opUpdate.Parameters = []openapi3.ParameterOrRef{
 		{Parameter: paramID},
+		{Parameter: paramIfMatch},
 	}
 
 	success := s.updateAPIResponses(&opUpdate, app.RoleAggregate{})
+	s.preconditionAPIResponse(&opUpdate)
 	handleError(s.reflector.SetRequest(&opUpdate, app.RoleAggregate{}, routes.updateRole.method))
 	handleError(s.reflector.Spec.AddOperation(routes.updateRole.method, routes.updateRole.getOAPI(), opUpdate))
 
@@ -104,7 +107,14 @@ func (s *Server) updateRoleHandler() http.HandlerFunc {
 			return
 		}
 
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
 		in.ID = id
+		in.Version = version
 
 		err = s.store.UpdateRole(ctx, in, app.IDOrNameFilter{
 			ID: id,
@@ -114,6 +124,7 @@ func (s *Server) updateRoleHandler() http.HandlerFunc {
 			return
 		}
 
+		w.Header().Set("ETag", etag(in.Version))
 		w.WriteHeader(success)
 	}
 }
@@ -123,9 +134,11 @@ func (s *Server) deleteRoleHandler() http.HandlerFunc {
 	opDelete := createSecureOperation("roles", "deleteRole", "Delete a role")
 	opDelete.Parameters = []openapi3.ParameterOrRef{
 		{Parameter: paramID},
+		{Parameter: paramIfMatch},
 	}
 
 	success := s.deleteAPIResponses(&opDelete)
+	s.preconditionAPIResponse(&opDelete)
 	handleError(s.reflector.Spec.AddOperation(routes.deleteRole.method, routes.deleteRole.getOAPI(), opDelete))
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -133,7 +146,96 @@ func (s *Server) deleteRoleHandler() http.HandlerFunc {
 		params := httprouter.ParamsFromContext(r.Context())
 		id := params.ByName(paramID.Name)
 
-		err := s.store.DeleteRole(ctx, &app.IDOrNameFilter{
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		err = s.store.DeleteRole(ctx, &app.IDOrNameFilter{
+			ID:      id,
+			Version: version,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
+
+func (s *Server) restoreRoleHandler() http.HandlerFunc {
+	// define openapi operation
+	opRestore := createSecureOperation("roles", "restoreRole", "Restore a deleted role")
+	opRestore.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramIfMatch},
+	}
+
+	success := s.updateAPIResponses(&opRestore, app.RoleAggregate{})
+	s.preconditionAPIResponse(&opRestore)
+	handleError(s.reflector.SetJSONResponse(&opRestore, new(ErrorResponse), http.StatusConflict))
+	handleError(s.reflector.Spec.AddOperation(routes.restoreRole.method, routes.restoreRole.getOAPI(), opRestore))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+		id := params.ByName(paramID.Name)
+
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		err = s.store.RestoreRole(ctx, &app.IDOrNameFilter{
+			ID:      id,
+			Version: version,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		role, err := s.store.GetRole(ctx, &app.IDOrNameFilter{
+			ID: id,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(role.Version))
+		JSON(w, success, &role)
+	}
+}
+
+func (s *Server) patchRoleHandler() http.HandlerFunc {
+	// define openapi operation
+	opPatch := createSecureOperation("roles", "patchRole", "Partially update existing role")
+	opPatch.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramIfMatch},
+	}
+
+	success := s.updateAPIResponses(&opPatch, app.RoleAggregate{})
+	s.preconditionAPIResponse(&opPatch)
+	s.setPatchRequest(&opPatch, app.RoleAggregate{})
+	handleError(s.reflector.Spec.AddOperation(routes.patchRole.method, routes.patchRole.getOAPI(), opPatch))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+		id := params.ByName(paramID.Name)
+
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		current, err := s.store.GetRole(ctx, &app.IDOrNameFilter{
 			ID: id,
 		})
 		if err != nil {
@@ -141,6 +243,89 @@ func (s *Server) deleteRoleHandler() http.HandlerFunc {
 			return
 		}
 
+		if version != 0 && version != current.Version {
+			s.error(w, r, app.ErrPreconditionFailed("version %d is not current", version))
+			return
+		}
+
+		in := &app.RoleAggregate{}
+		if err = applyPatch(w, r, current, in); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		if err = in.Validate(); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		// the patch is applied to what was read, so it's only stored if
+		// nobody changed the role in the meantime
+		in.ID = current.ID
+		in.Version = current.Version
+
+		err = s.store.UpdateRole(ctx, in, app.IDOrNameFilter{
+			ID: current.ID,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(in.Version))
+		JSON(w, success, in)
+	}
+}
+
+func (s *Server) addRolePermissionHandler() http.HandlerFunc {
+	// define openapi operation
+	opAdd := createSecureOperation("roles", "addRolePermission", "Grant a permission to the role")
+	opAdd.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramPermission},
+		{Parameter: paramResourceID},
+	}
+
+	success := s.deleteAPIResponses(&opAdd)
+	handleError(s.reflector.SetJSONResponse(&opAdd, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.Spec.AddOperation(routes.addRolePermission.method, routes.addRolePermission.getOAPI(), opAdd))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.store.AddRolePermission(ctx, params.ByName(paramID.Name), permissionCheck(r))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
+
+func (s *Server) removeRolePermissionHandler() http.HandlerFunc {
+	// define openapi operation
+	opRemove := createSecureOperation("roles", "removeRolePermission", "Revoke a permission from the role")
+	opRemove.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramPermission},
+		{Parameter: paramResourceID},
+	}
+
+	success := s.deleteAPIResponses(&opRemove)
+	handleError(s.reflector.Spec.AddOperation(routes.removeRolePermission.method, routes.removeRolePermission.getOAPI(), opRemove))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.store.RemoveRolePermission(ctx, params.ByName(paramID.Name), permissionCheck(r))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
 		w.WriteHeader(success)
 	}
 }
@@ -2,9 +2,12 @@ package http
 
 import (
 	"net/http"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/logging"
 	"github.com/enverbisevac/libs/httputil"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog/hlog"
@@ -17,31 +20,93 @@ const (
 )
 
 var routes = struct {
-	status         route
-	login          route
-	createUser     route
-	getUser        route
-	updateUser     route
-	updatePassword route
-	deleteUser     route
-	permissions    route
-	createRole     route
-	getRole        route
-	updateRole     route
-	deleteRole     route
+	status               route
+	livez                route
+	readyz               route
+	login                route
+	createUser           route
+	getUser              route
+	searchUsers          route
+	updateUser           route
+	patchUser            route
+	updatePassword       route
+	deleteUser           route
+	restoreUser          route
+	addUserRole          route
+	removeUserRole       route
+	addUserPermission    route
+	removeUserPermission route
+	exportUserData       route
+	eraseUser            route
+	permissions          route
+	createRole           route
+	getRole              route
+	updateRole           route
+	patchRole            route
+	deleteRole           route
+	restoreRole          route
+	addRolePermission    route
+	removeRolePermission route
+	audit                route
+	verifyAudit          route
+	createWebhook        route
+	listWebhooks         route
+	getWebhook           route
+	updateWebhook        route
+	deleteWebhook        route
+	webhookDeliveries    route
+	redeliverWebhook     route
+	events               route
+	backup               route
+	exportRecords        route
+	importRecords        route
+	reloadConfig         route
+	diagnosticsInfo      route
+	pprof                route
 }{
-	status:         route{path: "/status", method: http.MethodGet},
-	login:          route{path: "/login", method: http.MethodPost},
-	createUser:     route{path: "/users", method: http.MethodPost},
-	getUser:        route{path: "/users/:id", method: http.MethodGet},
-	updateUser:     route{path: "/users/:id", method: http.MethodPut},
-	updatePassword: route{path: "/users/:id/password", method: http.MethodPut},
-	deleteUser:     route{path: "/users/:id", method: http.MethodDelete},
-	permissions:    route{path: "/permissions", method: http.MethodGet},
-	createRole:     route{path: "/roles", method: http.MethodPost},
-	getRole:        route{path: "/roles/:id", method: http.MethodGet},
-	updateRole:     route{path: "/roles/:id", method: http.MethodPut},
-	deleteRole:     route{path: "/roles/:id", method: http.MethodDelete},
+	status:               route{path: "/status", method: http.MethodGet},
+	livez:                route{path: "/livez", method: http.MethodGet},
+	readyz:               route{path: "/readyz", method: http.MethodGet},
+	login:                route{path: "/login", method: http.MethodPost},
+	createUser:           route{path: "/users", method: http.MethodPost},
+	getUser:              route{path: "/users/:id", method: http.MethodGet},
+	searchUsers:          route{path: "/users/search", method: http.MethodGet},
+	updateUser:           route{path: "/users/:id", method: http.MethodPut},
+	patchUser:            route{path: "/users/:id", method: http.MethodPatch},
+	updatePassword:       route{path: "/users/:id/password", method: http.MethodPut},
+	deleteUser:           route{path: "/users/:id", method: http.MethodDelete},
+	restoreUser:          route{path: "/users/:id/restore", method: http.MethodPost},
+	addUserRole:          route{path: "/users/:id/roles/:role", method: http.MethodPut},
+	removeUserRole:       route{path: "/users/:id/roles/:role", method: http.MethodDelete},
+	addUserPermission:    route{path: "/users/:id/permissions/:permission", method: http.MethodPut},
+	removeUserPermission: route{path: "/users/:id/permissions/:permission", method: http.MethodDelete},
+	exportUserData:       route{path: "/users/:id/data-export", method: http.MethodGet},
+	eraseUser:            route{path: "/users/:id/erase", method: http.MethodPost},
+	permissions:          route{path: "/permissions", method: http.MethodGet},
+	createRole:           route{path: "/roles", method: http.MethodPost},
+	getRole:              route{path: "/roles/:id", method: http.MethodGet},
+	updateRole:           route{path: "/roles/:id", method: http.MethodPut},
+	patchRole:            route{path: "/roles/:id", method: http.MethodPatch},
+	deleteRole:           route{path: "/roles/:id", method: http.MethodDelete},
+	restoreRole:          route{path: "/roles/:id/restore", method: http.MethodPost},
+	addRolePermission:    route{path: "/roles/:id/permissions/:permission", method: http.MethodPut},
+	removeRolePermission: route{path: "/roles/:id/permissions/:permission", method: http.MethodDelete},
+	audit:                route{path: "/audit", method: http.MethodGet},
+	verifyAudit:          route{path: "/audit/verify", method: http.MethodGet},
+	createWebhook:        route{path: "/webhooks", method: http.MethodPost},
+	listWebhooks:         route{path: "/webhooks", method: http.MethodGet},
+	getWebhook:           route{path: "/webhooks/:id", method: http.MethodGet},
+	updateWebhook:        route{path: "/webhooks/:id", method: http.MethodPut},
+	deleteWebhook:        route{path: "/webhooks/:id", method: http.MethodDelete},
+	webhookDeliveries:    route{path: "/webhooks/:id/deliveries", method: http.MethodGet},
+	redeliverWebhook:     route{path: "/webhooks/:id/deliveries/:delivery/redeliver", method: http.MethodPost},
+	events:               route{path: "/events", method: http.MethodGet},
+	backup:               route{path: "/admin/backup", method: http.MethodPost},
+	exportRecords:        route{path: "/admin/export", method: http.MethodGet},
+	importRecords:        route{path: "/admin/import", method: http.MethodPost},
+	reloadConfig:         route{path: "/admin/reload", method: http.MethodPost},
+	diagnosticsInfo:      route{path: "/debug/info", method: http.MethodGet},
+	pprof:                route{path: "/debug/pprof/*name", method: http.MethodGet},
 }
 
 func (s *Server) openapi(w http.ResponseWriter, r *http.Request) {
@@ -55,7 +120,7 @@ func (s *Server) openapi(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) routes() http.Handler {
-	mux := httprouter.New()
+	mux := &router{Router: httprouter.New()}
 
 	mux.NotFound = http.HandlerFunc(s.notFound)
 	mux.MethodNotAllowed = http.HandlerFunc(s.methodNotAllowed)
@@ -75,6 +140,11 @@ func (s *Server) routes() http.Handler {
 
 	// system
 	mux.HandlerFunc("GET", "/status", s.status())
+	mux.HandlerFunc(routes.livez.method, routes.livez.path, s.livezHandler())
+	mux.HandlerFunc(routes.readyz.method, routes.readyz.path, s.readyzHandler())
+	if s.config.MetricsPort == 0 && s.config.MetricsPassword != "" {
+		mux.Handler(http.MethodGet, "/metrics", s.requireMetricsAuth(s.registry))
+	}
 
 	// auth
 	mux.HandlerFunc(routes.login.method, routes.login.path, s.loginHandler())
@@ -89,20 +159,60 @@ func (s *Server) routes() http.Handler {
 		s.authorize(s.requireAuthUser(s.updateUserHandler()),
 			app.PermissionUpdateUser, paramID.Name),
 	)
+	mux.Handler(routes.patchUser.method, routes.patchUser.path,
+		s.authorize(s.requireAuthUser(s.patchUserHandler()),
+			app.PermissionUpdateUser, paramID.Name),
+	)
 	mux.Handler(routes.updatePassword.method, routes.updatePassword.path, s.requireAuthUser(
 		s.updateUserPasswordHandler()),
 	)
-	mux.Handler(routes.getUser.method, routes.getUser.path, s.authorize(
-		s.requireAuthUser(s.getUserHandler()),
-		app.PermissionViewUser, paramID.Name),
-	)
+	mux.Handler(routes.getUser.method, routes.getUser.path, staticParam(paramID.Name,
+		s.authorize(
+			s.requireAuthUser(s.getUserHandler()),
+			app.PermissionViewUser, paramID.Name),
+		map[string]http.Handler{
+			path.Base(routes.searchUsers.path): s.authorize(
+				s.requireAuthUser(s.searchUsersHandler()),
+				app.PermissionViewUser, paramEmpty),
+		},
+	))
 	mux.Handler(routes.deleteUser.method, routes.deleteUser.path, s.authorize(
 		s.requireAuthUser(s.deleteUserHandler()),
 		app.PermissionDeleteUser, paramID.Name),
 	)
+	mux.Handler(routes.restoreUser.method, routes.restoreUser.path, s.authorize(
+		s.requireAuthUser(s.restoreUserHandler()),
+		app.PermissionDeleteUser, paramID.Name),
+	)
+	mux.Handler(routes.addUserRole.method, routes.addUserRole.path, s.authorize(
+		s.requireAuthUser(s.addUserRoleHandler()),
+		app.PermissionUpdateUser, paramID.Name),
+	)
+	mux.Handler(routes.removeUserRole.method, routes.removeUserRole.path, s.authorize(
+		s.requireAuthUser(s.removeUserRoleHandler()),
+		app.PermissionUpdateUser, paramID.Name),
+	)
+	mux.Handler(routes.addUserPermission.method, routes.addUserPermission.path, s.authorize(
+		s.requireAuthUser(s.addUserPermissionHandler()),
+		app.PermissionUpdateUser, paramID.Name),
+	)
+	mux.Handler(routes.removeUserPermission.method, routes.removeUserPermission.path, s.authorize(
+		s.requireAuthUser(s.removeUserPermissionHandler()),
+		app.PermissionUpdateUser, paramID.Name),
+	)
+
+	// personal data
+	mux.Handler(routes.exportUserData.method, routes.exportUserData.path, s.authorize(
+		s.requireAuthUser(s.exportUserDataHandler()),
+		app.PermissionExportUserData, paramID.Name),
+	)
+	mux.Handler(routes.eraseUser.method, routes.eraseUser.path, s.authorize(
+		s.requireAuthUser(s.eraseUserHandler()),
+		app.PermissionEraseUser, paramID.Name),
+	)
 
 	// roles
-	mux.Handler(routes.status.method, routes.createRole.path, s.authorize(
+	mux.Handler(routes.createRole.method, routes.createRole.path, s.authorize(
 		s.requireAuthUser(http.HandlerFunc(s.createRoleHandler())),
 		app.PermissionCreateRole, paramEmpty),
 	)
@@ -114,10 +224,82 @@ func (s *Server) routes() http.Handler {
 		s.requireAuthUser(http.HandlerFunc(s.updateRoleHandler())),
 		app.PermissionUpdateRole, paramID.Name),
 	)
+	mux.Handler(routes.patchRole.method, routes.patchRole.path, s.authorize(
+		s.requireAuthUser(http.HandlerFunc(s.patchRoleHandler())),
+		app.PermissionUpdateRole, paramID.Name),
+	)
 	mux.Handler(routes.deleteRole.method, routes.deleteRole.path, s.authorize(
 		s.requireAuthUser(http.HandlerFunc(s.deleteRoleHandler())),
 		app.PermissionDeleteRole, paramID.Name),
 	)
+	mux.Handler(routes.restoreRole.method, routes.restoreRole.path, s.authorize(
+		s.requireAuthUser(http.HandlerFunc(s.restoreRoleHandler())),
+		app.PermissionDeleteRole, paramID.Name),
+	)
+	mux.Handler(routes.addRolePermission.method, routes.addRolePermission.path, s.authorize(
+		s.requireAuthUser(http.HandlerFunc(s.addRolePermissionHandler())),
+		app.PermissionUpdateRole, paramID.Name),
+	)
+	mux.Handler(routes.removeRolePermission.method, routes.removeRolePermission.path, s.authorize(
+		s.requireAuthUser(http.HandlerFunc(s.removeRolePermissionHandler())),
+		app.PermissionUpdateRole, paramID.Name),
+	)
+
+	// audit
+	mux.Handler(routes.audit.method, routes.audit.path, s.authorize(
+		s.requireAuthUser(s.auditHandler()),
+		app.PermissionViewAudit, paramEmpty),
+	)
+	mux.Handler(routes.verifyAudit.method, routes.verifyAudit.path, s.authorize(
+		s.requireAuthUser(s.verifyAuditHandler()),
+		app.PermissionViewAudit, paramEmpty),
+	)
+
+	// webhooks
+	mux.Handler(routes.createWebhook.method, routes.createWebhook.path, s.authorize(
+		s.requireAuthUser(s.createWebhookHandler()),
+		app.PermissionManageWebhooks, paramEmpty),
+	)
+	mux.Handler(routes.listWebhooks.method, routes.listWebhooks.path, s.authorize(
+		s.requireAuthUser(s.listWebhooksHandler()),
+		app.PermissionManageWebhooks, paramEmpty),
+	)
+	mux.Handler(routes.getWebhook.method, routes.getWebhook.path, s.authorize(
+		s.requireAuthUser(s.getWebhookHandler()),
+		app.PermissionManageWebhooks, paramID.Name),
+	)
+	mux.Handler(routes.updateWebhook.method, routes.updateWebhook.path, s.authorize(
+		s.requireAuthUser(s.updateWebhookHandler()),
+		app.PermissionManageWebhooks, paramID.Name),
+	)
+	mux.Handler(routes.deleteWebhook.method, routes.deleteWebhook.path, s.authorize(
+		s.requireAuthUser(s.deleteWebhookHandler()),
+		app.PermissionManageWebhooks, paramID.Name),
+	)
+	mux.Handler(routes.webhookDeliveries.method, routes.webhookDeliveries.path, s.authorize(
+		s.requireAuthUser(s.webhookDeliveriesHandler()),
+		app.PermissionManageWebhooks, paramID.Name),
+	)
+	mux.Handler(routes.redeliverWebhook.method, routes.redeliverWebhook.path, s.authorize(
+		s.requireAuthUser(s.redeliverWebhookHandler()),
+		app.PermissionManageWebhooks, paramID.Name),
+	)
+
+	// events, filtered by the permissions of the caller
+	mux.Handler(routes.events.method, routes.events.path, s.requireAuthUser(s.eventsHandler()))
+
+	// admin
+	mux.Handler(routes.backup.method, routes.backup.path, s.requireAdmin(s.backupHandler()))
+	mux.Handler(routes.exportRecords.method, routes.exportRecords.path, s.requireAdmin(s.exportHandler()))
+	mux.Handler(routes.importRecords.method, routes.importRecords.path, s.requireAdmin(s.importHandler()))
+	mux.Handler(routes.reloadConfig.method, routes.reloadConfig.path, s.requireAdmin(s.reloadConfigHandler()))
+
+	// diagnostics
+	mux.Handler(routes.diagnosticsInfo.method, routes.diagnosticsInfo.path, s.requireAdmin(s.diagnosticsInfoHandler()))
+	pprofHandler := s.requireAdmin(s.pprofHandler())
+	mux.Handler(routes.pprof.method, routes.pprof.path, pprofHandler)
+	// symbol lookups of pprof are posted
+	mux.Handler(http.MethodPost, routes.pprof.path, pprofHandler)
 
 	// Web routes
 
@@ -132,22 +314,60 @@ func (s *Server) routes() http.Handler {
 	c := httputil.NewChain(
 		s.loggerHandler,
 		hlog.RequestIDHandler("requestId", "X-Request-Id"),
+		s.queryStats,
+		s.instrument,
 		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
-			hlog.FromRequest(r).Info().
+			logger := logging.Ctx(r.Context(), logging.HTTP)
+			if status < http.StatusBadRequest {
+				sampled := logger.Sample(s.accessSampler)
+				logger = &sampled
+			}
+			stats := app.QueryStatsFromContext(r.Context())
+			logger.Info().
 				Str("method", r.Method).
 				Stringer("url", r.URL).
 				Int("status", status).
 				Int("size", size).
 				Dur("duration", duration).
+				Int64("queries", stats.Queries()).
+				Int64("query_errors", stats.Errors()).
+				Dur("query_duration", stats.Duration()).
 				Send()
 		}),
 		s.authenticate,
+		s.auditActor,
 		s.recoverPanic,
 	)
 
 	return c.Then(mux)
 }
 
+// metricsRoutes serves /metrics on the metrics port, which is not exposed
+// like the API.
+func (s *Server) metricsRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.registry)
+	return mux
+}
+
+// staticParam dispatches requests to a static route when the value of the
+// path parameter matches one of the handlers keys. httprouter doesn't allow
+// registering static and wildcard segments at the same position, like
+// /users/search and /users/:id.
+func staticParam(param string, next http.Handler, handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if value := params.ByName(param); handlers[value] != nil {
+			if m := contextGetRequestMetrics(r.Context()); m != nil {
+				m.route = strings.Replace(m.route, ":"+param, value, 1)
+			}
+			handlers[value].ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 type route struct {
 	path   string
 	method string
@@ -1,6 +1,15 @@
 package http
 
-import "testing"
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
 
 func Test_route_getOAPI(t *testing.T) {
 	type fields struct {
@@ -46,3 +55,30 @@ func Test_route_getOAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_accessLogSample(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	t.Cleanup(func() { log.Logger = logger })
+
+	s := New(Config{AccessLogSample: 3}, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	handler := s.http.Handler
+	for i := 0; i < 6; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/livez", nil))
+	}
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	}
+
+	// failed requests are logged besides 1 of 3 successful ones
+	if got := strings.Count(logs.String(), `"status":200`); got != 2 {
+		t.Errorf("logged %d of 6 successful requests, want 2", got)
+	}
+	if got := strings.Count(logs.String(), `"status":404`); got != 2 {
+		t.Errorf("logged %d of 2 failed requests, want 2", got)
+	}
+	if got := strings.Count(logs.String(), `"component":"http"`); got != 4 {
+		t.Errorf("logged %d access logs of component http, want 4", got)
+	}
+}
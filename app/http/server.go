@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/enverbisevac/go-project/app"
-	"github.com/rs/zerolog/log"
+	"github.com/enverbisevac/go-project/app/health"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/enverbisevac/go-project/app/metrics"
+	"github.com/rs/zerolog"
 	"github.com/swaggest/openapi-go/openapi3"
 )
 
@@ -24,16 +27,55 @@ const (
 type Config struct {
 	BaseURL string
 	Port    int
+	// EventBuffer is the number of events kept for clients resuming the
+	// event stream.
+	EventBuffer int
+	// EventHeartbeat is the interval of keep-alive comments sent to event
+	// stream clients.
+	EventHeartbeat time.Duration
+	// MetricsPort serves /metrics on a port of its own, 0 serves it with
+	// the API when MetricsPassword is set.
+	MetricsPort int
+	// MetricsUsername and MetricsPassword guard /metrics served with the
+	// API by basic auth, without a password it is not served there.
+	MetricsUsername string
+	MetricsPassword string
+	// DrainDelay is how long the server keeps serving requests after
+	// /readyz starts failing on Stop, load balancers stop sending requests
+	// meanwhile.
+	DrainDelay time.Duration
+	// IdleTimeout, ReadTimeout and WriteTimeout are the timeouts of the
+	// http.Server, 0 uses the defaults.
+	IdleTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// ShutdownTimeout is how long Stop waits for requests in flight, 0 uses
+	// the default.
+	ShutdownTimeout time.Duration
+	// AccessLogSample logs 1 of N successful requests, failed requests are
+	// always logged. 0 logs all.
+	AccessLogSample int
 }
 
 type Server struct {
 	http          *http.Server
+	metricsHTTP   *http.Server
 	config        Config
 	jwt           app.JWTManager
 	authenticator app.Authenticator
 	authorizer    app.Authorizer
 	store         app.Storage
+	webhooks      app.WebhookSender
+	backups       app.BackupService
+	reloader      app.ConfigReloader
+	events        *eventStream
 	reflector     *openapi3.Reflector
+	registry      *metrics.Registry
+	metrics       *httpMetrics
+	health        *health.Registry
+	logger        zerolog.Logger
+	// accessSampler samples the access logs of successful requests.
+	accessSampler zerolog.Sampler
 }
 
 func New(config Config,
@@ -41,13 +83,47 @@ func New(config Config,
 	authenticator app.Authenticator,
 	authorizer app.Authorizer,
 	store app.Storage,
+	webhooks app.WebhookSender,
+	backups app.BackupService,
+	reloader app.ConfigReloader,
+	registry *metrics.Registry,
+	checks *health.Registry,
 ) *Server {
+	if registry == nil {
+		registry = metrics.NewRegistry()
+	}
+	if checks == nil {
+		checks = health.NewRegistry()
+	}
+	if config.EventBuffer <= 0 {
+		config.EventBuffer = defaultEventBuffer
+	}
+	if config.EventHeartbeat <= 0 {
+		config.EventHeartbeat = defaultEventHeartbeat
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+	if config.ReadTimeout <= 0 {
+		config.ReadTimeout = defaultReadTimeout
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownPeriod
+	}
+	if config.AccessLogSample <= 0 {
+		config.AccessLogSample = 1
+	}
+
+	logger := *logging.Component(logging.HTTP)
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", config.Port),
-		ErrorLog:     stdlog.New(log.Logger, "", 0),
-		IdleTimeout:  defaultIdleTimeout,
-		ReadTimeout:  defaultReadTimeout,
-		WriteTimeout: defaultWriteTimeout,
+		ErrorLog:     stdlog.New(logger, "", 0),
+		IdleTimeout:  config.IdleTimeout,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
 	}
 
 	server := &Server{
@@ -57,29 +133,73 @@ func New(config Config,
 		authenticator: authenticator,
 		authorizer:    authorizer,
 		store:         store,
+		webhooks:      webhooks,
+		backups:       backups,
+		reloader:      reloader,
+		events:        newEventStream(config.EventBuffer),
 		reflector:     newReflector(),
+		registry:      registry,
+		metrics:       newHTTPMetrics(registry),
+		health:        checks,
+		logger:        logger,
+		accessSampler: &zerolog.BasicSampler{N: uint32(config.AccessLogSample)},
 	}
 
 	httpServer.Handler = server.routes()
+	// event streams never go idle, close them so shutdown doesn't wait
+	httpServer.RegisterOnShutdown(server.events.Close)
+
+	if config.MetricsPort > 0 {
+		server.metricsHTTP = &http.Server{
+			Addr:         fmt.Sprintf(":%d", config.MetricsPort),
+			Handler:      server.metricsRoutes(),
+			ErrorLog:     stdlog.New(logger, "", 0),
+			IdleTimeout:  config.IdleTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+		}
+	}
 
 	return server
 }
 
 func (s *Server) Start() error {
-	log.Info().Str("address", s.http.Addr).Msg("starting http server")
-	err := s.http.ListenAndServe()
-	if !errors.Is(err, http.ErrServerClosed) {
-		return err
+	servers := []*http.Server{s.http}
+	if s.metricsHTTP != nil {
+		servers = append(servers, s.metricsHTTP)
+	}
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			s.logger.Info().Str("address", server.Addr).Msg("starting http server")
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+	for range servers {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
 	}
 	return nil
 }
 
 func (s *Server) Stop() error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownPeriod)
+	s.health.Drain()
+	if s.config.DrainDelay > 0 {
+		s.logger.Info().Dur("delay", s.config.DrainDelay).Msg("draining http server")
+		time.Sleep(s.config.DrainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
 	defer cancel()
-	log.Info().Str("address", s.http.Addr).Msg("stopping http server")
+	if s.metricsHTTP != nil {
+		s.logger.Info().Str("address", s.metricsHTTP.Addr).Msg("stopping http server")
+		s.metricsHTTP.Shutdown(ctx)
+	}
+	s.logger.Info().Str("address", s.http.Addr).Msg("stopping http server")
 	s.http.Shutdown(ctx)
-	log.Info().Msg("http server stopped")
+	s.logger.Info().Msg("http server stopped")
 
 	return nil
 }
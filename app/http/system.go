@@ -2,6 +2,9 @@ package http
 
 import (
 	"net/http"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/health"
 )
 
 func (s *Server) status() http.HandlerFunc {
@@ -24,3 +27,60 @@ func (s *Server) status() http.HandlerFunc {
 		}
 	}
 }
+
+// livezHandler reports that the server is up, it doesn't check dependencies,
+// a failing database is no reason to restart the process.
+func (s *Server) livezHandler() http.HandlerFunc {
+	opLivez := createOperation("system", "livez", "Liveness of the server")
+
+	handleError(s.reflector.SetRequest(&opLivez, nil, routes.livez.method))
+	handleError(s.reflector.SetJSONResponse(&opLivez, new(health.Report), http.StatusOK))
+	handleError(s.reflector.Spec.AddOperation(routes.livez.method, routes.livez.getOAPI(), opLivez))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := JSON(w, http.StatusOK, health.Report{Status: health.StatusOK})
+		if err != nil {
+			s.error(w, r, err)
+		}
+	}
+}
+
+// readyzHandler runs the health checks, the server is ready when all of them
+// pass and it isn't stopping. Results of the checks are shown only to users
+// with the view_health permission.
+func (s *Server) readyzHandler() http.HandlerFunc {
+	opReadyz := createOperation("system", "readyz", "Readiness of the server and its dependencies")
+
+	handleError(s.reflector.SetRequest(&opReadyz, nil, routes.readyz.method))
+	handleError(s.reflector.SetJSONResponse(&opReadyz, new(health.Report), http.StatusOK))
+	handleError(s.reflector.SetJSONResponse(&opReadyz, new(health.Report), http.StatusServiceUnavailable))
+	handleError(s.reflector.Spec.AddOperation(routes.readyz.method, routes.readyz.getOAPI(), opReadyz))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := s.health.Check(r.Context())
+
+		status := http.StatusOK
+		if report.Status != health.StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		if !s.canViewHealth(r) {
+			report.Checks = nil
+		}
+
+		err := JSON(w, status, report)
+		if err != nil {
+			s.error(w, r, err)
+		}
+	}
+}
+
+func (s *Server) canViewHealth(r *http.Request) bool {
+	session := contextGetAuthUser(r)
+	if session == nil {
+		return false
+	}
+	ok, err := s.authorizer.Authorize(r.Context(), session, app.PermissionCheck{
+		Permission: app.PermissionViewHealth,
+	})
+	return err == nil && ok
+}
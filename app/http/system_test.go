@@ -0,0 +1,97 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/health"
+)
+
+func TestServer_readyzHandler(t *testing.T) {
+	checks := health.NewRegistry()
+	s := &Server{
+		authorizer: authorizerFunc(func(session app.Session, permission app.PermissionCheck) bool {
+			return session.UserID() == "operator" && permission.Permission == app.PermissionViewHealth
+		}),
+		health:    checks,
+		reflector: newReflector(),
+	}
+	handler := s.readyzHandler()
+
+	var dbErr error
+	checks.Register(health.Check{Name: "db", Probe: func(context.Context) error { return dbErr }})
+
+	tests := []struct {
+		name       string
+		user       string
+		dbErr      error
+		drain      bool
+		wantCode   int
+		wantStatus string
+		wantChecks int
+	}{
+		{
+			name:       "ready",
+			wantCode:   http.StatusOK,
+			wantStatus: health.StatusOK,
+		},
+		{
+			name:       "details for authorized users",
+			user:       "operator",
+			wantCode:   http.StatusOK,
+			wantStatus: health.StatusOK,
+			wantChecks: 1,
+		},
+		{
+			name:       "no details for other users",
+			user:       "viewer",
+			dbErr:      errors.New("database is locked"),
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: health.StatusFailing,
+		},
+		{
+			name:       "failing check",
+			user:       "operator",
+			dbErr:      errors.New("database is locked"),
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: health.StatusFailing,
+			wantChecks: 1,
+		},
+		{
+			name:       "draining",
+			user:       "operator",
+			drain:      true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: health.StatusDraining,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbErr = tt.dbErr
+			if tt.drain {
+				checks.Drain()
+			}
+
+			r := httptest.NewRequest(http.MethodGet, routes.readyz.path, nil)
+			if tt.user != "" {
+				r = contextSetAuthUser(r, &app.AuthUser{ID: tt.user})
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			var report health.Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantCode || report.Status != tt.wantStatus || len(report.Checks) != tt.wantChecks {
+				t.Errorf("readyz = %d %+v, want %d with status %s and %d checks",
+					w.Code, report, tt.wantCode, tt.wantStatus, tt.wantChecks)
+			}
+		})
+	}
+}
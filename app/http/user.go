@@ -60,9 +60,11 @@ func (s *Server) updateUserHandler() http.HandlerFunc {
 	opUpdate := createSecureOperation("users", "updateUser", "Update existing user")
 	opUpdate.Parameters = []openapi3.ParameterOrRef{
 		{Parameter: paramID},
+		{Parameter: paramIfMatch},
 	}
 
 	success := s.updateAPIResponses(&opUpdate, new(app.UserAggregate))
+	s.preconditionAPIResponse(&opUpdate)
 	handleError(s.reflector.SetRequest(&opUpdate, new(app.UserAggregate), routes.updateUser.method))
 	handleError(s.reflector.Spec.AddOperation(routes.updateUser.method, routes.updateUser.getOAPI(), opUpdate))
 
@@ -83,7 +85,14 @@ func (s *Server) updateUserHandler() http.HandlerFunc {
 			return
 		}
 
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
 		in.ID = id
+		in.Version = version
 
 		err = s.store.UpdateUser(ctx, in)
 		if err != nil {
@@ -91,6 +100,7 @@ func (s *Server) updateUserHandler() http.HandlerFunc {
 			return
 		}
 
+		w.Header().Set("ETag", etag(in.Version))
 		JSON(w, success, in)
 	}
 }
@@ -140,9 +150,11 @@ func (s *Server) deleteUserHandler() http.HandlerFunc {
 	opDelete := createSecureOperation("users", "deleteUser", "Delete a user")
 	opDelete.Parameters = []openapi3.ParameterOrRef{
 		{Parameter: paramID},
+		{Parameter: paramIfMatch},
 	}
 
 	success := s.deleteAPIResponses(&opDelete)
+	s.preconditionAPIResponse(&opDelete)
 	handleError(s.reflector.Spec.AddOperation(routes.deleteUser.method, routes.deleteUser.getOAPI(), opDelete))
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -150,8 +162,15 @@ func (s *Server) deleteUserHandler() http.HandlerFunc {
 		params := httprouter.ParamsFromContext(r.Context())
 		id := params.ByName(paramID.Name)
 
-		err := s.store.DeleteUser(ctx, app.UserFilter{
-			ID: id,
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		err = s.store.DeleteUser(ctx, app.UserFilter{
+			ID:      id,
+			Version: version,
 		})
 		if err != nil {
 			s.error(w, r, err)
@@ -162,6 +181,52 @@ func (s *Server) deleteUserHandler() http.HandlerFunc {
 	}
 }
 
+func (s *Server) restoreUserHandler() http.HandlerFunc {
+	// define openapi operation
+	opRestore := createSecureOperation("users", "restoreUser", "Restore a deleted user")
+	opRestore.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramIfMatch},
+	}
+
+	success := s.updateAPIResponses(&opRestore, app.UserAggregate{})
+	s.preconditionAPIResponse(&opRestore)
+	handleError(s.reflector.SetJSONResponse(&opRestore, new(ErrorResponse), http.StatusConflict))
+	handleError(s.reflector.Spec.AddOperation(routes.restoreUser.method, routes.restoreUser.getOAPI(), opRestore))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+		id := params.ByName(paramID.Name)
+
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		err = s.store.RestoreUser(ctx, app.UserFilter{
+			ID:      id,
+			Version: version,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		user, err := s.store.GetUser(ctx, app.UserFilter{
+			ID: id,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(user.Version))
+		JSON(w, success, user)
+	}
+}
+
 func (s *Server) getUserHandler() http.HandlerFunc {
 	// define openapi operation
 	opRead := createSecureOperation("users", "getUser", "Get user data by ID")
@@ -190,6 +255,217 @@ func (s *Server) getUserHandler() http.HandlerFunc {
 			return
 		}
 
+		w.Header().Set("ETag", etag(user.Version))
 		JSON(w, success, user)
 	}
 }
+
+func (s *Server) searchUsersHandler() http.HandlerFunc {
+	// define openapi operation
+	opSearch := createSecureOperation("users", "searchUsers", "Full-text search users by name or email")
+	opSearch.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramQuery},
+		{Parameter: paramLimit},
+		{Parameter: paramOffset},
+	}
+
+	success := s.getAPIResponses(&opSearch, []app.UserSearchResult{})
+	handleError(s.reflector.SetJSONResponse(&opSearch, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.Spec.AddOperation(routes.searchUsers.method, routes.searchUsers.getOAPI(), opSearch))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		qs := r.URL.Query()
+
+		limit, offset, err := readPage(qs)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		users, err := s.store.SearchUsers(ctx, app.UserSearchFilter{
+			Query:  qs.Get(paramQuery.Name),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, users)
+	}
+}
+
+func (s *Server) patchUserHandler() http.HandlerFunc {
+	// define openapi operation
+	opPatch := createSecureOperation("users", "patchUser", "Partially update existing user")
+	opPatch.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramIfMatch},
+	}
+
+	success := s.updateAPIResponses(&opPatch, new(app.UserAggregate))
+	s.preconditionAPIResponse(&opPatch)
+	s.setPatchRequest(&opPatch, new(app.UserAggregate))
+	handleError(s.reflector.Spec.AddOperation(routes.patchUser.method, routes.patchUser.getOAPI(), opPatch))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+		id := params.ByName(paramID.Name)
+
+		version, err := ifMatch(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		current, err := s.store.GetUser(ctx, app.UserFilter{
+			ID: id,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		if version != 0 && version != current.Version {
+			s.error(w, r, app.ErrPreconditionFailed("version %d is not current", version))
+			return
+		}
+
+		in := &app.UserAggregate{}
+		if err = applyPatch(w, r, current, in); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		if in.Password != "" {
+			s.error(w, r, app.ErrInvalid("password can't be patched, use %s", routes.updatePassword.getOAPI()))
+			return
+		}
+
+		if err = in.ValidateProfile(); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		// the patch is applied to what was read, so it's only stored if
+		// nobody changed the user in the meantime
+		in.ID = current.ID
+		in.Version = current.Version
+
+		err = s.store.UpdateUser(ctx, in)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(in.Version))
+		JSON(w, success, in)
+	}
+}
+
+func (s *Server) addUserRoleHandler() http.HandlerFunc {
+	// define openapi operation
+	opAdd := createSecureOperation("users", "addUserRole", "Assign a role to the user")
+	opAdd.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramRole},
+	}
+
+	success := s.deleteAPIResponses(&opAdd)
+	handleError(s.reflector.SetJSONResponse(&opAdd, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.Spec.AddOperation(routes.addUserRole.method, routes.addUserRole.getOAPI(), opAdd))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.store.AddUserRole(ctx, params.ByName(paramID.Name), params.ByName(paramRole.Name))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
+
+func (s *Server) removeUserRoleHandler() http.HandlerFunc {
+	// define openapi operation
+	opRemove := createSecureOperation("users", "removeUserRole", "Take a role away from the user")
+	opRemove.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramRole},
+	}
+
+	success := s.deleteAPIResponses(&opRemove)
+	handleError(s.reflector.Spec.AddOperation(routes.removeUserRole.method, routes.removeUserRole.getOAPI(), opRemove))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.store.RemoveUserRole(ctx, params.ByName(paramID.Name), params.ByName(paramRole.Name))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
+
+func (s *Server) addUserPermissionHandler() http.HandlerFunc {
+	// define openapi operation
+	opAdd := createSecureOperation("users", "addUserPermission", "Grant a permission to the user")
+	opAdd.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramPermission},
+		{Parameter: paramResourceID},
+	}
+
+	success := s.deleteAPIResponses(&opAdd)
+	handleError(s.reflector.SetJSONResponse(&opAdd, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.Spec.AddOperation(routes.addUserPermission.method, routes.addUserPermission.getOAPI(), opAdd))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.store.AddUserPermission(ctx, params.ByName(paramID.Name), permissionCheck(r))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
+
+func (s *Server) removeUserPermissionHandler() http.HandlerFunc {
+	// define openapi operation
+	opRemove := createSecureOperation("users", "removeUserPermission", "Revoke a permission from the user")
+	opRemove.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramPermission},
+		{Parameter: paramResourceID},
+	}
+
+	success := s.deleteAPIResponses(&opRemove)
+	handleError(s.reflector.Spec.AddOperation(routes.removeUserPermission.method, routes.removeUserPermission.getOAPI(), opRemove))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(r.Context())
+
+		err := s.store.RemoveUserPermission(ctx, params.ByName(paramID.Name), permissionCheck(r))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
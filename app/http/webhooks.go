@@ -0,0 +1,215 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/julienschmidt/httprouter"
+	"github.com/swaggest/openapi-go/openapi3"
+)
+
+func (s *Server) createWebhookHandler() http.HandlerFunc {
+	// define openapi operation
+	opCreate := createSecureOperation("webhooks", "createWebhook", "Subscribe a webhook to events")
+
+	success := s.createAPIResponses(&opCreate, app.Webhook{})
+	handleError(s.reflector.SetRequest(&opCreate, app.Webhook{}, routes.createWebhook.method))
+	handleError(s.reflector.Spec.AddOperation(routes.createWebhook.method, routes.createWebhook.path, opCreate))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		in := &app.Webhook{}
+
+		err := DecodeJSON(w, r, in)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		in.ID = ""
+		if err = s.store.AddWebhook(r.Context(), in); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, in)
+	}
+}
+
+func (s *Server) listWebhooksHandler() http.HandlerFunc {
+	// define openapi operation
+	opList := createSecureOperation("webhooks", "listWebhooks", "List webhooks")
+
+	success := s.getAPIResponses(&opList, []app.Webhook{})
+	handleError(s.reflector.Spec.AddOperation(routes.listWebhooks.method, routes.listWebhooks.path, opList))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhooks, err := s.store.FindWebhooks(r.Context())
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, webhooks)
+	}
+}
+
+func (s *Server) getWebhookHandler() http.HandlerFunc {
+	// define openapi operation
+	opRead := createSecureOperation("webhooks", "getWebhook", "Get webhook data")
+	opRead.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+	}
+
+	success := s.getAPIResponses(&opRead, app.Webhook{})
+	handleError(s.reflector.Spec.AddOperation(routes.getWebhook.method, routes.getWebhook.getOAPI(), opRead))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		webhook, err := s.store.GetWebhook(r.Context(), params.ByName(paramID.Name))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, webhook)
+	}
+}
+
+func (s *Server) updateWebhookHandler() http.HandlerFunc {
+	// define openapi operation
+	opUpdate := createSecureOperation("webhooks", "updateWebhook",
+		"Update existing webhook, an empty secret keeps the current one")
+	opUpdate.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+	}
+
+	success := s.updateAPIResponses(&opUpdate, app.Webhook{})
+	handleError(s.reflector.SetRequest(&opUpdate, app.Webhook{}, routes.updateWebhook.method))
+	handleError(s.reflector.Spec.AddOperation(routes.updateWebhook.method, routes.updateWebhook.getOAPI(), opUpdate))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		in := &app.Webhook{}
+
+		err := DecodeJSON(w, r, in)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		in.ID = params.ByName(paramID.Name)
+		if err = s.store.UpdateWebhook(r.Context(), in); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, in)
+	}
+}
+
+func (s *Server) deleteWebhookHandler() http.HandlerFunc {
+	// define openapi operation
+	opDelete := createSecureOperation("webhooks", "deleteWebhook", "Delete a webhook with its delivery log")
+	opDelete.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+	}
+
+	success := s.deleteAPIResponses(&opDelete)
+	handleError(s.reflector.Spec.AddOperation(routes.deleteWebhook.method, routes.deleteWebhook.getOAPI(), opDelete))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if err := s.store.DeleteWebhook(r.Context(), params.ByName(paramID.Name)); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		w.WriteHeader(success)
+	}
+}
+
+func (s *Server) webhookDeliveriesHandler() http.HandlerFunc {
+	// define openapi operation
+	opList := createSecureOperation("webhooks", "listWebhookDeliveries", "List webhook deliveries, newest first")
+	opList.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramLimit},
+		{Parameter: paramOffset},
+	}
+
+	success := s.getAPIResponses(&opList, []app.WebhookDelivery{})
+	handleError(s.reflector.SetJSONResponse(&opList, new(ErrorResponse), http.StatusBadRequest))
+	handleError(s.reflector.Spec.AddOperation(routes.webhookDeliveries.method,
+		routes.webhookDeliveries.getOAPI(), opList))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(ctx)
+
+		limit, offset, err := readPage(r.URL.Query())
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		webhook, err := s.store.GetWebhook(ctx, params.ByName(paramID.Name))
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		deliveries, err := s.store.FindWebhookDeliveries(ctx, app.WebhookDeliveryFilter{
+			WebhookID: webhook.ID,
+			Limit:     limit,
+			Offset:    offset,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, deliveries)
+	}
+}
+
+func (s *Server) redeliverWebhookHandler() http.HandlerFunc {
+	// define openapi operation
+	opRedeliver := createSecureOperation("webhooks", "redeliverWebhook", "Send the delivery request again")
+	opRedeliver.Parameters = []openapi3.ParameterOrRef{
+		{Parameter: paramID},
+		{Parameter: paramDelivery},
+	}
+
+	success := s.createAPIResponses(&opRedeliver, app.WebhookDelivery{})
+	handleError(s.reflector.SetJSONResponse(&opRedeliver, new(ErrorResponse), http.StatusNotFound))
+	handleError(s.reflector.Spec.AddOperation(routes.redeliverWebhook.method,
+		routes.redeliverWebhook.getOAPI(), opRedeliver))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := httprouter.ParamsFromContext(ctx)
+
+		id, err := strconv.ParseInt(params.ByName(paramDelivery.Name), 10, 64)
+		if err != nil {
+			s.error(w, r, app.ErrNotFound("delivery not found"))
+			return
+		}
+
+		delivery, err := s.store.GetWebhookDelivery(ctx, params.ByName(paramID.Name), id)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		redelivery, err := s.webhooks.Redeliver(ctx, delivery)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		JSON(w, success, redelivery)
+	}
+}
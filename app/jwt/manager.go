@@ -3,32 +3,44 @@ package jwt
 import (
 	"context"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/enverbisevac/go-project/app/tracing"
 
 	"github.com/pascaldekloe/jwt"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Manager struct {
-	baseURL  string
-	duration time.Duration
+	baseURL string
+	// duration is the lifetime of tokens, it changes when the config is
+	// reloaded.
+	duration atomic.Int64
 	store    app.Storage
 }
 
 func NewManager(baseURL string, duration time.Duration, store app.Storage) *Manager {
-	return &Manager{
-		baseURL:  baseURL,
-		duration: duration,
-		store:    store,
+	m := &Manager{
+		baseURL: baseURL,
+		store:   store,
 	}
+	m.SetDuration(duration)
+	return m
+}
+
+// SetDuration sets the lifetime of tokens generated from now on.
+func (m *Manager) SetDuration(duration time.Duration) {
+	m.duration.Store(int64(duration))
 }
 
 func (m *Manager) Generate(user *app.AuthUser) ([]byte, time.Time, error) {
 	var claims jwt.Claims
 	claims.Subject = user.ID
 
-	expiry := time.Now().Add(m.duration)
+	expiry := time.Now().Add(time.Duration(m.duration.Load()))
 	claims.Issued = jwt.NewNumericTime(time.Now())
 	claims.NotBefore = jwt.NewNumericTime(time.Now())
 	claims.Expires = jwt.NewNumericTime(expiry)
@@ -45,6 +57,18 @@ func (m *Manager) Generate(user *app.AuthUser) ([]byte, time.Time, error) {
 }
 
 func (m *Manager) Verify(ctx context.Context, token string) (*app.UserClaims, error) {
+	ctx, span := tracing.Start(ctx, "jwt.Verify")
+	claims, err := m.verify(ctx, token)
+	if err == nil {
+		span.SetAttributes(attribute.String("user.id", claims.AuthUser.ID))
+	} else {
+		logging.Ctx(ctx, logging.JWT).Debug().Err(err).Msg("Token rejected")
+	}
+	tracing.End(span, err)
+	return claims, err
+}
+
+func (m *Manager) verify(ctx context.Context, token string) (*app.UserClaims, error) {
 	if strings.HasPrefix(token, "Bearer") {
 		_, after, found := strings.Cut(token, " ")
 		if found {
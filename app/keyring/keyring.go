@@ -0,0 +1,307 @@
+// Package keyring encrypts personal data at rest with keys from a local key
+// file.
+//
+// Values are sealed with envelope encryption: every value is encrypted with
+// a fresh data key using AES-256-GCM, and the data key is encrypted with the
+// current key of the key file. Keys have ids, so the key file can hold old
+// keys for reading while new values are encrypted with the current one.
+//
+// Blind indexes are keyed hashes of values, they allow lookups and unique
+// indexes of encrypted values without decrypting them. Search tokens are
+// keyed hashes of words for full-text indexes. The index key never rotates,
+// indexes would have to be rebuilt otherwise.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/xid"
+)
+
+const keySize = 32
+
+// file is the key file format, keys are base64 encoded.
+type file struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// Keyring holds the keys of a key file, it is safe for concurrent use.
+type Keyring struct {
+	current  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// Load reads the key file.
+func Load(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+
+	return f.keyring()
+}
+
+func (f *file) keyring() (*Keyring, error) {
+	if _, ok := f.Keys[f.Current]; !ok {
+		return nil, fmt.Errorf("current key %q is missing", f.Current)
+	}
+
+	indexKey, err := decodeKey(f.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index key: %w", err)
+	}
+
+	k := &Keyring{
+		current:  f.Current,
+		keys:     make(map[string]cipher.AEAD, len(f.Keys)),
+		indexKey: indexKey,
+	}
+	for id, encoded := range f.Keys {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		if k.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Rotate adds a new key to the key file and makes it the current one, the
+// key file is created when it doesn't exist.
+func Rotate(path string) (*Keyring, error) {
+	var f file
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		f.Keys = map[string]string{}
+		if f.IndexKey, err = newKey(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err = json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("key file %s: %w", path, err)
+		}
+	}
+
+	f.Current = xid.New().String()
+	if f.Keys[f.Current], err = newKey(); err != nil {
+		return nil, err
+	}
+
+	k, err := f.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err = json.MarshalIndent(f, "", "  "); err != nil {
+		return nil, err
+	}
+
+	// replace the file at once, a partly written key file loses data
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// LoadKey reads the base64 encoded key of the file at path. The file is
+// created with a new key when it doesn't exist.
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		encoded, err := newKey()
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = f.WriteString(encoded + "\n"); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err = f.Close(); err != nil {
+			return nil, err
+		}
+		data = []byte(encoded)
+	} else if err != nil {
+		return nil, err
+	}
+
+	key, err := decodeKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// CurrentID returns the id of the key new values are encrypted with.
+func (k *Keyring) CurrentID() string {
+	return k.current
+}
+
+// Encrypt seals the plaintext with the current key. Additional data isn't
+// encrypted but must be the same to decrypt the value, it binds the value to
+// its place.
+func (k *Keyring) Encrypt(plaintext, additionalData string) (keyID, ciphertext string, err error) {
+	dataKey := make([]byte, keySize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return "", "", err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the data key is bound to the key which encrypted it
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), []byte(additionalData))
+	if err != nil {
+		return "", "", err
+	}
+
+	// the data key has a fixed size, so does its sealed form
+	return k.current, base64.RawStdEncoding.EncodeToString(append(wrapped, sealed...)), nil
+}
+
+// Decrypt opens the value encrypted with the key with id.
+func (k *Keyring) Decrypt(keyID, ciphertext, additionalData string) (string, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("key %q is missing", keyID)
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	wrappedSize := key.NonceSize() + keySize + key.Overhead()
+	if len(data) < wrappedSize {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	dataKey, err := open(key, data[:wrappedSize], []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(aead, data[wrappedSize:], []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns the keyed hash of the value, equal values have equal
+// indexes.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// searchTokenSize is the size of search tokens in bytes, they only have to
+// tell the words of a search index apart.
+const searchTokenSize = 12
+
+// SearchToken returns the keyed hash of the search term. It is a word of
+// letters and digits, so full-text indexes keep it as a single token, and
+// it never equals the blind index of the same value.
+func (k *Keyring) SearchToken(term string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte("search:"))
+	mac.Write([]byte(term))
+	return "t" + hex.EncodeToString(mac.Sum(nil)[:searchTokenSize])
+}
+
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, data, additionalData []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes long", keySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,199 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode"
+)
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	keys, err := Rotate(path)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file permissions = %o, want 600", perm)
+	}
+
+	keyID, ciphertext, err := keys.Encrypt("ann@example.com", "1:email")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if keyID != keys.CurrentID() {
+		t.Errorf("Encrypt() key id = %s, want %s", keyID, keys.CurrentID())
+	}
+
+	rotated, err := Rotate(path)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if rotated.CurrentID() == keyID {
+		t.Fatal("Rotate() kept the current key")
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.CurrentID() != rotated.CurrentID() {
+		t.Errorf("Load() current key = %s, want %s", loaded.CurrentID(), rotated.CurrentID())
+	}
+
+	plaintext, err := loaded.Decrypt(keyID, ciphertext, "1:email")
+	if err != nil {
+		t.Fatalf("Decrypt() with the old key error = %v", err)
+	}
+	if plaintext != "ann@example.com" {
+		t.Errorf("Decrypt() = %q, want %q", plaintext, "ann@example.com")
+	}
+
+	if keys.BlindIndex("ann@example.com") != loaded.BlindIndex("ann@example.com") {
+		t.Error("BlindIndex() changed with the key rotation")
+	}
+	if keys.BlindIndex("ann@example.com") == keys.BlindIndex("bob@example.com") {
+		t.Error("BlindIndex() is the same for different values")
+	}
+
+	token := keys.SearchToken("ann")
+	if token != loaded.SearchToken("ann") || token == keys.SearchToken("bob") {
+		t.Errorf("SearchToken() = %s, want it stable and different for different terms", token)
+	}
+	for _, r := range token {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			t.Fatalf("SearchToken() = %s, want only letters and digits", token)
+		}
+	}
+}
+
+func TestKeyring_Decrypt(t *testing.T) {
+	keys, err := Rotate(filepath.Join(t.TempDir(), "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, ciphertext, err := keys.Encrypt("Ann", "1:full_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a bit of the sealed data, the last character of the encoding may
+	// only hold padding bits
+	data, err := base64.RawStdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	tampered := base64.RawStdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name           string
+		keyID          string
+		ciphertext     string
+		additionalData string
+		wantErr        bool
+	}{
+		{
+			name:           "valid",
+			keyID:          keyID,
+			ciphertext:     ciphertext,
+			additionalData: "1:full_name",
+		},
+		{
+			name:           "other additional data",
+			keyID:          keyID,
+			ciphertext:     ciphertext,
+			additionalData: "2:full_name",
+			wantErr:        true,
+		},
+		{
+			name:           "missing key",
+			keyID:          "missing",
+			ciphertext:     ciphertext,
+			additionalData: "1:full_name",
+			wantErr:        true,
+		},
+		{
+			name:           "tampered",
+			keyID:          keyID,
+			ciphertext:     tampered,
+			additionalData: "1:full_name",
+			wantErr:        true,
+		},
+		{
+			name:           "too short",
+			keyID:          keyID,
+			ciphertext:     ciphertext[:20],
+			additionalData: "1:full_name",
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keys.Decrypt(tt.keyID, tt.ciphertext, tt.additionalData)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid json", content: "{"},
+		{name: "missing current key", content: `{"current": "a", "keys": {}, "index_key": ""}`},
+		{name: "short key", content: `{"current": "a", "keys": {"a": "c2hvcnQ="}, "index_key": "c2hvcnQ="}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("Load() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.key")
+
+	key, err := LoadKey(path)
+	if err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	if len(key) != keySize {
+		t.Fatalf("LoadKey() key of %d bytes, want %d", len(key), keySize)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("LoadKey() created %v, %v, want a file readable by the owner", info, err)
+	}
+
+	again, err := LoadKey(path)
+	if err != nil || !bytes.Equal(again, key) {
+		t.Errorf("LoadKey() = %x, %v, want the created key %x", again, err, key)
+	}
+
+	if err = os.WriteFile(path, []byte("c2hvcnQ=\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadKey(path); err == nil {
+		t.Error("LoadKey() error = nil, want an error for a short key")
+	}
+}
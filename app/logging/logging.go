@@ -0,0 +1,258 @@
+// Package logging directs the logs of the app to stderr or to rotated files
+// and gives its components loggers of their own, each with its level.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Components with loggers of their own, their logs have a component field.
+const (
+	HTTP = "http"
+	SQL  = "sql"
+	JWT  = "jwt"
+)
+
+// Components are all components.
+var Components = []string{HTTP, SQL, JWT}
+
+// Formats of logs.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// FileName is the name of the log file in the log dir, rotated files are
+// named after it with the time of rotation.
+const FileName = "app.log"
+
+type Config struct {
+	// Level is the least level of logged messages, like info.
+	Level string
+	// Levels of components, components without one log at Level.
+	Levels map[string]string
+	// Format is FormatJSON or FormatConsole.
+	Format string
+	// Dir is where logs are written to, empty writes them to stderr.
+	Dir string
+	// MaxSize in megabytes of the log file before it is rotated.
+	MaxSize int
+	// MaxBackups is the number of rotated files kept, 0 keeps all.
+	MaxBackups int
+	// MaxAge is how long rotated files are kept, rounded up to days, 0
+	// keeps them forever.
+	MaxAge time.Duration
+	// RotateInterval rotates the log file this often besides by size, 0
+	// rotates by size only.
+	RotateInterval time.Duration
+	// Compress rotated files with gzip.
+	Compress bool
+}
+
+// output is where the logs go, each component has a writer of its own
+// which filters by its level.
+type output struct {
+	base       *levelWriter
+	components map[string]*levelWriter
+}
+
+// current is the output set up by Setup, without it components log to the
+// global logger.
+var current atomic.Pointer[output]
+
+// Setup directs the global logger and the loggers of the components to the
+// output of cfg. It returns a func which stops the rotation and closes the
+// log file. It should be called before the loggers are used.
+func Setup(cfg Config) (func() error, error) {
+	var (
+		out   io.Writer = os.Stderr
+		close           = func() error { return nil }
+	)
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, err
+		}
+		file := &lumberjack.Logger{
+			Filename:   filepath.Join(cfg.Dir, FileName),
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     int((cfg.MaxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+			Compress:   cfg.Compress,
+			LocalTime:  true,
+		}
+		out = file
+		close = rotateEvery(file, cfg.RotateInterval)
+	}
+
+	switch cfg.Format {
+	case FormatJSON, "":
+	case FormatConsole:
+		out = zerolog.ConsoleWriter{Out: out, NoColor: cfg.Dir != "", TimeFormat: time.RFC3339}
+	default:
+		close()
+		return nil, fmt.Errorf("unsupported log format %q", cfg.Format)
+	}
+
+	o := &output{
+		base:       &levelWriter{out: out},
+		components: make(map[string]*levelWriter, len(Components)),
+	}
+	for _, component := range Components {
+		o.components[component] = &levelWriter{out: out}
+	}
+	levels, err := ParseLevels(cfg.Level, cfg.Levels)
+	if err != nil {
+		close()
+		return nil, err
+	}
+
+	log.Logger = log.Output(o.base)
+	current.Store(o)
+	levels.Apply()
+	return close, nil
+}
+
+// SetLevels changes the level of the logs and those of the components while
+// the app runs.
+func SetLevels(level string, levels map[string]string) error {
+	if current.Load() == nil {
+		return fmt.Errorf("logging is not set up")
+	}
+	parsed, err := ParseLevels(level, levels)
+	if err != nil {
+		return err
+	}
+	parsed.Apply()
+	return nil
+}
+
+// Levels are parsed levels of the logs and of the components, ready to be
+// applied.
+type Levels struct {
+	base       zerolog.Level
+	components map[string]zerolog.Level
+}
+
+// ParseLevels parses the level of the logs and those of the components,
+// components without one log at level. Nothing changes until the levels are
+// applied.
+func ParseLevels(level string, levels map[string]string) (Levels, error) {
+	base, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return Levels{}, err
+	}
+
+	parsed := Levels{base: base, components: make(map[string]zerolog.Level, len(Components))}
+	for _, component := range Components {
+		parsed.components[component] = base
+		if levels[component] == "" {
+			continue
+		}
+		if parsed.components[component], err = zerolog.ParseLevel(levels[component]); err != nil {
+			return Levels{}, fmt.Errorf("level of %s: %w", component, err)
+		}
+	}
+	return parsed, nil
+}
+
+// Apply changes the levels of the output set up by Setup, without it only the
+// global level is changed.
+func (l Levels) Apply() {
+	least := l.base
+	for _, level := range l.components {
+		least = min(least, level)
+	}
+
+	// events below every level are dropped before they are written, the
+	// writers drop those below the level of their component
+	zerolog.SetGlobalLevel(least)
+	o := current.Load()
+	if o == nil {
+		return
+	}
+	o.base.level.Store(int32(l.base))
+	for component, w := range o.components {
+		w.level.Store(int32(l.components[component]))
+	}
+}
+
+// Ctx returns the logger of ctx, like a request logger, for the component.
+// Without one in ctx it is the global logger.
+func Ctx(ctx context.Context, component string) *zerolog.Logger {
+	l := zerolog.Ctx(ctx)
+	if l.GetLevel() == zerolog.Disabled {
+		l = &log.Logger
+	}
+	return forComponent(*l, component)
+}
+
+// Component returns the logger of the component derived from the global
+// logger.
+func Component(component string) *zerolog.Logger {
+	return forComponent(log.Logger, component)
+}
+
+func forComponent(l zerolog.Logger, component string) *zerolog.Logger {
+	if o := current.Load(); o != nil {
+		if w, ok := o.components[component]; ok {
+			l = l.Output(w)
+		}
+	}
+	l = l.With().Str("component", component).Logger()
+	return &l
+}
+
+// levelWriter drops events below its level.
+type levelWriter struct {
+	out   io.Writer
+	level atomic.Int32
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+func (w *levelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < zerolog.Level(w.level.Load()) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// rotateEvery rotates the file every interval, the returned func stops it
+// and closes the file.
+func rotateEvery(file *lumberjack.Logger, interval time.Duration) func() error {
+	if interval <= 0 {
+		return file.Close
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := file.Rotate(); err != nil {
+					fmt.Fprintf(os.Stderr, "rotate log file: %v\n", err)
+				}
+			}
+		}
+	}()
+	return func() error {
+		ticker.Stop()
+		close(done)
+		return file.Close()
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// setup sets up logging into a temp dir and returns a func reading the log
+// file, the global logger is restored after the test.
+func setup(t *testing.T, cfg Config) func() string {
+	t.Helper()
+	logger, level := log.Logger, zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+		current.Store(nil)
+	})
+
+	cfg.Dir = t.TempDir()
+	closeLogs, err := Setup(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() string {
+		if err := closeLogs(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.Dir, FileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
+
+func TestSetup_levels(t *testing.T) {
+	read := setup(t, Config{
+		Level:  "info",
+		Levels: map[string]string{SQL: "debug", HTTP: "warn"},
+		Format: FormatJSON,
+	})
+
+	log.Debug().Msg("app debug")
+	log.Info().Msg("app info")
+	Component(SQL).Debug().Msg("sql debug")
+	Component(HTTP).Info().Msg("http info")
+	Component(HTTP).Warn().Msg("http warn")
+	Component(JWT).Debug().Msg("jwt debug")
+	Component(JWT).Info().Msg("jwt info")
+
+	got := read()
+	tests := []struct {
+		msg    string
+		logged bool
+	}{
+		{`"message":"app debug"`, false},
+		{`"message":"app info"`, true},
+		{`"level":"debug","component":"sql"`, true},
+		{`"level":"info","component":"http"`, false},
+		{`"level":"warn","component":"http"`, true},
+		{`"level":"debug","component":"jwt"`, false},
+		{`"level":"info","component":"jwt"`, true},
+	}
+	for _, tt := range tests {
+		if strings.Contains(got, tt.msg) != tt.logged {
+			t.Errorf("log %s logged = %v, want %v", tt.msg, !tt.logged, tt.logged)
+		}
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	read := setup(t, Config{Level: "info", Format: FormatJSON})
+
+	Component(SQL).Debug().Msg("before")
+	if err := SetLevels("warn", map[string]string{SQL: "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	Component(SQL).Debug().Msg("after")
+	log.Info().Msg("app info")
+
+	if err := SetLevels("info", map[string]string{SQL: "verbose"}); err == nil {
+		t.Error("SetLevels() accepted level verbose")
+	}
+
+	got := read()
+	if strings.Contains(got, "before") || !strings.Contains(got, "after") || strings.Contains(got, "app info") {
+		t.Errorf("log = %s", got)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	read := setup(t, Config{Level: "info", Format: FormatJSON})
+
+	if _, err := ParseLevels("debug", map[string]string{JWT: "verbose"}); err == nil {
+		t.Error("ParseLevels() accepted level verbose")
+	}
+	log.Debug().Msg("not parsed")
+
+	levels, err := ParseLevels("warn", map[string]string{SQL: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Component(SQL).Debug().Msg("parsed")
+	levels.Apply()
+	Component(SQL).Debug().Msg("applied")
+	log.Info().Msg("app info")
+
+	got := read()
+	if strings.Contains(got, "not parsed") || strings.Contains(got, `"parsed"`) ||
+		!strings.Contains(got, "applied") || strings.Contains(got, "app info") {
+		t.Errorf("log = %s", got)
+	}
+}
+
+func TestSetup_console(t *testing.T) {
+	read := setup(t, Config{Level: "info", Format: FormatConsole})
+
+	ctx := log.With().Str("requestId", "abc").Logger().WithContext(context.Background())
+	Ctx(ctx, HTTP).Info().Msg("request")
+
+	got := read()
+	for _, want := range []string{"INF", "request", "component=http", "requestId=abc"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log %q doesn't contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "\x1b[") {
+		t.Errorf("log file %q is colored", got)
+	}
+}
+
+func TestSetup_format(t *testing.T) {
+	if _, err := Setup(Config{Level: "info", Format: "xml"}); err == nil {
+		t.Error("Setup() accepted format xml")
+	}
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/goccy/go-json"
+)
+
+// findUserData returns the user with id, deleted or not. Erased users have
+// no data left and aren't found.
+func (st *state) findUserData(id string) (user, error) {
+	if u, ok := st.users[id]; ok && u.ErasedAt == nil {
+		return u, nil
+	}
+	return user{}, app.ErrNotFound("user not found with id = %s", id)
+}
+
+// loginEvents returns the login events of the email still in the outbox.
+func (st *state) loginEvents(email app.Email) []app.Event {
+	events := []app.Event{}
+	for _, event := range st.events {
+		if event.AggregateType == app.AggregateLogin && event.AggregateID == strings.ToLower(email.String()) {
+			events = append(events, event.Event)
+		}
+	}
+	return events
+}
+
+// ExportUserData returns all data stored about the user like the sql
+// package.
+func (s *Store) ExportUserData(ctx context.Context, id string) (app.UserDataExport, error) {
+	var data app.UserDataExport
+	err := s.write(ctx, func(st *state) error {
+		u, err := st.findUserData(id)
+		if err != nil {
+			return err
+		}
+
+		aggregate := st.userAggregate(u)
+		roles := make([]app.RoleAggregate, len(aggregate.Roles))
+		for i, roleID := range aggregate.Roles {
+			roles[i] = roleAggregate(st.roles[roleID])
+		}
+
+		entries := []app.AuditEntry{}
+		for _, entry := range st.audit {
+			if entry.TargetType == app.AuditTargetUser && entry.TargetID == id || entry.ActorID == id {
+				entries = append(entries, entry)
+			}
+		}
+
+		data = app.UserDataExport{
+			Exported: time.Now().Unix(),
+			User:     aggregate,
+			Roles:    roles,
+			Sessions: app.UserSessions{
+				LastLogin: clonePtr(u.LastLogin),
+				Logins:    st.loginEvents(u.Email),
+			},
+			AuditEntries: entries,
+		}
+
+		return st.addAudit(ctx, app.AuditUserDataExported, app.AuditTargetUser, id, nil, nil)
+	})
+	return data, err
+}
+
+// EraseUser irreversibly replaces personal data of the user with
+// placeholders like the sql package.
+func (s *Store) EraseUser(ctx context.Context, id string) error {
+	return s.write(ctx, func(st *state) error {
+		u, err := st.findUserData(id)
+		if err != nil {
+			return err
+		}
+		email := u.Email
+
+		u.Erase(time.Now().Unix())
+		u.Version++
+		u.Salt = newSalt()
+		u.roles = nil
+		u.permissions = nil
+		st.users[u.ID] = u
+
+		erased := st.userAggregate(u)
+		if err = st.scrubEvents(erased, email); err != nil {
+			return err
+		}
+
+		err = st.addAudit(ctx, app.AuditUserErased, app.AuditTargetUser, id, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		return st.publish(app.EventUserErased, app.AggregateUser, id, erased)
+	})
+}
+
+// scrubEvents replaces payloads of the events of the erased user, and of
+// webhook deliveries of those events, with ones without personal data.
+func (st *state) scrubEvents(erased app.UserAggregate, email app.Email) error {
+	payload, err := json.Marshal(erased)
+	if err != nil {
+		return app.ErrInternal("failed to encode erased user %s", erased.ID, err)
+	}
+
+	requests := map[int64][]byte{}
+	events := make([]outboxEvent, len(st.events))
+	for i, event := range st.events {
+		switch {
+		case event.AggregateType == app.AggregateUser && event.AggregateID == erased.ID:
+			event.Payload = payload
+		case event.AggregateType == app.AggregateLogin && event.AggregateID == strings.ToLower(email.String()):
+			var login app.LoginEvent
+			if err = json.Unmarshal(event.Payload, &login); err != nil {
+				return app.ErrInternal("failed to decode event %d", event.ID, err)
+			}
+			login.Email = erased.Email.String()
+			login.IP = ""
+			if event.Payload, err = json.Marshal(login); err != nil {
+				return app.ErrInternal("failed to encode event %d", event.ID, err)
+			}
+			event.AggregateID = strings.ToLower(login.Email)
+		default:
+			events[i] = event
+			continue
+		}
+
+		if requests[event.ID], err = json.Marshal(event.Event); err != nil {
+			return app.ErrInternal("failed to encode event %d", event.ID, err)
+		}
+		events[i] = event
+	}
+	st.events = events
+
+	deliveries := make([]app.WebhookDelivery, len(st.deliveries))
+	for i, delivery := range st.deliveries {
+		if request, ok := requests[delivery.EventID]; ok {
+			delivery.Request = request
+		}
+		deliveries[i] = delivery
+	}
+	st.deliveries = deliveries
+	return nil
+}
@@ -0,0 +1,301 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+// findRole returns the not deleted role with the id or the name of the
+// filter.
+func (st *state) findRole(filter *app.IDOrNameFilter) (role, error) {
+	if r, ok := st.roles[filter.ID]; ok && r.DeletedAt == nil {
+		return r, nil
+	}
+
+	for _, r := range st.roles {
+		if r.DeletedAt == nil && strings.EqualFold(r.Name, filter.Name) {
+			return r, nil
+		}
+	}
+
+	return role{}, app.ErrNotFound("role not found with %s", filter.String())
+}
+
+// nameTaken reports whether a not deleted role other than the one with id
+// has the name.
+func (st *state) nameTaken(name, id string) bool {
+	for _, r := range st.roles {
+		if r.DeletedAt == nil && r.ID != id && strings.EqualFold(r.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func roleAggregate(r role) app.RoleAggregate {
+	aggregate := app.RoleAggregate{
+		Role:        r.Role,
+		Permissions: clonePermissions(r.permissions),
+	}
+	aggregate.Modified = clonePtr(r.Modified)
+	aggregate.DeletedAt = clonePtr(r.DeletedAt)
+	return aggregate
+}
+
+func (s *Store) AddRole(ctx context.Context, in *app.RoleAggregate) error {
+	return s.write(ctx, func(st *state) error {
+		return st.addRole(ctx, in)
+	})
+}
+
+// addRole stores the role with its permissions.
+func (st *state) addRole(ctx context.Context, in *app.RoleAggregate) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+
+	if in.ID == "" {
+		id, err := newID(&in.Role)
+		if err != nil {
+			return err
+		}
+		in.ID = id
+	}
+
+	if _, ok := st.roles[in.ID]; ok || st.nameTaken(in.Name, "") {
+		return app.ErrConflict("row already exists")
+	}
+	if err := checkPermissions(in.Permissions); err != nil {
+		return err
+	}
+
+	in.Created = time.Now().Unix()
+
+	r := role{
+		Role:        in.Role,
+		permissions: clonePermissions(in.Permissions),
+		seq:         st.nextSeq(),
+	}
+	r.Version = 1
+	r.Modified = nil
+	r.DeletedAt = nil
+	st.roles[r.ID] = r
+
+	created := roleAggregate(r)
+	if err := st.addAudit(ctx, app.AuditRoleCreated, app.AuditTargetRole, r.ID, nil, created); err != nil {
+		return err
+	}
+
+	return st.publish(app.EventRoleCreated, app.AggregateRole, r.ID, created)
+}
+
+func (s *Store) GetRole(ctx context.Context, filter *app.IDOrNameFilter) (app.RoleAggregate, error) {
+	var aggregate app.RoleAggregate
+	err := s.read(ctx, func(st *state) error {
+		r, err := st.findRole(filter)
+		if err != nil {
+			return err
+		}
+		aggregate = roleAggregate(r)
+		return nil
+	})
+	return aggregate, err
+}
+
+func (s *Store) UpdateRole(ctx context.Context, in *app.RoleAggregate, filter app.IDOrNameFilter) error {
+	return s.write(ctx, func(st *state) error {
+		return st.updateRole(ctx, in, filter)
+	})
+}
+
+// updateRole updates the role and replaces its permissions. When in.Version
+// is set the role is updated only if it's still at that version.
+func (st *state) updateRole(ctx context.Context, in *app.RoleAggregate, filter app.IDOrNameFilter) error {
+	r, err := st.findRole(&filter)
+	if err != nil {
+		return err
+	}
+	before := roleAggregate(r)
+
+	if err = in.Role.Validate(); err != nil {
+		return err
+	}
+	if in.Version != 0 && in.Version != r.Version {
+		return app.ErrPreconditionFailed("version %d is not current", in.Version)
+	}
+	if st.nameTaken(in.Name, r.ID) {
+		return app.ErrConflict("row already exists")
+	}
+	if err = checkPermissions(in.Permissions); err != nil {
+		return err
+	}
+
+	r.Name = in.Name
+	r.Modified = ptr.From(time.Now().Unix())
+	r.Version++
+	r.permissions = clonePermissions(in.Permissions)
+	st.roles[r.ID] = r
+
+	updated := roleAggregate(r)
+	in.Role = updated.Role
+
+	err = st.addAudit(ctx, app.AuditRoleUpdated, app.AuditTargetRole, r.ID, before, updated)
+	if err != nil {
+		return err
+	}
+
+	return st.publish(app.EventRoleUpdated, app.AggregateRole, r.ID, updated)
+}
+
+// DeleteRole marks the role as deleted, the role is kept until purged and
+// can be restored until then.
+func (s *Store) DeleteRole(ctx context.Context, filter *app.IDOrNameFilter) error {
+	return s.write(ctx, func(st *state) error {
+		r, err := st.findRole(filter)
+		if err != nil {
+			return err
+		}
+		if filter.Version != 0 && filter.Version != r.Version {
+			return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+		}
+		deleted := roleAggregate(r)
+
+		// permissions and assignments are kept, so they come back on restore
+		r.DeletedAt = ptr.From(time.Now().Unix())
+		r.Version++
+		st.roles[r.ID] = r
+
+		err = st.addAudit(ctx, app.AuditRoleDeleted, app.AuditTargetRole, r.ID, deleted, nil)
+		if err != nil {
+			return err
+		}
+
+		return st.publish(app.EventRoleDeleted, app.AggregateRole, r.ID, deleted)
+	})
+}
+
+// RestoreRole brings back the role deleted with DeleteRole. When filtered by
+// name the most recently deleted role with that name is restored.
+func (s *Store) RestoreRole(ctx context.Context, filter *app.IDOrNameFilter) error {
+	return s.write(ctx, func(st *state) error {
+		var (
+			r     role
+			found bool
+		)
+		for _, candidate := range st.roles {
+			if candidate.DeletedAt == nil ||
+				candidate.ID != filter.ID && !strings.EqualFold(candidate.Name, filter.Name) {
+				continue
+			}
+			if !found || *candidate.DeletedAt > *r.DeletedAt ||
+				*candidate.DeletedAt == *r.DeletedAt && candidate.seq > r.seq {
+				r, found = candidate, true
+			}
+		}
+		if !found {
+			return app.ErrNotFound("deleted role not found with %s", filter.String())
+		}
+		if filter.Version != 0 && filter.Version != r.Version {
+			return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+		}
+		if st.nameTaken(r.Name, r.ID) {
+			return app.ErrConflict("row already exists")
+		}
+
+		r.DeletedAt = nil
+		r.Modified = ptr.From(time.Now().Unix())
+		r.Version++
+		st.roles[r.ID] = r
+
+		restored := roleAggregate(r)
+		err := st.addAudit(ctx, app.AuditRoleRestored, app.AuditTargetRole, r.ID, nil, restored)
+		if err != nil {
+			return err
+		}
+
+		return st.publish(app.EventRoleRestored, app.AggregateRole, r.ID, restored)
+	})
+}
+
+// FindRoles returns not deleted roles, only the ones with the ids when any
+// are given.
+func (s *Store) FindRoles(ctx context.Context, ids ...string) ([]app.Role, error) {
+	var rows []role
+	err := s.read(ctx, func(st *state) error {
+		for _, r := range st.roles {
+			if r.DeletedAt == nil && (len(ids) == 0 || slices.Contains(ids, r.ID)) {
+				rows = append(rows, r)
+			}
+		}
+		return nil
+	})
+	sortBySeq(rows, func(r role) int64 { return r.seq })
+
+	roles := make([]app.Role, len(rows))
+	for i, r := range rows {
+		roles[i] = roleAggregate(r).Role
+	}
+	return roles, err
+}
+
+// AddRolePermission grants the permission to the role, granting a permission
+// the role already has does nothing.
+func (s *Store) AddRolePermission(ctx context.Context, roleID string, permission app.PermissionCheck) error {
+	return s.write(ctx, func(st *state) error {
+		r, err := st.findRole(&app.IDOrNameFilter{ID: roleID})
+		if err != nil {
+			return err
+		}
+		before := roleAggregate(r)
+
+		if hasPermission(r.permissions, permission) {
+			return nil
+		}
+		if err = checkPermissions([]app.PermissionCheck{permission}); err != nil {
+			return err
+		}
+
+		r.permissions = append(clonePermissions(r.permissions), clonePermissions([]app.PermissionCheck{permission})...)
+		return st.roleChanged(ctx, app.AuditRolePermissionAdded, r, before)
+	})
+}
+
+// RemoveRolePermission revokes the permission from the role.
+func (s *Store) RemoveRolePermission(ctx context.Context, roleID string, permission app.PermissionCheck) error {
+	return s.write(ctx, func(st *state) error {
+		r, err := st.findRole(&app.IDOrNameFilter{ID: roleID})
+		if err != nil {
+			return err
+		}
+		before := roleAggregate(r)
+
+		permissions, removed := withoutPermission(r.permissions, permission)
+		if !removed {
+			return app.ErrNotFound("role %s doesn't have permission %s", roleID, permission.Permission)
+		}
+
+		r.permissions = permissions
+		return st.roleChanged(ctx, app.AuditRolePermissionRemoved, r, before)
+	})
+}
+
+// roleChanged stores the role with a new version, logs the action and
+// publishes the role.updated event, before is the role as it was before the
+// change.
+func (st *state) roleChanged(ctx context.Context, action string, r role, before app.RoleAggregate) error {
+	r.Modified = ptr.From(time.Now().Unix())
+	r.Version++
+	st.roles[r.ID] = r
+
+	after := roleAggregate(r)
+	if err := st.addAudit(ctx, action, app.AuditTargetRole, r.ID, before, after); err != nil {
+		return err
+	}
+
+	return st.publish(app.EventRoleUpdated, app.AggregateRole, r.ID, after)
+}
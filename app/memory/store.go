@@ -0,0 +1,438 @@
+// Package memory implements the app storage, authenticator and authorizer in
+// memory. It follows the semantics of the sql package and is meant for tests
+// which don't need a real database.
+package memory
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/enverbisevac/go-project/app"
+	"github.com/goccy/go-json"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type user struct {
+	app.User
+	roles       []string
+	permissions []app.PermissionCheck
+	seq         int64
+}
+
+type role struct {
+	app.Role
+	permissions []app.PermissionCheck
+	seq         int64
+}
+
+type webhook struct {
+	app.Webhook
+	seq int64
+}
+
+type outboxEvent struct {
+	app.Event
+	dispatched int64
+}
+
+// state holds all stored rows. Changes are made on a clone of the state
+// which replaces the current one only when the change succeeds, so rows and
+// their slices must never be modified in place.
+type state struct {
+	seq        int64
+	users      map[string]user
+	roles      map[string]role
+	webhooks   map[string]webhook
+	deliveries []app.WebhookDelivery
+	audit      []app.AuditEntry
+	events     []outboxEvent
+	eventID    int64
+	deliveryID int64
+}
+
+func (st *state) clone() *state {
+	c := *st
+	c.users = maps.Clone(st.users)
+	c.roles = maps.Clone(st.roles)
+	c.webhooks = maps.Clone(st.webhooks)
+	return &c
+}
+
+func (st *state) nextSeq() int64 {
+	st.seq++
+	return st.seq
+}
+
+// Store is the in-memory storage, it is safe for concurrent use.
+type Store struct {
+	mu    sync.RWMutex
+	state *state
+}
+
+func New() *Store {
+	return &Store{
+		state: &state{
+			users:    map[string]user{},
+			roles:    map[string]role{},
+			webhooks: map[string]webhook{},
+		},
+	}
+}
+
+// read runs fn with the current state, fn must not change it.
+func (s *Store) read(ctx context.Context, fn func(st *state) error) error {
+	if t := s.txFromContext(ctx); t != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		return fn(t.state)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return fn(s.state)
+}
+
+// write runs fn on a clone of the state and stores the clone when fn
+// succeeds, like a transaction.
+func (s *Store) write(ctx context.Context, fn func(st *state) error) error {
+	if t := s.txFromContext(ctx); t != nil {
+		if t.readOnly {
+			return errReadOnly
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		st := t.state.clone()
+		if err := fn(st); err != nil {
+			return err
+		}
+		t.state = st
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.state.clone()
+	if err := fn(st); err != nil {
+		return err
+	}
+	s.state = st
+	return nil
+}
+
+// dryRun runs fn on a clone of the state which is thrown away.
+func (s *Store) dryRun(ctx context.Context, fn func(st *state) error) error {
+	if t := s.txFromContext(ctx); t != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		return fn(t.state.clone())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fn(s.state.clone())
+}
+
+// addAudit appends the change of the target to the audit log, the actor is
+// taken from ctx.
+func (st *state) addAudit(ctx context.Context, action, targetType, targetID string, before, after any) error {
+	entry, err := app.NewAuditEntry(ctx, nil, action, targetType, targetID, before, after)
+	if err != nil {
+		return app.ErrInternal("failed to create audit entry", err)
+	}
+
+	if n := len(st.audit); n > 0 {
+		entry.PrevHash = st.audit[n-1].Hash
+		entry.ID = st.audit[n-1].ID
+	}
+	entry.ID++
+	entry.Created = time.Now().Unix()
+	// the log lives in the process, there is nobody to keep a key from
+	if entry.Hash, err = entry.ComputeHash(nil); err != nil {
+		return app.ErrInternal("failed to hash audit entry", err)
+	}
+
+	st.audit = append(st.audit, *entry)
+	return nil
+}
+
+// publish stores the event in the outbox.
+func (st *state) publish(eventType, aggregateType, aggregateID string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return app.ErrInternal("failed to encode %s event", eventType, err)
+	}
+
+	st.eventID++
+	st.events = append(st.events, outboxEvent{
+		Event: app.Event{
+			ID:            st.eventID,
+			Type:          eventType,
+			AggregateType: aggregateType,
+			AggregateID:   aggregateID,
+			Payload:       data,
+			Created:       time.Now().Unix(),
+		},
+	})
+	return nil
+}
+
+func (s *Store) FindAuditEntries(ctx context.Context, filter app.AuditFilter) ([]app.AuditEntry, error) {
+	entries := make([]app.AuditEntry, 0, filter.Limit)
+	err := s.read(ctx, func(st *state) error {
+		for i := len(st.audit) - 1; i >= 0; i-- {
+			entry := st.audit[i]
+			if filter.ActorID != "" && entry.ActorID != filter.ActorID ||
+				filter.Action != "" && entry.Action != filter.Action ||
+				filter.TargetType != "" && entry.TargetType != filter.TargetType ||
+				filter.TargetID != "" && entry.TargetID != filter.TargetID ||
+				filter.From != 0 && entry.Created < filter.From ||
+				filter.To != 0 && entry.Created >= filter.To {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return page(entries, filter.Limit, filter.Offset), err
+}
+
+func (s *Store) VerifyAuditLog(ctx context.Context) (app.AuditVerification, error) {
+	result := app.AuditVerification{Valid: true}
+	err := s.read(ctx, func(st *state) error {
+		var prevHash string
+		for _, entry := range st.audit {
+			result.Entries++
+			hash, err := entry.ComputeHash(nil)
+			if err != nil {
+				return app.ErrInternal("failed to hash audit entry %d", entry.ID, err)
+			}
+			if entry.PrevHash != prevHash || entry.Hash != hash {
+				id := entry.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return nil
+			}
+			prevHash = entry.Hash
+		}
+		result.Head = prevHash
+		return nil
+	})
+	return result, err
+}
+
+func (s *Store) PendingEvents(ctx context.Context, afterID int64, limit int) ([]app.Event, error) {
+	events := make([]app.Event, 0, limit)
+	err := s.read(ctx, func(st *state) error {
+		for _, event := range st.events {
+			if len(events) == limit {
+				break
+			}
+			if event.dispatched == 0 && event.ID > afterID {
+				events = append(events, event.Event)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (s *Store) MarkEventsDispatched(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	dispatched := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		dispatched[id] = true
+	}
+
+	return s.write(ctx, func(st *state) error {
+		now := time.Now().Unix()
+		events := make([]outboxEvent, len(st.events))
+		for i, event := range st.events {
+			if dispatched[event.ID] {
+				event.dispatched = now
+			}
+			events[i] = event
+		}
+		st.events = events
+		return nil
+	})
+}
+
+// PurgeDispatchedEvents deletes events dispatched before the given time.
+func (s *Store) PurgeDispatchedEvents(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := s.write(ctx, func(st *state) error {
+		events := make([]outboxEvent, 0, len(st.events))
+		for _, event := range st.events {
+			if event.dispatched != 0 && event.dispatched < before.Unix() {
+				n++
+				continue
+			}
+			events = append(events, event)
+		}
+		st.events = events
+		return nil
+	})
+	return n, err
+}
+
+// PurgeDeleted permanently deletes users and roles deleted before the given
+// time with their roles and permissions, and returns how many were removed.
+// Erased users are kept, audit entries refer to them.
+func (s *Store) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var users, roles int64
+	err := s.write(ctx, func(st *state) error {
+		for id, u := range st.users {
+			if u.DeletedAt != nil && *u.DeletedAt < before.Unix() && u.ErasedAt == nil {
+				delete(st.users, id)
+				users++
+			}
+		}
+
+		purged := map[string]bool{}
+		for id, r := range st.roles {
+			if r.DeletedAt != nil && *r.DeletedAt < before.Unix() {
+				delete(st.roles, id)
+				purged[id] = true
+				roles++
+			}
+		}
+
+		// assignments of purged roles go with them
+		if len(purged) > 0 {
+			for id, u := range st.users {
+				assigned := make([]string, 0, len(u.roles))
+				for _, roleID := range u.roles {
+					if !purged[roleID] {
+						assigned = append(assigned, roleID)
+					}
+				}
+				u.roles = assigned
+				st.users[id] = u
+			}
+		}
+
+		if users+roles == 0 {
+			return nil
+		}
+		return st.addAudit(ctx, app.AuditDeletedPurged, "", "", nil, map[string]int64{
+			"users":  users,
+			"roles":  roles,
+			"before": before.Unix(),
+		})
+	})
+	return users + roles, err
+}
+
+func passwordHash[T ~string](plaintextPassword T) (string, error) {
+	// the store is meant for tests, hashing with the default cost is slow
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), bcrypt.MinCost)
+	if err != nil {
+		return "", app.ErrInternal("hash password failed", err)
+	}
+
+	return string(hashedPassword), nil
+}
+
+func passwordMatches(hashedPassword, plaintextPassword string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plaintextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, app.ErrInternal("compare passwords failed", err)
+		}
+	}
+
+	return true, nil
+}
+
+func newSalt() string {
+	return uniuri.NewLen(uniuri.UUIDLen)
+}
+
+// newID returns the id for the row, ids are generated like in the sql
+// package.
+func newID(row interface{ Generator() (func() any, error) }) (string, error) {
+	gen, err := row.Generator()
+	if err != nil {
+		return "", app.ErrInternal("generating id value failed!", err)
+	}
+	return gen().(string), nil
+}
+
+// hasPermission reports whether permissions contain the permission check
+// with exactly the same resource, an empty resource is the same as none.
+func hasPermission(permissions []app.PermissionCheck, check app.PermissionCheck) bool {
+	for _, p := range permissions {
+		if p.Permission == check.Permission && resource(p) == resource(check) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPermission returns permissions without the check, false when it
+// isn't there.
+func withoutPermission(permissions []app.PermissionCheck, check app.PermissionCheck) ([]app.PermissionCheck, bool) {
+	result := make([]app.PermissionCheck, 0, len(permissions))
+	for _, p := range permissions {
+		if p.Permission != check.Permission || resource(p) != resource(check) {
+			result = append(result, p)
+		}
+	}
+	return result, len(result) < len(permissions)
+}
+
+func resource(p app.PermissionCheck) string {
+	if p.ResourceID == nil {
+		return ""
+	}
+	return *p.ResourceID
+}
+
+// clonePermissions copies permissions and their resources, so callers can't
+// change stored rows.
+func clonePermissions(permissions []app.PermissionCheck) []app.PermissionCheck {
+	result := make([]app.PermissionCheck, len(permissions))
+	for i, p := range permissions {
+		result[i].Permission = p.Permission
+		if p.ResourceID != nil {
+			id := *p.ResourceID
+			result[i].ResourceID = &id
+		}
+	}
+	return result
+}
+
+func page[T any](rows []T, limit, offset int) []T {
+	if offset >= len(rows) {
+		return rows[:0]
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func sortBySeq[T any](rows []T, seq func(T) int64) {
+	sort.Slice(rows, func(i, j int) bool {
+		return seq(rows[i]) < seq(rows[j])
+	})
+}
@@ -0,0 +1,13 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/enverbisevac/go-project/app/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		return New()
+	})
+}
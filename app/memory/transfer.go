@@ -0,0 +1,237 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+type importOutcome int
+
+const (
+	importCreated importOutcome = iota
+	importUpdated
+	importSkipped
+)
+
+// ExportRecords returns all roles followed by all users, deleted ones are
+// left out. Users are ordered by email and exported with their password
+// hashes.
+func (s *Store) ExportRecords(ctx context.Context) ([]app.TransferRecord, error) {
+	var records []app.TransferRecord
+	err := s.read(ctx, func(st *state) error {
+		var (
+			roles []role
+			users []user
+		)
+		for _, r := range st.roles {
+			if r.DeletedAt == nil {
+				roles = append(roles, r)
+			}
+		}
+		for _, u := range st.users {
+			if u.DeletedAt == nil {
+				users = append(users, u)
+			}
+		}
+		sortBySeq(roles, func(r role) int64 { return r.seq })
+		slices.SortFunc(users, func(a, b user) int {
+			return strings.Compare(strings.ToLower(a.Email.String()), strings.ToLower(b.Email.String()))
+		})
+
+		records = make([]app.TransferRecord, 0, len(roles)+len(users))
+		for _, r := range roles {
+			records = append(records, app.TransferRecord{
+				Kind:        app.RecordRole,
+				Name:        r.Name,
+				Permissions: clonePermissions(r.permissions),
+			})
+		}
+
+		for _, u := range users {
+			aggregate := st.userAggregate(u)
+			names := make([]string, 0, len(aggregate.Roles))
+			for _, id := range aggregate.Roles {
+				names = append(names, st.roles[id].Name)
+			}
+
+			records = append(records, app.TransferRecord{
+				Kind:         app.RecordUser,
+				Email:        u.Email,
+				FullName:     u.FullName,
+				Active:       u.Active,
+				IsAdmin:      u.IsAdmin,
+				DateJoined:   u.DateJoined,
+				PasswordHash: u.Password.String(),
+				Roles:        names,
+				Permissions:  aggregate.Permissions,
+			})
+		}
+		return nil
+	})
+	return records, err
+}
+
+// ImportRecords stores the records in order, every record on its own. Invalid
+// records are reported and left out, roles and users that exist already are
+// skipped or updated depending on the mode. In dry run nothing is stored.
+func (s *Store) ImportRecords(ctx context.Context, records []app.TransferRecord, options app.ImportOptions) (app.ImportReport, error) {
+	report := app.ImportReport{DryRun: options.DryRun}
+	if err := options.Validate(); err != nil {
+		return report, err
+	}
+
+	// roles created in dry run, users can still reference them
+	pendingRoles := map[string]bool{}
+
+	for i := range records {
+		record := &records[i]
+
+		var outcome importOutcome
+		run := s.write
+		if options.DryRun {
+			run = s.dryRun
+		}
+		err := run(ctx, func(st *state) (err error) {
+			outcome, err = st.importRecord(ctx, record, options.Mode, pendingRoles)
+			return err
+		})
+		if err != nil {
+			if app.ErrorStatus(err) == app.StatusInternal {
+				return report, err
+			}
+
+			row := record.Row
+			if row == 0 {
+				row = i + 1
+			}
+			report.AddErrors(app.ImportError{
+				Row:   row,
+				Kind:  record.Kind,
+				Key:   record.Key(),
+				Error: app.ErrorMessage(err),
+			})
+			continue
+		}
+
+		if options.DryRun && record.Kind == app.RecordRole && outcome == importCreated {
+			pendingRoles[strings.ToLower(record.Name)] = true
+		}
+
+		switch outcome {
+		case importCreated:
+			report.Created++
+		case importUpdated:
+			report.Updated++
+		case importSkipped:
+			report.Skipped++
+		}
+	}
+
+	return report, nil
+}
+
+func (st *state) importRecord(
+	ctx context.Context,
+	record *app.TransferRecord,
+	mode string,
+	pendingRoles map[string]bool,
+) (importOutcome, error) {
+	switch record.Kind {
+	case app.RecordRole:
+		return st.importRole(ctx, record, mode)
+	case app.RecordUser:
+		return st.importUser(ctx, record, mode, pendingRoles)
+	default:
+		return 0, app.ErrInvalid("kind must be %s or %s", app.RecordRole, app.RecordUser)
+	}
+}
+
+func (st *state) importRole(ctx context.Context, record *app.TransferRecord, mode string) (importOutcome, error) {
+	r := record.RoleAggregate()
+	if err := r.Validate(); err != nil {
+		return 0, err
+	}
+
+	existing, err := st.findRole(&app.IDOrNameFilter{Name: record.Name})
+	switch {
+	case err != nil:
+		return importCreated, st.addRole(ctx, &r)
+	case mode == app.ConflictSkip:
+		return importSkipped, nil
+	}
+
+	r.ID = existing.ID
+	return importUpdated, st.updateRole(ctx, &r, app.IDOrNameFilter{ID: existing.ID})
+}
+
+func (st *state) importUser(
+	ctx context.Context,
+	record *app.TransferRecord,
+	mode string,
+	pendingRoles map[string]bool,
+) (importOutcome, error) {
+	u, err := record.UserAggregate()
+	if err != nil {
+		return 0, err
+	}
+
+	email := record.Email.String()
+	existing, err := st.findUser(app.UserFilter{Email: &email})
+	found := err == nil
+
+	// existing users keep their password unless the record has one
+	validate := u.Validate
+	if found && u.Password == "" {
+		validate = u.ValidateProfile
+	}
+	if err = validate(); err != nil {
+		return 0, err
+	}
+
+	for _, name := range record.Roles {
+		r, err := st.findRole(&app.IDOrNameFilter{Name: name})
+		switch {
+		case err != nil && pendingRoles[strings.ToLower(name)]:
+			continue
+		case err != nil:
+			return 0, app.ErrInvalid("role %s not found", name)
+		}
+		u.Roles = append(u.Roles, r.ID)
+	}
+
+	if !found {
+		if record.Password != "" {
+			hash, err := passwordHash(record.Password)
+			if err != nil {
+				return 0, err
+			}
+			u.Password = app.Password(hash)
+		}
+		return importCreated, st.addUser(ctx, &u, true)
+	}
+
+	if mode == app.ConflictSkip {
+		return importSkipped, nil
+	}
+
+	u.ID = existing.ID
+	if err = st.updateUser(ctx, &u); err != nil {
+		return 0, err
+	}
+
+	// the update reads the user back without its password
+	if record.Password == "" && record.PasswordHash == "" {
+		return importUpdated, nil
+	}
+
+	hash := record.PasswordHash
+	if hash == "" {
+		if hash, err = passwordHash(record.Password); err != nil {
+			return 0, err
+		}
+	}
+	return importUpdated, st.setUserPasswordHash(ctx, app.UserFilter{ID: existing.ID}, hash)
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+var errReadOnly = app.ErrInternal("cannot write in a read-only transaction")
+
+type txContextKey struct{}
+
+// tx is the unit of work of WithinTx, it is carried by the context passed to
+// the functions run in it. Changes are made to the state of tx and stored
+// in the store when the unit of work succeeds.
+type tx struct {
+	store    *Store
+	readOnly bool
+
+	mu    sync.Mutex
+	state *state
+}
+
+// txFromContext returns the unit of work of ctx run on the store, nil when
+// there is none.
+func (s *Store) txFromContext(ctx context.Context) *tx {
+	if t, ok := ctx.Value(txContextKey{}).(*tx); ok && t.store == s {
+		return t
+	}
+	return nil
+}
+
+// WithinTx runs fn in a unit of work like the sql package. Changes made with
+// the context passed to fn are stored when fn succeeds, a nested WithinTx
+// only throws away its own changes when it fails. The store is locked until
+// WithinTx returns.
+func (s *Store) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t := s.txFromContext(ctx); t != nil {
+		if t.readOnly {
+			return errReadOnly
+		}
+
+		// states are copied on write, the current one is a savepoint
+		t.mu.Lock()
+		saved := t.state
+		t.mu.Unlock()
+
+		if err := fn(ctx); err != nil {
+			t.mu.Lock()
+			t.state = saved
+			t.mu.Unlock()
+			return err
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &tx{
+		store: s,
+		state: s.state,
+	}
+	if err := fn(context.WithValue(ctx, txContextKey{}, t)); err != nil {
+		return err
+	}
+	s.state = t.state
+	return nil
+}
+
+// WithinReadTx runs fn in a read-only unit of work, see WithinTx. Nested in
+// WithinTx it joins the unit of work.
+func (s *Store) WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.txFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t := &tx{
+		store:    s,
+		state:    s.state,
+		readOnly: true,
+	}
+	return fn(context.WithValue(ctx, txContextKey{}, t))
+}
@@ -0,0 +1,584 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+// findUser returns the not deleted user with the id or the email of the
+// filter.
+func (st *state) findUser(filter app.UserFilter) (user, error) {
+	if u, ok := st.users[filter.ID]; ok && u.DeletedAt == nil {
+		return u, nil
+	}
+
+	if filter.Email != nil {
+		for _, u := range st.users {
+			if u.DeletedAt == nil && strings.EqualFold(u.Email.String(), *filter.Email) {
+				return u, nil
+			}
+		}
+	}
+
+	return user{}, app.ErrNotFound("user not found with %s", filter.String())
+}
+
+// emailTaken reports whether a not deleted user other than the one with id
+// has the email.
+func (st *state) emailTaken(email app.Email, id string) bool {
+	for _, u := range st.users {
+		if u.DeletedAt == nil && u.ID != id && strings.EqualFold(u.Email.String(), email.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// userAggregate returns the copy of the user with its permissions and roles,
+// deleted roles are left out. Like in the sql package the password isn't
+// returned.
+func (st *state) userAggregate(u user) app.UserAggregate {
+	roles := make([]string, 0, len(u.roles))
+	for _, id := range u.roles {
+		if r, ok := st.roles[id]; ok && r.DeletedAt == nil {
+			roles = append(roles, id)
+		}
+	}
+
+	return app.UserAggregate{
+		User:        copyUser(u.User),
+		Permissions: clonePermissions(u.permissions),
+		Roles:       roles,
+	}
+}
+
+func copyUser(u app.User) app.User {
+	u.Modified = clonePtr(u.Modified)
+	u.DeletedAt = clonePtr(u.DeletedAt)
+	u.ErasedAt = clonePtr(u.ErasedAt)
+	u.LastLogin = clonePtr(u.LastLogin)
+	u.Password = ""
+	return u
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	return ptr.From(*p)
+}
+
+// checkRoles returns an error when any of the roles doesn't exist or is
+// listed twice.
+func (st *state) checkRoles(ids []string) error {
+	for i, id := range ids {
+		if _, ok := st.roles[id]; !ok {
+			return app.ErrInvalid("role %s not found", id)
+		}
+		if slices.Contains(ids[:i], id) {
+			return app.ErrConflict("row already exists")
+		}
+	}
+	return nil
+}
+
+func checkPermissions(permissions []app.PermissionCheck) error {
+	for _, p := range permissions {
+		if p.Permission == "" {
+			return app.ErrInvalid("permission_id value is required")
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddUser(ctx context.Context, in *app.UserAggregate) error {
+	return s.write(ctx, func(st *state) error {
+		return st.addUser(ctx, in, false)
+	})
+}
+
+// addUser stores the user with roles and permissions. Imported users keep
+// their date joined and their password, which is hashed already.
+func (st *state) addUser(ctx context.Context, in *app.UserAggregate, imported bool) error {
+	validate := in.Validate
+	if imported {
+		validate = in.ValidateProfile
+	}
+	if err := validate(); err != nil {
+		return err
+	}
+
+	if in.ID == "" {
+		id, err := newID(&in.User)
+		if err != nil {
+			return err
+		}
+		in.ID = id
+	}
+
+	if _, ok := st.users[in.ID]; ok || st.emailTaken(in.Email, "") {
+		return app.ErrConflict("row already exists")
+	}
+	if err := st.checkRoles(in.Roles); err != nil {
+		return err
+	}
+	if err := checkPermissions(in.Permissions); err != nil {
+		return err
+	}
+
+	in.Created = time.Now().Unix()
+	if !imported || in.DateJoined == 0 {
+		in.DateJoined = in.Created
+	}
+
+	if in.Password != "" && !imported {
+		hashedPassword, err := passwordHash(in.Password)
+		if err != nil {
+			return err
+		}
+		in.Password = app.Password(hashedPassword)
+	}
+
+	in.Salt = newSalt()
+
+	u := user{
+		User:        in.User,
+		roles:       slices.Clone(in.Roles),
+		permissions: clonePermissions(in.Permissions),
+		seq:         st.nextSeq(),
+	}
+	u.Version = 1
+	u.Modified = nil
+	u.DeletedAt = nil
+	u.ErasedAt = nil
+	u.LastLogin = nil
+	st.users[u.ID] = u
+
+	created := st.userAggregate(u)
+	if err := st.addAudit(ctx, app.AuditUserCreated, app.AuditTargetUser, u.ID, nil, created); err != nil {
+		return err
+	}
+
+	return st.publish(app.EventUserCreated, app.AggregateUser, u.ID, created)
+}
+
+func (s *Store) GetUser(ctx context.Context, filter app.UserFilter) (app.UserAggregate, error) {
+	var aggregate app.UserAggregate
+	err := s.read(ctx, func(st *state) error {
+		u, err := st.findUser(filter)
+		if err != nil {
+			return err
+		}
+		aggregate = st.userAggregate(u)
+		return nil
+	})
+	return aggregate, err
+}
+
+func (s *Store) UpdateUser(ctx context.Context, in *app.UserAggregate) error {
+	return s.write(ctx, func(st *state) error {
+		return st.updateUser(ctx, in)
+	})
+}
+
+// updateUser updates the user and replaces its roles and permissions. When
+// in.Version is set the user is updated only if it's still at that version.
+func (st *state) updateUser(ctx context.Context, in *app.UserAggregate) error {
+	u, err := st.findUser(app.UserFilter{ID: in.ID})
+	if err != nil {
+		return err
+	}
+	before := st.userAggregate(u)
+
+	if in.Email != "" {
+		if err = in.Email.Validate(); err != nil {
+			return err
+		}
+	}
+	if in.Version != 0 && in.Version != u.Version {
+		return app.ErrPreconditionFailed("version %d is not current", in.Version)
+	}
+	if st.emailTaken(in.Email, u.ID) {
+		return app.ErrConflict("row already exists")
+	}
+	if err = st.checkRoles(in.Roles); err != nil {
+		return err
+	}
+	if err = checkPermissions(in.Permissions); err != nil {
+		return err
+	}
+
+	u.Active = in.Active
+	u.Email = in.Email
+	u.FullName = in.FullName
+	u.IsAdmin = in.IsAdmin
+	u.Modified = ptr.From(time.Now().Unix())
+	u.Version++
+	// memberships of deleted roles aren't listed, they are kept
+	roles := slices.Clone(in.Roles)
+	for _, id := range u.roles {
+		if r, ok := st.roles[id]; ok && r.DeletedAt != nil && !slices.Contains(roles, id) {
+			roles = append(roles, id)
+		}
+	}
+	u.roles = roles
+	u.permissions = clonePermissions(in.Permissions)
+	st.users[u.ID] = u
+
+	updated := st.userAggregate(u)
+	in.User = updated.User
+
+	err = st.addAudit(ctx, app.AuditUserUpdated, app.AuditTargetUser, u.ID, before, updated)
+	if err != nil {
+		return err
+	}
+
+	return st.publish(app.EventUserUpdated, app.AggregateUser, u.ID, updated)
+}
+
+// UpdateUserPassword changes the password of the user.
+func (s *Store) UpdateUserPassword(ctx context.Context, filter app.UserFilter, password app.Password) error {
+	hashedPassword, err := passwordHash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(st *state) error {
+		return st.setUserPasswordHash(ctx, filter, hashedPassword)
+	})
+}
+
+func (st *state) setUserPasswordHash(ctx context.Context, filter app.UserFilter, hash string) error {
+	u, err := st.findUser(filter)
+	if err != nil {
+		return err
+	}
+
+	u.Password = app.Password(hash)
+	st.users[u.ID] = u
+
+	// the password itself is never logged
+	return st.addAudit(ctx, app.AuditUserPasswordChanged, app.AuditTargetUser, u.ID, nil, nil)
+}
+
+// DeleteUser marks the user as deleted, the user is kept until purged and
+// can be restored until then.
+func (s *Store) DeleteUser(ctx context.Context, filter app.UserFilter) error {
+	return s.write(ctx, func(st *state) error {
+		u, err := st.findUser(filter)
+		if err != nil {
+			return err
+		}
+		if filter.Version != 0 && filter.Version != u.Version {
+			return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+		}
+		deleted := st.userAggregate(u)
+
+		// permissions and roles are kept, so they come back on restore
+		u.DeletedAt = ptr.From(time.Now().Unix())
+		u.Version++
+		st.users[u.ID] = u
+
+		err = st.addAudit(ctx, app.AuditUserDeleted, app.AuditTargetUser, u.ID, deleted, nil)
+		if err != nil {
+			return err
+		}
+
+		return st.publish(app.EventUserDeleted, app.AggregateUser, u.ID, deleted)
+	})
+}
+
+// RestoreUser brings back the user deleted with DeleteUser. When filtered by
+// email the most recently deleted user with that email is restored.
+func (s *Store) RestoreUser(ctx context.Context, filter app.UserFilter) error {
+	return s.write(ctx, func(st *state) error {
+		var (
+			u     user
+			found bool
+		)
+		for _, candidate := range st.users {
+			if candidate.DeletedAt == nil || candidate.ErasedAt != nil ||
+				candidate.ID != filter.ID &&
+					(filter.Email == nil || !strings.EqualFold(candidate.Email.String(), *filter.Email)) {
+				continue
+			}
+			if !found || *candidate.DeletedAt > *u.DeletedAt ||
+				*candidate.DeletedAt == *u.DeletedAt && candidate.seq > u.seq {
+				u, found = candidate, true
+			}
+		}
+		if !found {
+			return app.ErrNotFound("deleted user not found with %s", filter.String())
+		}
+		if filter.Version != 0 && filter.Version != u.Version {
+			return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+		}
+		if st.emailTaken(u.Email, u.ID) {
+			return app.ErrConflict("row already exists")
+		}
+
+		u.DeletedAt = nil
+		u.Modified = ptr.From(time.Now().Unix())
+		u.Version++
+		st.users[u.ID] = u
+
+		restored := st.userAggregate(u)
+		err := st.addAudit(ctx, app.AuditUserRestored, app.AuditTargetUser, u.ID, nil, restored)
+		if err != nil {
+			return err
+		}
+
+		return st.publish(app.EventUserRestored, app.AggregateUser, u.ID, restored)
+	})
+}
+
+func (s *Store) FindUsers(ctx context.Context) ([]app.User, error) {
+	return s.findUsers(ctx, func(u user) bool { return true })
+}
+
+func (s *Store) FindAdmins(ctx context.Context) ([]app.User, error) {
+	return s.findUsers(ctx, func(u user) bool { return u.IsAdmin })
+}
+
+func (s *Store) findUsers(ctx context.Context, match func(u user) bool) ([]app.User, error) {
+	var rows []user
+	err := s.read(ctx, func(st *state) error {
+		for _, u := range st.users {
+			if u.DeletedAt == nil && match(u) {
+				rows = append(rows, u)
+			}
+		}
+		return nil
+	})
+	sortBySeq(rows, func(u user) int64 { return u.seq })
+
+	users := make([]app.User, len(rows))
+	for i, u := range rows {
+		users[i] = copyUser(u.User)
+	}
+	return users, err
+}
+
+// SearchUsers matches the users like app.MatchUsers.
+func (s *Store) SearchUsers(ctx context.Context, filter app.UserSearchFilter) ([]app.UserSearchResult, error) {
+	var users []app.User
+	err := s.read(ctx, func(st *state) error {
+		for _, u := range st.users {
+			if u.DeletedAt == nil {
+				users = append(users, copyUser(u.User))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return app.MatchUsers(users, filter)
+}
+
+// AddUserRole assigns the role to the user, assigning a role the user
+// already has does nothing.
+func (s *Store) AddUserRole(ctx context.Context, userID, roleID string) error {
+	return s.write(ctx, func(st *state) error {
+		u, err := st.findUser(app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+		before := st.userAggregate(u)
+		if slices.Contains(before.Roles, roleID) {
+			return nil
+		}
+
+		if _, err = st.findRole(&app.IDOrNameFilter{ID: roleID}); err != nil {
+			return app.ErrInvalid("role %s not found", roleID, err)
+		}
+
+		u.roles = append(slices.Clip(u.roles), roleID)
+		return st.userChanged(ctx, app.AuditUserRoleAdded, u, before)
+	})
+}
+
+// RemoveUserRole takes the role away from the user.
+func (s *Store) RemoveUserRole(ctx context.Context, userID, roleID string) error {
+	return s.write(ctx, func(st *state) error {
+		u, err := st.findUser(app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+		before := st.userAggregate(u)
+
+		if !slices.Contains(u.roles, roleID) {
+			return app.ErrNotFound("user %s doesn't have role %s", userID, roleID)
+		}
+
+		u.roles = slices.DeleteFunc(slices.Clone(u.roles), func(id string) bool {
+			return id == roleID
+		})
+		return st.userChanged(ctx, app.AuditUserRoleRemoved, u, before)
+	})
+}
+
+// AddUserPermission grants the permission to the user, granting a permission
+// the user already has does nothing.
+func (s *Store) AddUserPermission(ctx context.Context, userID string, permission app.PermissionCheck) error {
+	return s.write(ctx, func(st *state) error {
+		u, err := st.findUser(app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+		before := st.userAggregate(u)
+
+		if hasPermission(u.permissions, permission) {
+			return nil
+		}
+		if err = checkPermissions([]app.PermissionCheck{permission}); err != nil {
+			return err
+		}
+
+		u.permissions = append(clonePermissions(u.permissions), clonePermissions([]app.PermissionCheck{permission})...)
+		return st.userChanged(ctx, app.AuditUserPermissionAdded, u, before)
+	})
+}
+
+// RemoveUserPermission revokes the permission from the user.
+func (s *Store) RemoveUserPermission(ctx context.Context, userID string, permission app.PermissionCheck) error {
+	return s.write(ctx, func(st *state) error {
+		u, err := st.findUser(app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+		before := st.userAggregate(u)
+
+		permissions, removed := withoutPermission(u.permissions, permission)
+		if !removed {
+			return app.ErrNotFound("user %s doesn't have permission %s", userID, permission.Permission)
+		}
+
+		u.permissions = permissions
+		return st.userChanged(ctx, app.AuditUserPermissionRemoved, u, before)
+	})
+}
+
+// userChanged stores the user with a new version, logs the action and
+// publishes the user.updated event, before is the user as it was before the
+// change.
+func (st *state) userChanged(ctx context.Context, action string, u user, before app.UserAggregate) error {
+	u.Modified = ptr.From(time.Now().Unix())
+	u.Version++
+	st.users[u.ID] = u
+
+	after := st.userAggregate(u)
+	if err := st.addAudit(ctx, action, app.AuditTargetUser, u.ID, before, after); err != nil {
+		return err
+	}
+
+	return st.publish(app.EventUserUpdated, app.AggregateUser, u.ID, after)
+}
+
+// Authenticate checks the credentials and publishes the login.succeeded
+// event with the last login change, or login.failed when the credentials
+// don't match.
+func (s *Store) Authenticate(ctx context.Context, creds app.Credentials) (app.AuthUser, error) {
+	if err := creds.Validate(); err != nil {
+		return app.AuthUser{}, err
+	}
+
+	event := app.LoginEvent{
+		Email: creds.Email.String(),
+		IP:    app.AuditActorFromContext(ctx).IP,
+	}
+	aggregateID := strings.ToLower(creds.Email.String())
+
+	var authUser app.AuthUser
+	err := s.write(ctx, func(st *state) error {
+		u, err := st.findUser(app.UserFilter{Email: ptr.From(creds.Email.String())})
+		if err != nil {
+			return app.ErrUnauthenticated("user %s doesn't exists", creds.Email, err)
+		}
+
+		if !u.Active {
+			return app.ErrUnauthenticated("user %s is deactivated", creds.Email)
+		}
+
+		if u.Password == "" {
+			return app.ErrUnauthenticated("wrong password")
+		}
+		matches, err := passwordMatches(u.Password.String(), creds.Password.String())
+		if err != nil {
+			return err
+		}
+		if !matches {
+			return app.ErrUnauthenticated("wrong password")
+		}
+
+		u.LastLogin = ptr.From(time.Now().Unix())
+		st.users[u.ID] = u
+
+		authUser = app.AuthUser{
+			ID:   u.ID,
+			Salt: u.Salt,
+		}
+		event.UserID = u.ID
+		return st.publish(app.EventLoginSucceeded, app.AggregateLogin, aggregateID, event)
+	})
+	if err != nil {
+		if app.ErrorStatus(err) != app.StatusUnauthenticated {
+			return app.AuthUser{}, err
+		}
+
+		event.Reason = app.ErrorMessage(err)
+		perr := s.write(ctx, func(st *state) error {
+			return st.publish(app.EventLoginFailed, app.AggregateLogin, aggregateID, event)
+		})
+		if perr != nil {
+			return app.AuthUser{}, perr
+		}
+		return app.AuthUser{}, err
+	}
+
+	return authUser, nil
+}
+
+// Authorize reports whether the user of the session has any of the
+// permissions. Administrators have all permissions, others have the ones
+// granted to them and to their roles. A permission granted without a
+// resource covers all resources.
+func (s *Store) Authorize(ctx context.Context, session app.Session, permissions ...app.PermissionCheck) (bool, error) {
+	var allowed bool
+	err := s.read(ctx, func(st *state) error {
+		u, err := st.findUser(app.UserFilter{ID: session.UserID()})
+		if err != nil {
+			return err
+		}
+
+		if u.IsAdmin {
+			allowed = true
+			return nil
+		}
+
+		grants := slices.Clone(u.permissions)
+		for _, id := range u.roles {
+			if r, ok := st.roles[id]; ok && r.DeletedAt == nil {
+				grants = append(grants, r.permissions...)
+			}
+		}
+
+		for _, permission := range permissions {
+			for _, grant := range grants {
+				if grant.Permission == permission.Permission &&
+					(resource(grant) == "" || resource(grant) == resource(permission)) {
+					allowed = true
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	return allowed, err
+}
@@ -0,0 +1,258 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+func (st *state) findWebhook(id string) (webhook, error) {
+	w, ok := st.webhooks[id]
+	if !ok {
+		return webhook{}, app.ErrNotFound("webhook not found with id = %s", id)
+	}
+	return w, nil
+}
+
+func copyWebhook(w webhook) app.Webhook {
+	result := w.Webhook
+	result.Events = slices.Clone(w.Events)
+	result.Modified = clonePtr(w.Modified)
+	return result
+}
+
+func (s *Store) AddWebhook(ctx context.Context, in *app.Webhook) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(st *state) error {
+		if in.ID == "" {
+			id, err := newID(in)
+			if err != nil {
+				return err
+			}
+			in.ID = id
+		}
+		if _, ok := st.webhooks[in.ID]; ok {
+			return app.ErrConflict("row already exists")
+		}
+
+		w := webhook{Webhook: *in, seq: st.nextSeq()}
+		w.Events = slices.Clone(in.Events)
+		w.Failures = 0
+		w.Created = time.Now().Unix()
+		w.Modified = nil
+		st.webhooks[w.ID] = w
+
+		created := copyWebhook(w)
+		*in = created
+
+		return st.addAudit(ctx, app.AuditWebhookCreated, app.AuditTargetWebhook, w.ID, nil, created)
+	})
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id string) (app.Webhook, error) {
+	var result app.Webhook
+	err := s.read(ctx, func(st *state) error {
+		w, err := st.findWebhook(id)
+		if err != nil {
+			return err
+		}
+		result = copyWebhook(w)
+		return nil
+	})
+	return result, err
+}
+
+// UpdateWebhook replaces the webhook settings, an empty secret keeps the
+// current one. The failure counter is reset when the webhook is activated.
+func (s *Store) UpdateWebhook(ctx context.Context, in *app.Webhook) error {
+	return s.write(ctx, func(st *state) error {
+		w, err := st.findWebhook(in.ID)
+		if err != nil {
+			return err
+		}
+		before := copyWebhook(w)
+
+		if in.Secret == "" {
+			in.Secret = w.Secret
+		}
+		if err = in.Validate(); err != nil {
+			return err
+		}
+
+		if in.Active && !w.Active {
+			w.Failures = 0
+		}
+		w.URL = in.URL
+		w.Secret = in.Secret
+		w.Events = slices.Clone(in.Events)
+		w.Active = in.Active
+		w.Modified = ptr.From(time.Now().Unix())
+		st.webhooks[w.ID] = w
+
+		updated := copyWebhook(w)
+		*in = updated
+
+		return st.addAudit(ctx, app.AuditWebhookUpdated, app.AuditTargetWebhook, w.ID, before, updated)
+	})
+}
+
+// DeleteWebhook deletes the webhook with its delivery log.
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	return s.write(ctx, func(st *state) error {
+		w, err := st.findWebhook(id)
+		if err != nil {
+			return err
+		}
+
+		delete(st.webhooks, id)
+		deliveries := make([]app.WebhookDelivery, 0, len(st.deliveries))
+		for _, delivery := range st.deliveries {
+			if delivery.WebhookID != id {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		st.deliveries = deliveries
+
+		return st.addAudit(ctx, app.AuditWebhookDeleted, app.AuditTargetWebhook, id, copyWebhook(w), nil)
+	})
+}
+
+func (s *Store) FindWebhooks(ctx context.Context) ([]app.Webhook, error) {
+	var rows []webhook
+	err := s.read(ctx, func(st *state) error {
+		for _, w := range st.webhooks {
+			rows = append(rows, w)
+		}
+		return nil
+	})
+	sortBySeq(rows, func(w webhook) int64 { return w.seq })
+
+	webhooks := make([]app.Webhook, len(rows))
+	for i, w := range rows {
+		webhooks[i] = copyWebhook(w)
+	}
+	return webhooks, err
+}
+
+// RecordWebhookResult resets the failure counter of the webhook when the
+// delivery succeeded, otherwise it increments it and deactivates the webhook
+// once the counter reaches maxFailures.
+func (s *Store) RecordWebhookResult(ctx context.Context, id string, succeeded bool, maxFailures int) (app.Webhook, error) {
+	var result app.Webhook
+	err := s.write(ctx, func(st *state) error {
+		w, err := st.findWebhook(id)
+		if err != nil {
+			return err
+		}
+
+		if succeeded {
+			w.Failures = 0
+		} else {
+			w.Failures++
+			if w.Failures >= maxFailures {
+				w.Active = false
+			}
+		}
+		st.webhooks[id] = w
+
+		result = copyWebhook(w)
+		return nil
+	})
+	return result, err
+}
+
+func (s *Store) AddWebhookDelivery(ctx context.Context, in *app.WebhookDelivery) error {
+	return s.write(ctx, func(st *state) error {
+		if _, err := st.findWebhook(in.WebhookID); err != nil {
+			return err
+		}
+
+		st.deliveryID++
+		in.ID = st.deliveryID
+		in.Created = time.Now().Unix()
+
+		st.deliveries = append(slices.Clip(st.deliveries), copyDelivery(*in))
+		return nil
+	})
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, webhookID string, id int64) (app.WebhookDelivery, error) {
+	var result app.WebhookDelivery
+	err := s.read(ctx, func(st *state) error {
+		for _, delivery := range st.deliveries {
+			if delivery.WebhookID == webhookID && delivery.ID == id {
+				result = copyDelivery(delivery)
+				return nil
+			}
+		}
+		return app.ErrNotFound("webhook delivery not found with id = %d", id)
+	})
+	return result, err
+}
+
+// FindWebhookDeliveries returns deliveries of the webhook, newest first.
+func (s *Store) FindWebhookDeliveries(ctx context.Context, filter app.WebhookDeliveryFilter) ([]app.WebhookDelivery, error) {
+	var deliveries []app.WebhookDelivery
+	err := s.read(ctx, func(st *state) error {
+		for i := len(st.deliveries) - 1; i >= 0; i-- {
+			if delivery := st.deliveries[i]; delivery.WebhookID == filter.WebhookID {
+				deliveries = append(deliveries, copyDelivery(delivery))
+			}
+		}
+		return nil
+	})
+	return page(deliveries, filter.Limit, filter.Offset), err
+}
+
+// UpdateWebhookDelivery stores the outcome of the attempt, the request and
+// the event it belongs to don't change.
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, in *app.WebhookDelivery) error {
+	return s.write(ctx, func(st *state) error {
+		i := slices.IndexFunc(st.deliveries, func(d app.WebhookDelivery) bool { return d.ID == in.ID })
+		if i < 0 {
+			return app.ErrNotFound("webhook delivery not found with id = %d", in.ID)
+		}
+
+		delivery := st.deliveries[i]
+		delivery.StatusCode = in.StatusCode
+		delivery.Error = in.Error
+		delivery.Duration = in.Duration
+		delivery.NextAttempt = clonePtr(in.NextAttempt)
+
+		deliveries := slices.Clone(st.deliveries)
+		deliveries[i] = delivery
+		st.deliveries = deliveries
+		return nil
+	})
+}
+
+// DueWebhookDeliveries returns up to limit queued deliveries due at now,
+// the longest waiting first.
+func (s *Store) DueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]app.WebhookDelivery, error) {
+	var deliveries []app.WebhookDelivery
+	err := s.read(ctx, func(st *state) error {
+		for _, delivery := range st.deliveries {
+			if delivery.NextAttempt != nil && *delivery.NextAttempt <= now {
+				deliveries = append(deliveries, copyDelivery(delivery))
+			}
+		}
+		return nil
+	})
+	slices.SortStableFunc(deliveries, func(a, b app.WebhookDelivery) int {
+		return cmp.Compare(*a.NextAttempt, *b.NextAttempt)
+	})
+	return page(deliveries, limit, 0), err
+}
+
+func copyDelivery(d app.WebhookDelivery) app.WebhookDelivery {
+	d.Request = slices.Clone(d.Request)
+	d.NextAttempt = clonePtr(d.NextAttempt)
+	return d
+}
@@ -0,0 +1,308 @@
+// Package metrics keeps metrics of the app and writes them in the Prometheus
+// text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is a label of a series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Registry holds metrics and writes them in the order they are registered,
+// it is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []func(w *Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Collect registers fn which writes metrics read when the registry is
+// written, like stats of the runtime.
+func (r *Registry) Collect(fn func(w *Writer)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, fn)
+}
+
+// Counter registers a counter, its series are told apart by values of the
+// labels.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: map[string]*counterSeries{},
+	}
+	r.Collect(c.write)
+	return c
+}
+
+// Histogram registers a histogram with the upper bounds of its buckets,
+// its series are told apart by values of the labels.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  labels,
+		series:  map[string]*histogramSeries{},
+	}
+	r.Collect(h.write)
+	return h
+}
+
+// WriteTo writes all metrics in the text exposition format.
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+
+	w := &Writer{written: map[string]bool{}}
+	for _, collect := range collectors {
+		collect(w)
+	}
+	return w.buf.WriteTo(out)
+}
+
+// ServeHTTP writes the metrics for a scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// Counter is a metric which only goes up.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+// Inc adds one to the series with the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the series with the label values, they are given in the
+// order of the labels of the counter.
+func (c *Counter) Add(v float64, values ...string) {
+	key := seriesKey(c.name, c.labels, values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: slices.Clone(values)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *Counter) write(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		w.Counter(c.name, c.help, s.value, labels(c.labels, s.values)...)
+	}
+}
+
+// Histogram counts observed values in buckets.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds v to the series with the label values, they are given in
+// the order of the labels of the histogram.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := seriesKey(h.name, h.labels, values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			values: slices.Clone(values),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		w.Histogram(h.name, h.help, HistogramValue{
+			Buckets: h.buckets,
+			Counts:  s.counts,
+			Count:   s.count,
+			Sum:     s.sum,
+		}, labels(h.labels, s.values)...)
+	}
+}
+
+// HistogramValue is a histogram read when it is written.
+type HistogramValue struct {
+	// Buckets are upper bounds, Counts are the cumulative numbers of
+	// observations in them.
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// Writer writes metrics in the text exposition format. Series of a metric
+// must be written one after another, help and type are written before the
+// first one.
+type Writer struct {
+	buf     bytes.Buffer
+	written map[string]bool
+}
+
+// Gauge writes a series of a gauge.
+func (w *Writer) Gauge(name, help string, value float64, labels ...Label) {
+	w.header(name, help, "gauge")
+	w.sample(name, value, labels)
+}
+
+// Counter writes a series of a counter.
+func (w *Writer) Counter(name, help string, value float64, labels ...Label) {
+	w.header(name, help, "counter")
+	w.sample(name, value, labels)
+}
+
+// Histogram writes a series of a histogram.
+func (w *Writer) Histogram(name, help string, h HistogramValue, labels ...Label) {
+	w.header(name, help, "histogram")
+
+	bucket := append(labels[:len(labels):len(labels)], Label{Name: "le"})
+	for i, bound := range h.Buckets {
+		bucket[len(bucket)-1].Value = formatFloat(bound)
+		w.sample(name+"_bucket", float64(h.Counts[i]), bucket)
+	}
+	bucket[len(bucket)-1].Value = "+Inf"
+	w.sample(name+"_bucket", float64(h.Count), bucket)
+	w.sample(name+"_sum", h.Sum, labels)
+	w.sample(name+"_count", float64(h.Count), labels)
+}
+
+func (w *Writer) header(name, help, typ string) {
+	if w.written[name] {
+		return
+	}
+	w.written[name] = true
+
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (w *Writer) sample(name string, value float64, labels []Label) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(label.Name)
+			w.buf.WriteString(`="`)
+			labelValueEscaper.WriteString(&w.buf, label.Value)
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(formatFloat(value))
+	w.buf.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// seriesKey joins the label values, a wrong number of them is a programming
+// error.
+func seriesKey(name string, labels, values []string) string {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", name, len(labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func labels(names, values []string) []Label {
+	labels := make([]Label, len(names))
+	for i, name := range names {
+		labels[i] = Label{Name: name, Value: values[i]}
+	}
+	return labels
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
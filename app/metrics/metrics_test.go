@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests.", "method", "path")
+	requests.Inc("GET", "/users")
+	requests.Add(2, "GET", "/users")
+	requests.Inc("POST", `/say "hi"\`+"\n")
+
+	duration := r.Histogram("duration_seconds", "Duration.", []float64{0.1, 1})
+	duration.Observe(0.05)
+	duration.Observe(0.5)
+	duration.Observe(3)
+
+	r.Collect(func(w *Writer) {
+		w.Gauge("up", "Whether it is\nup.", 1, Label{Name: "version", Value: "1"})
+		w.Gauge("limit", "Limit.", math.Inf(1))
+	})
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/users"} 3
+requests_total{method="POST",path="/say \"hi\"\\\n"} 1
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 1
+duration_seconds_bucket{le="1"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 3.55
+duration_seconds_count 3
+# HELP up Whether it is\nup.
+# TYPE up gauge
+up{version="1"} 1
+# HELP limit Limit.
+# TYPE limit gauge
+limit +Inf
+`
+	if got := out.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounter_Add(t *testing.T) {
+	c := NewRegistry().Counter("requests_total", "Requests.", "method")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Add() with a missing label value didn't panic")
+		}
+	}()
+	c.Add(1)
+}
+
+func TestWriteRuntime(t *testing.T) {
+	r := NewRegistry()
+	r.Collect(WriteBuildInfo)
+	r.Collect(WriteRuntime)
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"app_build_info{revision=", "go_goroutines ", "go_gc_cycles_total ", "go_info{version="} {
+		if !strings.Contains(out.String(), "\n"+want) {
+			t.Errorf("WriteTo() misses %q", want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"runtime"
+
+	"github.com/enverbisevac/go-project/version"
+)
+
+// WriteRuntime writes stats of the Go runtime, it is a collector for
+// Registry.Collect.
+func WriteRuntime(w *Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	w.Gauge("go_goroutines", "Number of goroutines.", float64(runtime.NumGoroutine()))
+	w.Gauge("go_gomaxprocs", "Number of CPUs running Go code at once.", float64(runtime.GOMAXPROCS(0)))
+	w.Gauge("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(stats.HeapAlloc))
+	w.Gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(stats.HeapInuse))
+	w.Gauge("go_memstats_heap_objects", "Number of allocated heap objects.", float64(stats.HeapObjects))
+	w.Gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", float64(stats.Sys))
+	w.Counter("go_memstats_mallocs_total", "Heap objects allocated.", float64(stats.Mallocs))
+	w.Counter("go_gc_cycles_total", "Completed GC cycles.", float64(stats.NumGC))
+	w.Counter("go_gc_pause_seconds_total", "Time spent in stop-the-world GC pauses.", float64(stats.PauseTotalNs)/1e9)
+	w.Gauge("go_info", "Version of Go, the value is always 1.", 1, Label{Name: "version", Value: runtime.Version()})
+}
+
+// WriteBuildInfo writes the revision the app is built from, it is a
+// collector for Registry.Collect.
+func WriteBuildInfo(w *Writer) {
+	w.Gauge("app_build_info", "Build of the app, the value is always 1.", 1,
+		Label{Name: "revision", Value: version.Get()},
+		Label{Name: "go_version", Value: runtime.Version()},
+	)
+}
@@ -13,12 +13,29 @@ const (
 	PermissionUpdateUser string = "update_user"
 	PermissionDeleteUser string = "delete_user"
 	//
+	// Personal data
+	//
+	PermissionExportUserData string = "export_user_data"
+	PermissionEraseUser      string = "erase_user"
+	//
 	// Roles
 	//
 	PermissionCreateRole string = "create_role"
 	PermissionViewRole   string = "view_role"
 	PermissionUpdateRole string = "update_role"
 	PermissionDeleteRole string = "delete_role"
+	//
+	// Audit
+	//
+	PermissionViewAudit string = "view_audit"
+	//
+	// Webhooks
+	//
+	PermissionManageWebhooks string = "manage_webhooks"
+	//
+	// System
+	//
+	PermissionViewHealth string = "view_health"
 )
 
 type PermissionCheck struct {
@@ -40,9 +57,18 @@ var Permissions = []struct {
 	{ID: PermissionViewUser, Name: "Get a user data"},
 	{ID: PermissionUpdateUser, Name: "Update a user data"},
 	{ID: PermissionDeleteUser, Name: "Delete a user"},
+	// Personal data
+	{ID: PermissionExportUserData, Name: "Export all data of a user"},
+	{ID: PermissionEraseUser, Name: "Erase personal data of a user"},
 	// Roles
 	{ID: PermissionCreateRole, Name: "Create a role"},
 	{ID: PermissionViewRole, Name: "Get role"},
 	{ID: PermissionUpdateRole, Name: "Update a role"},
 	{ID: PermissionDeleteRole, Name: "Delete a role"},
+	// Audit
+	{ID: PermissionViewAudit, Name: "View the audit log"},
+	// Webhooks
+	{ID: PermissionManageWebhooks, Name: "Manage webhooks"},
+	// System
+	{ID: PermissionViewHealth, Name: "View details of health checks"},
 }
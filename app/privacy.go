@@ -0,0 +1,43 @@
+package app
+
+// ErasedFullName replaces the full name of erased users.
+const ErasedFullName = "Erased user"
+
+// UserDataExport is all data stored about the user, it answers data subject
+// access requests.
+type UserDataExport struct {
+	Exported int64         `json:"exported"`
+	User     UserAggregate `json:"user"`
+	// Roles are the roles of the user with their permissions.
+	Roles    []RoleAggregate `json:"roles"`
+	Sessions UserSessions    `json:"sessions"`
+	// AuditEntries are the entries about the user and the ones made by
+	// the user, oldest first.
+	AuditEntries []AuditEntry `json:"audit_entries"`
+}
+
+// UserSessions describes sessions of the user. Tokens aren't stored, they
+// are signed with the salt of the user and all of them are revoked when the
+// user is erased.
+type UserSessions struct {
+	LastLogin *int64 `json:"last_login"`
+	// Logins are login events of the user kept in the outbox.
+	Logins []Event `json:"logins"`
+}
+
+// Erase replaces personal data of the user with placeholders, only the id
+// and the dates are kept. The user is deactivated and deleted, if it isn't
+// already.
+func (u *User) Erase(now int64) {
+	u.Email = Email("erased-" + u.ID + "@erased.invalid")
+	u.FullName = ErasedFullName
+	u.Active = false
+	u.IsAdmin = false
+	u.LastLogin = nil
+	u.Password = ""
+	if u.DeletedAt == nil {
+		u.DeletedAt = &now
+	}
+	u.ErasedAt = &now
+	u.Modified = &now
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// QueryStats counts database statements run on behalf of a request, it is
+// safe for concurrent use.
+type QueryStats struct {
+	queries  atomic.Int64
+	errors   atomic.Int64
+	duration atomic.Int64
+}
+
+// Add records the statement which took duration and failed with err, if not
+// nil.
+func (s *QueryStats) Add(duration time.Duration, err error) {
+	s.queries.Add(1)
+	s.duration.Add(int64(duration))
+	if err != nil {
+		s.errors.Add(1)
+	}
+}
+
+// Queries returns the number of statements run.
+func (s *QueryStats) Queries() int64 {
+	return s.queries.Load()
+}
+
+// Errors returns the number of failed statements.
+func (s *QueryStats) Errors() int64 {
+	return s.errors.Load()
+}
+
+// Duration returns the total time spent running statements.
+func (s *QueryStats) Duration() time.Duration {
+	return time.Duration(s.duration.Load())
+}
+
+type queryStatsContextKey struct{}
+
+// ContextWithQueryStats returns the copy of ctx carrying new stats, statements
+// run with the returned context are counted in them.
+func ContextWithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{}
+	return context.WithValue(ctx, queryStatsContextKey{}, stats), stats
+}
+
+// QueryStatsFromContext returns the stats stored in ctx, nil when there are
+// none.
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsContextKey{}).(*QueryStats)
+	return stats
+}
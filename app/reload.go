@@ -0,0 +1,27 @@
+package app
+
+import "context"
+
+// ConfigChange is a setting which changed when the config was reloaded.
+// Values of secrets are redacted.
+type ConfigChange struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Applied is false for settings which take effect on restart.
+	Applied bool `json:"applied"`
+}
+
+// ConfigReload is the outcome of a reload.
+type ConfigReload struct {
+	File    string         `json:"file,omitempty"`
+	Changes []ConfigChange `json:"changes"`
+}
+
+// ConfigReloader re-reads the configuration and applies the settings which
+// can change while the app runs.
+type ConfigReloader interface {
+	// Reload applies the settings together, none is applied when the
+	// configuration is invalid.
+	Reload(ctx context.Context) (ConfigReload, error)
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"html"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MatchUsers searches users without a full-text index. Every word of the
+// query must be a prefix of a word in the user full name or email, results
+// are ranked by the number of matched words.
+func MatchUsers(users []User, filter UserSearchFilter) ([]UserSearchResult, error) {
+	terms := SearchTokens(filter.Query)
+	if len(terms) == 0 {
+		return nil, ErrInvalid("search query is required")
+	}
+
+	results := make([]UserSearchResult, 0, filter.Limit)
+	for _, user := range users {
+		tokens := append(SearchTokens(user.FullName), SearchTokens(user.Email.String())...)
+		if !matchesAll(tokens, terms) {
+			continue
+		}
+
+		highlight, matches := highlightUser(user, terms)
+		results = append(results, UserSearchResult{
+			User:      user,
+			Rank:      float64(matches),
+			Highlight: highlight,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	if filter.Offset >= len(results) {
+		return results[:0], nil
+	}
+	results = results[filter.Offset:]
+	if filter.Limit < len(results) {
+		results = results[:filter.Limit]
+	}
+	return results, nil
+}
+
+// HighlightUser marks the words of the user matching the query like
+// MatchUsers. The full-text indexes find users, their highlights are built
+// here so the text is escaped.
+func HighlightUser(user User, query string) UserHighlight {
+	highlight, _ := highlightUser(user, SearchTokens(query))
+	return highlight
+}
+
+func highlightUser(user User, terms []string) (UserHighlight, int) {
+	fullName, nameMatches := highlight(user.FullName, terms)
+	email, emailMatches := highlight(user.Email.String(), terms)
+	return UserHighlight{FullName: fullName, Email: email}, nameMatches + emailMatches
+}
+
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// SearchTokens returns the lowercased words of the text, users are searched
+// by prefixes of them.
+func SearchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isTokenRune(r)
+	})
+}
+
+func matchesAny(token string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(token, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(tokens, terms []string) bool {
+	for _, term := range terms {
+		if !slices.ContainsFunc(tokens, func(token string) bool {
+			return strings.HasPrefix(token, term)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// highlight escapes the text for HTML, wraps words of it matching any of the
+// terms in <mark></mark> tags and returns the number of matched words.
+func highlight(text string, terms []string) (string, int) {
+	var (
+		b       strings.Builder
+		matches int
+		start   = -1
+	)
+
+	flush := func(end int) {
+		word := text[start:end]
+		if matchesAny(strings.ToLower(word), terms) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+			matches++
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+
+	for i, r := range text {
+		if isTokenRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			flush(i)
+		}
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+
+	return b.String(), matches
+}
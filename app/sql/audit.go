@@ -0,0 +1,236 @@
+package sql
+
+import (
+	"context"
+	"crypto/hmac"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+// auditLockID is the postgres advisory lock key held while appending to the
+// audit log, entries must be chained one at a time.
+const auditLockID = 7_203_114
+
+const selectAuditEntries = `--sql
+	SELECT
+		audit_id,
+		audit_created,
+		audit_actor_id,
+		audit_request_id,
+		audit_ip,
+		audit_action,
+		audit_target_type,
+		audit_target_id,
+		audit_changes,
+		audit_prev_hash,
+		audit_hash
+	FROM audit_log
+	`
+
+// SetAuditKey sets the key of the audit log hash chain, personal data in
+// the log is hashed with it too. It must be kept away from those who can
+// write the database, with the key they could rewrite entries and compute
+// their hashes again.
+func (db *DB) SetAuditKey(key []byte) {
+	db.auditKey = key
+}
+
+// audit appends the change of the target to the audit log, the actor is
+// taken from ctx.
+func (ds *DataSource) audit(ctx context.Context, action, targetType, targetID string, before, after any) error {
+	entry, err := app.NewAuditEntry(ctx, ds.auditKey, action, targetType, targetID, before, after)
+	if err != nil {
+		return app.ErrInternal("failed to create audit entry", err)
+	}
+	return ds.insertAuditEntry(ctx, entry)
+}
+
+// insertAuditEntry chains the entry to the last one and stores it. It must
+// run in the same transaction as the change.
+func (ds *DataSource) insertAuditEntry(ctx context.Context, entry *app.AuditEntry) error {
+	if ds.Dialect() == DialectPostgres {
+		if _, err := ds.ExecContext(ctx, `SELECT pg_advisory_xact_lock(?)`, auditLockID); err != nil {
+			return app.ErrInternal("failed to lock audit log", err)
+		}
+	}
+
+	const lastHash = `--sql
+	SELECT audit_hash
+	FROM audit_log
+	ORDER BY audit_id DESC
+	LIMIT 1
+	`
+
+	err := ds.GetContext(ctx, &entry.PrevHash, lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return app.ErrInternal("failed to get last audit entry", err)
+	}
+
+	entry.Created = time.Now().Unix()
+	if entry.Hash, err = entry.ComputeHash(ds.auditKey); err != nil {
+		return app.ErrInternal("failed to hash audit entry", err)
+	}
+
+	const query = `--sql
+	INSERT INTO audit_log (
+		audit_created,
+		audit_actor_id,
+		audit_request_id,
+		audit_ip,
+		audit_action,
+		audit_target_type,
+		audit_target_id,
+		audit_changes,
+		audit_prev_hash,
+		audit_hash
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING audit_id
+	`
+
+	err = ds.GetContext(ctx, &entry.ID, query,
+		entry.Created,
+		entry.ActorID,
+		entry.RequestID,
+		entry.IP,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.Changes,
+		entry.PrevHash,
+		entry.Hash,
+	)
+	if err != nil {
+		return app.ErrInternal("failed to insert audit entry", err)
+	}
+
+	const head = `--sql
+	INSERT INTO audit_head (head_id, head_entry_id, head_hash, head_mac)
+	VALUES (1, ?, ?, ?)
+	ON CONFLICT (head_id) DO UPDATE SET
+		head_entry_id = excluded.head_entry_id,
+		head_hash = excluded.head_hash,
+		head_mac = excluded.head_mac
+	`
+
+	_, err = ds.ExecContext(ctx, head, entry.ID, entry.Hash, app.AuditHeadMAC(ds.auditKey, entry.ID, entry.Hash))
+	if err != nil {
+		return app.ErrInternal("failed to update audit head", err)
+	}
+	return nil
+}
+
+// FindAuditEntries returns entries matching the filter, newest first.
+func (ds *DataSource) FindAuditEntries(ctx context.Context, filter app.AuditFilter) ([]app.AuditEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"audit_actor_id", filter.ActorID},
+		{"audit_action", filter.Action},
+		{"audit_target_type", filter.TargetType},
+		{"audit_target_id", filter.TargetID},
+	} {
+		if cond.value != "" {
+			where = append(where, cond.column+" = ?")
+			args = append(args, cond.value)
+		}
+	}
+	if filter.From != 0 {
+		where = append(where, "audit_created >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != 0 {
+		where = append(where, "audit_created < ?")
+		args = append(args, filter.To)
+	}
+
+	query := selectAuditEntries
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY audit_id DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	return querySQL[app.AuditEntry](ctx, ds, query, args...)
+}
+
+// auditHead is the newest entry recorded with the entries, see
+// app.AuditHeadMAC.
+type auditHead struct {
+	EntryID int64  `db:"head_entry_id"`
+	Hash    string `db:"head_hash"`
+	MAC     string `db:"head_mac"`
+}
+
+// VerifyAuditLog walks the whole audit log and checks that every entry is
+// chained to the previous one and its hash matches the content. The last
+// entry must be the recorded head, entries appended during the walk are
+// left for later checks.
+func (ds *DataSource) VerifyAuditLog(ctx context.Context) (app.AuditVerification, error) {
+	const batchSize = 500
+
+	var (
+		result   = app.AuditVerification{Valid: true}
+		head     auditHead
+		prevHash string
+		lastID   int64
+	)
+
+	err := ds.GetContext(ctx, &head, `SELECT head_entry_id, head_hash, head_mac FROM audit_head WHERE head_id = 1`)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return result, app.ErrInternal("failed to get audit head", err)
+	}
+
+	for {
+		entries, err := querySQL[app.AuditEntry](ctx, ds,
+			selectAuditEntries+" WHERE audit_id > ? AND audit_id <= ? ORDER BY audit_id LIMIT ?",
+			lastID, head.EntryID, batchSize)
+		if err != nil {
+			return result, err
+		}
+
+		for _, entry := range entries {
+			result.Entries++
+			hash, err := entry.ComputeHash(ds.auditKey)
+			if err != nil {
+				return result, app.ErrInternal("failed to hash audit entry %d", entry.ID, err)
+			}
+			if entry.PrevHash != prevHash || entry.Hash != hash {
+				id := entry.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return result, nil
+			}
+			prevHash = entry.Hash
+			lastID = entry.ID
+		}
+
+		if len(entries) < batchSize {
+			break
+		}
+	}
+
+	// without a head the log must be empty
+	if head.EntryID == 0 {
+		var n int64
+		if err = ds.GetContext(ctx, &n, `SELECT COUNT(*) FROM audit_log`); err != nil {
+			return result, app.ErrInternal("failed to count audit entries", err)
+		}
+		result.Truncated = n > 0
+	} else {
+		result.Truncated = lastID != head.EntryID || prevHash != head.Hash ||
+			!hmac.Equal([]byte(head.MAC), []byte(app.AuditHeadMAC(ds.auditKey, head.EntryID, head.Hash)))
+	}
+	result.Valid = !result.Truncated
+	result.Head = prevHash
+	return result, nil
+}
@@ -0,0 +1,259 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+func TestDB_Audit(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+	db.SetAuditKey([]byte("server held key"))
+
+	ctx := app.ContextWithAuditActor(context.Background(), app.AuditActor{
+		UserID:    "admin",
+		RequestID: "request-1",
+		IP:        "10.0.0.1",
+	})
+
+	user := &app.UserAggregate{
+		User: app.User{
+			FullName: "John Doe",
+			Email:    "john.doe@domain.com",
+			Password: "some password",
+		},
+	}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	user.FullName = "John Smith"
+	if err := db.UpdateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateUserPassword(ctx, app.UserFilter{ID: user.ID}, "other password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserPermission(ctx, user.ID, app.PermissionCheck{Permission: app.PermissionViewUser}); err != nil {
+		t.Fatal(err)
+	}
+	role := &app.RoleAggregate{
+		Role: app.Role{
+			Name: "Editors",
+		},
+	}
+	if err := db.AddRole(context.Background(), role); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteUser(ctx, app.UserFilter{ID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		filter      app.AuditFilter
+		wantActions []string
+	}{
+		{
+			name:   "changes of the user",
+			filter: app.AuditFilter{TargetType: app.AuditTargetUser, TargetID: user.ID},
+			wantActions: []string{
+				app.AuditUserDeleted,
+				app.AuditUserPermissionAdded,
+				app.AuditUserPasswordChanged,
+				app.AuditUserUpdated,
+				app.AuditUserCreated,
+			},
+		},
+		{
+			name:        "by action",
+			filter:      app.AuditFilter{Action: app.AuditRoleCreated},
+			wantActions: []string{app.AuditRoleCreated},
+		},
+		{
+			name:        "by actor",
+			filter:      app.AuditFilter{ActorID: "admin", Limit: 2},
+			wantActions: []string{app.AuditUserDeleted, app.AuditUserPermissionAdded},
+		},
+		{
+			name:        "second page",
+			filter:      app.AuditFilter{ActorID: "admin", Limit: 2, Offset: 4},
+			wantActions: []string{app.AuditUserCreated},
+		},
+		{
+			name:   "by time",
+			filter: app.AuditFilter{To: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter.Limit == 0 {
+				tt.filter.Limit = 100
+			}
+			entries, err := db.FindAuditEntries(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.wantActions) {
+				t.Fatalf("DB.FindAuditEntries() = %d entries, want %d", len(entries), len(tt.wantActions))
+			}
+			for i, entry := range entries {
+				if entry.Action != tt.wantActions[i] {
+					t.Errorf("entry %d action = %s, want %s", i, entry.Action, tt.wantActions[i])
+				}
+			}
+		})
+	}
+
+	entries, err := db.FindAuditEntries(context.Background(), app.AuditFilter{
+		Action: app.AuditUserUpdated,
+		Limit:  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := entries[0]
+	if updated.ActorID != "admin" || updated.RequestID != "request-1" || updated.IP != "10.0.0.1" {
+		t.Errorf("entry actor = %+v", updated)
+	}
+	// personal data is logged as keyed hashes
+	change, ok := updated.Changes["full_name"]
+	if !ok || !strings.HasPrefix(string(change.Before), `"hmac-sha256:`) || bytes.Equal(change.Before, change.After) ||
+		strings.Contains(string(change.After), "Smith") {
+		t.Errorf("full_name change = %s -> %s, want different hashes", change.Before, change.After)
+	}
+	if _, ok := updated.Changes["password"]; ok {
+		t.Error("password must not be logged")
+	}
+
+	got, err := db.VerifyAuditLog(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Valid || got.Entries != 6 {
+		t.Errorf("DB.VerifyAuditLog() = %+v, want 6 valid entries", got)
+	}
+
+	// entries can't be changed, not even by accident
+	if _, err = db.ExecContext(context.Background(),
+		`UPDATE audit_log SET audit_actor_id = 'someone' WHERE audit_id = ?`, updated.ID); err == nil {
+		t.Error("audit log entry updated")
+	}
+
+	// tampering without the trigger is detected
+	if _, err = db.ExecContext(context.Background(), `DROP TRIGGER trg_audit_log_no_update`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.ExecContext(context.Background(),
+		`UPDATE audit_log SET audit_actor_id = 'someone' WHERE audit_id = ?`, updated.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.VerifyAuditLog(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Valid || got.BrokenAt == nil || *got.BrokenAt != updated.ID {
+		t.Errorf("DB.VerifyAuditLog() of tampered log = %+v, want broken at %d", got, updated.ID)
+	}
+
+}
+
+func TestDB_VerifyAuditLog_key(t *testing.T) {
+	ctx := context.Background()
+	db, teardown := setupTest(t)
+	defer teardown()
+	db.SetAuditKey([]byte("server held key"))
+
+	user := &app.UserAggregate{User: app.User{FullName: "John Doe", Email: "john.doe@domain.com", Password: "some password"}}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := db.FindAuditEntries(ctx, app.AuditFilter{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// those who can write the database can change an entry and compute its
+	// hash again, but not the keyed one
+	last := entries[0]
+	last.ActorID = "someone"
+	hash, err := last.ComputeHash(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.ExecContext(ctx, `DROP TRIGGER trg_audit_log_no_update`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.ExecContext(ctx,
+		`UPDATE audit_log SET audit_actor_id = ?, audit_hash = ? WHERE audit_id = ?`, last.ActorID, hash, last.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.VerifyAuditLog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Valid || got.BrokenAt == nil || *got.BrokenAt != last.ID {
+		t.Errorf("DB.VerifyAuditLog() of rehashed log = %+v, want broken at %d", got, last.ID)
+	}
+}
+
+func TestDB_VerifyAuditLog_truncated(t *testing.T) {
+	ctx := context.Background()
+	db, teardown := setupTest(t)
+	defer teardown()
+	db.SetAuditKey([]byte("server held key"))
+
+	user := &app.UserAggregate{User: app.User{FullName: "John Doe", Email: "john.doe@domain.com", Password: "some password"}}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteUser(ctx, app.UserFilter{ID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := db.FindAuditEntries(ctx, app.AuditFilter{Limit: 2})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("FindAuditEntries() = %v, error = %v", entries, err)
+	}
+	last, prev := entries[0], entries[1]
+
+	got, err := db.VerifyAuditLog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Valid || got.Truncated || got.Head != last.Hash {
+		t.Errorf("DB.VerifyAuditLog() = %+v, want valid with head %s", got, last.Hash)
+	}
+
+	// deleting the newest entries leaves an intact chain behind the head
+	if _, err = db.ExecContext(ctx, `DROP TRIGGER trg_audit_log_no_delete`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.ExecContext(ctx, `DELETE FROM audit_log WHERE audit_id = ?`, last.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.VerifyAuditLog(ctx); err != nil || got.Valid || !got.Truncated {
+		t.Errorf("DB.VerifyAuditLog() of truncated log = %+v, error = %v, want truncated", got, err)
+	}
+
+	// the head can't be moved back without the key
+	_, err = db.ExecContext(ctx, `UPDATE audit_head SET head_entry_id = ?, head_hash = ?, head_mac = ?`,
+		prev.ID, prev.Hash, app.AuditHeadMAC(nil, prev.ID, prev.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.VerifyAuditLog(ctx); err != nil || got.Valid || !got.Truncated {
+		t.Errorf("DB.VerifyAuditLog() with forged head = %+v, error = %v, want truncated", got, err)
+	}
+
+	// nor removed while entries are left
+	if _, err = db.ExecContext(ctx, `DELETE FROM audit_head`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.VerifyAuditLog(ctx); err != nil || got.Valid || !got.Truncated {
+		t.Errorf("DB.VerifyAuditLog() without head = %+v, error = %v, want truncated", got, err)
+	}
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 
 	"github.com/enverbisevac/go-project/app"
 	"github.com/enverbisevac/go-project/pkg/ptr"
@@ -28,6 +29,11 @@ func (ds *DataSource) Authenticate(ctx context.Context, creds app.Credentials) (
 		return app.AuthUser{}, app.ErrUnauthenticated("user %s is deactivated", creds.Email)
 	}
 
+	// users without a password can't log in
+	if userCreds.Password == nil {
+		return app.AuthUser{}, app.ErrUnauthenticated("wrong password")
+	}
+
 	passwordMatches, err := passwordMatches(*userCreds.Password, creds.Password.String())
 	if err != nil {
 		return app.AuthUser{}, err
@@ -49,12 +55,65 @@ func (ds *DataSource) Authenticate(ctx context.Context, creds app.Credentials) (
 	}, nil
 }
 
+// Authenticate checks the credentials and publishes the login.succeeded
+// event with the last login change, or login.failed when the credentials
+// don't match.
+func (db *DB) Authenticate(ctx context.Context, creds app.Credentials) (app.AuthUser, error) {
+	event := app.LoginEvent{
+		Email: creds.Email.String(),
+		IP:    app.AuditActorFromContext(ctx).IP,
+	}
+	// the email index, with encryption enabled the outbox doesn't hold
+	// emails in plaintext
+	aggregateID := db.emailIndex(creds.Email.String())
+
+	var user app.AuthUser
+	err := db.inTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		if user, err = tx.Authenticate(ctx, creds); err != nil {
+			return err
+		}
+
+		event.UserID = user.ID
+		return tx.publish(ctx, app.EventLoginSucceeded, app.AggregateLogin, aggregateID, event)
+	})
+	if err != nil {
+		if app.ErrorStatus(err) != app.StatusUnauthenticated {
+			return app.AuthUser{}, err
+		}
+
+		// the failure is published after the rollback of the login
+		event.Reason = app.ErrorMessage(err)
+		if perr := db.publish(ctx, app.EventLoginFailed, app.AggregateLogin, aggregateID, event); perr != nil {
+			return app.AuthUser{}, perr
+		}
+		return app.AuthUser{}, err
+	}
+
+	return user, nil
+}
+
 func (db *DB) Authorize(ctx context.Context, session app.Session, permissions ...app.PermissionCheck) (bool, error) {
 	return db.CheckPermissions(ctx, session.UserID(), permissions...)
 }
 
-func passwordHash[T ~string](plaintextPassword T) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+// DefaultPasswordCost is the bcrypt cost of password hashes unless
+// SetPasswordCost changes it.
+const DefaultPasswordCost = 12
+
+// SetPasswordCost sets the bcrypt cost of password hashes written from now
+// on, hashes of a different cost keep matching.
+func (db *DB) SetPasswordCost(cost int) {
+	db.passwordCost.Store(int32(cost))
+}
+
+// passwordHash hashes the password with the cost, data sources made without
+// New have none and use DefaultPasswordCost.
+func passwordHash[T ~string](plaintextPassword T, cost *atomic.Int32) (string, error) {
+	c := DefaultPasswordCost
+	if cost != nil {
+		c = int(cost.Load())
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), c)
 	if err != nil {
 		return "", app.ErrInternal("hash password failed", err)
 	}
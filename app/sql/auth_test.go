@@ -0,0 +1,53 @@
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDB_SetPasswordCost(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	hashCost := func(t *testing.T, id string) int {
+		t.Helper()
+		var hash string
+		err := db.GetContext(context.Background(), &hash, "SELECT user_hashed_password FROM users WHERE user_id = ?", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cost
+	}
+
+	user := &app.User{FullName: "Default User", Email: "default@example.com", Password: "Correct-Horse-42"}
+	if err := db.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if cost := hashCost(t, user.ID); cost != DefaultPasswordCost {
+		t.Errorf("cost = %d, want %d", cost, DefaultPasswordCost)
+	}
+
+	// transactions hash with the cost of the database
+	db.SetPasswordCost(bcrypt.MinCost)
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user = &app.User{FullName: "Cheap User", Email: "cheap@example.com", Password: "Correct-Horse-42"}
+	if err = tx.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if cost := hashCost(t, user.ID); cost != bcrypt.MinCost {
+		t.Errorf("cost = %d, want %d", cost, bcrypt.MinCost)
+	}
+}
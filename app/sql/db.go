@@ -4,22 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"io/fs"
-	"sort"
+	"sync/atomic"
 	"time"
 
-	"github.com/enverbisevac/go-project/assets"
-
+	"github.com/enverbisevac/go-project/app/keyring"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const defaultTimeout = 65 * time.Second
 
+// Dialects of SQL supported by the package.
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
 type DAO interface {
 	sqlx.ExecerContext
 	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	Rebind(query string) string
+	DriverName() string
 }
 
 type DBTX interface {
@@ -30,8 +36,43 @@ type DBTX interface {
 	Close() error
 }
 
+// DataSource runs queries written with '?' placeholders, the placeholders
+// are rebound to the format of the underlying driver.
 type DataSource struct {
 	DAO
+	// keys encrypt personal data of users, nil keeps it in plaintext.
+	keys *keyring.Keyring
+	// auditKey keys the hashes of the audit log chain.
+	auditKey []byte
+	// passwordCost is the bcrypt cost of password hashes, shared with the
+	// transactions of the database.
+	passwordCost *atomic.Int32
+}
+
+func (ds *DataSource) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return ds.DAO.ExecContext(ctx, ds.Rebind(query), args...)
+}
+
+func (ds *DataSource) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return ds.DAO.SelectContext(ctx, dest, ds.Rebind(query), args...)
+}
+
+func (ds *DataSource) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return ds.DAO.GetContext(ctx, dest, ds.Rebind(query), args...)
+}
+
+// Dialect returns the SQL dialect of the underlying driver.
+func (ds *DataSource) Dialect() string {
+	return dialect(ds.DriverName())
+}
+
+func dialect(driverName string) string {
+	switch driverName {
+	case "postgres", "pgx":
+		return DialectPostgres
+	default:
+		return DialectSQLite
+	}
 }
 
 type Transaction struct {
@@ -42,14 +83,20 @@ type Transaction struct {
 type DB struct {
 	DBTX
 	*DataSource
+	metrics *QueryMetrics
 }
 
 func New(dbtx DBTX, automigrate bool) (*DB, error) {
+	metrics := newQueryMetrics()
+	passwordCost := new(atomic.Int32)
+	passwordCost.Store(DefaultPasswordCost)
 	sqlDB := &DB{
 		DBTX: dbtx,
 		DataSource: &DataSource{
-			DAO: dbtx,
+			DAO:          instrumentedDAO{DAO: contextDAO{DBTX: dbtx}, metrics: metrics},
+			passwordCost: passwordCost,
 		},
+		metrics: metrics,
 	}
 
 	if automigrate {
@@ -61,6 +108,18 @@ func New(dbtx DBTX, automigrate bool) (*DB, error) {
 	return sqlDB, nil
 }
 
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.DataSource.ExecContext(ctx, query, args...)
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.DataSource.SelectContext(ctx, dest, query, args...)
+}
+
+func (db *DB) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.DataSource.GetContext(ctx, dest, query, args...)
+}
+
 func (db *DB) Beginx() (*Transaction, error) {
 	tx, err := db.DBTX.Beginx()
 	if err != nil {
@@ -69,7 +128,10 @@ func (db *DB) Beginx() (*Transaction, error) {
 	return &Transaction{
 		Tx: tx,
 		DataSource: &DataSource{
-			DAO: tx,
+			DAO:          instrumentedDAO{DAO: tx, metrics: db.metrics},
+			keys:         db.keys,
+			auditKey:     db.auditKey,
+			passwordCost: db.passwordCost,
 		},
 	}, nil
 }
@@ -82,72 +144,23 @@ func (db *DB) BeginReadable() (*Transaction, error) {
 	return &Transaction{
 		Tx: tx,
 		DataSource: &DataSource{
-			DAO: tx,
+			DAO:          instrumentedDAO{DAO: tx, metrics: db.metrics},
+			keys:         db.keys,
+			auditKey:     db.auditKey,
+			passwordCost: db.passwordCost,
 		},
 	}, nil
 }
 
-// migrate sets up migration tracking and executes pending migration files.
-//
-// Migration files are embedded in the sqlite/migration folder and are executed
-// in lexigraphical order.
-//
-// Once a migration is run, its name is stored in the 'migrations' table so it
-// is not re-executed. Migrations run in a transaction to prevent partial
-// migrations.
+// QueryMetrics returns the metrics of statements run on the database.
+func (db *DB) QueryMetrics() *QueryMetrics {
+	return db.metrics
+}
+
+// migrate applies pending migrations, see Migrator.
 func (db *DB) migrate() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	// Ensure the 'migrations' table exists so we don't duplicate migrations.
-	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (name TEXT PRIMARY KEY);`); err != nil {
-		return fmt.Errorf("cannot create migrations table: %w", err)
-	}
-
-	// Read migration files from our embedded file system.
-	// This uses Go 1.16's 'embed' package.
-	names, err := fs.Glob(assets.MigrationFS, "migration/sqlite/*.sql")
-	if err != nil {
-		return err
-	}
-	sort.Strings(names)
-
-	// Loop over all migration files and execute them in order.
-	for _, name := range names {
-		if err := db.migrateFile(name); err != nil {
-			return fmt.Errorf("migration error: name=%q err=%w", name, err)
-		}
-	}
-	return nil
-}
-
-// migrate runs a single migration file within a transaction. On success, the
-// migration file name is saved to the "migrations" table to prevent re-running.
-func (db *DB) migrateFile(name string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Ensure migration has not already been run.
-	var n int
-	if err := tx.QueryRow(`SELECT COUNT(*) FROM migrations WHERE name = ?`, name).Scan(&n); err != nil {
-		return err
-	} else if n != 0 {
-		return nil // already run migration, skip
-	}
-
-	// Read and execute migration file.
-	if buf, err := fs.ReadFile(assets.MigrationFS, name); err != nil {
-		return err
-	} else if _, err := tx.Exec(string(buf)); err != nil {
-		return err
-	}
-
-	// Insert record into migrations to prevent re-running migration.
-	if _, err := tx.Exec(`INSERT INTO migrations (name) VALUES (?)`, name); err != nil {
-		return err
-	}
 
-	return tx.Commit()
+	return db.Migrator().Up(ctx)
 }
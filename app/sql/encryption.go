@@ -0,0 +1,471 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/keyring"
+)
+
+const (
+	columnEmail    = "user_email"
+	columnFullName = "user_full_name"
+
+	rotateBatchSize = 500
+
+	// words of encrypted users are searched by prefixes of these lengths in
+	// runes, longer query terms are cut to the longest prefix
+	minSearchPrefix = 2
+	maxSearchPrefix = 16
+)
+
+// storedUser is the user as read from the users table. KeyID is the key its
+// email and full name are encrypted with, nil when they're in plaintext.
+type storedUser struct {
+	app.User
+	KeyID *string `db:"user_key_id"`
+}
+
+// userRow is the user as written to the users table.
+type userRow struct {
+	*app.User
+	Email       string  `db:"user_email"`
+	FullName    string  `db:"user_full_name"`
+	EmailIndex  string  `db:"user_email_index"`
+	KeyID       *string `db:"user_key_id"`
+	SearchTerms *string `db:"user_search_terms"`
+}
+
+// SetKeyring enables encryption of user emails and full names, and of the
+// events and webhook deliveries which carry them. Users stored in plaintext
+// before are read as they are, but can't be found by email until they're
+// encrypted with EncryptUsers or RotateKeys.
+func (db *DB) SetKeyring(keys *keyring.Keyring) {
+	db.keys = keys
+}
+
+// emailIndex returns the blind index of the email, or the lowercased email
+// without encryption.
+func (ds *DataSource) emailIndex(email string) string {
+	email = strings.ToLower(email)
+	if ds.keys == nil {
+		return email
+	}
+	return ds.keys.BlindIndex(email)
+}
+
+// emailIndexOf is emailIndex of the optional email of a filter.
+func (ds *DataSource) emailIndexOf(email *string) *string {
+	if email == nil {
+		return nil
+	}
+	index := ds.emailIndex(*email)
+	return &index
+}
+
+// additionalData binds encrypted values to their user and column.
+func additionalData(userID, column string) string {
+	return userID + ":" + column
+}
+
+// eventAdditionalData binds encrypted payloads of events to their type and
+// aggregate, a payload moved to an event of another aggregate doesn't
+// decrypt.
+func eventAdditionalData(eventType, aggregateType, aggregateID string) string {
+	return eventType + ":" + aggregateType + ":" + aggregateID
+}
+
+// deliveryAdditionalData binds encrypted requests of webhook deliveries to
+// their event.
+func deliveryAdditionalData(eventID int64) string {
+	return strconv.FormatInt(eventID, 10)
+}
+
+// sealPayload encrypts the payload of an event or a webhook delivery when
+// encryption is enabled, they carry users. It returns the key id, nil when
+// the payload is stored in plaintext.
+func (ds *DataSource) sealPayload(payload app.EventPayload, additionalData string) (app.EventPayload, *string, error) {
+	if ds.keys == nil {
+		return payload, nil, nil
+	}
+	keyID, sealed, err := ds.keys.Encrypt(string(payload), additionalData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app.EventPayload(sealed), &keyID, nil
+}
+
+// openPayload decrypts the payload sealed by sealPayload.
+func (ds *DataSource) openPayload(payload app.EventPayload, keyID *string, additionalData string) (app.EventPayload, error) {
+	if keyID == nil {
+		return payload, nil
+	}
+	if ds.keys == nil {
+		return nil, errors.New("payload is encrypted, the key file is required")
+	}
+	plaintext, err := ds.keys.Decrypt(*keyID, string(payload), additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return app.EventPayload(plaintext), nil
+}
+
+// userRow returns the row of the user with id, the email and the full name
+// are encrypted when encryption is enabled.
+func (ds *DataSource) userRow(id string, user *app.User) (*userRow, error) {
+	row := &userRow{
+		User:       user,
+		Email:      user.Email.String(),
+		FullName:   user.FullName,
+		EmailIndex: ds.emailIndex(user.Email.String()),
+	}
+	if ds.keys == nil {
+		return row, nil
+	}
+
+	keyID, email, err := ds.keys.Encrypt(row.Email, additionalData(id, columnEmail))
+	if err != nil {
+		return nil, app.ErrInternal("failed to encrypt user %s email", id, err)
+	}
+	_, fullName, err := ds.keys.Encrypt(row.FullName, additionalData(id, columnFullName))
+	if err != nil {
+		return nil, app.ErrInternal("failed to encrypt user %s full name", id, err)
+	}
+
+	searchTerms := ds.searchTerms(user)
+	row.Email, row.FullName, row.KeyID, row.SearchTerms = email, fullName, &keyID, &searchTerms
+	return row, nil
+}
+
+// searchTerms returns the search tokens of the prefixes of the words of the
+// user, the full-text index holds them instead of the ciphertext.
+func (ds *DataSource) searchTerms(user *app.User) string {
+	var (
+		seen  = map[string]bool{}
+		terms = make([]string, 0, 32)
+	)
+	words := append(app.SearchTokens(user.FullName), app.SearchTokens(user.Email.String())...)
+	for _, word := range words {
+		runes := []rune(word)
+		for n := minSearchPrefix; n <= min(len(runes), maxSearchPrefix); n++ {
+			prefix := string(runes[:n])
+			if !seen[prefix] {
+				seen[prefix] = true
+				terms = append(terms, ds.keys.SearchToken(prefix))
+			}
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchQueryTokens returns the search tokens of the words of the query,
+// words shorter than the shortest indexed prefix are left out.
+func (ds *DataSource) searchQueryTokens(query string) []string {
+	var tokens []string
+	for _, word := range app.SearchTokens(query) {
+		runes := []rune(word)
+		if len(runes) < minSearchPrefix {
+			continue
+		}
+		tokens = append(tokens, ds.keys.SearchToken(string(runes[:min(len(runes), maxSearchPrefix)])))
+	}
+	return tokens
+}
+
+// decryptUser replaces the encrypted email and full name of the user with
+// their plaintext.
+func (ds *DataSource) decryptUser(user *storedUser) error {
+	if user.KeyID == nil {
+		return nil
+	}
+	if ds.keys == nil {
+		return app.ErrInternal("user %s is encrypted, the key file is required", user.ID)
+	}
+
+	email, err := ds.keys.Decrypt(*user.KeyID, user.Email.String(), additionalData(user.ID, columnEmail))
+	if err != nil {
+		return app.ErrInternal("failed to decrypt user %s email", user.ID, err)
+	}
+	fullName, err := ds.keys.Decrypt(*user.KeyID, user.FullName, additionalData(user.ID, columnFullName))
+	if err != nil {
+		return app.ErrInternal("failed to decrypt user %s full name", user.ID, err)
+	}
+
+	user.Email, user.FullName, user.KeyID = app.Email(email), fullName, nil
+	return nil
+}
+
+// decryptUsers returns the users with their plaintext email and full name.
+func (ds *DataSource) decryptUsers(rows []storedUser) ([]app.User, error) {
+	users := make([]app.User, len(rows))
+	for i := range rows {
+		if err := ds.decryptUser(&rows[i]); err != nil {
+			return nil, err
+		}
+		users[i] = rows[i].User
+	}
+	return users, nil
+}
+
+// RotateKeys re-encrypts users which aren't encrypted with the current key,
+// including the ones stored in plaintext, and rebuilds their email indexes
+// and search terms. Payloads of events and webhook deliveries are rotated
+// the same way. With decrypt everything is stored in plaintext again, so
+// encryption can be turned off. Rows are changed in batches, each in its own
+// transaction, and the number of changed users is returned.
+func (db *DB) RotateKeys(ctx context.Context, decrypt bool) (int64, error) {
+	return db.rotateUsers(ctx, decrypt, false)
+}
+
+// EncryptUsers encrypts the users stored in plaintext, like the ones stored
+// before encryption was enabled, so every user is found by the blind index
+// of the email, and payloads of events and webhook deliveries. It returns
+// the number of encrypted users.
+func (db *DB) EncryptUsers(ctx context.Context) (int64, error) {
+	return db.rotateUsers(ctx, false, true)
+}
+
+// rotateUsers is RotateKeys, with plaintextOnly only users stored in
+// plaintext are encrypted.
+func (db *DB) rotateUsers(ctx context.Context, decrypt, plaintextOnly bool) (int64, error) {
+	if db.keys == nil {
+		return 0, app.ErrInvalid("key file is required to rotate keys")
+	}
+
+	const selectQuery = `
+	SELECT
+		user_id,
+		user_email,
+		user_full_name,
+		user_key_id
+	FROM users
+	WHERE user_id > ?
+		AND (? AND user_key_id IS NOT NULL
+			OR NOT ? AND (user_key_id IS NULL OR user_key_id <> ?))
+		AND (NOT ? OR user_key_id IS NULL)
+	ORDER BY user_id
+	LIMIT ?
+	`
+
+	const updateQuery = `
+	UPDATE users
+	SET
+		user_email = ?,
+		user_full_name = ?,
+		user_email_index = ?,
+		user_key_id = ?,
+		user_search_terms = ?
+	WHERE user_id = ?
+	`
+
+	var (
+		rotated int64
+		lastID  string
+	)
+	for {
+		var rows []storedUser
+		err := db.inTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+			rows, err = querySQL[storedUser](ctx, tx.DataSource, selectQuery,
+				lastID, decrypt, decrypt, db.keys.CurrentID(), plaintextOnly, rotateBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for i := range rows {
+				user := &rows[i]
+				if err = tx.decryptUser(user); err != nil {
+					return err
+				}
+
+				row := &userRow{
+					User:       &user.User,
+					Email:      user.Email.String(),
+					FullName:   user.FullName,
+					EmailIndex: strings.ToLower(user.Email.String()),
+				}
+				if !decrypt {
+					if row, err = tx.userRow(user.ID, &user.User); err != nil {
+						return err
+					}
+				}
+
+				_, err = tx.ExecContext(ctx, updateQuery,
+					row.Email, row.FullName, row.EmailIndex, row.KeyID, row.SearchTerms, user.ID)
+				if err != nil {
+					if isUniqueViolation(err) {
+						return app.ErrConflict("email of user %s isn't unique", user.ID, err)
+					}
+					return app.ErrInternal("failed to rotate key of user %s", user.ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return rotated, err
+		}
+		if len(rows) > 0 {
+			lastID = rows[len(rows)-1].ID
+		}
+		rotated += int64(len(rows))
+
+		if len(rows) < rotateBatchSize {
+			break
+		}
+	}
+
+	payloads, err := db.rotatePayloads(ctx, decrypt, plaintextOnly)
+	if err != nil {
+		return rotated, err
+	}
+	if rotated == 0 && payloads == 0 {
+		return 0, nil
+	}
+
+	// the index keeps the replaced words until its segments are merged
+	if err := db.optimizeSearchIndex(ctx); err != nil {
+		return rotated, err
+	}
+
+	err = db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.audit(ctx, app.AuditKeysRotated, "", "", nil, map[string]any{
+			"users":     rotated,
+			"payloads":  payloads,
+			"key_id":    db.keys.CurrentID(),
+			"decrypted": decrypt,
+		})
+	})
+	return rotated, err
+}
+
+// payloadTable is a table of payloads sealed by sealPayload, the queries
+// select and update them in batches like the users in rotateUsers.
+type payloadTable struct {
+	name        string
+	selectQuery string
+	updateQuery string
+}
+
+var payloadTables = []payloadTable{
+	{
+		name: "event",
+		selectQuery: `
+		SELECT
+			event_id AS id,
+			event_payload AS payload,
+			event_key_id AS key_id,
+			event_type || ':' || event_aggregate_type || ':' || event_aggregate_id AS additional_data
+		FROM outbox
+		WHERE event_id > ?
+			AND (? AND event_key_id IS NOT NULL
+				OR NOT ? AND (event_key_id IS NULL OR event_key_id <> ?))
+			AND (NOT ? OR event_key_id IS NULL)
+		ORDER BY event_id
+		LIMIT ?
+		`,
+		updateQuery: `
+		UPDATE outbox
+		SET
+			event_payload = ?,
+			event_key_id = ?
+		WHERE event_id = ?
+		`,
+	},
+	{
+		name: "webhook delivery",
+		selectQuery: `
+		SELECT
+			delivery_id AS id,
+			delivery_request AS payload,
+			delivery_key_id AS key_id,
+			CAST(delivery_event_id AS TEXT) AS additional_data
+		FROM webhook_deliveries
+		WHERE delivery_id > ?
+			AND (? AND delivery_key_id IS NOT NULL
+				OR NOT ? AND (delivery_key_id IS NULL OR delivery_key_id <> ?))
+			AND (NOT ? OR delivery_key_id IS NULL)
+		ORDER BY delivery_id
+		LIMIT ?
+		`,
+		updateQuery: `
+		UPDATE webhook_deliveries
+		SET
+			delivery_request = ?,
+			delivery_key_id = ?
+		WHERE delivery_id = ?
+		`,
+	},
+}
+
+// payloadRow is a row of a payloadTable.
+type payloadRow struct {
+	ID             int64            `db:"id"`
+	Payload        app.EventPayload `db:"payload"`
+	KeyID          *string          `db:"key_id"`
+	AdditionalData string           `db:"additional_data"`
+}
+
+// rotatePayloads is rotateUsers for the payloads of events and webhook
+// deliveries, it returns the number of changed payloads.
+func (db *DB) rotatePayloads(ctx context.Context, decrypt, plaintextOnly bool) (int64, error) {
+	var rotated int64
+	for _, table := range payloadTables {
+		var lastID int64
+		for {
+			var rows []payloadRow
+			err := db.inTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+				rows, err = querySQL[payloadRow](ctx, tx.DataSource, table.selectQuery,
+					lastID, decrypt, decrypt, db.keys.CurrentID(), plaintextOnly, rotateBatchSize)
+				if err != nil {
+					return err
+				}
+
+				for _, row := range rows {
+					payload, err := tx.openPayload(row.Payload, row.KeyID, row.AdditionalData)
+					if err != nil {
+						return app.ErrInternal("failed to decrypt %s %d", table.name, row.ID, err)
+					}
+
+					var keyID *string
+					if !decrypt {
+						if payload, keyID, err = tx.sealPayload(payload, row.AdditionalData); err != nil {
+							return app.ErrInternal("failed to encrypt %s %d", table.name, row.ID, err)
+						}
+					}
+
+					if _, err = tx.ExecContext(ctx, table.updateQuery, payload, keyID, row.ID); err != nil {
+						return app.ErrInternal("failed to rotate key of %s %d", table.name, row.ID, err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return rotated, err
+			}
+			if len(rows) > 0 {
+				lastID = rows[len(rows)-1].ID
+			}
+			rotated += int64(len(rows))
+
+			if len(rows) < rotateBatchSize {
+				break
+			}
+		}
+	}
+	return rotated, nil
+}
+
+// optimizeSearchIndex merges the segments of the SQLite full-text index, the
+// words of changed and deleted users stay in its segments until then.
+// PostgreSQL drops them from the index when the table is vacuumed.
+func (ds *DataSource) optimizeSearchIndex(ctx context.Context) error {
+	if ds.Dialect() != DialectSQLite {
+		return nil
+	}
+	if _, err := ds.ExecContext(ctx, `INSERT INTO users_fts(users_fts) VALUES ('optimize')`); err != nil {
+		return app.ErrInternal("failed to optimize the search index", err)
+	}
+	return nil
+}
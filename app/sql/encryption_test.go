@@ -0,0 +1,260 @@
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/keyring"
+	"github.com/enverbisevac/go-project/app/storagetest"
+)
+
+// setupEncryptedTest is setupTest with encryption enabled, it returns the
+// path of the key file.
+func setupEncryptedTest(t *testing.T) (*DB, string) {
+	t.Helper()
+	db, teardown := setupTest(t)
+	t.Cleanup(teardown)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := keyring.Rotate(path)
+	if err != nil {
+		t.Fatalf("error creating key file, err: %v", err)
+	}
+	db.SetKeyring(keys)
+	return db, path
+}
+
+func TestDB_EncryptedStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		db, _ := setupEncryptedTest(t)
+		return db
+	})
+}
+
+// storedEmail returns the email and the key id of the user as stored.
+func storedEmail(t *testing.T, db *DB, id string) (string, *string) {
+	t.Helper()
+	var row struct {
+		Email string  `db:"user_email"`
+		KeyID *string `db:"user_key_id"`
+	}
+	err := db.GetContext(context.Background(), &row, "SELECT user_email, user_key_id FROM users WHERE user_id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return row.Email, row.KeyID
+}
+
+func TestDB_RotateKeys(t *testing.T) {
+	ctx := context.Background()
+	db, path := setupEncryptedTest(t)
+
+	if _, err := db.RotateKeys(ctx, false); err != nil {
+		t.Fatalf("RotateKeys() without users error = %v", err)
+	}
+
+	// stored before encryption was enabled
+	keys := db.keys
+	db.SetKeyring(nil)
+	plain := app.UserAggregate{User: app.User{Active: true, Email: "Ann@example.com", FullName: "Ann", Password: "secret123"}}
+	if err := db.AddUser(ctx, &plain); err != nil {
+		t.Fatal(err)
+	}
+	db.SetKeyring(keys)
+
+	encrypted := app.UserAggregate{User: app.User{Active: true, Email: "bob@example.com", FullName: "Bob", Password: "secret123"}}
+	if err := db.AddUser(ctx, &encrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	email, keyID := storedEmail(t, db, encrypted.ID)
+	if keyID == nil || *keyID != keys.CurrentID() || strings.Contains(email, "bob") {
+		t.Errorf("stored email = %q with key %v, want it encrypted with %s", email, keyID, keys.CurrentID())
+	}
+
+	// plaintext users are read, but found by email only once encrypted
+	if _, err := db.GetUser(ctx, app.UserFilter{ID: plain.ID}); err != nil {
+		t.Errorf("GetUser() of plaintext user error = %v", err)
+	}
+
+	n, err := db.RotateKeys(ctx, false)
+	if err != nil {
+		t.Fatalf("RotateKeys() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("RotateKeys() = %d, want 1", n)
+	}
+
+	user, err := db.GetUser(ctx, app.UserFilter{Email: (*string)(&plain.Email)})
+	if err != nil {
+		t.Fatalf("GetUser() by email after RotateKeys() error = %v", err)
+	}
+	if user.FullName != "Ann" {
+		t.Errorf("GetUser() full name = %q, want %q", user.FullName, "Ann")
+	}
+	if _, err = db.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: "secret123"}); err != nil {
+		t.Errorf("Authenticate() after RotateKeys() error = %v", err)
+	}
+
+	keys, err = keyring.Rotate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetKeyring(keys)
+
+	if n, err = db.RotateKeys(ctx, false); err != nil || n != 2 {
+		t.Errorf("RotateKeys() with a new key = %d, %v, want 2 users", n, err)
+	}
+	if _, keyID = storedEmail(t, db, plain.ID); keyID == nil || *keyID != keys.CurrentID() {
+		t.Errorf("stored key = %v, want %s", keyID, keys.CurrentID())
+	}
+
+	if n, err = db.RotateKeys(ctx, true); err != nil || n != 2 {
+		t.Errorf("RotateKeys() decrypt = %d, %v, want 2 users", n, err)
+	}
+	db.SetKeyring(nil)
+
+	if email, keyID = storedEmail(t, db, encrypted.ID); keyID != nil || email != "bob@example.com" {
+		t.Errorf("stored email = %q with key %v, want it in plaintext", email, keyID)
+	}
+	if _, err = db.GetUser(ctx, app.UserFilter{Email: (*string)(&encrypted.Email)}); err != nil {
+		t.Errorf("GetUser() by email after decrypt error = %v", err)
+	}
+}
+
+// indexHolds reports whether any block of the full-text index holds the
+// word, deleted words stay in the blocks until the segments are merged.
+func indexHolds(t *testing.T, db *DB, word string) bool {
+	t.Helper()
+	var n int
+	err := db.GetContext(context.Background(), &n,
+		"SELECT COUNT(*) FROM users_fts_data WHERE instr(block, CAST(? AS BLOB)) > 0", word)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestDB_EncryptUsers(t *testing.T) {
+	ctx := context.Background()
+	db, _ := setupEncryptedTest(t)
+
+	// stored before encryption was enabled
+	keys := db.keys
+	db.SetKeyring(nil)
+	ann := app.UserAggregate{User: app.User{Active: true, Email: "ann@example.com", FullName: "Ann Smith", Password: "secret123"}}
+	if err := db.AddUser(ctx, &ann); err != nil {
+		t.Fatal(err)
+	}
+	if !indexHolds(t, db, "smith") {
+		t.Fatal("search index doesn't hold the plaintext user")
+	}
+	db.SetKeyring(keys)
+
+	if n, err := db.EncryptUsers(ctx); err != nil || n != 1 {
+		t.Fatalf("EncryptUsers() = %d, %v, want 1 user", n, err)
+	}
+	if n, err := db.EncryptUsers(ctx); err != nil || n != 0 {
+		t.Errorf("EncryptUsers() again = %d, %v, want no users", n, err)
+	}
+
+	if _, err := db.GetUser(ctx, app.UserFilter{Email: (*string)(&ann.Email)}); err != nil {
+		t.Errorf("GetUser() by email of encrypted user error = %v", err)
+	}
+	for _, word := range []string{"smith", "example"} {
+		if indexHolds(t, db, word) {
+			t.Errorf("search index holds %q of the encrypted user", word)
+		}
+	}
+
+	for _, name := range []string{"Bob Smith", "Carl Smithers"} {
+		user := app.UserAggregate{User: app.User{
+			Active:   true,
+			Email:    app.Email(strings.ToLower(strings.Fields(name)[0]) + "@example.com"),
+			FullName: name,
+			Password: "secret123",
+		}}
+		if err := db.AddUser(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// encrypted users are paged by the database
+	var found []string
+	for offset := 0; offset < 4; offset += 2 {
+		page, err := db.SearchUsers(ctx, app.UserSearchFilter{Query: "smi", Limit: 2, Offset: offset})
+		if err != nil {
+			t.Fatalf("SearchUsers() error = %v", err)
+		}
+		for _, result := range page {
+			found = append(found, result.FullName)
+			if result.ID == ann.ID && result.Highlight.FullName != "Ann <mark>Smith</mark>" {
+				t.Errorf("SearchUsers() highlight = %q", result.Highlight.FullName)
+			}
+		}
+	}
+	if len(found) != 3 {
+		t.Errorf("SearchUsers() pages = %v, want 3 users", found)
+	}
+	if got, err := db.SearchUsers(ctx, app.UserSearchFilter{Query: "smithers", Limit: 10}); err != nil ||
+		len(got) != 1 || got[0].FullName != "Carl Smithers" {
+		t.Errorf("SearchUsers() of the whole word = %+v, error = %v", got, err)
+	}
+}
+
+func TestDB_EncryptedPayloads(t *testing.T) {
+	ctx := context.Background()
+	db, _ := setupEncryptedTest(t)
+
+	user := app.UserAggregate{User: app.User{Active: true, Email: "ann@example.com", FullName: "Ann", Password: "secret123"}}
+	if err := db.AddUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: "secret123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []string
+	err := db.SelectContext(ctx, &stored, "SELECT event_aggregate_id || event_payload FROM outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range stored {
+		if strings.Contains(row, "ann@example.com") {
+			t.Errorf("outbox holds the email in plaintext: %s", row)
+		}
+	}
+
+	events, err := db.PendingEvents(ctx, 0, 10)
+	if err != nil || len(events) != 2 || !strings.Contains(string(events[0].Payload), "ann@example.com") {
+		t.Fatalf("PendingEvents() = %+v, error = %v, want the decrypted events", events, err)
+	}
+
+	// a payload moved to an event of another user doesn't decrypt
+	bob := app.UserAggregate{User: app.User{Active: true, Email: "bob@example.com", FullName: "Bob", Password: "secret123"}}
+	if err = db.AddUser(ctx, &bob); err != nil {
+		t.Fatal(err)
+	}
+	const swap = `UPDATE outbox SET event_payload = (SELECT event_payload FROM outbox WHERE event_id = ?) WHERE event_id = ?`
+	if _, err = db.ExecContext(ctx, swap, events[0].ID, events[1].ID+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.PendingEvents(ctx, events[1].ID, 10); err == nil {
+		t.Error("PendingEvents() of a moved payload error = nil")
+	}
+	if _, err = db.ExecContext(ctx, `DELETE FROM outbox WHERE event_id > ?`, events[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// decrypted payloads are read without the key file
+	if _, err = db.RotateKeys(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	db.SetKeyring(nil)
+	if events, err = db.PendingEvents(ctx, 0, 10); err != nil || len(events) != 2 {
+		t.Errorf("PendingEvents() after decrypt = %+v, error = %v", events, err)
+	}
+}
@@ -0,0 +1,61 @@
+package sql
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLSTATE codes of the errors the app cares about.
+const (
+	sqlStateForeignKeyViolation  = "23503"
+	sqlStateUniqueViolation      = "23505"
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// sqlState returns the SQLSTATE code of a driver error. Drivers which don't
+// report SQLSTATE codes, like SQLite, have their errors translated to the
+// matching code. Unknown errors return an empty string.
+func sqlState(err error) string {
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState()
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return sqlStateUniqueViolation
+		case sqlite3.ErrConstraintForeignKey:
+			return sqlStateForeignKeyViolation
+		}
+	}
+
+	return ""
+}
+
+// isBusy reports whether the error is a lock conflict which may go away when
+// retried, SQLITE_BUSY, SQLITE_LOCKED of a shared cache or a PostgreSQL
+// serialization failure or deadlock.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	switch sqlState(err) {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return true
+	}
+	return false
+}
+
+func isUniqueViolation(err error) bool {
+	return sqlState(err) == sqlStateUniqueViolation
+}
+
+func isForeignKeyViolation(err error) bool {
+	return sqlState(err) == sqlStateForeignKeyViolation
+}
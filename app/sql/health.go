@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enverbisevac/go-project/app/health"
+)
+
+// checker is implemented by databases with health checks of their
+// connections, like sqlite.DB.
+type checker interface {
+	Checks() []health.Check
+}
+
+// Checks returns health checks of the connections and of the migration
+// state. The migration files are read once, when the checks are created.
+func (db *DB) Checks() []health.Check {
+	var checks []health.Check
+	if c, ok := db.DBTX.(checker); ok {
+		checks = c.Checks()
+	}
+	return append(checks, health.Check{Name: "migrations", Probe: db.migrationsProbe()})
+}
+
+// migrationsProbe returns a probe which fails when migrations are pending,
+// the schema is older than the app expects, or when applied migrations were
+// modified. It reads only the migrations table.
+func (db *DB) migrationsProbe() func(ctx context.Context) error {
+	m := db.Migrator()
+	migrations, err := m.files()
+	if err != nil {
+		return func(context.Context) error {
+			return fmt.Errorf("read migration files: %w", err)
+		}
+	}
+
+	return func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pending, modified []int64
+		for _, v := range sortedKeys(migrations) {
+			row, ok := applied[v]
+			switch {
+			case !ok:
+				pending = append(pending, v)
+			case row.Checksum != migrations[v].Checksum:
+				modified = append(modified, v)
+			}
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations are pending: %v", len(pending), pending)
+		}
+		if len(modified) > 0 {
+			return fmt.Errorf("applied migrations were modified: %v", modified)
+		}
+		return nil
+	}
+}
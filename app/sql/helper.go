@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	"time"
 
 	"github.com/enverbisevac/go-project/app"
@@ -92,11 +91,11 @@ func insertSQL[T Object](
 
 	_, err = dao.ExecContext(ctx, query, args...)
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		switch {
+		case isUniqueViolation(err):
 			return app.ErrConflict("row already exists", err)
-		}
-		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
-			return app.ErrInvalid("FOREIGN KEY constraint failed", err)
+		case isForeignKeyViolation(err):
+			return app.ErrInvalid("foreign key constraint failed", err)
 		}
 		return app.ErrInternal("failed to insert new row", err)
 	}
@@ -183,6 +182,9 @@ func updateSQL(
 
 	result, err := dao.ExecContext(ctx, query, append(args, params...)...)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return app.ErrConflict("row already exists", err)
+		}
 		return app.ErrInternal("updating failed!", err)
 	}
 
@@ -198,6 +200,47 @@ func updateSQL(
 	return nil
 }
 
+// versionError tells a missing row from a stale version when a statement
+// guarded by the version changed no rows. existsQuery counts the rows
+// matching args regardless of their version.
+func versionError(ctx context.Context, dao DAO, err error, version int64, existsQuery string, args ...any) error {
+	if version == 0 || app.ErrorStatus(err) != app.StatusNotFound {
+		return err
+	}
+
+	var n int
+	if err = dao.GetContext(ctx, &n, existsQuery, args...); err != nil {
+		return app.ErrInternal("failed to check row", err)
+	}
+	if n == 0 {
+		return app.ErrNotFound("not found")
+	}
+	return app.ErrPreconditionFailed("version %d is not current", version)
+}
+
+// diffSets returns the items of before missing from after and the items of
+// after missing from before, items are compared by their keys.
+func diffSets[T any](before, after []T, key func(T) string) (removed, added []T) {
+	keys := make(map[string]bool, len(after))
+	for _, item := range after {
+		keys[key(item)] = true
+	}
+	for _, item := range before {
+		k := key(item)
+		if !keys[k] {
+			removed = append(removed, item)
+		}
+		delete(keys, k)
+	}
+	for _, item := range after {
+		if k := key(item); keys[k] {
+			added = append(added, item)
+			delete(keys, k)
+		}
+	}
+	return removed, added
+}
+
 func deleteSQL(
 	ctx context.Context,
 	dao DAO,
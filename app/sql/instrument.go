@@ -0,0 +1,223 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/enverbisevac/go-project/app/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Operations of statements, they label query metrics.
+const (
+	OperationExec   = "exec"
+	OperationSelect = "select"
+	OperationGet    = "get"
+)
+
+// durationBuckets are upper bounds of the query duration histograms in
+// seconds.
+var durationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram holds durations of statements of an operation.
+type Histogram struct {
+	// Buckets are upper bounds in seconds, Counts are the cumulative
+	// numbers of statements which took at most as long.
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	// Sum of durations in seconds.
+	Sum float64
+	// Rows is the number of rows returned or affected.
+	Rows   uint64
+	Errors uint64
+}
+
+func (h *Histogram) observe(duration time.Duration, rows int64, err error) {
+	seconds := duration.Seconds()
+	for i, bound := range h.Buckets {
+		if seconds <= bound {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += seconds
+	h.Rows += uint64(rows)
+	if err != nil {
+		h.Errors++
+	}
+}
+
+// QueryMetrics records duration, rows and errors of every statement and logs
+// slow ones, it is safe for concurrent use.
+type QueryMetrics struct {
+	slowQuery atomic.Int64
+
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+}
+
+func newQueryMetrics() *QueryMetrics {
+	return &QueryMetrics{
+		histograms: map[string]*Histogram{},
+	}
+}
+
+// SetSlowQuery sets the duration from which statements are logged as slow,
+// 0 turns the log off.
+func (m *QueryMetrics) SetSlowQuery(threshold time.Duration) {
+	m.slowQuery.Store(int64(threshold))
+}
+
+// Histograms returns copies of the histograms by operation.
+func (m *QueryMetrics) Histograms() map[string]Histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	histograms := make(map[string]Histogram, len(m.histograms))
+	for operation, h := range m.histograms {
+		c := *h
+		c.Counts = append([]uint64(nil), h.Counts...)
+		histograms[operation] = c
+	}
+	return histograms
+}
+
+func (m *QueryMetrics) observe(ctx context.Context, operation, query string, duration time.Duration, rows int64, err error) {
+	// a missing row is an answer, not a failure
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+
+	m.mu.Lock()
+	h, ok := m.histograms[operation]
+	if !ok {
+		h = &Histogram{
+			Buckets: durationBuckets,
+			Counts:  make([]uint64, len(durationBuckets)),
+		}
+		m.histograms[operation] = h
+	}
+	h.observe(duration, rows, err)
+	m.mu.Unlock()
+
+	if stats := app.QueryStatsFromContext(ctx); stats != nil {
+		stats.Add(duration, err)
+	}
+
+	if threshold := time.Duration(m.slowQuery.Load()); threshold > 0 && duration >= threshold {
+		// the request logger carries the request id
+		logging.Ctx(ctx, logging.SQL).Warn().
+			Str("operation", operation).
+			Str("query", strings.Join(strings.Fields(query), " ")).
+			Dur("duration", duration).
+			Int64("rows", rows).
+			Err(err).
+			Msg("Slow query")
+	}
+}
+
+// instrumentedDAO runs statements with the DAO and records them in the
+// metrics.
+type instrumentedDAO struct {
+	DAO
+	metrics *QueryMetrics
+}
+
+func (d instrumentedDAO) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := d.startSpan(ctx, OperationExec, query)
+	start := time.Now()
+	result, err := d.DAO.ExecContext(ctx, query, args...)
+
+	var rows int64
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+	d.metrics.observe(ctx, OperationExec, query, time.Since(start), rows, err)
+	endSpan(span, rows, err)
+	return result, err
+}
+
+func (d instrumentedDAO) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, span := d.startSpan(ctx, OperationSelect, query)
+	start := time.Now()
+	err := d.DAO.SelectContext(ctx, dest, query, args...)
+
+	var rows int64
+	if value := reflect.ValueOf(dest); err == nil && value.Kind() == reflect.Pointer {
+		if value = value.Elem(); value.Kind() == reflect.Slice {
+			rows = int64(value.Len())
+		}
+	}
+	d.metrics.observe(ctx, OperationSelect, query, time.Since(start), rows, err)
+	endSpan(span, rows, err)
+	return err
+}
+
+func (d instrumentedDAO) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, span := d.startSpan(ctx, OperationGet, query)
+	start := time.Now()
+	err := d.DAO.GetContext(ctx, dest, query, args...)
+
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	d.metrics.observe(ctx, OperationGet, query, time.Since(start), rows, err)
+	endSpan(span, rows, err)
+	return err
+}
+
+// startSpan starts the span of a statement, see statementName.
+func (d instrumentedDAO) startSpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	ctx, span := tracing.Start(ctx, statementName(query), trace.WithSpanKind(trace.SpanKindClient))
+	// the query text is built only for spans which are exported
+	if span.IsRecording() {
+		system := semconv.DBSystemSqlite
+		if dialect(d.DriverName()) == DialectPostgres {
+			system = semconv.DBSystemPostgreSQL
+		}
+		span.SetAttributes(
+			system,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(strings.Join(strings.Fields(query), " ")),
+		)
+	}
+	return ctx, span
+}
+
+// statementName returns the first keyword of the query, like SELECT or
+// INSERT, line comments before it are skipped.
+func statementName(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		if !strings.HasPrefix(query, "--") {
+			break
+		}
+		_, query, _ = strings.Cut(query, "\n")
+	}
+	if i := strings.IndexFunc(query, unicode.IsSpace); i > 0 {
+		query = query[:i]
+	}
+	return strings.ToUpper(query)
+}
+
+func endSpan(span trace.Span, rows int64, err error) {
+	// a missing row is an answer, not a failure
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	span.SetAttributes(attribute.Int64("db.rows", rows))
+	tracing.End(span, err)
+}
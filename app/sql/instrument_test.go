@@ -0,0 +1,121 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDB_QueryMetrics(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs).With().Str("requestId", "req-1").Logger()
+	ctx, stats := app.ContextWithQueryStats(logger.WithContext(context.Background()))
+
+	db.QueryMetrics().SetSlowQuery(time.Nanosecond)
+	before := db.QueryMetrics().Histograms()
+
+	if err := db.AddRole(ctx, &app.RoleAggregate{Role: app.Role{Name: "viewer"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindRoles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.GetContext(ctx, &n, "SELECT COUNT(*) FROM missing_table"); err == nil {
+		t.Fatal("GetContext() of missing table error = nil")
+	}
+
+	if stats.Queries() < 3 || stats.Errors() != 1 || stats.Duration() <= 0 {
+		t.Errorf("stats = %d queries, %d errors in %s, want at least 3 with 1 error",
+			stats.Queries(), stats.Errors(), stats.Duration())
+	}
+
+	histograms := db.QueryMetrics().Histograms()
+	for _, operation := range []string{OperationExec, OperationSelect, OperationGet} {
+		h := histograms[operation]
+		if h.Count <= before[operation].Count || h.Counts[len(h.Counts)-1] > h.Count || h.Sum <= 0 {
+			t.Errorf("%s histogram = %+v, want new statements", operation, h)
+		}
+	}
+	if h := histograms[OperationGet]; h.Errors != before[OperationGet].Errors+1 {
+		t.Errorf("get errors = %d, want %d", h.Errors, before[OperationGet].Errors+1)
+	}
+	if h := histograms[OperationSelect]; h.Rows < before[OperationSelect].Rows+1 {
+		t.Errorf("select rows = %d, want the role counted", h.Rows)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if int64(len(lines)) != stats.Queries() {
+		t.Fatalf("logged %d slow queries, want %d", len(lines), stats.Queries())
+	}
+	last := lines[len(lines)-1]
+	for _, want := range []string{`"requestId":"req-1"`, `"query":"SELECT COUNT(*) FROM missing_table"`, `"error":`} {
+		if !strings.Contains(last, want) {
+			t.Errorf("slow query log %s, want %s", last, want)
+		}
+	}
+
+	db.QueryMetrics().SetSlowQuery(0)
+	logs.Reset()
+	if _, err := db.FindRoles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("logged %s with the slow query log off", logs.String())
+	}
+}
+
+func TestDB_spans(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, request := tracing.Start(context.Background(), "request")
+	if _, err := db.GetRole(ctx, &app.IDOrNameFilter{Name: "missing"}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Fatalf("GetRole() error = %v, want not found", err)
+	}
+	var n int
+	if err := db.GetContext(ctx, &n, "\n\tselect COUNT(*) FROM missing_table"); err == nil {
+		t.Fatal("GetContext() of missing table error = nil")
+	}
+	request.End()
+
+	ended := spans.Ended()
+	if len(ended) < 3 {
+		t.Fatalf("ended %d spans, want statements and the request", len(ended))
+	}
+	for _, span := range ended[:len(ended)-1] {
+		if span.Name() != "SELECT" || span.Parent().SpanID() != request.SpanContext().SpanID() {
+			t.Errorf("span %q parent = %s, want SELECT of the request", span.Name(), span.Parent().SpanID())
+		}
+	}
+	if status := ended[0].Status().Code; status != codes.Unset {
+		t.Errorf("span of missing row status = %v, want unset", status)
+	}
+	failed := ended[len(ended)-2]
+	if failed.Status().Code != codes.Error {
+		t.Errorf("span of failed statement status = %v, want error", failed.Status().Code)
+	}
+	for _, attr := range failed.Attributes() {
+		if attr.Key == "db.query.text" && attr.Value.AsString() != "select COUNT(*) FROM missing_table" {
+			t.Errorf("db.query.text = %q", attr.Value.AsString())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package sql
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/enverbisevac/go-project/app/metrics"
+)
+
+// poolStatter is implemented by databases reporting stats of their
+// connection pools by name, like sqlite.DB.
+type poolStatter interface {
+	PoolStats() map[string]sql.DBStats
+}
+
+// CollectMetrics writes the query metrics and stats of the connection pools,
+// it is a collector for metrics.Registry.Collect.
+func (db *DB) CollectMetrics(w *metrics.Writer) {
+	histograms := db.metrics.Histograms()
+	operations := make([]string, 0, len(histograms))
+	for operation := range histograms {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	for _, operation := range operations {
+		h := histograms[operation]
+		w.Histogram("db_query_duration_seconds", "Duration of statements.", metrics.HistogramValue{
+			Buckets: h.Buckets,
+			Counts:  h.Counts,
+			Count:   h.Count,
+			Sum:     h.Sum,
+		}, metrics.Label{Name: "operation", Value: operation})
+	}
+	for _, operation := range operations {
+		w.Counter("db_query_rows_total", "Rows returned or affected by statements.",
+			float64(histograms[operation].Rows), metrics.Label{Name: "operation", Value: operation})
+	}
+	for _, operation := range operations {
+		w.Counter("db_query_errors_total", "Statements which failed.",
+			float64(histograms[operation].Errors), metrics.Label{Name: "operation", Value: operation})
+	}
+
+	statter, ok := db.DBTX.(poolStatter)
+	if !ok {
+		return
+	}
+	pools := statter.PoolStats()
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// series of a metric are written one after another
+	write := func(fn func(stats sql.DBStats, pool metrics.Label)) {
+		for _, name := range names {
+			fn(pools[name], metrics.Label{Name: "pool", Value: name})
+		}
+	}
+	write(func(s sql.DBStats, pool metrics.Label) {
+		w.Gauge("db_pool_max_open_connections", "Maximum number of open connections.", float64(s.MaxOpenConnections), pool)
+	})
+	write(func(s sql.DBStats, pool metrics.Label) {
+		w.Gauge("db_pool_open_connections", "Open connections.", float64(s.OpenConnections), pool)
+	})
+	write(func(s sql.DBStats, pool metrics.Label) {
+		w.Gauge("db_pool_in_use_connections", "Connections in use.", float64(s.InUse), pool)
+	})
+	write(func(s sql.DBStats, pool metrics.Label) {
+		w.Gauge("db_pool_idle_connections", "Idle connections.", float64(s.Idle), pool)
+	})
+	write(func(s sql.DBStats, pool metrics.Label) {
+		w.Counter("db_pool_wait_total", "Connections waited for.", float64(s.WaitCount), pool)
+	})
+	write(func(s sql.DBStats, pool metrics.Label) {
+		w.Counter("db_pool_wait_seconds_total", "Time spent waiting for connections.", s.WaitDuration.Seconds(), pool)
+	})
+}
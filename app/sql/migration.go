@@ -0,0 +1,497 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/go-project/assets"
+	"github.com/enverbisevac/go-project/pkg/validator"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+var migrationFileRgx = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a pair of up and down scripts identified by version.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes state of a single migration in the database.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *int64
+	// Modified is set when the up script was edited after the migration
+	// was applied.
+	Modified bool
+	// Missing is set when the migration is applied but the file doesn't
+	// exist anymore.
+	Missing bool
+}
+
+type appliedMigration struct {
+	Version   int64  `db:"version"`
+	Name      string `db:"name"`
+	Checksum  string `db:"checksum"`
+	AppliedAt int64  `db:"applied_at"`
+}
+
+// Migrator applies and reverts versioned migrations. Migration files are
+// named NNNNNN_name.up.sql and NNNNNN_name.down.sql, every applied version
+// is stored in the 'migrations' table together with the checksum of its up
+// script so edits of already applied files are detected.
+type Migrator struct {
+	db   *DB
+	fsys fs.FS
+	dir  string
+
+	// DryRun prints SQL statements to Out instead of executing them.
+	DryRun bool
+	Out    io.Writer
+}
+
+// Migrator returns migrator for embedded migration files of the database
+// dialect.
+func (db *DB) Migrator() *Migrator {
+	return &Migrator{
+		db:   db,
+		fsys: assets.MigrationFS,
+		dir:  "migration/" + db.Dialect(),
+		Out:  os.Stdout,
+	}
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, -1)
+}
+
+// Down reverts the n most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	migrations, applied, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	versions := sortedKeys(applied)
+	versions = versions[len(versions)-min(max(n, 0), len(versions)):]
+	reverts, err := downMigrations(migrations, versions)
+	if err != nil {
+		return err
+	}
+	for _, migration := range reverts {
+		if err := m.revert(ctx, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Goto migrates the database up or down to the version. Negative version
+// applies all pending migrations.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	migrations, applied, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	var newer []int64
+	if version >= 0 {
+		for _, v := range sortedKeys(applied) {
+			if v > version {
+				newer = append(newer, v)
+			}
+		}
+	}
+	reverts, err := downMigrations(migrations, newer)
+	if err != nil {
+		return err
+	}
+	for _, migration := range reverts {
+		if err := m.revert(ctx, migration); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range sortedKeys(migrations) {
+		if version >= 0 && v > version {
+			break
+		}
+		if _, ok := applied[v]; ok {
+			continue
+		}
+		if err := m.apply(ctx, migrations[v]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downMigrations returns the migrations of the applied versions in the
+// order they are reverted, newest first. It fails before anything is
+// reverted if any of them can't be: without a down script the schema
+// change would stay while its version is forgotten.
+func downMigrations(migrations map[int64]Migration, versions []int64) ([]Migration, error) {
+	reverts := make([]Migration, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		migration, ok := migrations[versions[i]]
+		if !ok || isEmptyScript(migration.Down) {
+			return nil, fmt.Errorf("applied migration %d can't be reverted, its down file is missing or empty", versions[i])
+		}
+		reverts = append(reverts, migration)
+	}
+	return reverts, nil
+}
+
+// isEmptyScript reports whether the script has no statements, only blank
+// lines and comments.
+func isEmptyScript(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// Status returns state of all known migrations ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[int64]*MigrationStatus, len(migrations))
+	for v, migration := range migrations {
+		statuses[v] = &MigrationStatus{
+			Version: v,
+			Name:    migration.Name,
+		}
+	}
+
+	for v, row := range applied {
+		status, ok := statuses[v]
+		if !ok {
+			status = &MigrationStatus{
+				Version: v,
+				Name:    row.Name,
+				Missing: true,
+			}
+			statuses[v] = status
+		}
+		status.AppliedAt = &row.AppliedAt
+		status.Modified = ok && migrations[v].Checksum != row.Checksum
+	}
+
+	result := make([]MigrationStatus, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// load returns migration files and applied migrations. It fails if any of
+// the applied migrations was modified.
+func (m *Migrator) load(ctx context.Context) (map[int64]Migration, map[int64]appliedMigration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	migrations, err := m.files()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modified := make([]string, 0)
+	for v, row := range applied {
+		if migration, ok := migrations[v]; ok && migration.Checksum != row.Checksum {
+			modified = append(modified, strconv.FormatInt(v, 10))
+		}
+	}
+	if len(modified) > 0 {
+		sort.Strings(modified)
+		return nil, nil, fmt.Errorf("applied migrations were modified: %s", strings.Join(modified, ", "))
+	}
+
+	return migrations, applied, nil
+}
+
+// files reads migration files from our embedded file system.
+func (m *Migrator) files() (map[int64]Migration, error) {
+	entries, err := fs.ReadDir(m.fsys, m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[int64]Migration, len(entries)/2)
+	for _, entry := range entries {
+		matches := migrationFileRgx.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", entry.Name(), err)
+		}
+
+		buf, err := fs.ReadFile(m.fsys, path.Join(m.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration := migrations[version]
+		if migration.Name != "" && migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, migration.Name, matches[2])
+		}
+		migration.Version = version
+		migration.Name = matches[2]
+
+		switch matches[3] {
+		case "up":
+			migration.Up = string(buf)
+			migration.Checksum = checksum(buf)
+		case "down":
+			migration.Down = string(buf)
+		}
+		migrations[version] = migration
+	}
+
+	for v, migration := range migrations {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s doesn't have an up file", v, migration.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	rows := make([]appliedMigration, 0, 16)
+	err := m.db.SelectContext(ctx, &rows, `SELECT version, name, checksum, applied_at FROM migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// apply runs a single migration up file within a transaction. On success,
+// the migration version is saved to the "migrations" table to prevent
+// re-running.
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	if m.DryRun {
+		fmt.Fprintf(m.Out, "-- migrate up %06d_%s\n%s\n", migration.Version, migration.Name, migration.Up)
+		return nil
+	}
+
+	return m.exec(ctx, migration, migration.Up,
+		`INSERT INTO migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+		migration.Version, migration.Name, migration.Checksum, time.Now().Unix())
+}
+
+// revert runs a single migration down file within a transaction and removes
+// the version from the "migrations" table.
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if m.DryRun {
+		fmt.Fprintf(m.Out, "-- migrate down %06d_%s\n%s\n", migration.Version, migration.Name, migration.Down)
+		return nil
+	}
+
+	return m.exec(ctx, migration, migration.Down,
+		`DELETE FROM migrations WHERE version = ?`, migration.Version)
+}
+
+func (m *Migrator) exec(ctx context.Context, migration Migration, script, query string, args ...any) error {
+	tx, err := m.db.DBTX.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("migration error: version=%d name=%q err=%w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, m.db.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureTable creates the 'migrations' table, databases created before
+// versioned migrations only tracked file names so those are converted to
+// versions.
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	const createTable = `
+	CREATE TABLE IF NOT EXISTS migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`
+
+	columns, err := m.tableColumns(ctx, "migrations")
+	if err != nil {
+		return err
+	}
+
+	if len(columns) == 0 || validator.In("version", columns...) {
+		if _, err := m.db.ExecContext(ctx, createTable); err != nil {
+			return fmt.Errorf("cannot create migrations table: %w", err)
+		}
+		return nil
+	}
+
+	return m.convertLegacyTable(ctx, createTable)
+}
+
+func (m *Migrator) convertLegacyTable(ctx context.Context, createTable string) error {
+	names := make([]string, 0, 16)
+	if err := m.db.SelectContext(ctx, &names, `SELECT name FROM migrations`); err != nil {
+		return err
+	}
+
+	migrations, err := m.files()
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.DBTX.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{`DROP TABLE migrations`, createTable} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("cannot convert migrations table: %w", err)
+		}
+	}
+
+	for _, name := range names {
+		// legacy names are paths like migration/sqlite/000002_initial.sql
+		version, err := strconv.ParseInt(strings.SplitN(path.Base(name), "_", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid legacy migration name %q: %w", name, err)
+		}
+
+		migration, ok := migrations[version]
+		if !ok {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			m.db.Rebind(`INSERT INTO migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`),
+			migration.Version, migration.Name, migration.Checksum, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) tableColumns(ctx context.Context, table string) ([]string, error) {
+	query := `SELECT name FROM pragma_table_info(?)`
+	if m.db.Dialect() == DialectPostgres {
+		query = `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ?`
+	}
+
+	columns := make([]string, 0, 4)
+	if err := m.db.SelectContext(ctx, &columns, query, table); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// CreateMigration creates empty up and down files for a new migration in
+// dir, versioned after the latest migration found there.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.Trim(regexp.MustCompile(`\W+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var version int64
+	for _, entry := range entries {
+		matches := migrationFileRgx.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		if v, _ := strconv.ParseInt(matches[1], 10, 64); v > version {
+			version = v
+		}
+	}
+	version++
+
+	files := make([]string, 0, 2)
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, fmt.Sprintf("%06d_%s.%s.sql", version, name, direction))
+		content := fmt.Sprintf("-- %s migration for %06d_%s\n", direction, version, name)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func checksum(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedKeys[V any](m map[int64]V) []int64 {
+	keys := maps.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
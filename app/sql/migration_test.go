@@ -0,0 +1,199 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/enverbisevac/go-project/app/sql/sqlite"
+)
+
+func TestMigrator(t *testing.T) {
+	dbtx, err := sqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening db, err: %v", err)
+	}
+	db, err := New(dbtx, false)
+	if err != nil {
+		t.Fatalf("error initializing db, err: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m := db.Migrator()
+
+	applied := func() []int64 {
+		t.Helper()
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			t.Fatalf("Migrator.Status() error = %v", err)
+		}
+		versions := make([]int64, 0, len(statuses))
+		for _, status := range statuses {
+			if status.AppliedAt != nil {
+				versions = append(versions, status.Version)
+			}
+		}
+		return versions
+	}
+
+	out := &bytes.Buffer{}
+	m.DryRun, m.Out = true, out
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Migrator.Up() dry run error = %v", err)
+	}
+	if !strings.Contains(out.String(), "CREATE TABLE users") || len(applied()) != 0 {
+		t.Errorf("Migrator.Up() dry run should only print statements")
+	}
+	m.DryRun = false
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+	all := applied()
+	if len(all) < 2 {
+		t.Fatalf("Migrator.Up() applied %v", all)
+	}
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("Migrator.Down() error = %v", err)
+	}
+	if got := applied(); len(got) != len(all)-1 {
+		t.Errorf("Migrator.Down() applied %v, expected %v", got, all[:len(all)-1])
+	}
+
+	if err := m.Goto(ctx, all[0]); err != nil {
+		t.Fatalf("Migrator.Goto() error = %v", err)
+	}
+	if got := applied(); len(got) != 1 || got[0] != all[0] {
+		t.Errorf("Migrator.Goto() applied %v, expected [%d]", got, all[0])
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE migrations SET checksum = 'edited' WHERE version = ?`, all[0]); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Migrator.Status() error = %v", err)
+	}
+	if !statuses[0].Modified {
+		t.Errorf("Migrator.Status() expected modified migration %d", all[0])
+	}
+	if err := m.Down(ctx, 1); err == nil {
+		t.Errorf("Migrator.Down() expected error when applied migration is modified")
+	}
+}
+
+func TestMigrator_convertLegacyTable(t *testing.T) {
+	dbtx, err := sqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening db, err: %v", err)
+	}
+	db, err := New(dbtx, false)
+	if err != nil {
+		t.Fatalf("error initializing db, err: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for _, stmt := range []string{
+		`CREATE TABLE migrations (name TEXT PRIMARY KEY)`,
+		`INSERT INTO migrations (name) VALUES
+			('migration/sqlite/000001_initalize_schema_migrations.sql'),
+			('migration/sqlite/000002_initial.sql')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses, err := db.Migrator().Status(ctx)
+	if err != nil {
+		t.Fatalf("Migrator.Status() error = %v", err)
+	}
+	for _, status := range statuses {
+		if (status.Version == 2) != (status.AppliedAt != nil) {
+			t.Errorf("Migrator.Status() unexpected state of %d_%s", status.Version, status.Name)
+		}
+	}
+}
+
+func TestMigrator_missingDown(t *testing.T) {
+	dbtx, err := sqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening db, err: %v", err)
+	}
+	db, err := New(dbtx, false)
+	if err != nil {
+		t.Fatalf("error initializing db, err: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m := db.Migrator()
+	m.fsys = fstest.MapFS{
+		"000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"000001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"000002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"000002_b.down.sql": {Data: []byte("-- down migration for 000002_b\n")},
+		"000003_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+		"000003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	m.dir = "."
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+
+	if err := m.Goto(ctx, 1); err == nil {
+		t.Error("Migrator.Goto() reverted migration 2 without a down script")
+	}
+	if err := m.Down(ctx, 2); err == nil {
+		t.Error("Migrator.Down() reverted migration 2 without a down script")
+	}
+
+	// nothing is reverted when any of the migrations can't be
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Migrator.Status() error = %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("Migrator.Status() migration %d reverted", status.Version)
+		}
+	}
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Errorf("Migrator.Down() error = %v", err)
+	}
+}
+
+func TestDB_migrationsProbe(t *testing.T) {
+	ctx := context.Background()
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	probe := db.migrationsProbe()
+	if err := probe(ctx); err != nil {
+		t.Fatalf("probe of migrated database error = %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE migrations SET checksum = 'edited' WHERE version = 3`); err != nil {
+		t.Fatal(err)
+	}
+	if err := probe(ctx); err == nil || !strings.Contains(err.Error(), "modified: [3]") {
+		t.Errorf("probe of modified migration error = %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM migrations WHERE version = 10`); err != nil {
+		t.Fatal(err)
+	}
+	if err := probe(ctx); err == nil || !strings.Contains(err.Error(), "pending: [10]") {
+		t.Errorf("probe of pending migration error = %v", err)
+	}
+}
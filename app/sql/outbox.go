@@ -0,0 +1,121 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+)
+
+const selectEvents = `--sql
+	SELECT
+		event_id,
+		event_type,
+		event_aggregate_type,
+		event_aggregate_id,
+		event_payload,
+		event_key_id,
+		event_created
+	FROM outbox
+	`
+
+// storedEvent is the event as read from the outbox. KeyID is the key its
+// payload is encrypted with, nil when it's in plaintext.
+type storedEvent struct {
+	app.Event
+	KeyID *string `db:"event_key_id"`
+}
+
+// publish stores the event in the outbox, it must run in the same
+// transaction as the change so the event is stored only if the change is.
+func (ds *DataSource) publish(ctx context.Context, eventType, aggregateType, aggregateID string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return app.ErrInternal("failed to encode %s event", eventType, err)
+	}
+
+	sealed, keyID, err := ds.sealPayload(data, eventAdditionalData(eventType, aggregateType, aggregateID))
+	if err != nil {
+		return app.ErrInternal("failed to encrypt %s event", eventType, err)
+	}
+
+	const query = `--sql
+	INSERT INTO outbox (
+		event_type,
+		event_aggregate_type,
+		event_aggregate_id,
+		event_payload,
+		event_key_id,
+		event_created
+	) VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = ds.ExecContext(ctx, query, eventType, aggregateType, aggregateID,
+		sealed, keyID, time.Now().Unix())
+	if err != nil {
+		return app.ErrInternal("failed to store %s event", eventType, err)
+	}
+	return nil
+}
+
+// queryEvents returns the events selected by the query with their payloads
+// decrypted.
+func (ds *DataSource) queryEvents(ctx context.Context, query string, args ...any) ([]app.Event, error) {
+	rows, err := querySQL[storedEvent](ctx, ds, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]app.Event, len(rows))
+	for i, row := range rows {
+		events[i] = row.Event
+		if events[i].Payload, err = ds.openPayload(row.Payload, row.KeyID,
+			eventAdditionalData(row.Type, row.AggregateType, row.AggregateID)); err != nil {
+			return nil, app.ErrInternal("failed to decrypt event %d", row.ID, err)
+		}
+	}
+	return events, nil
+}
+
+func (ds *DataSource) PendingEvents(ctx context.Context, afterID int64, limit int) ([]app.Event, error) {
+	const query = selectEvents + `
+	WHERE event_dispatched IS NULL
+		AND event_id > ?
+	ORDER BY event_id
+	LIMIT ?
+	`
+	return ds.queryEvents(ctx, query, afterID, limit)
+}
+
+func (ds *DataSource) MarkEventsDispatched(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(`UPDATE outbox SET event_dispatched = ? WHERE event_id IN (?)`,
+		time.Now().Unix(), ids)
+	if err != nil {
+		return app.ErrInternal("failed to build query", err)
+	}
+
+	if _, err = ds.ExecContext(ctx, query, args...); err != nil {
+		return app.ErrInternal("failed to mark events dispatched", err)
+	}
+	return nil
+}
+
+// PurgeDispatchedEvents deletes events dispatched before the given time.
+func (ds *DataSource) PurgeDispatchedEvents(ctx context.Context, before time.Time) (int64, error) {
+	const query = `--sql
+	DELETE FROM outbox
+	WHERE event_dispatched < ?
+	`
+
+	result, err := ds.ExecContext(ctx, query, before.Unix())
+	if err != nil {
+		return 0, app.ErrInternal("failed to purge dispatched events", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,162 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+// sinkFunc records delivered events and fails them when fail returns true.
+type sinkFunc struct {
+	events []app.Event
+	fail   func(event app.Event) bool
+}
+
+func (s *sinkFunc) Name() string {
+	return "test"
+}
+
+func (s *sinkFunc) Publish(ctx context.Context, event app.Event) error {
+	if s.fail != nil && s.fail(event) {
+		return errors.New("sink is down")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestDB_Outbox(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	user := &app.UserAggregate{
+		User: app.User{
+			Active:   true,
+			FullName: "John Doe",
+			Email:    "john.doe@domain.com",
+			Password: "some password",
+		},
+	}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	role := &app.RoleAggregate{
+		Role: app.Role{
+			Name: "Editors",
+		},
+	}
+	if err := db.AddRole(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserRole(ctx, user.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed changes don't publish anything
+	user.Version = 1
+	if err := db.UpdateUser(ctx, user); app.ErrorStatus(err) != app.StatusPreconditionFailed {
+		t.Fatalf("DB.UpdateUser() with stale version error = %v", err)
+	}
+
+	if _, err := db.Authenticate(ctx, app.Credentials{Email: "john.doe@domain.com", Password: "wrong password"}); err == nil {
+		t.Fatal("DB.Authenticate() with wrong password succeeded")
+	}
+	if _, err := db.Authenticate(ctx, app.Credentials{Email: "john.doe@domain.com", Password: "some password"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRole(ctx, &app.IDOrNameFilter{ID: role.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := db.PendingEvents(ctx, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTypes := []string{
+		app.EventUserCreated,
+		app.EventRoleCreated,
+		app.EventUserUpdated,
+		app.EventLoginFailed,
+		app.EventLoginSucceeded,
+		app.EventRoleDeleted,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("DB.PendingEvents() = %d events, want %d", len(events), len(wantTypes))
+	}
+	for i, event := range events {
+		if event.Type != wantTypes[i] {
+			t.Errorf("event %d type = %s, want %s", i, event.Type, wantTypes[i])
+		}
+	}
+	if string(events[0].Payload) == "" || events[0].AggregateID != user.ID {
+		t.Errorf("user.created event = %+v", events[0])
+	}
+
+	tests := []struct {
+		name      string
+		fail      func(event app.Event) bool
+		wantTypes []string
+		wantLeft  int
+	}{
+		{
+			name: "role aggregate fails",
+			fail: func(event app.Event) bool {
+				return event.AggregateType == app.AggregateRole
+			},
+			wantTypes: []string{
+				app.EventUserCreated,
+				app.EventUserUpdated,
+				app.EventLoginFailed,
+				app.EventLoginSucceeded,
+			},
+			wantLeft: 2,
+		},
+		{
+			name: "role events are delivered in order",
+			wantTypes: []string{
+				app.EventRoleCreated,
+				app.EventRoleDeleted,
+			},
+		},
+		{
+			name: "nothing left",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &sinkFunc{fail: tt.fail}
+			dispatcher := app.NewDispatcher(db, app.DispatcherConfig{BatchSize: 2}, sink)
+			if err := dispatcher.Dispatch(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sink.events) != len(tt.wantTypes) {
+				t.Fatalf("delivered %d events, want %d", len(sink.events), len(tt.wantTypes))
+			}
+			for i, event := range sink.events {
+				if event.Type != tt.wantTypes[i] {
+					t.Errorf("delivered event %d type = %s, want %s", i, event.Type, tt.wantTypes[i])
+				}
+			}
+
+			left, err := db.PendingEvents(ctx, 0, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(left) != tt.wantLeft {
+				t.Errorf("pending events = %d, want %d", len(left), tt.wantLeft)
+			}
+		})
+	}
+
+	n, err := db.PurgeDispatchedEvents(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(wantTypes)) {
+		t.Errorf("DB.PurgeDispatchedEvents() = %d, want %d", n, len(wantTypes))
+	}
+}
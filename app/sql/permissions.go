@@ -5,7 +5,10 @@ import (
 	"reflect"
 
 	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/tracing"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (ds *DataSource) InsertPermission(ctx context.Context, in *app.Permission) error {
@@ -35,11 +38,23 @@ func (ds *DataSource) InsertPermission(ctx context.Context, in *app.Permission)
 func (ds *DataSource) DeletePermissions(ctx context.Context, filter app.PermissionFilter) error {
 	const query = `--sql
 	DELETE FROM permissions
-	WHERE permission_user_id = $1 OR permission_role_id = $2
+	WHERE permission_user_id = ? OR permission_role_id = ?
 	`
 	return deleteSQL(ctx, ds, query, filter.UserID, filter.RoleID)
 }
 
+// DeletePermission deletes a single user or role permission.
+func (ds *DataSource) DeletePermission(ctx context.Context, in *app.Permission) error {
+	const query = `--sql
+	DELETE FROM permissions
+	WHERE COALESCE(permission_user_id, '') = COALESCE(?, '')
+		AND COALESCE(permission_role_id, '') = COALESCE(?, '')
+		AND permission_id = ?
+		AND COALESCE(permission_resource_id, '') = COALESCE(?, '')
+	`
+	return deleteSQL(ctx, ds, query, in.UserID, in.RoleID, in.PermissionID, in.ResourceID)
+}
+
 func (ds *DataSource) GetPermissions(
 	ctx context.Context,
 	filters ...app.PermissionFilter,
@@ -83,10 +98,10 @@ func (ds *DataSource) GetPermissions(
 		permission_resource_id,
 		permission_created
 	FROM permissions
-	WHERE ` + field + ` in ($1)
+	WHERE ` + field + ` IN (?)
 	`
 
-	query, args, err := sqlx.In(query, value...)
+	query, args, err := sqlx.In(query, value)
 	if err != nil {
 		return nil, err
 	}
@@ -98,17 +113,62 @@ func (ds *DataSource) GetPermissions(
 	return permissions, nil
 }
 
+// hasPermission reports whether permissions contain the permission check
+// with the same resource, no resource is the same as an empty one.
+func hasPermission(permissions []app.Permission, check app.PermissionCheck) bool {
+	for _, p := range permissions {
+		if p.PermissionID == check.Permission && resourceID(p.ResourceID) == resourceID(check.ResourceID) {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionKey identifies the permission check, a check without a resource
+// is the same as one with an empty resource.
+func permissionKey(p app.PermissionCheck) string {
+	return p.Permission + "\x00" + resourceID(p.ResourceID)
+}
+
+// grants reports whether the permission covers the check, a permission
+// without a resource covers all resources.
+func grants(p app.Permission, check app.PermissionCheck) bool {
+	if p.PermissionID != check.Permission {
+		return false
+	}
+	resource := resourceID(p.ResourceID)
+	return resource == "" || resource == resourceID(check.ResourceID)
+}
+
+func resourceID(id *string) string {
+	if id == nil {
+		return ""
+	}
+	return *id
+}
+
 func (db *DB) CheckPermissions(ctx context.Context, userID string, permissions ...app.PermissionCheck) (bool, error) {
+	ctx, span := tracing.Start(ctx, "sql.CheckPermissions", trace.WithAttributes(
+		attribute.String("user.id", userID),
+		attribute.Int("permissions", len(permissions)),
+	))
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	tx, err := db.Beginx()
-	if err != nil {
-		return false, err
-	}
-	defer tx.Rollback()
+	var allowed bool
+	err := db.inReadTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		allowed, err = tx.checkPermissions(ctx, userID, permissions...)
+		return err
+	})
+	span.SetAttributes(attribute.Bool("allowed", allowed))
+	tracing.End(span, err)
+	return allowed, err
+}
 
-	user, err := tx.GetUser(ctx, app.UserFilter{
+// checkPermissions reports whether the user, its roles or admin rights grant
+// all the permissions.
+func (ds *DataSource) checkPermissions(ctx context.Context, userID string, permissions ...app.PermissionCheck) (bool, error) {
+	user, err := ds.GetUser(ctx, app.UserFilter{
 		ID: userID,
 	})
 	if err != nil {
@@ -119,14 +179,14 @@ func (db *DB) CheckPermissions(ctx context.Context, userID string, permissions .
 		return true, nil
 	}
 
-	permChecks, err := tx.GetPermissions(ctx, app.PermissionFilter{
+	permChecks, err := ds.GetPermissions(ctx, app.PermissionFilter{
 		UserID: user.ID,
 	})
 	if err != nil {
 		return false, err
 	}
 
-	userRoles, err := tx.GetUserRoles(ctx, user.ID)
+	userRoles, err := ds.GetUserRoles(ctx, user.ID)
 	if err != nil {
 		return false, err
 	}
@@ -136,35 +196,34 @@ func (db *DB) CheckPermissions(ctx context.Context, userID string, permissions .
 		rolesIDs[i] = role.RoleID
 	}
 
-	roles, err := tx.FindRoles(ctx, rolesIDs...)
-	if err != nil {
-		return false, err
-	}
+	// without ids all roles are found, users without roles have only their
+	// own permissions
+	if len(rolesIDs) > 0 {
+		roles, err := ds.FindRoles(ctx, rolesIDs...)
+		if err != nil {
+			return false, err
+		}
 
-	args := make([]app.PermissionFilter, len(roles))
-	for i, role := range roles {
-		args[i] = app.PermissionFilter{
-			RoleID: role.ID,
+		args := make([]app.PermissionFilter, len(roles))
+		for i, role := range roles {
+			args[i] = app.PermissionFilter{
+				RoleID: role.ID,
+			}
 		}
-	}
 
-	perms, err := tx.GetPermissions(ctx, args...)
-	if err != nil {
-		return false, err
-	}
+		perms, err := ds.GetPermissions(ctx, args...)
+		if err != nil {
+			return false, err
+		}
 
-	permChecks = append(permChecks, perms...)
+		permChecks = append(permChecks, perms...)
+	}
 
 	for _, permission := range permissions {
 		for _, pc := range permChecks {
-			if pc.PermissionID != permission.Permission {
-				continue
-			}
-			if permission.ResourceID != nil && *permission.ResourceID != "" &&
-				pc.ResourceID == nil || *pc.ResourceID != *permission.ResourceID {
-				continue
+			if grants(pc, permission) {
+				return true, nil
 			}
-			return true, nil
 		}
 	}
 	return false, nil
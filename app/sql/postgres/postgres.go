@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/enverbisevac/go-project/app/health"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// DriverName is the database/sql driver used for PostgreSQL connections.
+const DriverName = "pgx"
+
+type DB struct {
+	*sqlx.DB
+}
+
+func New(dsn string) (*DB, error) {
+	db, err := sqlx.Connect(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{
+		DB: db,
+	}, nil
+}
+
+func (d *DB) Beginx() (*sqlx.Tx, error) {
+	return d.DB.Beginx()
+}
+
+func (d *DB) BeginReadable() (*sqlx.Tx, error) {
+	return d.DB.BeginTxx(context.Background(), &sql.TxOptions{
+		ReadOnly: true,
+	})
+}
+
+// PoolStats returns stats of the connection pool.
+func (db *DB) PoolStats() map[string]sql.DBStats {
+	return map[string]sql.DBStats{
+		"default": db.DB.Stats(),
+	}
+}
+
+// Checks returns the health check of the connection pool.
+func (db *DB) Checks() []health.Check {
+	return []health.Check{
+		{Name: "postgres", Probe: db.DB.PingContext},
+	}
+}
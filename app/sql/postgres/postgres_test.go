@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+// testDSN returns data source name of the database used in tests. It uses
+// POSTGRES_TEST_DSN when set, otherwise it starts an ephemeral PostgreSQL
+// cluster if initdb and pg_ctl are found in PATH. Test is skipped when no
+// database is available.
+func testDSN(t *testing.T) string {
+	t.Helper()
+
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		t.Skip("postgres is not available, set POSTGRES_TEST_DSN or add initdb to PATH")
+	}
+	pgctl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		t.Skip("postgres is not available, set POSTGRES_TEST_DSN or add pg_ctl to PATH")
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "--auth=trust").CombinedOutput()
+	if err != nil {
+		t.Fatalf("initdb failed: %v\n%s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = exec.Command(pgctl, "start", "-w", "-D", data, "-l", filepath.Join(dir, "postgres.log"),
+		"-o", fmt.Sprintf("-p %d -k %s -c listen_addresses=''", port, dir)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("pg_ctl start failed: %v\n%s", err, out)
+	}
+	t.Cleanup(func() {
+		exec.Command(pgctl, "stop", "-m", "immediate", "-D", data).Run()
+	})
+
+	return fmt.Sprintf("host=%s port=%d user=postgres dbname=postgres sslmode=disable", dir, port)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func setupTest(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dbtx, err := New(testDSN(t))
+	if err != nil {
+		t.Fatalf("Error opening db, err: %v", err)
+	}
+
+	// start every test with an empty schema
+	for _, stmt := range []string{
+		"DROP SCHEMA public CASCADE",
+		"CREATE SCHEMA public",
+	} {
+		if _, err := dbtx.Exec(stmt); err != nil {
+			t.Fatalf("error resetting schema, err: %v", err)
+		}
+	}
+
+	db, err := sql.New(dbtx, true)
+	if err != nil {
+		t.Fatalf("error initializing db, err: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestDB(t *testing.T) {
+	db := setupTest(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	role := &app.RoleAggregate{
+		Role: app.Role{Name: "Editors"},
+		Permissions: []app.PermissionCheck{
+			{Permission: app.PermissionViewUser},
+		},
+	}
+	if err := db.AddRole(ctx, role); err != nil {
+		t.Fatalf("DB.AddRole() error = %v", app.SourceError(err))
+	}
+
+	user := &app.UserAggregate{
+		User: app.User{
+			Active:   true,
+			FullName: "John Doe",
+			Email:    "john.doe@domain.com",
+			Password: "some password",
+		},
+		Roles: []string{role.ID},
+		Permissions: []app.PermissionCheck{
+			{Permission: app.PermissionUpdateUser, ResourceID: ptr.From("self")},
+		},
+	}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatalf("DB.AddUser() error = %v", app.SourceError(err))
+	}
+
+	got, err := db.GetUser(ctx, app.UserFilter{Email: ptr.From("JOHN.DOE@domain.com")})
+	if err != nil {
+		t.Fatalf("DB.GetUser() error = %v", app.SourceError(err))
+	}
+	if got.ID != user.ID || len(got.Roles) != 1 || len(got.Permissions) != 1 {
+		t.Errorf("DB.GetUser() unexpected user %+v", got)
+	}
+
+	duplicate := &app.UserAggregate{
+		User: app.User{
+			FullName: "John Doe",
+			Email:    "John.Doe@domain.com",
+			Password: "some password",
+		},
+	}
+	if err := db.AddUser(ctx, duplicate); app.ErrorStatus(err) != app.StatusConflict {
+		t.Errorf("DB.AddUser() with duplicate email error = %v, expected conflict", err)
+	}
+
+	unknownRole := &app.UserAggregate{
+		User: app.User{
+			FullName: "Jane Roe",
+			Email:    "jane@domain.com",
+			Password: "some password",
+		},
+		Roles: []string{"unknown"},
+	}
+	if err := db.AddUser(ctx, unknownRole); app.ErrorStatus(err) != app.StatusInvalid {
+		t.Errorf("DB.AddUser() with unknown role error = %v, expected invalid", err)
+	}
+
+	results, err := db.SearchUsers(ctx, app.UserSearchFilter{Query: "joh do", Limit: 10})
+	if err != nil {
+		t.Fatalf("DB.SearchUsers() error = %v", app.SourceError(err))
+	}
+	if len(results) != 1 || results[0].ID != user.ID {
+		t.Errorf("DB.SearchUsers() unexpected results %+v", results)
+	}
+
+	role.Name = "Writers"
+	role.Version = 1
+	if err := db.UpdateRole(ctx, role, app.IDOrNameFilter{ID: role.ID}); err != nil {
+		t.Fatalf("DB.UpdateRole() error = %v", app.SourceError(err))
+	}
+	if role.Version != 2 {
+		t.Errorf("DB.UpdateRole() version = %d, expected 2", role.Version)
+	}
+
+	role.Version = 1
+	err = db.UpdateRole(ctx, role, app.IDOrNameFilter{ID: role.ID})
+	if app.ErrorStatus(err) != app.StatusPreconditionFailed {
+		t.Errorf("DB.UpdateRole() with stale version error = %v, expected precondition failed", err)
+	}
+
+	if err := db.DeleteUser(ctx, app.UserFilter{ID: user.ID}); err != nil {
+		t.Fatalf("DB.DeleteUser() error = %v", app.SourceError(err))
+	}
+	if _, err := db.GetUser(ctx, app.UserFilter{ID: user.ID}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.GetUser() after delete error = %v, expected not found", err)
+	}
+}
@@ -0,0 +1,274 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/enverbisevac/go-project/app"
+	"github.com/goccy/go-json"
+)
+
+// getUserData returns the user with id, deleted or not. Erased users have
+// no data left and aren't found.
+func (ds *DataSource) getUserData(ctx context.Context, id string) (*app.User, error) {
+	query := selectUsers + `
+	WHERE user_id = ?
+		AND user_erased_at IS NULL
+	`
+
+	user := &storedUser{}
+	if err := ds.GetContext(ctx, user, query, id); err != nil {
+		return nil, wrapError(err, "user", "id = %s", id)
+	}
+	if err := ds.decryptUser(user); err != nil {
+		return nil, err
+	}
+	return &user.User, nil
+}
+
+// loginEvents returns the login events of the email still in the outbox.
+func (ds *DataSource) loginEvents(ctx context.Context, email app.Email) ([]app.Event, error) {
+	const query = selectEvents + `
+	WHERE event_aggregate_type = ?
+		AND event_aggregate_id = ?
+	ORDER BY event_id
+	`
+	return ds.queryEvents(ctx, query, app.AggregateLogin, ds.emailIndex(email.String()))
+}
+
+// ExportUserData returns all data stored about the user, deleted users are
+// exported too. The data is read in a read-only transaction, the export is
+// then recorded in the audit log.
+func (db *DB) ExportUserData(ctx context.Context, id string) (app.UserDataExport, error) {
+	var data app.UserDataExport
+	err := db.inReadTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		data, err = tx.exportUserData(ctx, id)
+		return err
+	})
+	if err != nil {
+		return app.UserDataExport{}, err
+	}
+
+	// the data itself isn't logged, it is what the log must not spread
+	err = db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.audit(ctx, app.AuditUserDataExported, app.AuditTargetUser, id, nil, nil)
+	})
+	if err != nil {
+		return app.UserDataExport{}, err
+	}
+	return data, nil
+}
+
+func (ds *DataSource) exportUserData(ctx context.Context, id string) (app.UserDataExport, error) {
+	user, err := ds.getUserData(ctx, id)
+	if err != nil {
+		return app.UserDataExport{}, err
+	}
+
+	aggregate, err := ds.userAggregate(ctx, user)
+	if err != nil {
+		return app.UserDataExport{}, err
+	}
+
+	roles := make([]app.RoleAggregate, len(aggregate.Roles))
+	for i, roleID := range aggregate.Roles {
+		if roles[i], err = ds.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: roleID}); err != nil {
+			return app.UserDataExport{}, err
+		}
+	}
+
+	const auditQuery = selectAuditEntries + `
+	WHERE audit_target_type = ? AND audit_target_id = ?
+		OR audit_actor_id = ?
+	ORDER BY audit_id
+	`
+	entries, err := querySQL[app.AuditEntry](ctx, ds, auditQuery, app.AuditTargetUser, id, id)
+	if err != nil {
+		return app.UserDataExport{}, err
+	}
+
+	logins, err := ds.loginEvents(ctx, user.Email)
+	if err != nil {
+		return app.UserDataExport{}, err
+	}
+
+	return app.UserDataExport{
+		Exported: time.Now().Unix(),
+		User:     aggregate,
+		Roles:    roles,
+		Sessions: app.UserSessions{
+			LastLogin: user.LastLogin,
+			Logins:    logins,
+		},
+		AuditEntries: entries,
+	}, nil
+}
+
+// EraseUser irreversibly replaces personal data of the user with
+// placeholders, see app.User.Erase. The row is kept so audit entries still
+// refer to it, roles and permissions are removed and tokens of the user
+// revoked. Personal data is scrubbed from events and webhook deliveries and
+// purged from the search index. Entries of the audit log are kept as they
+// are, they hold only keyed hashes of the email and full name. PostgreSQL
+// drops the old row versions once the table is vacuumed.
+func (db *DB) EraseUser(ctx context.Context, id string) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		user, err := tx.getUserData(ctx, id)
+		if err != nil {
+			return err
+		}
+		email := user.Email
+
+		user.Erase(time.Now().Unix())
+		user.Version++
+
+		// a new salt revokes tokens of the user
+		const query = `
+		UPDATE users
+		SET
+			user_active = ?,
+			user_is_admin = ?,
+			user_email = ?,
+			user_full_name = ?,
+			user_email_index = ?,
+			user_key_id = NULL,
+			user_search_terms = NULL,
+			user_last_login = NULL,
+			user_hashed_password = NULL,
+			user_salt = ?,
+			user_deleted_at = ?,
+			user_erased_at = ?,
+			user_modified = ?,
+			user_version = user_version + 1
+		WHERE user_id = ?
+		`
+		err = updateSQL(ctx, tx.DataSource, query,
+			user.Active,
+			user.IsAdmin,
+			user.Email,
+			user.FullName,
+			tx.emailIndex(user.Email.String()),
+			uniuri.NewLen(uniuri.UUIDLen),
+			user.DeletedAt,
+			user.ErasedAt,
+			user.Modified,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = tx.DeleteUserRoles(ctx, id)
+		if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
+			return err
+		}
+		err = tx.DeletePermissions(ctx, app.PermissionFilter{UserID: id})
+		if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
+			return err
+		}
+
+		// the index keeps the replaced words until its segments are merged
+		if err = tx.optimizeSearchIndex(ctx); err != nil {
+			return err
+		}
+
+		erased := app.UserAggregate{
+			User:        *user,
+			Permissions: []app.PermissionCheck{},
+			Roles:       []string{},
+		}
+		if err = tx.scrubEvents(ctx, erased, email); err != nil {
+			return err
+		}
+
+		// nothing about the user is logged, the entry only records the erasure
+		err = tx.audit(ctx, app.AuditUserErased, app.AuditTargetUser, id, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		return tx.publish(ctx, app.EventUserErased, app.AggregateUser, id, erased)
+	})
+}
+
+// scrubEvents replaces payloads of the events of the erased user, and of
+// webhook deliveries of those events, with ones without personal data. email
+// is the email of the user before the erasure.
+func (ds *DataSource) scrubEvents(ctx context.Context, erased app.UserAggregate, email app.Email) error {
+	const userEventsQuery = selectEvents + `
+	WHERE event_aggregate_type = ?
+		AND event_aggregate_id = ?
+	`
+	events, err := ds.queryEvents(ctx, userEventsQuery, app.AggregateUser, erased.ID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(erased)
+	if err != nil {
+		return app.ErrInternal("failed to encode erased user %s", erased.ID, err)
+	}
+	for i := range events {
+		events[i].Payload = payload
+	}
+
+	logins, err := ds.loginEvents(ctx, email)
+	if err != nil {
+		return err
+	}
+	for _, event := range logins {
+		var login app.LoginEvent
+		if err = json.Unmarshal(event.Payload, &login); err != nil {
+			return app.ErrInternal("failed to decode event %d", event.ID, err)
+		}
+		login.Email = erased.Email.String()
+		login.IP = ""
+		if event.Payload, err = json.Marshal(login); err != nil {
+			return app.ErrInternal("failed to encode event %d", event.ID, err)
+		}
+		event.AggregateID = ds.emailIndex(login.Email)
+		events = append(events, event)
+	}
+
+	for _, event := range events {
+		additionalData := eventAdditionalData(event.Type, event.AggregateType, event.AggregateID)
+		payload, keyID, err := ds.sealPayload(event.Payload, additionalData)
+		if err != nil {
+			return app.ErrInternal("failed to encrypt event %d", event.ID, err)
+		}
+
+		const query = `--sql
+		UPDATE outbox
+		SET
+			event_aggregate_id = ?,
+			event_payload = ?,
+			event_key_id = ?
+		WHERE event_id = ?
+		`
+		if _, err = ds.ExecContext(ctx, query, event.AggregateID, payload, keyID, event.ID); err != nil {
+			return app.ErrInternal("failed to scrub event %d", event.ID, err)
+		}
+
+		// deliveries hold the request body, which is the event
+		request, err := json.Marshal(event)
+		if err != nil {
+			return app.ErrInternal("failed to encode event %d", event.ID, err)
+		}
+		if request, keyID, err = ds.sealPayload(request, deliveryAdditionalData(event.ID)); err != nil {
+			return app.ErrInternal("failed to encrypt deliveries of event %d", event.ID, err)
+		}
+		const deliveriesQuery = `--sql
+		UPDATE webhook_deliveries
+		SET
+			delivery_request = ?,
+			delivery_key_id = ?
+		WHERE delivery_event_id = ?
+		`
+		_, err = ds.ExecContext(ctx, deliveriesQuery, app.EventPayload(request), keyID, event.ID)
+		if err != nil {
+			return app.ErrInternal("failed to scrub deliveries of event %d", event.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/goccy/go-json"
+)
+
+func TestDB_EraseUser(t *testing.T) {
+	ctx := context.Background()
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ann := app.UserAggregate{User: app.User{Active: true, Email: "Ann@example.com", FullName: "Ann Smith", Password: "Xq9!long-pass"}}
+	if err := db.AddUser(ctx, &ann); err != nil {
+		t.Fatal(err)
+	}
+	ann.FullName = "Ann Smithson"
+	if err := db.UpdateUser(ctx, &ann); err != nil {
+		t.Fatal(err)
+	}
+	ctx = app.ContextWithAuditActor(ctx, app.AuditActor{IP: "192.0.2.1"})
+	if _, err := db.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: "Xq9!long-pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := app.Webhook{URL: "https://example.com/hooks", Secret: "0123456789abcdef", Active: true}
+	if err := db.AddWebhook(ctx, &webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := db.PendingEvents(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		request, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.AddWebhookDelivery(ctx, &app.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Attempt:   1,
+			Request:   request,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = db.EraseUser(ctx, ann.ID); err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+
+	var stored []string
+	err = db.SelectContext(ctx, &stored, `
+	SELECT event_aggregate_id || event_payload FROM outbox
+	UNION ALL
+	SELECT delivery_request FROM webhook_deliveries
+	UNION ALL
+	SELECT user_email || user_full_name || user_salt FROM users
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2*len(events)+2 {
+		t.Errorf("stored rows = %d, want %d", len(stored), 2*len(events)+2)
+	}
+	for _, value := range stored {
+		for _, personal := range []string{"ann@example.com", "Smith", "192.0.2.1", ann.Salt} {
+			if strings.Contains(strings.ToLower(value), strings.ToLower(personal)) {
+				t.Errorf("stored %s, want %q erased", value, personal)
+			}
+		}
+	}
+
+	// the audit log holds hashes and the search index no words of the user
+	var changes []string
+	if err = db.SelectContext(ctx, &changes, "SELECT audit_changes FROM audit_log"); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range changes {
+		for _, personal := range []string{"ann@example.com", "Smith"} {
+			if strings.Contains(strings.ToLower(value), strings.ToLower(personal)) {
+				t.Errorf("audit log holds %s, want %q erased", value, personal)
+			}
+		}
+	}
+	for _, word := range []string{"smith", "smithson"} {
+		if indexHolds(t, db, word) {
+			t.Errorf("search index holds %q of the erased user", word)
+		}
+	}
+	var terms int
+	err = db.GetContext(ctx, &terms, "SELECT COUNT(*) FROM users_fts_idx WHERE instr(term, CAST('smith' AS BLOB)) > 0")
+	if err != nil || terms != 0 {
+		t.Errorf("search index segments start with the erased words %d times, error = %v", terms, err)
+	}
+
+	verification, err := db.VerifyAuditLog(ctx)
+	if err != nil || !verification.Valid {
+		t.Errorf("VerifyAuditLog() = %+v, %v, want the chain intact", verification, err)
+	}
+}
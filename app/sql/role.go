@@ -2,6 +2,7 @@ package sql
 
 import (
 	"context"
+	"time"
 
 	"github.com/enverbisevac/go-project/app"
 	"github.com/jmoiron/sqlx"
@@ -13,6 +14,8 @@ const (
 		role_id,
 		role_created,
 		role_modified,
+		role_version,
+		role_deleted_at,
 		role_name
 	FROM roles
 	`
@@ -38,7 +41,8 @@ func (ds *DataSource) InsertRole(ctx context.Context, in *app.Role) error {
 
 func (ds *DataSource) getRole(ctx context.Context, filter *app.IDOrNameFilter) (*app.Role, error) {
 	const query = selectRoles + `
-	WHERE role_id = $1 OR LOWER(role_name) = LOWER($2)
+	WHERE (role_id = ? OR LOWER(role_name) = LOWER(?))
+		AND role_deleted_at IS NULL
 	`
 	role, err := getSQL[app.Role](ctx,
 		ds,
@@ -56,15 +60,17 @@ func (ds *DataSource) FindRoles(ctx context.Context, ids ...string) ([]app.Role,
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	query := selectRoles
+	var (
+		query = selectRoles + " WHERE role_deleted_at IS NULL "
+		args  []any
+		err   error
+	)
 
 	if len(ids) > 0 {
-		query += " WHERE role_id in ($1) "
-	}
-
-	query, args, err := sqlx.In(query, ToSliceOfAny(ids)...)
-	if err != nil {
-		return nil, err
+		query, args, err = sqlx.In(query+" AND role_id IN (?) ", ids)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var roles []app.Role
@@ -83,39 +89,121 @@ func (ds *DataSource) UpdateRole(ctx context.Context, role *app.Role, filter app
 	const query = `--sql
 	UPDATE roles
 	SET
-		role_id,
-		role_created,
-		role_modified,
-		role_name
-	WHERE role_id = $1 OR LOWER(role_name) = LOWER($2)
+		role_modified = :role_modified,
+		role_version = role_version + 1,
+		role_name = :role_name
+	WHERE (:role_version = 0 OR role_version = :role_version)
+		AND role_deleted_at IS NULL
+		AND (role_id = ? OR LOWER(role_name) = LOWER(?))
 	`
 
-	return updateSQL(ctx, ds, query, filter.ID, filter.Name)
+	err := updateSQL(ctx, ds, query, role, filter.ID, filter.Name)
+	return versionError(ctx, ds, err, role.Version, `
+	SELECT COUNT(*) FROM roles
+	WHERE (role_id = ? OR LOWER(role_name) = LOWER(?)) AND role_deleted_at IS NULL
+	`, filter.ID, filter.Name)
 }
 
+// DeleteRole marks the role as deleted, the role is kept until purged and
+// can be restored until then.
 func (ds *DataSource) DeleteRole(ctx context.Context, filter *app.IDOrNameFilter) error {
 	const query = `--sql
-	DELETE FROM roles
-	WHERE role_id = $1 OR LOWER(role_name) = LOWER($2)
+	UPDATE roles
+	SET
+		role_deleted_at = ?,
+		role_version = role_version + 1
+	WHERE (role_id = ? OR LOWER(role_name) = LOWER(?))
+		AND (? = 0 OR role_version = ?)
+		AND role_deleted_at IS NULL
 	`
-	return deleteSQL(ctx, ds, query, filter.ID, filter.Name)
+	err := updateSQL(ctx, ds, query, time.Now().Unix(), filter.ID, filter.Name, filter.Version, filter.Version)
+	return versionError(ctx, ds, err, filter.Version, `
+	SELECT COUNT(*) FROM roles
+	WHERE (role_id = ? OR LOWER(role_name) = LOWER(?)) AND role_deleted_at IS NULL
+	`, filter.ID, filter.Name)
 }
 
-func (db *DB) AddRole(ctx context.Context, in *app.RoleAggregate) error {
-	tx, err := db.Beginx()
+// RestoreRole undoes DeleteRole. When filtered by name the most recently
+// deleted role with that name is restored.
+func (ds *DataSource) RestoreRole(ctx context.Context, filter *app.IDOrNameFilter) error {
+	const selectQuery = `--sql
+	SELECT role_id, role_version
+	FROM roles
+	WHERE (role_id = ? OR LOWER(role_name) = LOWER(?))
+		AND role_deleted_at IS NOT NULL
+	ORDER BY role_deleted_at DESC
+	LIMIT 1
+	`
+
+	deleted, err := getSQL[app.Role](ctx, ds, selectQuery, filter.ID, filter.Name)
 	if err != nil {
-		return err
+		return wrapError(err, "deleted role", "%s", filter.String())
+	}
+	if filter.Version != 0 && filter.Version != deleted.Version {
+		return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+	}
+
+	const query = `--sql
+	UPDATE roles
+	SET
+		role_deleted_at = NULL,
+		role_modified = ?,
+		role_version = role_version + 1
+	WHERE role_id = ?
+	`
+
+	return updateSQL(ctx, ds, query, time.Now().Unix(), deleted.ID)
+}
+
+// purgeRoles permanently deletes roles deleted before the unix time, their
+// permissions and assignments are removed by the foreign keys.
+func (ds *DataSource) purgeRoles(ctx context.Context, before int64) (int64, error) {
+	const query = `--sql
+	DELETE FROM roles
+	WHERE role_deleted_at < ?
+	`
+
+	result, err := ds.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, app.ErrInternal("failed to purge deleted roles", err)
+	}
+	return result.RowsAffected()
+}
+
+// touchRole increments the role version, it is used when permissions of the
+// role change.
+func (ds *DataSource) touchRole(ctx context.Context, id string) error {
+	const query = `--sql
+	UPDATE roles
+	SET
+		role_modified = ?,
+		role_version = role_version + 1
+	WHERE role_id = ?
+		AND role_deleted_at IS NULL
+	`
+	err := updateSQL(ctx, ds, query, time.Now().Unix(), id)
+	if app.ErrorStatus(err) == app.StatusNotFound {
+		return app.ErrNotFound("role not found with id = %s", id)
 	}
+	return err
+}
 
-	defer tx.Rollback()
+func (db *DB) AddRole(ctx context.Context, in *app.RoleAggregate) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.addRoleAggregate(ctx, in)
+	})
+}
 
-	if err := tx.InsertRole(ctx, &in.Role); err != nil {
+// addRoleAggregate stores the role with its permissions.
+func (ds *DataSource) addRoleAggregate(ctx context.Context, in *app.RoleAggregate) error {
+	err := ds.InsertRole(ctx, &in.Role)
+	if err != nil {
 		return err
 	}
 
 	// add user permissions
 	for _, permission := range in.Permissions {
-		err = tx.InsertPermission(ctx, &app.Permission{
+		err = ds.InsertPermission(ctx, &app.Permission{
 			RoleID:       &in.ID,
 			PermissionID: permission.Permission,
 			ResourceID:   permission.ResourceID,
@@ -124,32 +212,49 @@ func (db *DB) AddRole(ctx context.Context, in *app.RoleAggregate) error {
 			return err
 		}
 	}
-	return tx.Commit()
+
+	created, err := ds.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: in.ID})
+	if err != nil {
+		return err
+	}
+
+	err = ds.audit(ctx, app.AuditRoleCreated, app.AuditTargetRole, in.ID, nil, created)
+	if err != nil {
+		return err
+	}
+
+	return ds.publish(ctx, app.EventRoleCreated, app.AggregateRole, in.ID, created)
 }
 
 func (db *DB) UpdateRole(ctx context.Context, in *app.RoleAggregate, filter app.IDOrNameFilter) error {
-	tx, err := db.Beginx()
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.updateRoleAggregate(ctx, in, filter)
+	})
+}
+
+// updateRoleAggregate updates the role and replaces its permissions.
+func (ds *DataSource) updateRoleAggregate(ctx context.Context, in *app.RoleAggregate, filter app.IDOrNameFilter) error {
+	before, err := ds.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: filter.ID, Name: filter.Name})
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	err = tx.UpdateRole(ctx, &in.Role, filter)
+	err = ds.UpdateRole(ctx, &in.Role, filter)
 	if err != nil {
 		return err
 	}
 
 	// delete user permissions
-	err = tx.DeletePermissions(ctx, app.PermissionFilter{
+	err = ds.DeletePermissions(ctx, app.PermissionFilter{
 		RoleID: in.ID,
 	})
-	if err != nil {
+	if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
 		return err
 	}
 
 	// add user permissions
 	for _, permission := range in.Permissions {
-		err = tx.InsertPermission(ctx, &app.Permission{
+		err = ds.InsertPermission(ctx, &app.Permission{
 			RoleID:       &in.ID,
 			PermissionID: permission.Permission,
 			ResourceID:   permission.ResourceID,
@@ -159,22 +264,38 @@ func (db *DB) UpdateRole(ctx context.Context, in *app.RoleAggregate, filter app.
 		}
 	}
 
-	return tx.Commit()
-}
+	// read back the stored row for the new version
+	updated, err := ds.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: in.ID})
+	if err != nil {
+		return err
+	}
+	in.Role = updated.Role
 
-func (db *DB) GetRole(ctx context.Context, filter *app.IDOrNameFilter) (app.RoleAggregate, error) {
-	tx, err := db.BeginReadable()
+	err = ds.audit(ctx, app.AuditRoleUpdated, app.AuditTargetRole, in.ID, before, updated)
 	if err != nil {
-		return app.RoleAggregate{}, err
+		return err
 	}
-	defer tx.Rollback()
 
-	role, err := tx.getRole(ctx, filter)
+	return ds.publish(ctx, app.EventRoleUpdated, app.AggregateRole, in.ID, updated)
+}
+
+func (db *DB) GetRole(ctx context.Context, filter *app.IDOrNameFilter) (app.RoleAggregate, error) {
+	var role app.RoleAggregate
+	err := db.inReadTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		role, err = tx.getRoleAggregate(ctx, filter)
+		return err
+	})
+	return role, err
+}
+
+// getRoleAggregate returns the role with its permissions.
+func (ds *DataSource) getRoleAggregate(ctx context.Context, filter *app.IDOrNameFilter) (app.RoleAggregate, error) {
+	role, err := ds.getRole(ctx, filter)
 	if err != nil {
 		return app.RoleAggregate{}, err
 	}
 
-	permissions, err := tx.GetPermissions(ctx, app.PermissionFilter{
+	permissions, err := ds.GetPermissions(ctx, app.PermissionFilter{
 		RoleID: role.ID,
 	})
 	if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
@@ -196,28 +317,129 @@ func (db *DB) GetRole(ctx context.Context, filter *app.IDOrNameFilter) (app.Role
 }
 
 func (db *DB) DeleteRole(ctx context.Context, filter *app.IDOrNameFilter) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		role, err := tx.getRoleAggregate(ctx, filter)
+		if err != nil {
+			return err
+		}
 
-	role, err := tx.getRole(ctx, filter)
-	if err != nil {
-		return err
-	}
+		if filter.Version != 0 && filter.Version != role.Version {
+			return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+		}
 
-	err = tx.DeletePermissions(ctx, app.PermissionFilter{
-		RoleID: role.ID,
+		// permissions and assignments are kept, so they come back on restore
+		err = tx.DeleteRole(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		err = tx.audit(ctx, app.AuditRoleDeleted, app.AuditTargetRole, role.ID, role, nil)
+		if err != nil {
+			return err
+		}
+
+		return tx.publish(ctx, app.EventRoleDeleted, app.AggregateRole, role.ID, role)
+	})
+}
+
+// AddRolePermission grants the permission to the role, granting a permission
+// the role already has does nothing.
+func (db *DB) AddRolePermission(ctx context.Context, roleID string, permission app.PermissionCheck) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: roleID})
+		if err != nil {
+			return err
+		}
+
+		permissions, err := tx.GetPermissions(ctx, app.PermissionFilter{
+			RoleID: roleID,
+		})
+		if err != nil {
+			return err
+		}
+		if hasPermission(permissions, permission) {
+			return nil
+		}
+
+		if err = tx.touchRole(ctx, roleID); err != nil {
+			return err
+		}
+
+		err = tx.InsertPermission(ctx, &app.Permission{
+			RoleID:       &roleID,
+			PermissionID: permission.Permission,
+			ResourceID:   permission.ResourceID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.roleChanged(ctx, app.AuditRolePermissionAdded, before)
+	})
+}
+
+// RemoveRolePermission revokes the permission from the role.
+func (db *DB) RemoveRolePermission(ctx context.Context, roleID string, permission app.PermissionCheck) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: roleID})
+		if err != nil {
+			return err
+		}
+
+		if err = tx.touchRole(ctx, roleID); err != nil {
+			return err
+		}
+
+		err = tx.DeletePermission(ctx, &app.Permission{
+			RoleID:       &roleID,
+			PermissionID: permission.Permission,
+			ResourceID:   permission.ResourceID,
+		})
+		if err != nil {
+			if app.ErrorStatus(err) == app.StatusNotFound {
+				return app.ErrNotFound("role %s doesn't have permission %s", roleID, permission.Permission)
+			}
+			return err
+		}
+
+		return tx.roleChanged(ctx, app.AuditRolePermissionRemoved, before)
 	})
+}
+
+// RestoreRole brings back the role deleted with DeleteRole, as long as it
+// isn't purged yet.
+func (db *DB) RestoreRole(ctx context.Context, filter *app.IDOrNameFilter) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		if err := tx.RestoreRole(ctx, filter); err != nil {
+			return err
+		}
+
+		// only the restored role can be found with the filter
+		restored, err := tx.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: filter.ID, Name: filter.Name})
+		if err != nil {
+			return err
+		}
+
+		err = tx.audit(ctx, app.AuditRoleRestored, app.AuditTargetRole, restored.ID, nil, restored)
+		if err != nil {
+			return err
+		}
+
+		return tx.publish(ctx, app.EventRoleRestored, app.AggregateRole, restored.ID, restored)
+	})
+}
+
+// roleChanged logs the action on the role and publishes the role.updated
+// event, before is the role as it was before the change.
+func (ds *DataSource) roleChanged(ctx context.Context, action string, before app.RoleAggregate) error {
+	after, err := ds.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: before.ID})
 	if err != nil {
 		return err
 	}
 
-	err = tx.DeleteRole(ctx, filter)
-	if err != nil {
+	if err = ds.audit(ctx, action, app.AuditTargetRole, before.ID, before, after); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	return ds.publish(ctx, app.EventRoleUpdated, app.AggregateRole, before.ID, after)
 }
@@ -0,0 +1,250 @@
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+func TestDB_UpdateRole_Version(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	role := &app.RoleAggregate{
+		Role: app.Role{
+			Name: "Editors",
+		},
+		Permissions: []app.PermissionCheck{
+			{Permission: app.PermissionViewUser},
+		},
+	}
+	if err := db.AddRole(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := db.GetRole(ctx, &app.IDOrNameFilter{ID: role.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != 1 {
+		t.Fatalf("new role version = %d, want 1", stored.Version)
+	}
+
+	tests := []struct {
+		name        string
+		version     int64
+		wantStatus  app.Status
+		wantVersion int64
+	}{
+		{
+			name:        "current version",
+			version:     1,
+			wantVersion: 2,
+		},
+		{
+			name:       "stale version",
+			version:    1,
+			wantStatus: app.StatusPreconditionFailed,
+		},
+		{
+			name:        "without version",
+			version:     0,
+			wantVersion: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &app.RoleAggregate{
+				Role: app.Role{
+					ID:      role.ID,
+					Name:    "Editors " + tt.name,
+					Version: tt.version,
+				},
+				Permissions: role.Permissions,
+			}
+			err := db.UpdateRole(ctx, in, app.IDOrNameFilter{ID: role.ID})
+			if status := app.ErrorStatus(err); status != tt.wantStatus {
+				t.Fatalf("DB.UpdateRole() error = %v, want status %q", err, tt.wantStatus)
+			}
+			if err != nil {
+				return
+			}
+			if in.Version != tt.wantVersion {
+				t.Errorf("DB.UpdateRole() version = %d, want %d", in.Version, tt.wantVersion)
+			}
+		})
+	}
+
+	err = db.DeleteRole(ctx, &app.IDOrNameFilter{ID: role.ID, Version: 2})
+	if app.ErrorStatus(err) != app.StatusPreconditionFailed {
+		t.Errorf("DB.DeleteRole() with stale version error = %v", err)
+	}
+
+	if err = db.DeleteRole(ctx, &app.IDOrNameFilter{ID: role.ID, Version: 3}); err != nil {
+		t.Errorf("DB.DeleteRole() with current version error = %v", err)
+	}
+
+	// a role deleted after it was read isn't found, whatever its version
+	err = db.DataSource.UpdateRole(ctx, &app.Role{Name: "Editors", Version: 3}, app.IDOrNameFilter{ID: role.ID})
+	if app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DataSource.UpdateRole() of deleted role error = %v, want not found", err)
+	}
+}
+
+func TestDB_RolePermissions(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	role := &app.RoleAggregate{
+		Role: app.Role{
+			Name: "Editors",
+		},
+	}
+	if err := db.AddRole(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+
+	resourceID := "user-1"
+	tests := []struct {
+		name        string
+		remove      bool
+		permission  app.PermissionCheck
+		wantStatus  app.Status
+		wantVersion int64
+		wantCount   int
+	}{
+		{
+			name:        "add permission",
+			permission:  app.PermissionCheck{Permission: app.PermissionViewUser},
+			wantVersion: 2,
+			wantCount:   1,
+		},
+		{
+			name:        "add same permission again",
+			permission:  app.PermissionCheck{Permission: app.PermissionViewUser},
+			wantVersion: 2,
+			wantCount:   1,
+		},
+		{
+			name:        "add permission on resource",
+			permission:  app.PermissionCheck{Permission: app.PermissionViewUser, ResourceID: &resourceID},
+			wantVersion: 3,
+			wantCount:   2,
+		},
+		{
+			name:        "remove permission on resource",
+			remove:      true,
+			permission:  app.PermissionCheck{Permission: app.PermissionViewUser, ResourceID: &resourceID},
+			wantVersion: 4,
+			wantCount:   1,
+		},
+		{
+			name:        "remove missing permission",
+			remove:      true,
+			permission:  app.PermissionCheck{Permission: app.PermissionDeleteUser},
+			wantStatus:  app.StatusNotFound,
+			wantVersion: 4,
+			wantCount:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.remove {
+				err = db.RemoveRolePermission(ctx, role.ID, tt.permission)
+			} else {
+				err = db.AddRolePermission(ctx, role.ID, tt.permission)
+			}
+			if status := app.ErrorStatus(err); status != tt.wantStatus {
+				t.Fatalf("error = %v, want status %q", err, tt.wantStatus)
+			}
+
+			got, err := db.GetRole(ctx, &app.IDOrNameFilter{ID: role.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != tt.wantVersion {
+				t.Errorf("role version = %d, want %d", got.Version, tt.wantVersion)
+			}
+			if len(got.Permissions) != tt.wantCount {
+				t.Errorf("role permissions = %v, want %d", got.Permissions, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestDB_SoftDeleteRole(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	role := &app.RoleAggregate{
+		Role: app.Role{
+			Name: "Editors",
+		},
+		Permissions: []app.PermissionCheck{
+			{Permission: app.PermissionViewUser},
+		},
+	}
+	if err := db.AddRole(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+	user := &app.UserAggregate{
+		User: app.User{
+			FullName: "John Doe",
+			Email:    "john.doe@domain.com",
+			Password: "some password",
+		},
+	}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserRole(ctx, user.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteRole(ctx, &app.IDOrNameFilter{ID: role.ID}); err != nil {
+		t.Fatalf("DB.DeleteRole() error = %v", err)
+	}
+	if _, err := db.GetRole(ctx, &app.IDOrNameFilter{Name: "editors"}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.GetRole() of deleted role error = %v", err)
+	}
+	got, err := db.GetUser(ctx, app.UserFilter{ID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Roles) != 0 {
+		t.Errorf("user roles = %v, deleted role must be hidden", got.Roles)
+	}
+	if err = db.AddUserRole(ctx, user.ID, role.ID); app.ErrorStatus(err) != app.StatusInvalid {
+		t.Errorf("DB.AddUserRole() with deleted role error = %v", err)
+	}
+
+	if err = db.RestoreRole(ctx, &app.IDOrNameFilter{ID: role.ID}); err != nil {
+		t.Fatalf("DB.RestoreRole() error = %v", err)
+	}
+	restored, err := db.GetRole(ctx, &app.IDOrNameFilter{ID: role.ID})
+	if err != nil {
+		t.Fatalf("DB.GetRole() of restored role error = %v", err)
+	}
+	if restored.Version != 3 || len(restored.Permissions) != 1 {
+		t.Errorf("restored role = %+v, want version 3 with 1 permission", restored)
+	}
+	if got, err = db.GetUser(ctx, app.UserFilter{ID: user.ID}); err != nil || len(got.Roles) != 1 {
+		t.Errorf("user roles after restore = %v, err = %v", got.Roles, err)
+	}
+
+	if err = db.DeleteRole(ctx, &app.IDOrNameFilter{ID: role.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.PurgeDeleted(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("DB.PurgeDeleted() = %d, %v, want 1", n, err)
+	}
+	if err = db.RestoreRole(ctx, &app.IDOrNameFilter{ID: role.ID}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.RestoreRole() of purged role error = %v", err)
+	}
+}
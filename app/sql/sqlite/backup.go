@@ -0,0 +1,285 @@
+package sqlite
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+const (
+	backupPrefix     = "backup-"
+	backupTimeFormat = "20060102T150405Z"
+	gzipExt          = ".gz"
+)
+
+// BackupTo writes a consistent snapshot of the database to path while the
+// database is in use, a path ending with .gz is compressed. The snapshot is
+// checked for integrity before it is moved to path.
+func (db *DB) BackupTo(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup %s already exists", path)
+	}
+
+	tmp, err := tempPath(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	// VACUUM INTO reads the database in a single transaction
+	if _, err = db.ReadableDB.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		return fmt.Errorf("vacuum into %s: %w", tmp, err)
+	}
+
+	if err = Verify(ctx, tmp); err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(path, gzipExt) {
+		return os.Rename(tmp, path)
+	}
+
+	if err = compressFile(tmp, path+".tmp"); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Restore replaces the database file at dsn with the backup, the server
+// using the database must be stopped. The backup is checked for integrity
+// before the database is replaced.
+func Restore(ctx context.Context, backup, dsn string) error {
+	path := dsnPath(dsn)
+	if path == "" {
+		return fmt.Errorf("cannot restore into %q, a database file is required", dsn)
+	}
+
+	tmp, err := tempPath(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if strings.HasSuffix(backup, gzipExt) {
+		err = decompressFile(backup, tmp)
+	} else {
+		err = copyFile(backup, tmp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = Verify(ctx, tmp); err != nil {
+		return err
+	}
+
+	// journals of the replaced database must not be applied to the backup
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err = os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+// Verify runs the integrity check on the database file.
+func Verify(ctx context.Context, path string) error {
+	db, err := sql.Open(DriverName, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err = db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("integrity check of %s: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check of %s failed: %s", path, result)
+	}
+	return nil
+}
+
+// BackupConfig configures backups taken by Backups.
+type BackupConfig struct {
+	// Dir where backups are written.
+	Dir string
+	// Compress backups with gzip.
+	Compress bool
+	// Keep is the number of most recent backups kept, 0 keeps all.
+	Keep int
+}
+
+// Backups takes timestamped backups of the database into a directory and
+// removes old ones.
+type Backups struct {
+	db     *DB
+	config BackupConfig
+}
+
+func NewBackups(db *DB, config BackupConfig) *Backups {
+	return &Backups{
+		db:     db,
+		config: config,
+	}
+}
+
+func (b *Backups) Backup(ctx context.Context) (app.Backup, error) {
+	if err := os.MkdirAll(b.config.Dir, 0o750); err != nil {
+		return app.Backup{}, app.ErrInternal("failed to create backup dir", err)
+	}
+
+	now := time.Now().UTC()
+	name := backupPrefix + now.Format(backupTimeFormat) + ".db"
+	if b.config.Compress {
+		name += gzipExt
+	}
+	path := filepath.Join(b.config.Dir, name)
+
+	if err := b.db.BackupTo(ctx, path); err != nil {
+		return app.Backup{}, app.ErrInternal("failed to back up database", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return app.Backup{}, app.ErrInternal("failed to read backup", err)
+	}
+
+	if b.config.Keep > 0 {
+		if _, err = RotateBackups(b.config.Dir, b.config.Keep); err != nil {
+			return app.Backup{}, app.ErrInternal("failed to remove old backups", err)
+		}
+	}
+
+	return app.Backup{
+		Path:       path,
+		Size:       info.Size(),
+		Compressed: b.config.Compress,
+		Created:    now.Unix(),
+	}, nil
+}
+
+// RotateBackups removes all but the keep most recent backups in dir and
+// returns the removed paths.
+func RotateBackups(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) &&
+			(strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db"+gzipExt)) {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= keep {
+		return nil, nil
+	}
+
+	// names start with the time, newest sort last
+	sort.Strings(backups)
+
+	var removed []string
+	for _, name := range backups[:len(backups)-keep] {
+		path := filepath.Join(dir, name)
+		if err = os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// dsnPath returns the file path of the dsn, it is empty for in-memory
+// databases.
+func dsnPath(dsn string) string {
+	path := strings.TrimPrefix(dsn, "file:")
+	path, _, _ = strings.Cut(path, "?")
+	if path == ":memory:" || strings.Contains(dsn, "mode=memory") {
+		return ""
+	}
+	return path
+}
+
+// tempPath returns a not existing path in the directory of path.
+func tempPath(path string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), os.Remove(f.Name())
+}
+
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func decompressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", src, err)
+	}
+	return writeFile(dst, zr)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+func writeFile(dst string, r io.Reader) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, r); err != nil {
+		return err
+	}
+	return out.Sync()
+}
@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func setupBackupTest(t *testing.T) (*DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := New(filepath.Join(dir, "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err = db.Exec(`CREATE TABLE items (name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(`INSERT INTO items VALUES ('one'), ('two')`); err != nil {
+		t.Fatal(err)
+	}
+	return db, dir
+}
+
+func TestDB_BackupRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"plain", "backup.db"},
+		{"compressed", "backup.db.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, dir := setupBackupTest(t)
+			path := filepath.Join(dir, tt.file)
+
+			if err := db.BackupTo(ctx, path); err != nil {
+				t.Fatalf("DB.BackupTo() error = %v", err)
+			}
+			if err := db.BackupTo(ctx, path); err == nil {
+				t.Fatal("DB.BackupTo() overwrote existing backup")
+			}
+
+			target := filepath.Join(dir, "restored.db")
+			if err := os.WriteFile(target+"-journal", []byte("stale"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := Restore(ctx, path, target); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			if _, err := os.Stat(target + "-journal"); !os.IsNotExist(err) {
+				t.Errorf("journal of replaced database is kept, err = %v", err)
+			}
+
+			restored, err := New(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer restored.Close()
+
+			var names []string
+			if err = restored.Select(&names, `SELECT name FROM items ORDER BY name`); err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"one", "two"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("restored rows = %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestRestore_Corrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.db")
+	if err := os.WriteFile(target, []byte("current"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"not a database", "broken.db", "definitely not sqlite"},
+		{"not gzip", "broken.db.gz", "definitely not gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := Restore(ctx, path, target); err == nil {
+				t.Fatal("Restore() of corrupt backup succeeded")
+			}
+			if got, _ := os.ReadFile(target); string(got) != "current" {
+				t.Errorf("database replaced by corrupt backup")
+			}
+		})
+	}
+
+	if err := Restore(ctx, filepath.Join(dir, "broken.db"), ":memory:"); err == nil {
+		t.Error("Restore() into memory database succeeded")
+	}
+}
+
+func TestBackups_Rotate(t *testing.T) {
+	ctx := context.Background()
+	db, dir := setupBackupTest(t)
+	backupDir := filepath.Join(dir, "backups")
+
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"backup-20240101T000000Z.db",
+		"backup-20240102T000000Z.db.gz",
+		"backup-20240103T000000Z.db",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(backupDir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backup, err := NewBackups(db, BackupConfig{Dir: backupDir, Compress: true, Keep: 2}).Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backups.Backup() error = %v", err)
+	}
+	if !backup.Compressed || backup.Size == 0 || filepath.Ext(backup.Path) != ".gz" {
+		t.Errorf("Backups.Backup() = %+v", backup)
+	}
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"backup-20240103T000000Z.db", filepath.Base(backup.Path), "notes.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("backup dir = %v, want %v", names, want)
+	}
+}
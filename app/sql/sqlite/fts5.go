@@ -0,0 +1,10 @@
+//go:build !sqlite_fts5
+
+package sqlite
+
+// User search needs FTS5, which go-sqlite3 compiles in only with the
+// sqlite_fts5 build tag. Without the tag the build fails here rather than
+// at runtime when the migrations create the search index, build with
+//
+//	go build -tags sqlite_fts5 ./...
+var _ = sqlite_fts5_build_tag_is_required_for_user_search
@@ -3,43 +3,99 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/enverbisevac/go-project/app/health"
 	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
 	"github.com/rs/xid"
 )
 
+// DriverName is the database/sql driver registered by this package. It is
+// the stock sqlite3 driver with the pragmas the app needs on every
+// connection.
+const DriverName = "sqlite3_ext"
+
+func init() {
+	sqlx.BindDriver(DriverName, sqlx.QUESTION)
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// the pragma is per connection, every connection of both pools
+			// must check foreign keys
+			if _, err := conn.Exec(`PRAGMA foreign_keys = ON;`, nil); err != nil {
+				return fmt.Errorf("foreign keys pragma: %w", err)
+			}
+			// readers of a shared cache, used by in-memory databases, take
+			// table locks which make the writer fail with SQLITE_LOCKED,
+			// reading uncommitted rows avoids them. Without a shared cache
+			// the pragma does nothing.
+			if _, err := conn.Exec(`PRAGMA read_uncommitted = true;`, nil); err != nil {
+				return fmt.Errorf("read uncommitted pragma: %w", err)
+			}
+			return nil
+		},
+	})
+}
+
 type DB struct {
 	*sqlx.DB
 	ReadableDB *sqlx.DB
+
+	// writeCheck is the last result of the write lock probe.
+	writeCheck struct {
+		sync.Mutex
+		at  time.Time
+		err error
+	}
 }
 
+// writeCheckInterval is how long a result of the write lock probe is reused,
+// frequent probes must not compete with writes of the app for the lock.
+const writeCheckInterval = 30 * time.Second
+
 func New(dsn string) (*DB, error) {
 	if dsn == ":memory:" {
 		dsn = fmt.Sprintf("file:%s.db?mode=memory&cache=shared", xid.New().String())
 	}
-	db, err := sqlx.Connect("sqlite3", dsn)
+	db, err := sqlx.Connect(DriverName, dsn)
 	if err != nil {
 		return nil, err
 	}
 
 	db.SetMaxOpenConns(1)
-	dbReadable, err := sqlx.Connect("sqlite3", dsn)
+	if err = checkFTS5(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	dbReadable, err := sqlx.Connect(DriverName, dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	// Enable foreign key checks.
-	if _, err := db.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
-		return nil, fmt.Errorf("foreign keys pragma: %w", err)
-	}
 	return &DB{
 		DB:         db,
 		ReadableDB: dbReadable,
 	}, nil
 }
 
+// checkFTS5 fails when SQLite is compiled without FTS5, which user search
+// needs. The sqlite_fts5 build tag is enforced at compile time, this catches
+// a system library linked with the libsqlite3 tag which lacks it.
+func checkFTS5(db *sqlx.DB) error {
+	var enabled bool
+	if err := db.Get(&enabled, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`); err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("sqlite is built without FTS5, build with -tags sqlite_fts5")
+	}
+	return nil
+}
+
 func (d *DB) Beginx() (*sqlx.Tx, error) {
 	return d.DB.Beginx()
 }
@@ -63,3 +119,60 @@ func (db *DB) Close() error {
 	rErr := db.ReadableDB.Close()
 	return errors.Join(mErr, rErr)
 }
+
+// PoolStats returns stats of the write and the read connection pools.
+func (db *DB) PoolStats() map[string]sql.DBStats {
+	return map[string]sql.DBStats{
+		"write": db.DB.Stats(),
+		"read":  db.ReadableDB.Stats(),
+	}
+}
+
+// Checks returns health checks of the write and the read connection pools.
+func (db *DB) Checks() []health.Check {
+	return []health.Check{
+		{Name: "sqlite_write", Probe: db.checkWrite},
+		{Name: "sqlite_read", Probe: db.checkRead},
+	}
+}
+
+// checkWrite takes the write lock and releases it, it fails while a
+// transaction of the app or another process holds the lock for too long. The
+// lock is taken at most once per writeCheckInterval, probes in between
+// return the last result.
+func (db *DB) checkWrite(ctx context.Context) error {
+	db.writeCheck.Lock()
+	defer db.writeCheck.Unlock()
+
+	if time.Since(db.writeCheck.at) < writeCheckInterval {
+		return db.writeCheck.err
+	}
+	err := db.lockWrite(ctx)
+	db.writeCheck.at, db.writeCheck.err = time.Now(), err
+	return err
+}
+
+func (db *DB) lockWrite(ctx context.Context) error {
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if _, err = conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK"); err != nil {
+		// the connection may still be in the transaction, it must not be
+		// reused
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		return err
+	}
+	return nil
+}
+
+// checkRead reads the schema with a connection of the read pool.
+func (db *DB) checkRead(ctx context.Context) error {
+	var tables int
+	return db.ReadableDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&tables)
+}
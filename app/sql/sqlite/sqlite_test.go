@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Checks(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "app.db") + "?_busy_timeout=50"
+	db, err := New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// another process holding the write lock
+	other, err := New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	probes := map[string]func(context.Context) error{}
+	for _, check := range db.Checks() {
+		probes[check.Name] = check.Probe
+	}
+	for _, name := range []string{"sqlite_write", "sqlite_read"} {
+		if err := probes[name](ctx); err != nil {
+			t.Errorf("%s probe error = %v", name, err)
+		}
+	}
+
+	tx, err := other.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec(`CREATE TABLE items (name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	// the last result is reused until the interval passes
+	if err := probes["sqlite_write"](ctx); err != nil {
+		t.Errorf("sqlite_write probe within the interval error = %v", err)
+	}
+	db.writeCheck.at = time.Time{}
+	if err := probes["sqlite_write"](ctx); err == nil {
+		t.Error("sqlite_write probe of locked database error = nil")
+	}
+	if err := probes["sqlite_read"](ctx); err != nil {
+		t.Errorf("sqlite_read probe of locked database error = %v", err)
+	}
+	tx.Rollback()
+
+	db.writeCheck.at = time.Time{}
+	if err := probes["sqlite_write"](ctx); err != nil {
+		t.Errorf("sqlite_write probe after the lock is released error = %v", err)
+	}
+	// the probe leaves no transaction open
+	if _, err = db.Exec(`CREATE TABLE items (name TEXT)`); err != nil {
+		t.Errorf("write after probes error = %v", err)
+	}
+}
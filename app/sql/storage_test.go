@@ -0,0 +1,15 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/enverbisevac/go-project/app/storagetest"
+)
+
+func TestDB_Storage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		db, teardown := setupTest(t)
+		t.Cleanup(teardown)
+		return db
+	})
+}
@@ -0,0 +1,283 @@
+package sql
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+type importOutcome int
+
+const (
+	importCreated importOutcome = iota
+	importUpdated
+	importSkipped
+)
+
+// ExportRecords returns all roles followed by all users, deleted ones are
+// left out. Users are ordered by email and exported with their password
+// hashes.
+func (db *DB) ExportRecords(ctx context.Context) ([]app.TransferRecord, error) {
+	var records []app.TransferRecord
+	err := db.inReadTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		records, err = tx.exportRecords(ctx)
+		return err
+	})
+	return records, err
+}
+
+func (ds *DataSource) exportRecords(ctx context.Context) ([]app.TransferRecord, error) {
+	roles, err := ds.FindRoles(ctx)
+	if err != nil {
+		return nil, app.ErrInternal("failed to get roles", err)
+	}
+
+	records := make([]app.TransferRecord, 0, len(roles))
+	roleNames := make(map[string]string, len(roles))
+	for _, role := range roles {
+		aggregate, err := ds.getRoleAggregate(ctx, &app.IDOrNameFilter{ID: role.ID})
+		if err != nil {
+			return nil, err
+		}
+		roleNames[role.ID] = role.Name
+		records = append(records, app.TransferRecord{
+			Kind:        app.RecordRole,
+			Name:        role.Name,
+			Permissions: aggregate.Permissions,
+		})
+	}
+
+	const query = `
+	SELECT
+		user_id,
+		user_active,
+		user_email,
+		user_full_name,
+		user_is_admin,
+		user_date_joined,
+		COALESCE(user_hashed_password, '') AS user_hashed_password,
+		user_key_id
+	FROM users
+	WHERE user_deleted_at IS NULL
+	`
+
+	rows, err := querySQL[storedUser](ctx, ds, query)
+	if err != nil {
+		return nil, err
+	}
+	users, err := ds.decryptUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// encrypted emails can only be ordered once decrypted
+	slices.SortFunc(users, func(a, b app.User) int {
+		return strings.Compare(strings.ToLower(a.Email.String()), strings.ToLower(b.Email.String()))
+	})
+
+	for _, user := range users {
+		aggregate, err := ds.getUserAggregate(ctx, app.UserFilter{ID: user.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, 0, len(aggregate.Roles))
+		for _, id := range aggregate.Roles {
+			names = append(names, roleNames[id])
+		}
+
+		records = append(records, app.TransferRecord{
+			Kind:         app.RecordUser,
+			Email:        user.Email,
+			FullName:     user.FullName,
+			Active:       user.Active,
+			IsAdmin:      user.IsAdmin,
+			DateJoined:   user.DateJoined,
+			PasswordHash: user.Password.String(),
+			Roles:        names,
+			Permissions:  aggregate.Permissions,
+		})
+	}
+
+	return records, nil
+}
+
+// ImportRecords stores the records in order, every record in its own
+// transaction. Invalid records are reported and left out, roles and users
+// that exist already are skipped or updated depending on the mode. In dry
+// run nothing is stored.
+func (db *DB) ImportRecords(ctx context.Context, records []app.TransferRecord, options app.ImportOptions) (app.ImportReport, error) {
+	report := app.ImportReport{DryRun: options.DryRun}
+	if err := options.Validate(); err != nil {
+		return report, err
+	}
+
+	// roles created in dry run, users can still reference them
+	pendingRoles := map[string]bool{}
+
+	for i := range records {
+		record := &records[i]
+
+		outcome, err := db.importRecord(ctx, record, options, pendingRoles)
+		if err != nil {
+			if app.ErrorStatus(err) == app.StatusInternal {
+				return report, err
+			}
+
+			row := record.Row
+			if row == 0 {
+				row = i + 1
+			}
+			report.AddErrors(app.ImportError{
+				Row:   row,
+				Kind:  record.Kind,
+				Key:   record.Key(),
+				Error: app.ErrorMessage(err),
+			})
+			continue
+		}
+
+		switch outcome {
+		case importCreated:
+			report.Created++
+		case importUpdated:
+			report.Updated++
+		case importSkipped:
+			report.Skipped++
+		}
+	}
+
+	return report, nil
+}
+
+func (db *DB) importRecord(
+	ctx context.Context,
+	record *app.TransferRecord,
+	options app.ImportOptions,
+	pendingRoles map[string]bool,
+) (importOutcome, error) {
+	var outcome importOutcome
+	err := db.inTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		switch record.Kind {
+		case app.RecordRole:
+			outcome, err = tx.importRole(ctx, record, options.Mode)
+		case app.RecordUser:
+			outcome, err = tx.importUser(ctx, record, options.Mode, pendingRoles)
+		default:
+			err = app.ErrInvalid("kind must be %s or %s", app.RecordRole, app.RecordUser)
+		}
+		if err == nil && options.DryRun {
+			return errRollback
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if options.DryRun && record.Kind == app.RecordRole && outcome == importCreated {
+		pendingRoles[strings.ToLower(record.Name)] = true
+	}
+	return outcome, nil
+}
+
+func (ds *DataSource) importRole(ctx context.Context, record *app.TransferRecord, mode string) (importOutcome, error) {
+	role := record.RoleAggregate()
+	if err := role.Validate(); err != nil {
+		return 0, err
+	}
+
+	existing, err := ds.getRole(ctx, &app.IDOrNameFilter{Name: record.Name})
+	switch {
+	case app.ErrorStatus(err) == app.StatusNotFound:
+		return importCreated, ds.addRoleAggregate(ctx, &role)
+	case err != nil:
+		return 0, err
+	case mode == app.ConflictSkip:
+		return importSkipped, nil
+	}
+
+	role.ID = existing.ID
+	return importUpdated, ds.updateRoleAggregate(ctx, &role, app.IDOrNameFilter{ID: existing.ID})
+}
+
+func (ds *DataSource) importUser(
+	ctx context.Context,
+	record *app.TransferRecord,
+	mode string,
+	pendingRoles map[string]bool,
+) (importOutcome, error) {
+	user, err := record.UserAggregate()
+	if err != nil {
+		return 0, err
+	}
+
+	email := record.Email.String()
+	existing, err := ds.GetUser(ctx, app.UserFilter{Email: &email})
+	if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
+		return 0, err
+	}
+
+	// existing users keep their password unless the record has one
+	validate := user.Validate
+	if existing != nil && user.Password == "" {
+		validate = user.ValidateProfile
+	}
+	if err = validate(); err != nil {
+		return 0, err
+	}
+
+	for _, name := range record.Roles {
+		role, err := ds.getRole(ctx, &app.IDOrNameFilter{Name: name})
+		switch {
+		case app.ErrorStatus(err) == app.StatusNotFound && pendingRoles[strings.ToLower(name)]:
+			continue
+		case app.ErrorStatus(err) == app.StatusNotFound:
+			return 0, app.ErrInvalid("role %s not found", name)
+		case err != nil:
+			return 0, err
+		}
+		user.Roles = append(user.Roles, role.ID)
+	}
+
+	if existing == nil {
+		if record.Password != "" {
+			hash, err := passwordHash(record.Password, ds.passwordCost)
+			if err != nil {
+				return 0, err
+			}
+			user.Password = app.Password(hash)
+		}
+		return importCreated, ds.addUserAggregate(ctx, &user, true)
+	}
+
+	if mode == app.ConflictSkip {
+		return importSkipped, nil
+	}
+
+	user.ID = existing.ID
+	if err = ds.updateUserAggregate(ctx, &user); err != nil {
+		return 0, err
+	}
+
+	// the update reads the user back without its password
+	if record.Password == "" && record.PasswordHash == "" {
+		return importUpdated, nil
+	}
+
+	filter := app.UserFilter{ID: existing.ID}
+	if record.PasswordHash != "" {
+		err = ds.setUserPasswordHash(ctx, filter, record.PasswordHash)
+	} else {
+		err = ds.UpdateUserPassword(ctx, filter, record.Password)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// the password itself is never logged
+	err = ds.audit(ctx, app.AuditUserPasswordChanged, app.AuditTargetUser, existing.ID, nil, nil)
+	return importUpdated, err
+}
@@ -0,0 +1,158 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const importCSV = `kind,name,email,full_name,active,is_admin,date_joined,password_hash,password,roles,permissions
+role,Editors,,,,,,,,,view_user;edit_user:u1
+user,,ann@example.com,Ann,true,false,1700000000,%s,,Editors,
+user,,bob@example.com,Bob,true,false,,,Xq9!long-pass,,view_role
+user,,not-an-email,Broken,true,false,,,Xq9!long-pass,,
+user,,cid@example.com,Cid,maybe,false,,,,,
+user,,dan@example.com,Dan,true,false,,,Xq9!long-pass,Missing,
+`
+
+func importRecords(t *testing.T, db *DB, hash string, options app.ImportOptions) app.ImportReport {
+	t.Helper()
+	data := strings.Replace(importCSV, "%s", hash, 1)
+	records, errs, err := app.DecodeRecords(strings.NewReader(data), app.FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.ImportRecords(context.Background(), records, options)
+	if err != nil {
+		t.Fatalf("DB.ImportRecords() error = %v", err)
+	}
+	report.AddErrors(errs...)
+	return report
+}
+
+func TestDB_ImportRecords(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("Kept!password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options app.ImportOptions
+		want    app.ImportReport
+	}{
+		{
+			name:    "dry run",
+			options: app.ImportOptions{Mode: app.ConflictSkip, DryRun: true},
+			want:    app.ImportReport{DryRun: true, Created: 3},
+		},
+		{
+			name:    "import",
+			options: app.ImportOptions{Mode: app.ConflictSkip},
+			want:    app.ImportReport{Created: 3},
+		},
+		{
+			name:    "skip existing",
+			options: app.ImportOptions{Mode: app.ConflictSkip},
+			want:    app.ImportReport{Skipped: 3},
+		},
+		{
+			name:    "upsert existing",
+			options: app.ImportOptions{Mode: app.ConflictUpsert},
+			want:    app.ImportReport{Updated: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := importRecords(t, db, string(hash), tt.options)
+
+			var rows []int
+			for _, e := range got.Errors {
+				rows = append(rows, e.Row)
+			}
+			if want := []int{4, 5, 6}; !reflect.DeepEqual(rows, want) {
+				t.Errorf("error rows = %v, want %v: %+v", rows, want, got.Errors)
+			}
+			got.Errors = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.ImportRecords() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err = db.ImportRecords(ctx, nil, app.ImportOptions{Mode: "replace"}); app.ErrorStatus(err) != app.StatusInvalid {
+		t.Errorf("DB.ImportRecords() with unknown mode error = %v", err)
+	}
+
+	// the imported hash is stored as is
+	if _, err = db.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: "Kept!password-1"}); err != nil {
+		t.Errorf("DB.Authenticate() with imported hash error = %v", err)
+	}
+}
+
+func TestDB_ExportRecords(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("Kept!password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	importRecords(t, db, string(hash), app.ImportOptions{Mode: app.ConflictSkip})
+
+	records, err := db.ExportRecords(ctx)
+	if err != nil {
+		t.Fatalf("DB.ExportRecords() error = %v", err)
+	}
+
+	var keys []string
+	for _, record := range records {
+		keys = append(keys, record.Kind+":"+record.Key())
+		if record.Kind == app.RecordUser && record.PasswordHash == "" {
+			t.Errorf("user %s exported without password hash", record.Email)
+		}
+	}
+	want := []string{"role:Editors", "user:ann@example.com", "user:bob@example.com"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("exported records = %v, want %v", keys, want)
+	}
+	if ann := records[1]; ann.PasswordHash != string(hash) || ann.DateJoined != 1700000000 ||
+		!reflect.DeepEqual(ann.Roles, []string{"Editors"}) {
+		t.Errorf("exported user = %+v", ann)
+	}
+
+	for _, format := range []string{app.FormatNDJSON, app.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := app.EncodeRecords(&buf, format, records); err != nil {
+				t.Fatalf("app.EncodeRecords() error = %v", err)
+			}
+			encoded := buf.String()
+			decoded, errs, err := app.DecodeRecords(&buf, format)
+			if err != nil || len(errs) > 0 {
+				t.Fatalf("app.DecodeRecords() errs = %v, error = %v", errs, err)
+			}
+			if err = app.EncodeRecords(&buf, format, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != encoded {
+				t.Errorf("decoded records encode to\n%s\nwant\n%s", buf.String(), encoded)
+			}
+
+			report, err := db.ImportRecords(ctx, decoded, app.ImportOptions{Mode: app.ConflictSkip})
+			if err != nil || report.Skipped != len(records) || len(report.Errors) > 0 {
+				t.Errorf("DB.ImportRecords() of export = %+v, error = %v", report, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+// Retries of statements and transactions failing on lock conflicts.
+const (
+	busyRetries    = 10
+	busyBackoff    = 2 * time.Millisecond
+	maxBusyBackoff = 250 * time.Millisecond
+)
+
+// errRollback is returned by functions run in a transaction to roll it back
+// without failing.
+var errRollback = errors.New("rollback")
+
+type txContextKey struct{}
+
+// ambientTx is the transaction of a unit of work, it is carried by the
+// context passed to the functions run in it.
+type ambientTx struct {
+	dbtx     DBTX
+	tx       *Transaction
+	readOnly bool
+	// savepoints names savepoints of nested units of work.
+	savepoints atomic.Int64
+}
+
+// ambientFromContext returns the transaction of ctx started on dbtx, nil when
+// there is none.
+func ambientFromContext(ctx context.Context, dbtx DBTX) *ambientTx {
+	if a, ok := ctx.Value(txContextKey{}).(*ambientTx); ok && a.dbtx == dbtx {
+		return a
+	}
+	return nil
+}
+
+// WithinTx runs fn in a transaction which is committed when fn succeeds.
+// Storage calls made with the context passed to fn join the transaction, a
+// nested WithinTx runs in a savepoint and only its own changes are rolled
+// back when it fails. Transactions failing on lock conflicts, like
+// SQLITE_BUSY, are run again, so fn must be safe to retry. The context must
+// not be used once WithinTx returns.
+func (db *DB) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.inTx(ctx, func(ctx context.Context, _ *Transaction) error {
+		return fn(ctx)
+	})
+}
+
+// WithinReadTx runs fn in a read-only transaction started with
+// BeginReadable, see WithinTx. Nested in WithinTx it joins the write
+// transaction.
+func (db *DB) WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.inReadTx(ctx, func(ctx context.Context, _ *Transaction) error {
+		return fn(ctx)
+	})
+}
+
+// inTx runs fn in the transaction of ctx or in a new one, see WithinTx.
+func (db *DB) inTx(ctx context.Context, fn func(ctx context.Context, tx *Transaction) error) error {
+	if a := ambientFromContext(ctx, db.DBTX); a != nil {
+		if a.readOnly {
+			return app.ErrInternal("cannot write in a read-only transaction")
+		}
+		return a.savepoint(ctx, fn)
+	}
+
+	return retry(ctx, func() error {
+		return db.run(ctx, db.Beginx, false, fn)
+	})
+}
+
+// inReadTx runs fn in the transaction of ctx or in a new read-only one, see
+// WithinReadTx.
+func (db *DB) inReadTx(ctx context.Context, fn func(ctx context.Context, tx *Transaction) error) error {
+	if a := ambientFromContext(ctx, db.DBTX); a != nil {
+		return fn(ctx, a.tx)
+	}
+
+	return retry(ctx, func() error {
+		return db.run(ctx, db.BeginReadable, true, fn)
+	})
+}
+
+// run runs fn in a transaction started with begin, ctx passed to fn carries
+// the transaction.
+func (db *DB) run(
+	ctx context.Context,
+	begin func() (*Transaction, error),
+	readOnly bool,
+	fn func(ctx context.Context, tx *Transaction) error,
+) error {
+	tx, err := begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	a := &ambientTx{
+		dbtx:     db.DBTX,
+		tx:       tx,
+		readOnly: readOnly,
+	}
+	if err = fn(context.WithValue(ctx, txContextKey{}, a), tx); err != nil {
+		if errors.Is(err, errRollback) {
+			return nil
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// savepoint runs fn in a savepoint of the transaction, changes made by fn are
+// rolled back when it fails.
+func (a *ambientTx) savepoint(ctx context.Context, fn func(ctx context.Context, tx *Transaction) error) error {
+	name := fmt.Sprintf("unit_%d", a.savepoints.Add(1))
+	if _, err := a.tx.DataSource.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return app.ErrInternal("failed to create savepoint %s", name, err)
+	}
+
+	err := fn(ctx, a.tx)
+	if err != nil {
+		if _, rerr := a.tx.DataSource.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rerr != nil {
+			return errors.Join(err, app.ErrInternal("failed to roll back to savepoint %s", name, rerr))
+		}
+	}
+
+	if _, rerr := a.tx.DataSource.ExecContext(ctx, "RELEASE SAVEPOINT "+name); rerr != nil {
+		return errors.Join(err, app.ErrInternal("failed to release savepoint %s", name, rerr))
+	}
+	if errors.Is(err, errRollback) {
+		return nil
+	}
+	return err
+}
+
+// retry runs fn again while it fails on lock conflicts, waiting longer after
+// every attempt.
+func retry(ctx context.Context, fn func() error) error {
+	backoff := busyBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt == busyRetries {
+			return err
+		}
+
+		// jitter spreads out retries of statements which conflicted together
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, maxBusyBackoff)
+	}
+}
+
+// contextDAO runs statements in the transaction of the context, if there is
+// one. Statements run outside of transactions are retried on lock conflicts,
+// a failed statement has no effect then.
+type contextDAO struct {
+	DBTX
+}
+
+func (d contextDAO) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if a := ambientFromContext(ctx, d.DBTX); a != nil {
+		return a.tx.Tx.ExecContext(ctx, query, args...)
+	}
+
+	var result sql.Result
+	err := retry(ctx, func() (err error) {
+		result, err = d.DBTX.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+func (d contextDAO) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	if a := ambientFromContext(ctx, d.DBTX); a != nil {
+		return a.tx.Tx.SelectContext(ctx, dest, query, args...)
+	}
+
+	return retry(ctx, func() error {
+		// rows scanned by a failed attempt are appended to
+		if value := reflect.ValueOf(dest); value.Kind() == reflect.Pointer && value.Elem().Kind() == reflect.Slice {
+			value.Elem().SetLen(0)
+		}
+		return d.DBTX.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (d contextDAO) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	if a := ambientFromContext(ctx, d.DBTX); a != nil {
+		return a.tx.Tx.GetContext(ctx, dest, query, args...)
+	}
+
+	return retry(ctx, func() error {
+		return d.DBTX.GetContext(ctx, dest, query, args...)
+	})
+}
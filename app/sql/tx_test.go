@@ -0,0 +1,137 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRetry(t *testing.T) {
+	busy := app.ErrInternal("failed to insert new row", sqlite3.Error{Code: sqlite3.ErrBusy})
+	locked := sqlite3.Error{Code: sqlite3.ErrLocked}
+	conflict := app.ErrConflict("row already exists")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "success",
+			errs:         []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			name:         "busy then success",
+			errs:         []error{busy, locked, nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "other error",
+			errs:         []error{conflict},
+			wantAttempts: 1,
+			wantErr:      conflict,
+		},
+		{
+			name:         "always busy",
+			errs:         []error{busy},
+			wantAttempts: busyRetries,
+			wantErr:      busy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := retry(context.Background(), func() error {
+				err := tt.errs[min(attempts, len(tt.errs)-1)]
+				attempts++
+				return err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retry() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("retry() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDB_WithinTx(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	// statements of the storage calls run in the transaction
+	err := db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := db.AddRole(ctx, &app.RoleAggregate{Role: app.Role{Name: "Editors"}}); err != nil {
+			return err
+		}
+		if roles, err := db.FindRoles(ctx); err != nil || len(roles) != 1 {
+			t.Errorf("FindRoles() in the transaction = %v, error = %v, want the added role", roles, err)
+		}
+		return errRollback
+	})
+	if err != nil {
+		t.Fatalf("WithinTx() error = %v", err)
+	}
+	if roles, err := db.FindRoles(ctx); err != nil || len(roles) != 0 {
+		t.Errorf("FindRoles() = %v, error = %v, want the role rolled back", roles, err)
+	}
+
+	// a transaction of another database isn't joined
+	other, teardownOther := setupTest(t)
+	defer teardownOther()
+	err = db.WithinTx(ctx, func(ctx context.Context) error {
+		return other.AddRole(ctx, &app.RoleAggregate{Role: app.Role{Name: "Viewers"}})
+	})
+	if err != nil {
+		t.Fatalf("WithinTx() error = %v", err)
+	}
+	if _, err = other.GetRole(ctx, &app.IDOrNameFilter{Name: "Viewers"}); err != nil {
+		t.Errorf("GetRole() of the other database error = %v", err)
+	}
+}
+
+func TestDB_readsDontWaitForWriter(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	ann := app.UserAggregate{User: app.User{Active: true, Email: "ann@example.com", FullName: "Ann Smith", Password: "Xq9!long-pass"}}
+	if err := db.AddUser(ctx, &ann); err != nil {
+		t.Fatal(err)
+	}
+
+	// the write transaction holds the only writer connection, reads made
+	// outside of it must not wait for it
+	done := make(chan struct{})
+	err := db.WithinTx(ctx, func(context.Context) error {
+		go func() {
+			defer close(done)
+			if _, err := db.GetUser(ctx, app.UserFilter{ID: ann.ID}); err != nil {
+				t.Errorf("GetUser() error = %v", err)
+			}
+			if _, err := db.CheckPermissions(ctx, ann.ID, app.PermissionCheck{Permission: "view_user"}); err != nil {
+				t.Errorf("CheckPermissions() error = %v", err)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("reads wait for the write transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
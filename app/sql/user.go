@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/dchest/uniuri"
 	"github.com/enverbisevac/go-project/app"
@@ -16,18 +17,32 @@ const (
 		user_active,
 		user_created,
 		user_modified,
+		user_version,
+		user_deleted_at,
 		user_email,
 		user_full_name,
 		user_is_admin,
 		user_date_joined,
 		user_last_login,
-		user_salt
+		user_salt,
+		user_key_id,
+		user_erased_at
 	FROM users
 	`
 )
 
 func (ds *DataSource) InsertUser(ctx context.Context, in *app.User) error {
-	if err := in.Validate(); err != nil {
+	return ds.insertUser(ctx, in, false)
+}
+
+// insertUser stores the new user. Imported users keep their date joined and
+// their password, which is hashed already.
+func (ds *DataSource) insertUser(ctx context.Context, in *app.User, imported bool) error {
+	validate := in.Validate
+	if imported {
+		validate = in.ValidateProfile
+	}
+	if err := validate(); err != nil {
 		return err
 	}
 
@@ -38,6 +53,9 @@ func (ds *DataSource) InsertUser(ctx context.Context, in *app.User) error {
 		user_created,
 		user_email,
 		user_full_name,
+		user_email_index,
+		user_key_id,
+		user_search_terms,
 		user_is_admin,
 		user_date_joined,
 		user_salt,
@@ -48,6 +66,9 @@ func (ds *DataSource) InsertUser(ctx context.Context, in *app.User) error {
 		:user_created,
 		:user_email,
 		:user_full_name,
+		:user_email_index,
+		:user_key_id,
+		:user_search_terms,
 		:user_is_admin,
 		:user_date_joined,
 		:user_salt,
@@ -56,10 +77,12 @@ func (ds *DataSource) InsertUser(ctx context.Context, in *app.User) error {
 	`
 
 	in.Created = time.Now().Unix()
-	in.DateJoined = in.Created
+	if !imported || in.DateJoined == 0 {
+		in.DateJoined = in.Created
+	}
 
-	if in.Password != "" {
-		hashedPassword, err := passwordHash(in.Password)
+	if in.Password != "" && !imported {
+		hashedPassword, err := passwordHash(in.Password, ds.passwordCost)
 		if err != nil {
 			return app.ErrInternal("hash password error", err)
 		}
@@ -69,26 +92,43 @@ func (ds *DataSource) InsertUser(ctx context.Context, in *app.User) error {
 
 	in.Salt = uniuri.NewLen(uniuri.UUIDLen)
 
-	return insertSQL(ctx, ds, query, in)
+	// encrypted values are bound to the user id, so it's needed up front
+	if in.ID == "" {
+		generate, err := in.Generator()
+		if err != nil {
+			return err
+		}
+		in.SetID(generate())
+	}
+
+	row, err := ds.userRow(in.ID, in)
+	if err != nil {
+		return err
+	}
+
+	return insertSQL(ctx, ds, query, row)
 }
 
 func (ds *DataSource) GetUser(ctx context.Context, filter app.UserFilter) (*app.User, error) {
 	query := selectUsers + `
-	WHERE user_id = $1
-		OR LOWER(user_email) = LOWER($2)
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND user_deleted_at IS NULL
 	LIMIT 1
 	`
 
-	user := &app.User{}
+	user := &storedUser{}
 	if err := ds.GetContext(ctx,
 		user,
 		query,
 		filter.ID,
-		filter.Email,
+		ds.emailIndexOf(filter.Email),
 	); err != nil {
 		return nil, wrapError(err, "user", filter.String())
 	}
-	return user, nil
+	if err := ds.decryptUser(user); err != nil {
+		return nil, err
+	}
+	return &user.User, nil
 }
 
 type userCredentials struct {
@@ -107,88 +147,319 @@ func (ds *DataSource) getUserCredentials(ctx context.Context, filter app.UserFil
 		user_hashed_password,
 		user_salt
 	FROM users
-	WHERE user_id = $1
-		OR LOWER(user_email) = LOWER($2)
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND user_deleted_at IS NULL
 	LIMIT 1
 	`
 	userCreds := &userCredentials{}
-	err := ds.GetContext(ctx, userCreds, query, filter.ID, filter.Email)
+	err := ds.GetContext(ctx, userCreds, query, filter.ID, ds.emailIndexOf(filter.Email))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, "user", filter.String())
 	}
 	return userCreds, nil
 }
 
 func (ds *DataSource) FindUsers(ctx context.Context) ([]app.User, error) {
-	var users []app.User
+	const query = selectUsers + `
+	WHERE user_deleted_at IS NULL
+	`
+	var rows []storedUser
 
-	err := ds.SelectContext(ctx, &users, selectUsers)
+	err := ds.SelectContext(ctx, &rows, query)
 	if err != nil {
 		return []app.User{}, app.ErrInternal("failed to retrieve users", err)
 	}
 
-	return users, nil
+	return ds.decryptUsers(rows)
 }
 
 func (ds *DataSource) FindAdmins(ctx context.Context) ([]app.User, error) {
 	const query = selectUsers + `
-	WHERE user_is_admin = 1
+	WHERE user_is_admin = true
+		AND user_deleted_at IS NULL
 	`
-	rows := make([]app.User, 0, 20)
+	rows := make([]storedUser, 0, 20)
 	if err := ds.SelectContext(ctx, &rows, query); err != nil {
 		return nil, app.ErrInternal("failed to get admin users", err)
 	}
-	return rows, nil
+	return ds.decryptUsers(rows)
+}
+
+// storedSearchResult is a search result as read from the database, see
+// storedUser.
+type storedSearchResult struct {
+	storedUser
+	Rank float64 `db:"search_rank"`
+}
+
+// SearchUsers ranks users by the full-text index. Encrypted users are indexed
+// by the search tokens of their words, they are matched by the tokens of the
+// query. Highlights are built from the decrypted users, so their text is
+// escaped.
+func (ds *DataSource) SearchUsers(ctx context.Context, filter app.UserSearchFilter) ([]app.UserSearchResult, error) {
+	const (
+		selectColumns = `
+		u.user_id,
+		u.user_active,
+		u.user_created,
+		u.user_modified,
+		u.user_version,
+		u.user_deleted_at,
+		u.user_email,
+		u.user_full_name,
+		u.user_is_admin,
+		u.user_date_joined,
+		u.user_last_login,
+		u.user_salt,
+		u.user_key_id,`
+
+		sqliteQuery = `
+	SELECT` + selectColumns + `
+		-bm25(users_fts) AS search_rank
+	FROM users_fts
+	JOIN users u ON u.rowid = users_fts.rowid
+	WHERE users_fts MATCH ?
+		AND u.user_deleted_at IS NULL
+	ORDER BY search_rank DESC, u.user_id
+	LIMIT ? OFFSET ?
+	`
+
+		postgresQuery = `
+	SELECT` + selectColumns + `
+		ts_rank(u.user_search, q) AS search_rank
+	FROM users u, to_tsquery('simple', ?) q
+	WHERE u.user_search @@ q
+		AND u.user_deleted_at IS NULL
+	ORDER BY search_rank DESC, u.user_id
+	LIMIT ? OFFSET ?
+	`
+	)
+
+	query, match := sqliteQuery, matchQuery(filter.Query)
+	if ds.Dialect() == DialectPostgres {
+		query, match = postgresQuery, tsQuery(filter.Query)
+	}
+	if ds.keys != nil {
+		match = ds.tokenQuery(filter.Query)
+	}
+
+	if match == "" {
+		return nil, app.ErrInvalid("search query is required")
+	}
+
+	rows := make([]storedSearchResult, 0, filter.Limit)
+	if err := ds.SelectContext(ctx, &rows, query, match, filter.Limit, filter.Offset); err != nil {
+		return nil, app.ErrInternal("failed to search users with %s", filter.String(), err)
+	}
+
+	results := make([]app.UserSearchResult, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if err := ds.decryptUser(&row.storedUser); err != nil {
+			return nil, err
+		}
+		results[i] = app.UserSearchResult{
+			User:      row.User,
+			Rank:      row.Rank,
+			Highlight: app.HighlightUser(row.User, filter.Query),
+		}
+	}
+	return results, nil
+}
+
+// tokenQuery is the full-text query of the search tokens of the query,
+// every token must be present.
+func (ds *DataSource) tokenQuery(text string) string {
+	tokens := ds.searchQueryTokens(text)
+	if ds.Dialect() == DialectPostgres {
+		return strings.Join(tokens, " & ")
+	}
+	return strings.Join(tokens, " ")
+}
+
+// matchQuery converts free text into a full-text query where every term is
+// a quoted prefix phrase, so user input can't inject query syntax and
+// partial words still match.
+func matchQuery(text string) string {
+	terms := make([]string, 0, 4)
+	for _, term := range strings.Fields(strings.ReplaceAll(text, `"`, " ")) {
+		terms = append(terms, `"`+term+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// tsQuery is the PostgreSQL counterpart of matchQuery. Input is split into
+// words, which are matched as prefixes and must all be present.
+func tsQuery(text string) string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
 }
 
 func (ds *DataSource) UpdateUserPassword(ctx context.Context, filter app.UserFilter, password app.Password) error {
 	const query = `
 	UPDATE users
 	SET
-		user_hashed_password = $1
-	WHERE user_id = $2 OR LOWER(user_email) = LOWER($3)
+		user_hashed_password = ?
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND user_deleted_at IS NULL
 	`
 
-	hashedPassword, err := passwordHash(password)
+	hashedPassword, err := passwordHash(password, ds.passwordCost)
 	if err != nil {
 		return err
 	}
 
-	return updateSQL(ctx, ds, query, hashedPassword, filter.ID, filter.Email)
+	return updateSQL(ctx, ds, query, hashedPassword, filter.ID, ds.emailIndexOf(filter.Email))
 }
 
+// setUserPasswordHash stores an already hashed password.
+func (ds *DataSource) setUserPasswordHash(ctx context.Context, filter app.UserFilter, hash string) error {
+	const query = `
+	UPDATE users
+	SET
+		user_hashed_password = ?
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND user_deleted_at IS NULL
+	`
+
+	return updateSQL(ctx, ds, query, hash, filter.ID, ds.emailIndexOf(filter.Email))
+}
+
+// UpdateUser updates the user with id and increments its version. When
+// user.Version is set the row is updated only if it's still at that version.
 func (ds *DataSource) UpdateUser(ctx context.Context, user *app.User, id string) error {
 	const query = `
 	UPDATE users
 	SET
 		user_active = :user_active,
 		user_modified = :user_modified,
+		user_version = user_version + 1,
 		user_email = :user_email,
 		user_full_name = :user_full_name,
+		user_email_index = :user_email_index,
+		user_key_id = :user_key_id,
+		user_search_terms = :user_search_terms,
 		user_is_admin = :user_is_admin
-	WHERE user_id = $1
+	WHERE (:user_version = 0 OR user_version = :user_version)
+		AND user_deleted_at IS NULL
+		AND user_id = ?
 	`
 
-	return updateSQL(ctx, ds, query, user, id)
+	row, err := ds.userRow(id, user)
+	if err != nil {
+		return err
+	}
+
+	err = updateSQL(ctx, ds, query, row, id)
+	return versionError(ctx, ds, err, user.Version, `
+	SELECT COUNT(*) FROM users
+	WHERE user_id = ? AND user_deleted_at IS NULL
+	`, id)
 }
 
+// DeleteUser marks the user as deleted, the user is kept until purged and
+// can be restored until then.
 func (ds *DataSource) DeleteUser(ctx context.Context, filter app.UserFilter) error {
+	const query = `
+	UPDATE users
+	SET
+		user_deleted_at = ?,
+		user_version = user_version + 1
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND (? = 0 OR user_version = ?)
+		AND user_deleted_at IS NULL
+	`
+
+	emailIndex := ds.emailIndexOf(filter.Email)
+	err := updateSQL(ctx, ds, query, time.Now().Unix(), filter.ID, emailIndex, filter.Version, filter.Version)
+	return versionError(ctx, ds, err, filter.Version, `
+	SELECT COUNT(*) FROM users
+	WHERE (user_id = ? OR user_email_index = ?) AND user_deleted_at IS NULL
+	`, filter.ID, emailIndex)
+}
+
+// RestoreUser undoes DeleteUser. When filtered by email the most recently
+// deleted user with that email is restored.
+func (ds *DataSource) RestoreUser(ctx context.Context, filter app.UserFilter) error {
+	const selectQuery = `
+	SELECT user_id, user_version
+	FROM users
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND user_deleted_at IS NOT NULL
+		AND user_erased_at IS NULL
+	ORDER BY user_deleted_at DESC
+	LIMIT 1
+	`
+
+	deleted, err := getSQL[app.User](ctx, ds, selectQuery, filter.ID, ds.emailIndexOf(filter.Email))
+	if err != nil {
+		return wrapError(err, "deleted user", "%s", filter.String())
+	}
+	if filter.Version != 0 && filter.Version != deleted.Version {
+		return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+	}
+
+	const query = `
+	UPDATE users
+	SET
+		user_deleted_at = NULL,
+		user_modified = ?,
+		user_version = user_version + 1
+	WHERE user_id = ?
+	`
+
+	return updateSQL(ctx, ds, query, time.Now().Unix(), deleted.ID)
+}
+
+// purgeUsers permanently deletes users deleted before the unix time, their
+// roles and permissions are removed by the foreign keys. Erased users are
+// kept, audit entries refer to them.
+func (ds *DataSource) purgeUsers(ctx context.Context, before int64) (int64, error) {
 	const query = `
 	DELETE FROM users
-	WHERE user_id = $1 OR LOWER(user_email) = LOWER($2)
+	WHERE user_deleted_at < ?
+		AND user_erased_at IS NULL
 	`
 
-	return deleteSQL(ctx, ds, query, filter.ID, filter.Email)
+	result, err := ds.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, app.ErrInternal("failed to purge deleted users", err)
+	}
+	return result.RowsAffected()
+}
+
+// touchUser increments the user version, it is used when roles or
+// permissions of the user change.
+func (ds *DataSource) touchUser(ctx context.Context, id string) error {
+	const query = `
+	UPDATE users
+	SET
+		user_modified = ?,
+		user_version = user_version + 1
+	WHERE user_id = ?
+		AND user_deleted_at IS NULL
+	`
+	err := updateSQL(ctx, ds, query, time.Now().Unix(), id)
+	if app.ErrorStatus(err) == app.StatusNotFound {
+		return app.ErrNotFound("user not found with id = %s", id)
+	}
+	return err
 }
 
 func (ds *DataSource) updateUserLastLogin(ctx context.Context, filter app.UserFilter) error {
 	const query = `
 	UPDATE users
 	SET
-		user_last_login = $1
-	WHERE user_id = $2 OR LOWER(user_email) = LOWER($3)
+		user_last_login = ?
+	WHERE (user_id = ? OR user_email_index = ?)
+		AND user_deleted_at IS NULL
 	`
-	return updateSQL(ctx, ds, query, time.Now().Unix(), filter.ID, filter.Email)
+	return updateSQL(ctx, ds, query, time.Now().Unix(), filter.ID, ds.emailIndexOf(filter.Email))
 }
 
 func (ds *DataSource) InsertUserRole(ctx context.Context, in *app.UserRole) error {
@@ -206,22 +477,32 @@ func (ds *DataSource) InsertUserRole(ctx context.Context, in *app.UserRole) erro
 	return insertSQL(ctx, ds, query, in)
 }
 
+func (ds *DataSource) DeleteUserRole(ctx context.Context, in *app.UserRole) error {
+	const query = `
+	DELETE FROM user_roles
+	WHERE user_role_user_id = ? AND user_role_role_id = ?
+	`
+	return deleteSQL(ctx, ds, query, in.UserID, in.RoleID)
+}
+
 func (ds *DataSource) DeleteUserRoles(ctx context.Context, userID string) error {
 	const query = `
 	DELETE FROM user_roles
-	WHERE user_role_user_id = $1
+	WHERE user_role_user_id = ?
 	`
 	return deleteSQL(ctx, ds, query, userID)
 }
 
 func (ds *DataSource) GetUserRoles(ctx context.Context, userID string) ([]app.UserRole, error) {
 	const query = `
-		SELECT 
+		SELECT
 		user_role_user_id,
 		user_role_role_id,
 		user_role_created
-		FROM user_roles 
-		WHERE user_role_user_id = $1`
+		FROM user_roles
+		JOIN roles ON role_id = user_role_role_id
+		WHERE user_role_user_id = ?
+			AND role_deleted_at IS NULL`
 
 	rows := make([]app.UserRole, 0, 20)
 	if err := ds.SelectContext(ctx, &rows, query, userID); err != nil {
@@ -233,26 +514,27 @@ func (ds *DataSource) GetUserRoles(ctx context.Context, userID string) ([]app.Us
 // User service methods
 
 func (db *DB) AddUser(ctx context.Context, user *app.UserAggregate) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.addUserAggregate(ctx, user, false)
+	})
+}
 
-	err = tx.InsertUser(ctx, &user.User)
+// addUserAggregate stores the user with roles and permissions, see
+// insertUser for imported users.
+func (ds *DataSource) addUserAggregate(ctx context.Context, user *app.UserAggregate, imported bool) error {
+	err := ds.insertUser(ctx, &user.User, imported)
 	if err != nil {
 		return err
 	}
 
 	// add user roles
 	for _, roleID := range user.Roles {
-		err = tx.InsertUserRole(ctx, &app.UserRole{
+		err = ds.InsertUserRole(ctx, &app.UserRole{
 			UserID: user.ID,
 			RoleID: roleID,
 		})
 		if err != nil {
-			switch {
-			case strings.Contains(err.Error(), "FOREIGN KEY constraint failed"):
+			if isForeignKeyViolation(app.SourceError(err)) {
 				return app.ErrInvalid("role %s not found", roleID, err)
 			}
 			return err
@@ -261,7 +543,7 @@ func (db *DB) AddUser(ctx context.Context, user *app.UserAggregate) error {
 
 	// add user permissions
 	for _, permission := range user.Permissions {
-		err = tx.InsertPermission(ctx, &app.Permission{
+		err = ds.InsertPermission(ctx, &app.Permission{
 			UserID:       &user.ID,
 			PermissionID: permission.Permission,
 			ResourceID:   permission.ResourceID,
@@ -271,30 +553,48 @@ func (db *DB) AddUser(ctx context.Context, user *app.UserAggregate) error {
 		}
 	}
 
-	return tx.Commit()
-}
+	created, err := ds.getUserAggregate(ctx, app.UserFilter{ID: user.ID})
+	if err != nil {
+		return err
+	}
 
-func (db *DB) UpdateUser(ctx context.Context, user *app.UserAggregate) error {
-	tx, err := db.Beginx()
+	err = ds.audit(ctx, app.AuditUserCreated, app.AuditTargetUser, user.ID, nil, created)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	err = tx.UpdateUser(ctx, &user.User, user.ID)
+	return ds.publish(ctx, app.EventUserCreated, app.AggregateUser, user.ID, created)
+}
+
+func (db *DB) UpdateUser(ctx context.Context, user *app.UserAggregate) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.updateUserAggregate(ctx, user)
+	})
+}
+
+// updateUserAggregate updates the user and replaces its roles and
+// permissions.
+func (ds *DataSource) updateUserAggregate(ctx context.Context, user *app.UserAggregate) error {
+	before, err := ds.getUserAggregate(ctx, app.UserFilter{ID: user.ID})
 	if err != nil {
 		return err
 	}
 
-	// delete user roles
-	err = tx.DeleteUserRoles(ctx, user.ID)
-	if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
+	err = ds.UpdateUser(ctx, &user.User, user.ID)
+	if err != nil {
 		return err
 	}
 
-	// add user roles
-	for _, roleID := range user.Roles {
-		err = tx.InsertUserRole(ctx, &app.UserRole{
+	// roles and permissions are changed by their differences, memberships
+	// of deleted roles aren't listed and are kept
+	removedRoles, addedRoles := diffSets(before.Roles, user.Roles, func(id string) string { return id })
+	for _, roleID := range removedRoles {
+		if err = ds.DeleteUserRole(ctx, &app.UserRole{UserID: user.ID, RoleID: roleID}); err != nil {
+			return err
+		}
+	}
+	for _, roleID := range addedRoles {
+		err = ds.InsertUserRole(ctx, &app.UserRole{
 			UserID: user.ID,
 			RoleID: roleID,
 		})
@@ -303,17 +603,19 @@ func (db *DB) UpdateUser(ctx context.Context, user *app.UserAggregate) error {
 		}
 	}
 
-	// delete permissions
-	err = tx.DeletePermissions(ctx, app.PermissionFilter{
-		UserID: user.ID,
-	})
-	if err != nil {
-		return err
+	removed, added := diffSets(before.Permissions, user.Permissions, permissionKey)
+	for _, permission := range removed {
+		err = ds.DeletePermission(ctx, &app.Permission{
+			UserID:       &user.ID,
+			PermissionID: permission.Permission,
+			ResourceID:   permission.ResourceID,
+		})
+		if err != nil {
+			return err
+		}
 	}
-
-	// add user permissions
-	for _, permission := range user.Permissions {
-		err = tx.InsertPermission(ctx, &app.Permission{
+	for _, permission := range added {
+		err = ds.InsertPermission(ctx, &app.Permission{
 			UserID:       &user.ID,
 			PermissionID: permission.Permission,
 			ResourceID:   permission.ResourceID,
@@ -323,22 +625,42 @@ func (db *DB) UpdateUser(ctx context.Context, user *app.UserAggregate) error {
 		}
 	}
 
-	return tx.Commit()
-}
+	// read back the stored row for the new version
+	updated, err := ds.getUserAggregate(ctx, app.UserFilter{ID: user.ID})
+	if err != nil {
+		return err
+	}
+	user.User = updated.User
 
-func (db *DB) GetUser(ctx context.Context, filter app.UserFilter) (app.UserAggregate, error) {
-	tx, err := db.Beginx()
+	err = ds.audit(ctx, app.AuditUserUpdated, app.AuditTargetUser, user.ID, before, updated)
 	if err != nil {
-		return app.UserAggregate{}, err
+		return err
 	}
-	defer tx.Rollback()
 
-	user, err := tx.GetUser(ctx, filter)
+	return ds.publish(ctx, app.EventUserUpdated, app.AggregateUser, user.ID, updated)
+}
+
+func (db *DB) GetUser(ctx context.Context, filter app.UserFilter) (app.UserAggregate, error) {
+	var user app.UserAggregate
+	err := db.inReadTx(ctx, func(ctx context.Context, tx *Transaction) (err error) {
+		user, err = tx.getUserAggregate(ctx, filter)
+		return err
+	})
+	return user, err
+}
+
+// getUserAggregate returns the user with its permissions and roles.
+func (ds *DataSource) getUserAggregate(ctx context.Context, filter app.UserFilter) (app.UserAggregate, error) {
+	user, err := ds.GetUser(ctx, filter)
 	if err != nil {
 		return app.UserAggregate{}, err
 	}
+	return ds.userAggregate(ctx, user)
+}
 
-	permissions, err := tx.GetPermissions(ctx, app.PermissionFilter{
+// userAggregate adds permissions and roles to the user.
+func (ds *DataSource) userAggregate(ctx context.Context, user *app.User) (app.UserAggregate, error) {
+	permissions, err := ds.GetPermissions(ctx, app.PermissionFilter{
 		UserID: user.ID,
 	})
 	if err != nil {
@@ -353,7 +675,7 @@ func (db *DB) GetUser(ctx context.Context, filter app.UserFilter) (app.UserAggre
 		}
 	}
 
-	roles, err := tx.GetUserRoles(ctx, user.ID)
+	roles, err := ds.GetUserRoles(ctx, user.ID)
 	if err != nil {
 		return app.UserAggregate{}, err
 	}
@@ -371,28 +693,244 @@ func (db *DB) GetUser(ctx context.Context, filter app.UserFilter) (app.UserAggre
 }
 
 func (db *DB) DeleteUser(ctx context.Context, filter app.UserFilter) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		user, err := tx.getUserAggregate(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		if filter.Version != 0 && filter.Version != user.Version {
+			return app.ErrPreconditionFailed("version %d is not current", filter.Version)
+		}
+
+		// permissions and roles are kept, so they come back on restore
+		err = tx.DeleteUser(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		err = tx.audit(ctx, app.AuditUserDeleted, app.AuditTargetUser, user.ID, user, nil)
+		if err != nil {
+			return err
+		}
+
+		return tx.publish(ctx, app.EventUserDeleted, app.AggregateUser, user.ID, user)
+	})
+}
+
+// AddUserRole assigns the role to the user, assigning a role the user
+// already has does nothing.
+func (db *DB) AddUserRole(ctx context.Context, userID, roleID string) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.getUserAggregate(ctx, app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+		for _, id := range before.Roles {
+			if id == roleID {
+				return nil
+			}
+		}
+
+		if _, err = tx.getRole(ctx, &app.IDOrNameFilter{ID: roleID}); err != nil {
+			if app.ErrorStatus(err) == app.StatusNotFound {
+				return app.ErrInvalid("role %s not found", roleID, err)
+			}
+			return err
+		}
+
+		if err = tx.touchUser(ctx, userID); err != nil {
+			return err
+		}
+
+		err = tx.InsertUserRole(ctx, &app.UserRole{
+			UserID: userID,
+			RoleID: roleID,
+		})
+		if err != nil {
+			if isForeignKeyViolation(app.SourceError(err)) {
+				return app.ErrInvalid("role %s not found", roleID, err)
+			}
+			return err
+		}
+
+		return tx.userChanged(ctx, app.AuditUserRoleAdded, before)
+	})
+}
+
+// RemoveUserRole takes the role away from the user.
+func (db *DB) RemoveUserRole(ctx context.Context, userID, roleID string) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.getUserAggregate(ctx, app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+
+		if err = tx.touchUser(ctx, userID); err != nil {
+			return err
+		}
+
+		err = tx.DeleteUserRole(ctx, &app.UserRole{
+			UserID: userID,
+			RoleID: roleID,
+		})
+		if err != nil {
+			if app.ErrorStatus(err) == app.StatusNotFound {
+				return app.ErrNotFound("user %s doesn't have role %s", userID, roleID)
+			}
+			return err
+		}
+
+		return tx.userChanged(ctx, app.AuditUserRoleRemoved, before)
+	})
+}
+
+// AddUserPermission grants the permission to the user, granting a permission
+// the user already has does nothing.
+func (db *DB) AddUserPermission(ctx context.Context, userID string, permission app.PermissionCheck) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.getUserAggregate(ctx, app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+
+		permissions, err := tx.GetPermissions(ctx, app.PermissionFilter{
+			UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+		if hasPermission(permissions, permission) {
+			return nil
+		}
+
+		if err = tx.touchUser(ctx, userID); err != nil {
+			return err
+		}
+
+		err = tx.InsertPermission(ctx, &app.Permission{
+			UserID:       &userID,
+			PermissionID: permission.Permission,
+			ResourceID:   permission.ResourceID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.userChanged(ctx, app.AuditUserPermissionAdded, before)
+	})
+}
+
+// RemoveUserPermission revokes the permission from the user.
+func (db *DB) RemoveUserPermission(ctx context.Context, userID string, permission app.PermissionCheck) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.getUserAggregate(ctx, app.UserFilter{ID: userID})
+		if err != nil {
+			return err
+		}
+
+		if err = tx.touchUser(ctx, userID); err != nil {
+			return err
+		}
+
+		err = tx.DeletePermission(ctx, &app.Permission{
+			UserID:       &userID,
+			PermissionID: permission.Permission,
+			ResourceID:   permission.ResourceID,
+		})
+		if err != nil {
+			if app.ErrorStatus(err) == app.StatusNotFound {
+				return app.ErrNotFound("user %s doesn't have permission %s", userID, permission.Permission)
+			}
+			return err
+		}
+
+		return tx.userChanged(ctx, app.AuditUserPermissionRemoved, before)
+	})
+}
+
+// RestoreUser brings back the user deleted with DeleteUser, as long as it
+// isn't purged yet.
+func (db *DB) RestoreUser(ctx context.Context, filter app.UserFilter) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		if err := tx.RestoreUser(ctx, filter); err != nil {
+			return err
+		}
+
+		// only the restored user can be found with the filter
+		restored, err := tx.getUserAggregate(ctx, app.UserFilter{ID: filter.ID, Email: filter.Email})
+		if err != nil {
+			return err
+		}
+
+		err = tx.audit(ctx, app.AuditUserRestored, app.AuditTargetUser, restored.ID, nil, restored)
+		if err != nil {
+			return err
+		}
 
-	user, err := tx.GetUser(ctx, filter)
+		return tx.publish(ctx, app.EventUserRestored, app.AggregateUser, restored.ID, restored)
+	})
+}
+
+// PurgeDeleted permanently deletes users and roles deleted before the given
+// time and returns how many rows were removed.
+func (db *DB) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		users, err := tx.purgeUsers(ctx, before.Unix())
+		if err != nil {
+			return err
+		}
+
+		roles, err := tx.purgeRoles(ctx, before.Unix())
+		if err != nil {
+			return err
+		}
+
+		purged = users + roles
+		if purged == 0 {
+			return nil
+		}
+		return tx.audit(ctx, app.AuditDeletedPurged, "", "", nil, map[string]int64{
+			"users":  users,
+			"roles":  roles,
+			"before": before.Unix(),
+		})
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return purged, nil
+}
 
-	err = tx.DeletePermissions(ctx, app.PermissionFilter{
-		UserID: user.ID,
+// UpdateUserPassword changes the password of the user.
+func (db *DB) UpdateUserPassword(ctx context.Context, filter app.UserFilter, password app.Password) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		user, err := tx.GetUser(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.UpdateUserPassword(ctx, filter, password); err != nil {
+			return err
+		}
+
+		// the password itself is never logged
+		return tx.audit(ctx, app.AuditUserPasswordChanged, app.AuditTargetUser, user.ID, nil, nil)
 	})
+}
+
+// userChanged logs the action on the user and publishes the user.updated
+// event, before is the user as it was before the change.
+func (ds *DataSource) userChanged(ctx context.Context, action string, before app.UserAggregate) error {
+	after, err := ds.getUserAggregate(ctx, app.UserFilter{ID: before.ID})
 	if err != nil {
 		return err
 	}
 
-	err = tx.DeleteUser(ctx, filter)
-	if err != nil {
+	if err = ds.audit(ctx, action, app.AuditTargetUser, before.ID, before, after); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	return ds.publish(ctx, app.EventUserUpdated, app.AggregateUser, before.ID, after)
 }
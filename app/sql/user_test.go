@@ -4,6 +4,7 @@ package sql
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/enverbisevac/go-project/app"
 )
@@ -246,3 +247,309 @@ func TestDataSource_DeleteUser(t *testing.T) {
 		})
 	}
 }
+
+func TestDataSource_SearchUsers(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	users := []app.User{
+		{FullName: "John Doe", Email: "john.doe@domain.com", Password: "some password"},
+		{FullName: "Johnny Walker", Email: "walker@domain.com", Password: "some password"},
+		{FullName: "Jane Roe", Email: "jane@example.com", Password: "some password"},
+	}
+	for i := range users {
+		if err := db.InsertUser(context.Background(), &users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filter  app.UserSearchFilter
+		wantErr bool
+		want    []app.Email
+	}{
+		{
+			name:   "partial name",
+			filter: app.UserSearchFilter{Query: "joh", Limit: 10},
+			want:   []app.Email{"john.doe@domain.com", "walker@domain.com"},
+		},
+		{
+			name:   "term in name and email",
+			filter: app.UserSearchFilter{Query: "doe", Limit: 10},
+			want:   []app.Email{"john.doe@domain.com"},
+		},
+		{
+			name:   "email domain",
+			filter: app.UserSearchFilter{Query: "example", Limit: 10},
+			want:   []app.Email{"jane@example.com"},
+		},
+		{
+			name:   "query syntax is escaped",
+			filter: app.UserSearchFilter{Query: `(jane"`, Limit: 10},
+			want:   []app.Email{"jane@example.com"},
+		},
+		{
+			name:   "pagination",
+			filter: app.UserSearchFilter{Query: "domain", Limit: 1, Offset: 1},
+			want:   []app.Email{"john.doe@domain.com"},
+		},
+		{
+			name:    "empty query",
+			filter:  app.UserSearchFilter{Query: "  ", Limit: 10},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.SearchUsers(context.Background(), tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DataSource.SearchUsers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("DataSource.SearchUsers() got %d users, expected %d", len(got), len(tt.want))
+			}
+			for i, email := range tt.want {
+				if got[i].Email != email {
+					t.Errorf("DataSource.SearchUsers() result %d email = %s, expected %s", i, got[i].Email, email)
+				}
+			}
+		})
+	}
+
+	got, err := db.SearchUsers(context.Background(), app.UserSearchFilter{Query: "john doe", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Highlight.FullName != "<mark>John</mark> <mark>Doe</mark>" {
+		t.Errorf("DataSource.SearchUsers() unexpected highlight %+v", got)
+	}
+
+	err = db.DataSource.UpdateUser(context.Background(), &app.User{
+		FullName: "Richard Roe",
+		Email:    "john.doe@domain.com",
+	}, users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = db.SearchUsers(context.Background(), app.UserSearchFilter{Query: "richard", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != users[0].ID {
+		t.Errorf("DataSource.SearchUsers() index not updated, got %+v", got)
+	}
+}
+
+func TestDB_UserRoles(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	role := &app.RoleAggregate{
+		Role: app.Role{
+			Name: "Editors",
+		},
+	}
+	if err := db.AddRole(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &app.UserAggregate{
+		User: app.User{
+			FullName: "John Doe",
+			Email:    "john.doe@domain.com",
+			Password: "some password",
+		},
+	}
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		remove      bool
+		userID      string
+		roleID      string
+		wantStatus  app.Status
+		wantVersion int64
+		wantRoles   int
+	}{
+		{
+			name:        "add role",
+			roleID:      role.ID,
+			wantVersion: 2,
+			wantRoles:   1,
+		},
+		{
+			name:        "add same role again",
+			roleID:      role.ID,
+			wantVersion: 2,
+			wantRoles:   1,
+		},
+		{
+			name:        "add unknown role",
+			roleID:      "unknown",
+			wantStatus:  app.StatusInvalid,
+			wantVersion: 2,
+			wantRoles:   1,
+		},
+		{
+			name:        "add role to unknown user",
+			userID:      "unknown",
+			roleID:      role.ID,
+			wantStatus:  app.StatusNotFound,
+			wantVersion: 2,
+			wantRoles:   1,
+		},
+		{
+			name:        "remove role",
+			remove:      true,
+			roleID:      role.ID,
+			wantVersion: 3,
+		},
+		{
+			name:        "remove role user doesn't have",
+			remove:      true,
+			roleID:      role.ID,
+			wantStatus:  app.StatusNotFound,
+			wantVersion: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := user.ID
+			if tt.userID != "" {
+				userID = tt.userID
+			}
+
+			var err error
+			if tt.remove {
+				err = db.RemoveUserRole(ctx, userID, tt.roleID)
+			} else {
+				err = db.AddUserRole(ctx, userID, tt.roleID)
+			}
+			if status := app.ErrorStatus(err); status != tt.wantStatus {
+				t.Fatalf("error = %v, want status %q", err, tt.wantStatus)
+			}
+
+			got, err := db.GetUser(ctx, app.UserFilter{ID: user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != tt.wantVersion {
+				t.Errorf("user version = %d, want %d", got.Version, tt.wantVersion)
+			}
+			if len(got.Roles) != tt.wantRoles {
+				t.Errorf("user roles = %v, want %d", got.Roles, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestDB_SoftDeleteUser(t *testing.T) {
+	db, teardown := setupTest(t)
+	defer teardown()
+
+	ctx := context.Background()
+	newUser := func() *app.UserAggregate {
+		return &app.UserAggregate{
+			User: app.User{
+				FullName: "John Doe",
+				Email:    "john.doe@domain.com",
+				Password: "some password",
+			},
+			Permissions: []app.PermissionCheck{
+				{Permission: app.PermissionViewUser},
+			},
+		}
+	}
+	user := newUser()
+	if err := db.AddUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteUser(ctx, app.UserFilter{ID: user.ID}); err != nil {
+		t.Fatalf("DB.DeleteUser() error = %v", err)
+	}
+	if _, err := db.GetUser(ctx, app.UserFilter{ID: user.ID}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.GetUser() of deleted user error = %v", err)
+	}
+	users, err := db.FindUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users {
+		if u.ID == user.ID {
+			t.Errorf("DB.FindUsers() returned deleted user %s", u.ID)
+		}
+	}
+	if err = db.DeleteUser(ctx, app.UserFilter{ID: user.ID}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.DeleteUser() of deleted user error = %v", err)
+	}
+
+	// email of deleted user can be taken, restore must fail then
+	other := newUser()
+	if err = db.AddUser(ctx, other); err != nil {
+		t.Fatalf("DB.AddUser() with email of deleted user error = %v", err)
+	}
+	if err = db.RestoreUser(ctx, app.UserFilter{ID: user.ID}); app.ErrorStatus(err) != app.StatusConflict {
+		t.Errorf("DB.RestoreUser() with taken email error = %v", err)
+	}
+	if err = db.DeleteUser(ctx, app.UserFilter{ID: other.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.RestoreUser(ctx, app.UserFilter{ID: user.ID, Version: 1}); app.ErrorStatus(err) != app.StatusPreconditionFailed {
+		t.Errorf("DB.RestoreUser() with stale version error = %v", err)
+	}
+	if err = db.RestoreUser(ctx, app.UserFilter{ID: user.ID, Version: 2}); err != nil {
+		t.Fatalf("DB.RestoreUser() error = %v", err)
+	}
+	got, err := db.GetUser(ctx, app.UserFilter{ID: user.ID})
+	if err != nil {
+		t.Fatalf("DB.GetUser() of restored user error = %v", err)
+	}
+	if got.DeletedAt != nil || got.Version != 3 || len(got.Permissions) != 1 {
+		t.Errorf("restored user = %+v, want version 3 with 1 permission", got)
+	}
+	if err = db.RestoreUser(ctx, app.UserFilter{ID: user.ID}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.RestoreUser() of active user error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		before time.Time
+		want   int64
+	}{
+		{
+			name:   "deleted after cutoff",
+			before: time.Now().Add(-time.Hour),
+		},
+		{
+			name:   "deleted before cutoff",
+			before: time.Now().Add(time.Second),
+			want:   1,
+		},
+		{
+			name:   "nothing left",
+			before: time.Now().Add(time.Second),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.PurgeDeleted(ctx, tt.before)
+			if err != nil {
+				t.Fatalf("DB.PurgeDeleted() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DB.PurgeDeleted() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if err = db.RestoreUser(ctx, app.UserFilter{ID: other.ID}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("DB.RestoreUser() of purged user error = %v", err)
+	}
+}
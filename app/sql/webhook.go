@@ -0,0 +1,326 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+const (
+	selectWebhooks = `--sql
+	SELECT
+		webhook_id,
+		webhook_url,
+		webhook_secret,
+		webhook_events,
+		webhook_active,
+		webhook_failures,
+		webhook_created,
+		webhook_modified
+	FROM webhooks
+	`
+
+	selectWebhookDeliveries = `--sql
+	SELECT
+		delivery_id,
+		delivery_webhook_id,
+		delivery_event_id,
+		delivery_event_type,
+		delivery_attempt,
+		delivery_request,
+		delivery_key_id,
+		delivery_status_code,
+		delivery_error,
+		delivery_duration,
+		delivery_next_attempt,
+		delivery_created
+	FROM webhook_deliveries
+	`
+)
+
+func (ds *DataSource) InsertWebhook(ctx context.Context, in *app.Webhook) error {
+	const query = `--sql
+	INSERT INTO webhooks (
+		webhook_id,
+		webhook_url,
+		webhook_secret,
+		webhook_events,
+		webhook_active,
+		webhook_failures,
+		webhook_created
+	) VALUES (
+		:webhook_id,
+		:webhook_url,
+		:webhook_secret,
+		:webhook_events,
+		:webhook_active,
+		0,
+		:webhook_created
+	)
+	`
+	if err := in.Validate(); err != nil {
+		return err
+	}
+	return insertSQL(ctx, ds, query, in)
+}
+
+func (ds *DataSource) GetWebhook(ctx context.Context, id string) (app.Webhook, error) {
+	webhook, err := getSQL[app.Webhook](ctx, ds, selectWebhooks+" WHERE webhook_id = ?", id)
+	if err != nil {
+		return app.Webhook{}, wrapError(err, "webhook", "id = %s", id)
+	}
+	return *webhook, nil
+}
+
+func (ds *DataSource) FindWebhooks(ctx context.Context) ([]app.Webhook, error) {
+	return querySQL[app.Webhook](ctx, ds, selectWebhooks+" ORDER BY webhook_created, webhook_id")
+}
+
+// UpdateWebhook replaces the webhook settings, the failure counter is reset
+// when the webhook is activated.
+func (ds *DataSource) UpdateWebhook(ctx context.Context, in *app.Webhook) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+
+	const query = `--sql
+	UPDATE webhooks
+	SET
+		webhook_url = :webhook_url,
+		webhook_secret = :webhook_secret,
+		webhook_events = :webhook_events,
+		webhook_failures = CASE WHEN :webhook_active AND NOT webhook_active THEN 0 ELSE webhook_failures END,
+		webhook_active = :webhook_active,
+		webhook_modified = :webhook_modified
+	WHERE webhook_id = :webhook_id
+	`
+	return updateSQL(ctx, ds, query, in)
+}
+
+func (ds *DataSource) DeleteWebhook(ctx context.Context, id string) error {
+	return deleteSQL(ctx, ds, `DELETE FROM webhooks WHERE webhook_id = ?`, id)
+}
+
+// RecordWebhookResult resets the failure counter of the webhook when the
+// delivery succeeded, otherwise it increments it and deactivates the webhook
+// once the counter reaches maxFailures.
+func (ds *DataSource) RecordWebhookResult(ctx context.Context, id string, succeeded bool, maxFailures int) (app.Webhook, error) {
+	const (
+		succeededQuery = `--sql
+		UPDATE webhooks
+		SET webhook_failures = 0
+		WHERE webhook_id = ?
+		`
+		failedQuery = `--sql
+		UPDATE webhooks
+		SET
+			webhook_failures = webhook_failures + 1,
+			webhook_active = CASE WHEN webhook_failures + 1 >= ? THEN false ELSE webhook_active END
+		WHERE webhook_id = ?
+		`
+	)
+
+	var err error
+	if succeeded {
+		_, err = ds.ExecContext(ctx, succeededQuery, id)
+	} else {
+		_, err = ds.ExecContext(ctx, failedQuery, maxFailures, id)
+	}
+	if err != nil {
+		return app.Webhook{}, app.ErrInternal("failed to record webhook %s result", id, err)
+	}
+
+	return ds.GetWebhook(ctx, id)
+}
+
+func (ds *DataSource) AddWebhookDelivery(ctx context.Context, in *app.WebhookDelivery) error {
+	const query = `--sql
+	INSERT INTO webhook_deliveries (
+		delivery_webhook_id,
+		delivery_event_id,
+		delivery_event_type,
+		delivery_attempt,
+		delivery_request,
+		delivery_key_id,
+		delivery_status_code,
+		delivery_error,
+		delivery_duration,
+		delivery_next_attempt,
+		delivery_created
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING delivery_id
+	`
+
+	request, keyID, err := ds.sealPayload(in.Request, deliveryAdditionalData(in.EventID))
+	if err != nil {
+		return app.ErrInternal("failed to encrypt webhook delivery", err)
+	}
+
+	in.Created = time.Now().Unix()
+	err = ds.GetContext(ctx, &in.ID, query,
+		in.WebhookID,
+		in.EventID,
+		in.EventType,
+		in.Attempt,
+		request,
+		keyID,
+		in.StatusCode,
+		in.Error,
+		in.Duration,
+		in.NextAttempt,
+		in.Created,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return app.ErrNotFound("webhook not found with id = %s", in.WebhookID, err)
+		}
+		return app.ErrInternal("failed to insert webhook delivery", err)
+	}
+	return nil
+}
+
+func (ds *DataSource) GetWebhookDelivery(ctx context.Context, webhookID string, id int64) (app.WebhookDelivery, error) {
+	const query = selectWebhookDeliveries + `
+	WHERE delivery_webhook_id = ?
+		AND delivery_id = ?
+	`
+
+	deliveries, err := ds.queryDeliveries(ctx, query, webhookID, id)
+	if err != nil {
+		return app.WebhookDelivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return app.WebhookDelivery{}, app.ErrNotFound("webhook delivery not found with id = %d", id)
+	}
+	return deliveries[0], nil
+}
+
+// FindWebhookDeliveries returns deliveries of the webhook, newest first.
+func (ds *DataSource) FindWebhookDeliveries(ctx context.Context, filter app.WebhookDeliveryFilter) ([]app.WebhookDelivery, error) {
+	const query = selectWebhookDeliveries + `
+	WHERE delivery_webhook_id = ?
+	ORDER BY delivery_id DESC
+	LIMIT ? OFFSET ?
+	`
+	return ds.queryDeliveries(ctx, query, filter.WebhookID, filter.Limit, filter.Offset)
+}
+
+// UpdateWebhookDelivery stores the outcome of the attempt, the request and
+// the event it belongs to don't change.
+func (ds *DataSource) UpdateWebhookDelivery(ctx context.Context, in *app.WebhookDelivery) error {
+	const query = `--sql
+	UPDATE webhook_deliveries
+	SET
+		delivery_status_code = :delivery_status_code,
+		delivery_error = :delivery_error,
+		delivery_duration = :delivery_duration,
+		delivery_next_attempt = :delivery_next_attempt
+	WHERE delivery_id = :delivery_id
+	`
+	return updateSQL(ctx, ds, query, in)
+}
+
+// DueWebhookDeliveries returns up to limit queued deliveries due at now,
+// the longest waiting first.
+func (ds *DataSource) DueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]app.WebhookDelivery, error) {
+	const query = selectWebhookDeliveries + `
+	WHERE delivery_next_attempt <= ?
+	ORDER BY delivery_next_attempt, delivery_id
+	LIMIT ?
+	`
+	return ds.queryDeliveries(ctx, query, now, limit)
+}
+
+// storedDelivery is the webhook delivery as read from the database, see
+// storedEvent.
+type storedDelivery struct {
+	app.WebhookDelivery
+	KeyID *string `db:"delivery_key_id"`
+}
+
+// queryDeliveries returns the deliveries selected by the query with their
+// requests decrypted.
+func (ds *DataSource) queryDeliveries(ctx context.Context, query string, args ...any) ([]app.WebhookDelivery, error) {
+	rows, err := querySQL[storedDelivery](ctx, ds, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]app.WebhookDelivery, len(rows))
+	for i, row := range rows {
+		deliveries[i] = row.WebhookDelivery
+		deliveries[i].Request, err = ds.openPayload(row.Request, row.KeyID, deliveryAdditionalData(row.EventID))
+		if err != nil {
+			return nil, app.ErrInternal("failed to decrypt webhook delivery %d", row.ID, err)
+		}
+	}
+	return deliveries, nil
+}
+
+func (db *DB) AddWebhook(ctx context.Context, in *app.Webhook) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		if err := tx.InsertWebhook(ctx, in); err != nil {
+			return err
+		}
+
+		created, err := tx.GetWebhook(ctx, in.ID)
+		if err != nil {
+			return err
+		}
+		*in = created
+
+		return tx.audit(ctx, app.AuditWebhookCreated, app.AuditTargetWebhook, in.ID, nil, created)
+	})
+}
+
+// AddWebhookDelivery stores the delivery in a transaction, outside one the
+// insert would be sent to the read pool since it returns the id.
+func (db *DB) AddWebhookDelivery(ctx context.Context, in *app.WebhookDelivery) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		return tx.AddWebhookDelivery(ctx, in)
+	})
+}
+
+// UpdateWebhook replaces the webhook settings, an empty secret keeps the
+// current one.
+func (db *DB) UpdateWebhook(ctx context.Context, in *app.Webhook) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		before, err := tx.GetWebhook(ctx, in.ID)
+		if err != nil {
+			return err
+		}
+
+		if in.Secret == "" {
+			in.Secret = before.Secret
+		}
+
+		if err = tx.UpdateWebhook(ctx, in); err != nil {
+			return err
+		}
+
+		updated, err := tx.GetWebhook(ctx, in.ID)
+		if err != nil {
+			return err
+		}
+		*in = updated
+
+		return tx.audit(ctx, app.AuditWebhookUpdated, app.AuditTargetWebhook, in.ID, before, updated)
+	})
+}
+
+// DeleteWebhook deletes the webhook with its delivery log.
+func (db *DB) DeleteWebhook(ctx context.Context, id string) error {
+	return db.inTx(ctx, func(ctx context.Context, tx *Transaction) error {
+		webhook, err := tx.GetWebhook(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.DeleteWebhook(ctx, id); err != nil {
+			return err
+		}
+
+		return tx.audit(ctx, app.AuditWebhookDeleted, app.AuditTargetWebhook, id, webhook, nil)
+	})
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"time"
 )
 
 type Authenticator interface {
@@ -9,6 +10,16 @@ type Authenticator interface {
 }
 
 type Storage interface {
+	//
+	// Units of work
+	//
+	// WithinTx runs fn in a transaction committed when fn succeeds. Storage
+	// calls made with the context passed to fn join the transaction, nested
+	// calls which fail only roll back their own changes. fn may be run again
+	// when the transaction conflicts with another one.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// WithinReadTx runs fn in a read-only transaction, see WithinTx.
+	WithinReadTx(ctx context.Context, fn func(ctx context.Context) error) error
 	//
 	// Users
 	//
@@ -17,8 +28,16 @@ type Storage interface {
 	UpdateUser(ctx context.Context, user *UserAggregate) error
 	UpdateUserPassword(ctx context.Context, filter UserFilter, password Password) error
 	DeleteUser(ctx context.Context, filter UserFilter) error
+	RestoreUser(ctx context.Context, filter UserFilter) error
 	FindUsers(ctx context.Context) ([]User, error)
 	FindAdmins(ctx context.Context) ([]User, error)
+	SearchUsers(ctx context.Context, filter UserSearchFilter) ([]UserSearchResult, error)
+	AddUserRole(ctx context.Context, userID, roleID string) error
+	RemoveUserRole(ctx context.Context, userID, roleID string) error
+	AddUserPermission(ctx context.Context, userID string, permission PermissionCheck) error
+	RemoveUserPermission(ctx context.Context, userID string, permission PermissionCheck) error
+	ExportUserData(ctx context.Context, id string) (UserDataExport, error)
+	EraseUser(ctx context.Context, id string) error
 	//
 	// Roles
 	//
@@ -26,5 +45,38 @@ type Storage interface {
 	GetRole(ctx context.Context, filter *IDOrNameFilter) (RoleAggregate, error)
 	UpdateRole(ctx context.Context, in *RoleAggregate, filter IDOrNameFilter) error
 	DeleteRole(ctx context.Context, filter *IDOrNameFilter) error
+	RestoreRole(ctx context.Context, filter *IDOrNameFilter) error
 	FindRoles(ctx context.Context, ids ...string) ([]Role, error)
+	AddRolePermission(ctx context.Context, roleID string, permission PermissionCheck) error
+	RemoveRolePermission(ctx context.Context, roleID string, permission PermissionCheck) error
+	//
+	// Audit
+	//
+	FindAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+	VerifyAuditLog(ctx context.Context) (AuditVerification, error)
+	//
+	// Webhooks
+	//
+	AddWebhook(ctx context.Context, in *Webhook) error
+	GetWebhook(ctx context.Context, id string) (Webhook, error)
+	UpdateWebhook(ctx context.Context, in *Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	FindWebhooks(ctx context.Context) ([]Webhook, error)
+	AddWebhookDelivery(ctx context.Context, in *WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, webhookID string, id int64) (WebhookDelivery, error)
+	FindWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, in *WebhookDelivery) error
+	// DueWebhookDeliveries returns up to limit queued deliveries due at now,
+	// the longest waiting first.
+	DueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]WebhookDelivery, error)
+	RecordWebhookResult(ctx context.Context, id string, succeeded bool, maxFailures int) (Webhook, error)
+	//
+	// Import and export
+	//
+	ExportRecords(ctx context.Context) ([]TransferRecord, error)
+	ImportRecords(ctx context.Context, records []TransferRecord, options ImportOptions) (ImportReport, error)
+	//
+	// Maintenance
+	//
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
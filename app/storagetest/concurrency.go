@@ -0,0 +1,75 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+// testConcurrency checks that concurrent changes neither get lost nor break
+// uniqueness.
+func testConcurrency(t *testing.T, b Backend) {
+	const (
+		workers = 8
+		roles   = 5
+	)
+	ctx := context.Background()
+
+	shared := addRole(t, b, "Shared")
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for k := 0; k < roles; k++ {
+				role := app.RoleAggregate{Role: app.Role{Name: fmt.Sprintf("Role %d-%d", worker, k)}}
+				if err := b.AddRole(ctx, &role); err != nil {
+					t.Errorf("AddRole(%s) error = %v", role.Name, err)
+				}
+			}
+
+			// only one of the workers gets the name
+			role := app.RoleAggregate{Role: app.Role{Name: "Contested"}}
+			switch err := b.AddRole(ctx, &role); app.ErrorStatus(err) {
+			case "":
+				mu.Lock()
+				created++
+				mu.Unlock()
+			case app.StatusConflict:
+			default:
+				t.Errorf("AddRole(%s) error = %v", role.Name, err)
+			}
+
+			permission := app.PermissionCheck{Permission: "edit_user", ResourceID: ptr.From(fmt.Sprint(worker))}
+			if err := b.AddRolePermission(ctx, shared.ID, permission); err != nil {
+				t.Errorf("AddRolePermission() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("role with contested name created %d times, want once", created)
+	}
+
+	got, err := b.FindRoles(ctx)
+	if err != nil || len(got) != workers*roles+2 {
+		t.Errorf("FindRoles() = %d roles, error = %v, want %d", len(got), err, workers*roles+2)
+	}
+
+	role, err := b.GetRole(ctx, &app.IDOrNameFilter{ID: shared.ID})
+	if err != nil || len(role.Permissions) != workers || role.Version != workers+1 {
+		t.Errorf("GetRole() = %d permissions at version %d, error = %v, want %d at version %d",
+			len(role.Permissions), role.Version, err, workers, workers+1)
+	}
+}
@@ -0,0 +1,121 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+func testAuthorize(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	editors := addRole(t, b, "Editors", app.PermissionCheck{Permission: "edit_user", ResourceID: ptr.From("u1")})
+	ann := addUser(t, b, "ann@example.com", "Ann", editors.ID)
+
+	// bob has no roles, only an own permission on all resources
+	bob := addUser(t, b, "bob@example.com", "Bob")
+	if err := b.AddUserPermission(ctx, bob.ID, app.PermissionCheck{Permission: "view_user"}); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := app.UserAggregate{User: app.User{
+		Active:   true,
+		Email:    "admin@example.com",
+		FullName: "Admin",
+		IsAdmin:  true,
+		Password: password,
+	}}
+	if err := b.AddUser(ctx, &admin); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(permission string, resourceID *string) app.PermissionCheck {
+		return app.PermissionCheck{Permission: permission, ResourceID: resourceID}
+	}
+
+	tests := []struct {
+		name        string
+		userID      string
+		permissions []app.PermissionCheck
+		want        bool
+	}{
+		{
+			name:        "admin has all permissions",
+			userID:      admin.ID,
+			permissions: []app.PermissionCheck{check("delete_user", ptr.From("u1"))},
+			want:        true,
+		},
+		{
+			name:        "permission of role on the resource",
+			userID:      ann.ID,
+			permissions: []app.PermissionCheck{check("edit_user", ptr.From("u1"))},
+			want:        true,
+		},
+		{
+			name:        "permission of role on other resource",
+			userID:      ann.ID,
+			permissions: []app.PermissionCheck{check("edit_user", ptr.From("u2"))},
+		},
+		{
+			name:        "permission of role on the resource without resource",
+			userID:      ann.ID,
+			permissions: []app.PermissionCheck{check("edit_user", nil)},
+		},
+		{
+			name:        "permission of role on the resource with empty resource",
+			userID:      ann.ID,
+			permissions: []app.PermissionCheck{check("edit_user", ptr.From(""))},
+		},
+		{
+			name:        "other permission",
+			userID:      ann.ID,
+			permissions: []app.PermissionCheck{check("delete_user", ptr.From("u1"))},
+		},
+		{
+			name:        "any of the permissions",
+			userID:      ann.ID,
+			permissions: []app.PermissionCheck{check("delete_user", nil), check("edit_user", ptr.From("u1"))},
+			want:        true,
+		},
+		{
+			name:        "permission on all resources without resource",
+			userID:      bob.ID,
+			permissions: []app.PermissionCheck{check("view_user", nil)},
+			want:        true,
+		},
+		{
+			name:        "permission on all resources with empty resource",
+			userID:      bob.ID,
+			permissions: []app.PermissionCheck{check("view_user", ptr.From(""))},
+			want:        true,
+		},
+		{
+			name:        "permission on all resources with resource",
+			userID:      bob.ID,
+			permissions: []app.PermissionCheck{check("view_user", ptr.From("u1"))},
+			want:        true,
+		},
+		{
+			name:        "permission of role the user doesn't have",
+			userID:      bob.ID,
+			permissions: []app.PermissionCheck{check("edit_user", ptr.From("u1"))},
+		},
+		{
+			name:   "no permissions",
+			userID: ann.ID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.Authorize(ctx, app.AuthUser{ID: tt.userID}, tt.permissions...)
+			if err != nil || got != tt.want {
+				t.Errorf("Authorize() = %v, error = %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	_, err := b.Authorize(ctx, app.AuthUser{ID: "missing"}, app.PermissionCheck{Permission: "view_user"})
+	wantStatus(t, "Authorize() of missing user", err, app.StatusNotFound)
+}
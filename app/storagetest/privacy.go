@@ -0,0 +1,127 @@
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+func testExportUserData(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	viewer := addRole(t, b, "viewer", app.PermissionCheck{Permission: app.PermissionViewUser})
+	ann := addUser(t, b, "ann@example.com", "Ann", viewer.ID)
+	bob := addUser(t, b, "bob@example.com", "Bob")
+
+	err := b.AddUserPermission(ctx, ann.ID, app.PermissionCheck{Permission: app.PermissionViewRole})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: password}); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes made by the user belong to the export too
+	actorCtx := app.ContextWithAuditActor(ctx, app.AuditActor{UserID: ann.ID})
+	if err = b.AddUserPermission(actorCtx, bob.ID, app.PermissionCheck{Permission: app.PermissionViewUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = b.DeleteUser(ctx, app.UserFilter{ID: ann.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := b.ExportUserData(ctx, ann.ID)
+	if err != nil {
+		t.Fatalf("ExportUserData() of deleted user error = %v", err)
+	}
+	if data.User.Email != "ann@example.com" || data.User.DeletedAt == nil || data.Exported == 0 {
+		t.Errorf("ExportUserData() user = %+v, want the deleted user", data.User.User)
+	}
+	if len(data.User.Permissions) != 1 || len(data.Roles) != 1 || len(data.Roles[0].Permissions) != 1 {
+		t.Errorf("ExportUserData() permissions = %v, roles = %v, want 1 of each with role permissions",
+			data.User.Permissions, data.Roles)
+	}
+	if data.Sessions.LastLogin == nil || len(data.Sessions.Logins) != 1 {
+		t.Errorf("ExportUserData() sessions = %+v, want last login and 1 login", data.Sessions)
+	}
+
+	actions := map[string]bool{}
+	for _, entry := range data.AuditEntries {
+		actions[entry.Action] = true
+	}
+	for _, action := range []string{app.AuditUserCreated, app.AuditUserPermissionAdded, app.AuditUserDeleted} {
+		if !actions[action] {
+			t.Errorf("ExportUserData() audit entries = %v, want %s", actions, action)
+		}
+	}
+	for _, entry := range data.AuditEntries {
+		if entry.TargetID == bob.ID && entry.ActorID != ann.ID {
+			t.Errorf("ExportUserData() has entry %d about another user", entry.ID)
+		}
+	}
+
+	entries, err := b.FindAuditEntries(ctx, app.AuditFilter{Action: app.AuditUserDataExported, Limit: 10})
+	if err != nil || len(entries) != 1 || entries[0].TargetID != ann.ID || len(entries[0].Changes) != 0 {
+		t.Errorf("FindAuditEntries() = %v, %v, want the export logged without data", entries, err)
+	}
+
+	_, err = b.ExportUserData(ctx, "missing")
+	wantStatus(t, "ExportUserData() of missing user", err, app.StatusNotFound)
+}
+
+func testEraseUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	role := addRole(t, b, "editor")
+	ann := addUser(t, b, "ann@example.com", "Ann Smith", role.ID)
+	if err := b.AddUserPermission(ctx, ann.ID, app.PermissionCheck{Permission: app.PermissionViewUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.EraseUser(ctx, ann.ID); err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+
+	_, err := b.GetUser(ctx, app.UserFilter{ID: ann.ID})
+	wantStatus(t, "GetUser() of erased user", err, app.StatusNotFound)
+	_, err = b.ExportUserData(ctx, ann.ID)
+	wantStatus(t, "ExportUserData() of erased user", err, app.StatusNotFound)
+	wantStatus(t, "EraseUser() of erased user", b.EraseUser(ctx, ann.ID), app.StatusNotFound)
+	wantStatus(t, "RestoreUser() of erased user", b.RestoreUser(ctx, app.UserFilter{ID: ann.ID}), app.StatusNotFound)
+
+	_, err = b.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: password})
+	wantStatus(t, "Authenticate() of erased user", err, app.StatusUnauthenticated)
+
+	// the email is free again
+	addUser(t, b, "ann@example.com", "Ann")
+
+	// erased users are kept, audit entries refer to them
+	if _, err = b.PurgeDeleted(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := b.FindAuditEntries(ctx, app.AuditFilter{TargetID: ann.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || entries[0].Action != app.AuditUserErased || len(entries[0].Changes) != 0 {
+		t.Fatalf("FindAuditEntries() = %v, want the erasure logged without data", entries)
+	}
+	changes, err := json.Marshal(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(changes), "Smith") {
+		t.Errorf("erasure audit entry = %s, want no personal data", changes)
+	}
+
+	if err = b.RestoreUser(ctx, app.UserFilter{Email: ptr.From("ann@example.com")}); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("RestoreUser() by email of erased user error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,98 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+func testRoles(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	editors := addRole(t, b, "Editors", app.PermissionCheck{Permission: "view_user"})
+
+	got, err := b.GetRole(ctx, &app.IDOrNameFilter{Name: "editors"})
+	if err != nil {
+		t.Fatalf("GetRole() by name error = %v", err)
+	}
+	if got.ID != editors.ID || got.Version != 1 || len(got.Permissions) != 1 {
+		t.Errorf("GetRole() = %+v, want id %s at version 1 with 1 permission", got, editors.ID)
+	}
+
+	duplicate := app.RoleAggregate{Role: app.Role{Name: "EDITORS"}}
+	wantStatus(t, "AddRole() with taken name", b.AddRole(ctx, &duplicate), app.StatusConflict)
+
+	_, err = b.GetRole(ctx, &app.IDOrNameFilter{ID: "missing"})
+	wantStatus(t, "GetRole() of missing role", err, app.StatusNotFound)
+
+	update := got
+	update.Name = "Writers"
+	if err = b.UpdateRole(ctx, &update, app.IDOrNameFilter{ID: editors.ID}); err != nil {
+		t.Fatalf("UpdateRole() error = %v", err)
+	}
+	if update.Version != 2 || update.Name != "Writers" {
+		t.Errorf("UpdateRole() = %+v, want version 2", update.Role)
+	}
+
+	stale := got
+	err = b.UpdateRole(ctx, &stale, app.IDOrNameFilter{ID: editors.ID})
+	wantStatus(t, "UpdateRole() with stale version", err, app.StatusPreconditionFailed)
+	err = b.DeleteRole(ctx, &app.IDOrNameFilter{ID: editors.ID, Version: got.Version})
+	wantStatus(t, "DeleteRole() with stale version", err, app.StatusPreconditionFailed)
+
+	edit := app.PermissionCheck{Permission: "edit_user", ResourceID: ptr.From("u1")}
+	for i := 0; i < 2; i++ {
+		if err = b.AddRolePermission(ctx, editors.ID, edit); err != nil {
+			t.Fatalf("AddRolePermission() error = %v", err)
+		}
+	}
+	if got, err = b.GetRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil || len(got.Permissions) != 2 {
+		t.Errorf("GetRole() permissions = %v, error = %v, want 2 permissions", got.Permissions, err)
+	}
+
+	err = b.RemoveRolePermission(ctx, editors.ID, app.PermissionCheck{Permission: "delete_user"})
+	wantStatus(t, "RemoveRolePermission() of missing permission", err, app.StatusNotFound)
+
+	filter := &app.IDOrNameFilter{ID: editors.ID}
+	if err = b.DeleteRole(ctx, filter); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	_, err = b.GetRole(ctx, filter)
+	wantStatus(t, "GetRole() of deleted role", err, app.StatusNotFound)
+	if roles, err := b.FindRoles(ctx); err != nil || len(roles) != 0 {
+		t.Errorf("FindRoles() = %v, error = %v, want no roles", roles, err)
+	}
+
+	if err = b.RestoreRole(ctx, filter); err != nil {
+		t.Fatalf("RestoreRole() error = %v", err)
+	}
+	if roles, err := b.FindRoles(ctx); err != nil || len(roles) != 1 {
+		t.Errorf("FindRoles() = %v, error = %v, want the restored role", roles, err)
+	}
+}
+
+func testRoleUniqueness(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	editors := addRole(t, b, "Editors")
+	viewers := addRole(t, b, "Viewers")
+
+	sameID := app.RoleAggregate{Role: app.Role{ID: editors.ID, Name: "Writers"}}
+	wantStatus(t, "AddRole() with taken id", b.AddRole(ctx, &sameID), app.StatusConflict)
+
+	viewers.Name = "editors"
+	viewers.Version = 0
+	err := b.UpdateRole(ctx, &viewers, app.IDOrNameFilter{ID: viewers.ID})
+	wantStatus(t, "UpdateRole() to taken name", err, app.StatusConflict)
+
+	// names of deleted roles are free, the roles can't be restored while
+	// taken
+	if err = b.DeleteRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+		t.Fatal(err)
+	}
+	addRole(t, b, "EDITORS")
+	err = b.RestoreRole(ctx, &app.IDOrNameFilter{ID: editors.ID})
+	wantStatus(t, "RestoreRole() with taken name", err, app.StatusConflict)
+}
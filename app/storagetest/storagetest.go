@@ -0,0 +1,310 @@
+// Package storagetest checks that implementations of the app storage,
+// authenticator and authorizer behave the same way, so they can be used in
+// place of each other.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+// Backend is the implementation under test.
+type Backend interface {
+	app.Storage
+	app.Authenticator
+	app.Authorizer
+}
+
+const password = "Xq9!long-pass"
+
+// Run runs the conformance tests against backends created with newBackend,
+// every test gets an empty backend of its own.
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b Backend)
+	}{
+		{name: "users", test: testUsers},
+		{name: "user uniqueness", test: testUserUniqueness},
+		{name: "user permissions", test: testUserPermissions},
+		{name: "roles", test: testRoles},
+		{name: "role uniqueness", test: testRoleUniqueness},
+		{name: "user roles", test: testUserRoles},
+		{name: "not found", test: testNotFound},
+		{name: "cascade on delete", test: testCascade},
+		{name: "purge deleted", test: testPurgeDeleted},
+		{name: "authenticate", test: testAuthenticate},
+		{name: "authorize", test: testAuthorize},
+		{name: "search", test: testSearch},
+		{name: "export user data", test: testExportUserData},
+		{name: "erase user", test: testEraseUser},
+		{name: "webhooks", test: testWebhooks},
+		{name: "within tx", test: testWithinTx},
+		{name: "within read tx", test: testWithinReadTx},
+		{name: "concurrency", test: testConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t))
+		})
+	}
+}
+
+func wantStatus(t *testing.T, op string, err error, status app.Status) {
+	t.Helper()
+	if got := app.ErrorStatus(err); err == nil || got != status {
+		t.Errorf("%s error = %v, want status %s", op, err, status)
+	}
+}
+
+func addUser(t *testing.T, b Backend, email, fullName string, roles ...string) app.UserAggregate {
+	t.Helper()
+	user := app.UserAggregate{
+		User: app.User{
+			Active:   true,
+			Email:    app.Email(email),
+			FullName: fullName,
+			Password: password,
+		},
+		Roles: roles,
+	}
+	if err := b.AddUser(context.Background(), &user); err != nil {
+		t.Fatalf("AddUser(%s) error = %v", email, err)
+	}
+	return user
+}
+
+func addRole(t *testing.T, b Backend, name string, permissions ...app.PermissionCheck) app.RoleAggregate {
+	t.Helper()
+	role := app.RoleAggregate{
+		Role:        app.Role{Name: name},
+		Permissions: permissions,
+	}
+	if err := b.AddRole(context.Background(), &role); err != nil {
+		t.Fatalf("AddRole(%s) error = %v", name, err)
+	}
+	return role
+}
+
+func testNotFound(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	ann := addUser(t, b, "ann@example.com", "Ann")
+	editors := addRole(t, b, "Editors")
+	view := app.PermissionCheck{Permission: "view_user"}
+	missing := &app.IDOrNameFilter{ID: "missing"}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "GetUser",
+			call: func() error {
+				_, err := b.GetUser(ctx, app.UserFilter{ID: "missing"})
+				return err
+			},
+		},
+		{
+			name: "UpdateUser",
+			call: func() error {
+				return b.UpdateUser(ctx, &app.UserAggregate{User: app.User{ID: "missing", Email: "bob@example.com", FullName: "Bob"}})
+			},
+		},
+		{
+			name: "UpdateUserPassword",
+			call: func() error {
+				return b.UpdateUserPassword(ctx, app.UserFilter{ID: "missing"}, password)
+			},
+		},
+		{
+			name: "DeleteUser",
+			call: func() error { return b.DeleteUser(ctx, app.UserFilter{ID: "missing"}) },
+		},
+		{
+			name: "RestoreUser",
+			call: func() error { return b.RestoreUser(ctx, app.UserFilter{ID: "missing"}) },
+		},
+		{
+			name: "AddUserRole",
+			call: func() error { return b.AddUserRole(ctx, "missing", editors.ID) },
+		},
+		{
+			name: "RemoveUserRole",
+			call: func() error { return b.RemoveUserRole(ctx, ann.ID, editors.ID) },
+		},
+		{
+			name: "AddUserPermission",
+			call: func() error { return b.AddUserPermission(ctx, "missing", view) },
+		},
+		{
+			name: "RemoveUserPermission",
+			call: func() error { return b.RemoveUserPermission(ctx, ann.ID, view) },
+		},
+		{
+			name: "GetRole",
+			call: func() error {
+				_, err := b.GetRole(ctx, missing)
+				return err
+			},
+		},
+		{
+			name: "UpdateRole",
+			call: func() error {
+				return b.UpdateRole(ctx, &app.RoleAggregate{Role: app.Role{Name: "Viewers"}}, *missing)
+			},
+		},
+		{
+			name: "DeleteRole",
+			call: func() error { return b.DeleteRole(ctx, missing) },
+		},
+		{
+			name: "RestoreRole",
+			call: func() error { return b.RestoreRole(ctx, &app.IDOrNameFilter{ID: editors.ID}) },
+		},
+		{
+			name: "AddRolePermission",
+			call: func() error { return b.AddRolePermission(ctx, "missing", view) },
+		},
+		{
+			name: "RemoveRolePermission",
+			call: func() error { return b.RemoveRolePermission(ctx, editors.ID, view) },
+		},
+		{
+			name: "GetWebhook",
+			call: func() error {
+				_, err := b.GetWebhook(ctx, "missing")
+				return err
+			},
+		},
+		{
+			name: "UpdateWebhook",
+			call: func() error {
+				webhook := newWebhook()
+				webhook.ID = "missing"
+				return b.UpdateWebhook(ctx, &webhook)
+			},
+		},
+		{
+			name: "DeleteWebhook",
+			call: func() error { return b.DeleteWebhook(ctx, "missing") },
+		},
+		{
+			name: "RecordWebhookResult",
+			call: func() error {
+				_, err := b.RecordWebhookResult(ctx, "missing", false, 3)
+				return err
+			},
+		},
+		{
+			name: "AddWebhookDelivery",
+			call: func() error {
+				return b.AddWebhookDelivery(ctx, &app.WebhookDelivery{WebhookID: "missing", EventType: app.EventUserCreated})
+			},
+		},
+		{
+			name: "GetWebhookDelivery",
+			call: func() error {
+				_, err := b.GetWebhookDelivery(ctx, "missing", 1)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantStatus(t, tt.name+"()", tt.call(), app.StatusNotFound)
+		})
+	}
+}
+
+// testCascade checks that deleting a row takes its dependent rows along.
+func testCascade(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	edit := app.PermissionCheck{Permission: "edit_user", ResourceID: ptr.From("u1")}
+	editors := addRole(t, b, "Editors", edit)
+	ann := addUser(t, b, "ann@example.com", "Ann", editors.ID)
+	session := app.AuthUser{ID: ann.ID}
+
+	authorized := func() bool {
+		t.Helper()
+		got, err := b.Authorize(ctx, session, edit)
+		if err != nil {
+			t.Fatalf("Authorize() error = %v", err)
+		}
+		return got
+	}
+
+	if !authorized() {
+		t.Fatal("Authorize() = false with permission of role")
+	}
+
+	// permissions of deleted roles don't apply
+	filter := &app.IDOrNameFilter{ID: editors.ID}
+	if err := b.DeleteRole(ctx, filter); err != nil {
+		t.Fatal(err)
+	}
+	if authorized() {
+		t.Error("Authorize() = true with permission of deleted role")
+	}
+	if err := b.RestoreRole(ctx, filter); err != nil {
+		t.Fatal(err)
+	}
+	if !authorized() {
+		t.Error("Authorize() = false with permission of restored role")
+	}
+
+	if err := b.DeleteUser(ctx, app.UserFilter{ID: ann.ID}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := b.Authorize(ctx, session, edit)
+	wantStatus(t, "Authorize() of deleted user", err, app.StatusNotFound)
+
+	webhook := newWebhook()
+	if err = b.AddWebhook(ctx, &webhook); err != nil {
+		t.Fatal(err)
+	}
+	delivery := app.WebhookDelivery{WebhookID: webhook.ID, EventID: 1, EventType: app.EventUserCreated, Attempt: 1}
+	if err = b.AddWebhookDelivery(ctx, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.DeleteWebhook(ctx, webhook.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetWebhookDelivery(ctx, webhook.ID, delivery.ID)
+	wantStatus(t, "GetWebhookDelivery() of deleted webhook", err, app.StatusNotFound)
+}
+
+func testPurgeDeleted(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	editors := addRole(t, b, "Editors")
+	ann := addUser(t, b, "ann@example.com", "Ann")
+	bob := addUser(t, b, "bob@example.com", "Bob", editors.ID)
+
+	if err := b.DeleteUser(ctx, app.UserFilter{ID: ann.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := b.PurgeDeleted(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PurgeDeleted() of recent deletes = %d, error = %v, want 0", n, err)
+	}
+	if n, err := b.PurgeDeleted(ctx, time.Now().Add(time.Second)); err != nil || n != 2 {
+		t.Errorf("PurgeDeleted() = %d, error = %v, want 2", n, err)
+	}
+
+	wantStatus(t, "RestoreUser() of purged user", b.RestoreUser(ctx, app.UserFilter{ID: ann.ID}), app.StatusNotFound)
+	wantStatus(t, "RestoreRole() of purged role", b.RestoreRole(ctx, &app.IDOrNameFilter{ID: editors.ID}), app.StatusNotFound)
+
+	got, err := b.GetUser(ctx, app.UserFilter{ID: bob.ID})
+	if err != nil || len(got.Roles) != 0 {
+		t.Errorf("GetUser() roles = %v, error = %v, want none", got.Roles, err)
+	}
+}
@@ -0,0 +1,127 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+// testWithinTx checks that storage calls join the unit of work of the
+// context and that nested units roll back on their own.
+func testWithinTx(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	var (
+		editors app.RoleAggregate
+		ann     app.UserAggregate
+	)
+	err := b.WithinTx(ctx, func(ctx context.Context) error {
+		editors = app.RoleAggregate{Role: app.Role{Name: "Editors"}}
+		if err := b.AddRole(ctx, &editors); err != nil {
+			return err
+		}
+
+		// the role isn't committed yet, the user sees it in the transaction
+		ann = app.UserAggregate{
+			User:  app.User{Active: true, Email: "ann@example.com", FullName: "Ann", Password: password},
+			Roles: []string{editors.ID},
+		}
+		if err := b.AddUser(ctx, &ann); err != nil {
+			return err
+		}
+
+		// a failed call leaves the transaction usable
+		duplicate := app.RoleAggregate{Role: app.Role{Name: "editors"}}
+		wantStatus(t, "AddRole() with taken name", b.AddRole(ctx, &duplicate), app.StatusConflict)
+
+		nested := errors.New("nested")
+		err := b.WithinTx(ctx, func(ctx context.Context) error {
+			viewers := app.RoleAggregate{Role: app.Role{Name: "Viewers"}}
+			if err := b.AddRole(ctx, &viewers); err != nil {
+				return err
+			}
+			return nested
+		})
+		if !errors.Is(err, nested) {
+			t.Errorf("nested WithinTx() error = %v, want %v", err, nested)
+		}
+
+		_, err = b.GetRole(ctx, &app.IDOrNameFilter{Name: "Viewers"})
+		wantStatus(t, "GetRole() rolled back by nested WithinTx", err, app.StatusNotFound)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx() error = %v", err)
+	}
+
+	roles, err := b.FindRoles(ctx)
+	if err != nil || len(roles) != 1 || roles[0].ID != editors.ID {
+		t.Errorf("FindRoles() = %v, error = %v, want only %s", roles, err, editors.Name)
+	}
+	got, err := b.GetUser(ctx, app.UserFilter{ID: ann.ID})
+	if err != nil || len(got.Roles) != 1 || got.Roles[0] != editors.ID {
+		t.Errorf("GetUser() roles = %v, error = %v, want %s", got.Roles, err, editors.ID)
+	}
+
+	failed := errors.New("failed")
+	err = b.WithinTx(ctx, func(ctx context.Context) error {
+		if err := b.DeleteRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("WithinTx() error = %v, want %v", err, failed)
+	}
+	if _, err = b.GetRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+		t.Errorf("GetRole() of role deleted in failed WithinTx() error = %v", err)
+	}
+
+	entries, err := b.FindAuditEntries(ctx, app.AuditFilter{Action: app.AuditRoleDeleted})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("FindAuditEntries() = %d entries, error = %v, want none of the rolled back deletion", len(entries), err)
+	}
+}
+
+// testWithinReadTx checks that read-only units of work read but don't
+// write.
+func testWithinReadTx(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	editors := addRole(t, b, "Editors")
+
+	err := b.WithinReadTx(ctx, func(ctx context.Context) error {
+		if _, err := b.GetRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+			return err
+		}
+
+		viewers := app.RoleAggregate{Role: app.Role{Name: "Viewers"}}
+		if err := b.AddRole(ctx, &viewers); err == nil {
+			t.Error("AddRole() in WithinReadTx() error = nil")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinReadTx() error = %v", err)
+	}
+
+	_, err = b.GetRole(ctx, &app.IDOrNameFilter{Name: "Viewers"})
+	wantStatus(t, "GetRole() of role added in WithinReadTx()", err, app.StatusNotFound)
+
+	// reads nested in a write transaction see its changes
+	err = b.WithinTx(ctx, func(ctx context.Context) error {
+		viewers := app.RoleAggregate{Role: app.Role{Name: "Viewers"}}
+		if err := b.AddRole(ctx, &viewers); err != nil {
+			return err
+		}
+		return b.WithinReadTx(ctx, func(ctx context.Context) error {
+			_, err := b.GetRole(ctx, &app.IDOrNameFilter{ID: viewers.ID})
+			return err
+		})
+	})
+	if err != nil {
+		t.Errorf("WithinReadTx() nested in WithinTx() error = %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/pkg/ptr"
+)
+
+func testUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	ann := addUser(t, b, "ann@example.com", "Ann")
+	if ann.ID == "" || ann.Created == 0 {
+		t.Fatalf("AddUser() = %+v, want id and created set", ann.User)
+	}
+
+	got, err := b.GetUser(ctx, app.UserFilter{Email: ptr.From("ANN@example.com")})
+	if err != nil {
+		t.Fatalf("GetUser() by email error = %v", err)
+	}
+	if got.ID != ann.ID || got.Version != 1 || got.Password != "" {
+		t.Errorf("GetUser() = %+v, want id %s at version 1 without password", got.User, ann.ID)
+	}
+
+	duplicate := app.UserAggregate{User: app.User{Email: "Ann@Example.com", FullName: "Ann", Password: password}}
+	wantStatus(t, "AddUser() with taken email", b.AddUser(ctx, &duplicate), app.StatusConflict)
+
+	_, err = b.GetUser(ctx, app.UserFilter{ID: "missing"})
+	wantStatus(t, "GetUser() of missing user", err, app.StatusNotFound)
+
+	update := got
+	update.FullName = "Ann Smith"
+	if err = b.UpdateUser(ctx, &update); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if update.Version != 2 || update.FullName != "Ann Smith" || update.Modified == nil {
+		t.Errorf("UpdateUser() = %+v, want version 2", update.User)
+	}
+
+	stale := got
+	wantStatus(t, "UpdateUser() with stale version", b.UpdateUser(ctx, &stale), app.StatusPreconditionFailed)
+
+	missing := got
+	missing.ID = "missing"
+	missing.Version = 0
+	wantStatus(t, "UpdateUser() of missing user", b.UpdateUser(ctx, &missing), app.StatusNotFound)
+
+	users, err := b.FindUsers(ctx)
+	if err != nil || len(users) != 1 {
+		t.Errorf("FindUsers() = %v, error = %v, want 1 user", users, err)
+	}
+
+	filter := app.UserFilter{ID: ann.ID, Version: got.Version}
+	wantStatus(t, "DeleteUser() with stale version", b.DeleteUser(ctx, filter), app.StatusPreconditionFailed)
+	filter.Version = 0
+	if err = b.DeleteUser(ctx, filter); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	_, err = b.GetUser(ctx, filter)
+	wantStatus(t, "GetUser() of deleted user", err, app.StatusNotFound)
+	wantStatus(t, "DeleteUser() of deleted user", b.DeleteUser(ctx, filter), app.StatusNotFound)
+
+	if err = b.RestoreUser(ctx, filter); err != nil {
+		t.Fatalf("RestoreUser() error = %v", err)
+	}
+	if got, err = b.GetUser(ctx, filter); err != nil || got.Version != 4 {
+		t.Errorf("GetUser() of restored user = %+v, error = %v, want version 4", got.User, err)
+	}
+	wantStatus(t, "RestoreUser() of active user", b.RestoreUser(ctx, filter), app.StatusNotFound)
+}
+
+func testUserRoles(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	editors := addRole(t, b, "Editors")
+	viewers := addRole(t, b, "Viewers")
+	ann := addUser(t, b, "ann@example.com", "Ann", editors.ID)
+
+	if err := b.AddUserRole(ctx, ann.ID, viewers.ID); err != nil {
+		t.Fatalf("AddUserRole() error = %v", err)
+	}
+	if err := b.AddUserRole(ctx, ann.ID, viewers.ID); err != nil {
+		t.Errorf("AddUserRole() of assigned role error = %v", err)
+	}
+	wantStatus(t, "AddUserRole() of missing role", b.AddUserRole(ctx, ann.ID, "missing"), app.StatusInvalid)
+
+	roles := func() []string {
+		t.Helper()
+		got, err := b.GetUser(ctx, app.UserFilter{ID: ann.ID})
+		if err != nil {
+			t.Fatalf("GetUser() error = %v", err)
+		}
+		return got.Roles
+	}
+	if got := roles(); len(got) != 2 {
+		t.Errorf("user roles = %v, want 2 roles", got)
+	}
+
+	// deleted roles aren't listed, they come back on restore even when the
+	// user was updated in the meantime
+	if err := b.DeleteRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); len(got) != 1 || got[0] != viewers.ID {
+		t.Errorf("user roles after role delete = %v, want [%s]", got, viewers.ID)
+	}
+	user, err := b.GetUser(ctx, app.UserFilter{ID: ann.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.UpdateUser(ctx, &user); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if err := b.RestoreRole(ctx, &app.IDOrNameFilter{ID: editors.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); len(got) != 2 {
+		t.Errorf("user roles after role restore = %v, want 2 roles", got)
+	}
+
+	if err := b.RemoveUserRole(ctx, ann.ID, viewers.ID); err != nil {
+		t.Fatalf("RemoveUserRole() error = %v", err)
+	}
+	wantStatus(t, "RemoveUserRole() of removed role", b.RemoveUserRole(ctx, ann.ID, viewers.ID), app.StatusNotFound)
+	if got := roles(); len(got) != 1 || got[0] != editors.ID {
+		t.Errorf("user roles = %v, want [%s]", got, editors.ID)
+	}
+}
+
+func testAuthenticate(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	ann := addUser(t, b, "ann@example.com", "Ann")
+
+	got, err := b.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: password})
+	if err != nil || got.ID != ann.ID || got.Salt == "" {
+		t.Errorf("Authenticate() = %+v, error = %v, want user %s", got, err, ann.ID)
+	}
+
+	_, err = b.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: password + "!"})
+	wantStatus(t, "Authenticate() with wrong password", err, app.StatusUnauthenticated)
+
+	_, err = b.Authenticate(ctx, app.Credentials{Email: "bob@example.com", Password: password})
+	wantStatus(t, "Authenticate() of missing user", err, app.StatusUnauthenticated)
+
+	ann.Active = false
+	ann.Version = 0
+	if err = b.UpdateUser(ctx, &ann); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Authenticate(ctx, app.Credentials{Email: "ann@example.com", Password: password})
+	wantStatus(t, "Authenticate() of deactivated user", err, app.StatusUnauthenticated)
+}
+
+func testUserUniqueness(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	ann := addUser(t, b, "ann@example.com", "Ann")
+	bob := addUser(t, b, "bob@example.com", "Bob")
+
+	sameID := app.UserAggregate{User: app.User{ID: ann.ID, Email: "cid@example.com", FullName: "Cid", Password: password}}
+	wantStatus(t, "AddUser() with taken id", b.AddUser(ctx, &sameID), app.StatusConflict)
+
+	bob.Email = "ANN@example.com"
+	bob.Version = 0
+	wantStatus(t, "UpdateUser() to taken email", b.UpdateUser(ctx, &bob), app.StatusConflict)
+
+	// emails of deleted users are free, their owners can't be restored
+	// while taken
+	if err := b.DeleteUser(ctx, app.UserFilter{ID: ann.ID}); err != nil {
+		t.Fatal(err)
+	}
+	addUser(t, b, "Ann@Example.com", "Ann Again")
+	err := b.RestoreUser(ctx, app.UserFilter{ID: ann.ID})
+	wantStatus(t, "RestoreUser() with taken email", err, app.StatusConflict)
+}
+
+func testUserPermissions(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	ann := addUser(t, b, "ann@example.com", "Ann")
+
+	permissions := func() []app.PermissionCheck {
+		t.Helper()
+		got, err := b.GetUser(ctx, app.UserFilter{ID: ann.ID})
+		if err != nil {
+			t.Fatalf("GetUser() error = %v", err)
+		}
+		return got.Permissions
+	}
+
+	view := app.PermissionCheck{Permission: "view_user"}
+	edit := app.PermissionCheck{Permission: "edit_user", ResourceID: ptr.From("u1")}
+	for _, permission := range []app.PermissionCheck{view, edit, edit} {
+		if err := b.AddUserPermission(ctx, ann.ID, permission); err != nil {
+			t.Fatalf("AddUserPermission(%s) error = %v", permission.Permission, err)
+		}
+	}
+
+	// no resource is the same as an empty one
+	err := b.AddUserPermission(ctx, ann.ID, app.PermissionCheck{Permission: "view_user", ResourceID: ptr.From("")})
+	if err != nil {
+		t.Fatalf("AddUserPermission() error = %v", err)
+	}
+	if got := permissions(); len(got) != 2 {
+		t.Errorf("user permissions = %v, want 2 permissions", got)
+	}
+
+	err = b.AddUserPermission(ctx, ann.ID, app.PermissionCheck{})
+	wantStatus(t, "AddUserPermission() without permission", err, app.StatusInvalid)
+
+	if err = b.RemoveUserPermission(ctx, ann.ID, edit); err != nil {
+		t.Fatalf("RemoveUserPermission() error = %v", err)
+	}
+	err = b.RemoveUserPermission(ctx, ann.ID, edit)
+	wantStatus(t, "RemoveUserPermission() of removed permission", err, app.StatusNotFound)
+	err = b.RemoveUserPermission(ctx, ann.ID, app.PermissionCheck{Permission: "view_user", ResourceID: ptr.From("u1")})
+	wantStatus(t, "RemoveUserPermission() on other resource", err, app.StatusNotFound)
+
+	if got := permissions(); len(got) != 1 || got[0].Permission != "view_user" {
+		t.Errorf("user permissions = %v, want [view_user]", got)
+	}
+
+	// replaced with the user
+	user, err := b.GetUser(ctx, app.UserFilter{ID: ann.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Permissions = []app.PermissionCheck{edit}
+	if err = b.UpdateUser(ctx, &user); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if got := permissions(); len(got) != 1 || got[0].Permission != "edit_user" {
+		t.Errorf("user permissions after update = %v, want [edit_user]", got)
+	}
+}
+
+func testSearch(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	ann := addUser(t, b, "ann@example.com", "Ann Smith")
+	addUser(t, b, "bob@example.com", "Bob Jones")
+
+	got, err := b.SearchUsers(ctx, app.UserSearchFilter{Query: "smi", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchUsers() error = %v", err)
+	}
+	if len(got) != 1 || got[0].ID != ann.ID || got[0].Highlight.FullName != "Ann <mark>Smith</mark>" {
+		t.Errorf("SearchUsers() = %+v, want Ann with highlighted name", got)
+	}
+
+	// highlights are escaped
+	addUser(t, b, "eve@example.com", `Eve <img src=x onerror=alert(1)>`)
+	got, err = b.SearchUsers(ctx, app.UserSearchFilter{Query: "eve img", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchUsers() error = %v", err)
+	}
+	if want := "<mark>Eve</mark> &lt;<mark>img</mark> src=x onerror=alert(1)&gt;"; len(got) != 1 || got[0].Highlight.FullName != want {
+		t.Errorf("SearchUsers() = %+v, want highlight %s", got, want)
+	}
+
+	if got, err = b.SearchUsers(ctx, app.UserSearchFilter{Query: "nobody", Limit: 10}); err != nil || len(got) != 0 {
+		t.Errorf("SearchUsers() without matches = %+v, error = %v", got, err)
+	}
+
+	_, err = b.SearchUsers(ctx, app.UserSearchFilter{Query: "  ", Limit: 10})
+	wantStatus(t, "SearchUsers() without query", err, app.StatusInvalid)
+
+	// deleted users aren't found
+	if err = b.DeleteUser(ctx, app.UserFilter{ID: ann.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = b.SearchUsers(ctx, app.UserSearchFilter{Query: "ann", Limit: 10}); err != nil || len(got) != 0 {
+		t.Errorf("SearchUsers() of deleted user = %+v, error = %v", got, err)
+	}
+}
@@ -0,0 +1,139 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/enverbisevac/go-project/app"
+)
+
+func newWebhook() app.Webhook {
+	return app.Webhook{
+		URL:    "https://example.com/hooks",
+		Secret: "0123456789abcdef",
+		Events: app.EventPatterns{"user.*"},
+		Active: true,
+	}
+}
+
+func testWebhooks(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	invalid := newWebhook()
+	invalid.URL = "ftp://example.com"
+	wantStatus(t, "AddWebhook() with invalid url", b.AddWebhook(ctx, &invalid), app.StatusInvalid)
+
+	webhook := newWebhook()
+	if err := b.AddWebhook(ctx, &webhook); err != nil {
+		t.Fatalf("AddWebhook() error = %v", err)
+	}
+	if webhook.ID == "" || webhook.Created == 0 {
+		t.Fatalf("AddWebhook() = %+v, want id and created set", webhook)
+	}
+
+	// an empty secret keeps the current one
+	update := webhook
+	update.URL = "https://example.com/other"
+	update.Secret = ""
+	if err := b.UpdateWebhook(ctx, &update); err != nil {
+		t.Fatalf("UpdateWebhook() error = %v", err)
+	}
+	got, err := b.GetWebhook(ctx, webhook.ID)
+	if err != nil || got.URL != update.URL || got.Secret != webhook.Secret || got.Modified == nil {
+		t.Errorf("GetWebhook() = %+v, error = %v, want updated url and kept secret", got, err)
+	}
+
+	record := func(succeeded bool, wantFailures int, wantActive bool) {
+		t.Helper()
+		got, err := b.RecordWebhookResult(ctx, webhook.ID, succeeded, 3)
+		if err != nil || got.Failures != wantFailures || got.Active != wantActive {
+			t.Errorf("RecordWebhookResult(%v) = %d failures, active %v, error = %v, want %d, %v",
+				succeeded, got.Failures, got.Active, err, wantFailures, wantActive)
+		}
+	}
+	record(false, 1, true)
+	record(true, 0, true)
+	record(false, 1, true)
+	record(false, 2, true)
+	record(false, 3, false)
+
+	// activating the webhook resets the failures
+	got.Active = true
+	if err = b.UpdateWebhook(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Failures != 0 || !got.Active {
+		t.Errorf("UpdateWebhook() = %d failures, active %v, want 0, true", got.Failures, got.Active)
+	}
+
+	var ids []int64
+	for attempt := 1; attempt <= 3; attempt++ {
+		delivery := app.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			EventID:    1,
+			EventType:  app.EventUserCreated,
+			Attempt:    attempt,
+			Request:    app.EventPayload(`{"id":1}`),
+			StatusCode: 500,
+		}
+		if err = b.AddWebhookDelivery(ctx, &delivery); err != nil {
+			t.Fatalf("AddWebhookDelivery() error = %v", err)
+		}
+		ids = append(ids, delivery.ID)
+	}
+
+	deliveries, err := b.FindWebhookDeliveries(ctx, app.WebhookDeliveryFilter{WebhookID: webhook.ID, Limit: 2})
+	if err != nil || len(deliveries) != 2 || deliveries[0].ID != ids[2] || deliveries[1].ID != ids[1] {
+		t.Errorf("FindWebhookDeliveries() = %+v, error = %v, want deliveries %v newest first", deliveries, err, ids[1:])
+	}
+
+	delivery, err := b.GetWebhookDelivery(ctx, webhook.ID, ids[0])
+	if err != nil || delivery.Attempt != 1 || string(delivery.Request) != `{"id":1}` {
+		t.Errorf("GetWebhookDelivery() = %+v, error = %v", delivery, err)
+	}
+	_, err = b.GetWebhookDelivery(ctx, "other", ids[0])
+	wantStatus(t, "GetWebhookDelivery() of other webhook", err, app.StatusNotFound)
+
+	// queued deliveries are due at their next attempt
+	var queued []app.WebhookDelivery
+	for _, next := range []int64{200, 100, 300} {
+		delivery := app.WebhookDelivery{
+			WebhookID:   webhook.ID,
+			EventID:     2,
+			EventType:   app.EventUserUpdated,
+			Attempt:     1,
+			Request:     app.EventPayload(`{"id":2}`),
+			NextAttempt: &next,
+		}
+		if err = b.AddWebhookDelivery(ctx, &delivery); err != nil {
+			t.Fatalf("AddWebhookDelivery() error = %v", err)
+		}
+		queued = append(queued, delivery)
+	}
+	due, err := b.DueWebhookDeliveries(ctx, 250, 10)
+	if err != nil || len(due) != 2 || due[0].ID != queued[1].ID || due[1].ID != queued[0].ID {
+		t.Errorf("DueWebhookDeliveries() = %+v, error = %v, want deliveries %d, %d", due, err, queued[1].ID, queued[0].ID)
+	}
+
+	sent := due[0]
+	sent.StatusCode = 204
+	sent.Duration = 12
+	sent.NextAttempt = nil
+	if err = b.UpdateWebhookDelivery(ctx, &sent); err != nil {
+		t.Fatalf("UpdateWebhookDelivery() error = %v", err)
+	}
+	stored, err := b.GetWebhookDelivery(ctx, webhook.ID, sent.ID)
+	if err != nil || stored.StatusCode != 204 || stored.Duration != 12 || stored.NextAttempt != nil {
+		t.Errorf("GetWebhookDelivery() = %+v, error = %v, want the sent delivery", stored, err)
+	}
+	if due, err = b.DueWebhookDeliveries(ctx, 250, 10); err != nil || len(due) != 1 || due[0].ID != queued[0].ID {
+		t.Errorf("DueWebhookDeliveries() = %+v, error = %v, want delivery %d", due, err, queued[0].ID)
+	}
+
+	missing := app.WebhookDelivery{ID: -1}
+	wantStatus(t, "UpdateWebhookDelivery() of missing delivery", b.UpdateWebhookDelivery(ctx, &missing), app.StatusNotFound)
+
+	if webhooks, err := b.FindWebhooks(ctx); err != nil || len(webhooks) != 1 {
+		t.Errorf("FindWebhooks() = %v, error = %v, want 1 webhook", webhooks, err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package tracing traces requests with OpenTelemetry. Spans started before
+// Setup, or without it, are not recorded and cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/enverbisevac/go-project/version"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName names the app in traces.
+const ServiceName = "go-project"
+
+// Exporters of spans.
+const (
+	// ExporterNone doesn't record spans.
+	ExporterNone = "none"
+	// ExporterOTLP sends spans to an OTLP/HTTP collector.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to stdout, or to File when it is
+	// set.
+	ExporterStdout = "stdout"
+)
+
+// instrumentationName names the tracer of the app.
+const instrumentationName = "github.com/enverbisevac/go-project"
+
+type Config struct {
+	Exporter string
+	// Endpoint is the URL of the OTLP collector, like
+	// http://localhost:4318/v1/traces. Empty uses the OTEL_EXPORTER_OTLP_*
+	// environment variables or the default of the collector.
+	Endpoint string
+	// File the stdout exporter writes to.
+	File string
+	// SampleRatio is the ratio of traces started by the app which are
+	// recorded, traces of callers are recorded when the caller records
+	// them.
+	SampleRatio float64
+}
+
+func init() {
+	// W3C trace context is propagated even when spans aren't exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Setup installs the exporter of the config. The returned function flushes
+// spans which aren't exported yet.
+func Setup(ctx context.Context, config Config) (shutdown func(ctx context.Context) error, err error) {
+	var (
+		exporter sdktrace.SpanExporter
+		file     *os.File
+	)
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case ExporterStdout:
+		var out io.Writer = os.Stdout
+		if config.File != "" {
+			if file, err = os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+				return nil, fmt.Errorf("open trace file: %w", err)
+			}
+			out = file
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s trace exporter: %w", config.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(version.Get()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span, it is a child of the span of ctx.
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, options...)
+}
+
+// End ends the span, a non-nil error marks it as failed.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Extract returns ctx with the trace context of the carrier, like the
+// headers of a request.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// Inject writes the trace context of ctx to the carrier, like the headers of
+// an outgoing request.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// ContextWithLogger returns ctx with its logger extended by the trace and
+// span IDs of the span of ctx, logs are joined with the trace they are
+// written in.
+func ContextWithLogger(ctx context.Context) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+	logger := zerolog.Ctx(ctx).With().
+		Str("traceId", sc.TraceID().String()).
+		Str("spanId", sc.SpanID().String()).
+		Logger()
+	return logger.WithContext(ctx)
+}
+
+// IsRecording reports whether ctx carries a span which is recorded, so
+// attributes which are costly to compute can be skipped.
+func IsRecording(ctx context.Context) bool {
+	return trace.SpanFromContext(ctx).IsRecording()
+}
@@ -0,0 +1,345 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Transfer formats.
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// Kinds of transfer records.
+const (
+	RecordRole = "role"
+	RecordUser = "user"
+)
+
+// Import conflict modes, they decide what happens to records matching an
+// existing role name or user email.
+const (
+	ConflictSkip   = "skip"
+	ConflictUpsert = "upsert"
+)
+
+// TransferRecord is a role or a user in import and export files. Roles are
+// referenced by name, so files can move between databases.
+type TransferRecord struct {
+	Kind string `json:"kind"`
+	// Name of the role.
+	Name string `json:"name,omitempty"`
+	// Email, FullName, Active, IsAdmin, DateJoined and passwords are user
+	// fields.
+	Email      Email  `json:"email,omitempty"`
+	FullName   string `json:"full_name,omitempty"`
+	Active     bool   `json:"active,omitempty"`
+	IsAdmin    bool   `json:"is_admin,omitempty"`
+	DateJoined int64  `json:"date_joined,omitempty"`
+	// PasswordHash is the bcrypt hash of the password, it is stored as is.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Password is a plain text password hashed on import.
+	Password    Password          `json:"password,omitempty"`
+	Roles       []string          `json:"roles,omitempty"`
+	Permissions []PermissionCheck `json:"permissions,omitempty"`
+	// Row is the 1-based number of the record in the file.
+	Row int `json:"-"`
+}
+
+// Key identifies the record in reports.
+func (r *TransferRecord) Key() string {
+	if r.Kind == RecordUser {
+		return r.Email.String()
+	}
+	return r.Name
+}
+
+// RoleAggregate returns the role of the record.
+func (r *TransferRecord) RoleAggregate() RoleAggregate {
+	return RoleAggregate{
+		Role:        Role{Name: r.Name},
+		Permissions: r.Permissions,
+	}
+}
+
+// UserAggregate returns the user of the record without roles, they are
+// referenced by name and must be looked up. The password of the user is the
+// password hash when the record has one, otherwise the plain text password.
+func (r *TransferRecord) UserAggregate() (UserAggregate, error) {
+	user := UserAggregate{
+		User: User{
+			Active:     r.Active,
+			Email:      r.Email,
+			FullName:   r.FullName,
+			IsAdmin:    r.IsAdmin,
+			DateJoined: r.DateJoined,
+			Password:   r.Password,
+		},
+		Permissions: r.Permissions,
+	}
+
+	if r.PasswordHash != "" {
+		if r.Password != "" {
+			return user, ErrInvalid("password and password_hash can't both be set")
+		}
+		if _, err := bcrypt.Cost([]byte(r.PasswordHash)); err != nil {
+			return user, ErrInvalid("password_hash must be a bcrypt hash")
+		}
+		user.Password = Password(r.PasswordHash)
+	}
+	return user, nil
+}
+
+// ImportOptions configure the import.
+type ImportOptions struct {
+	// Mode is ConflictSkip or ConflictUpsert.
+	Mode string
+	// DryRun validates records without storing them.
+	DryRun bool
+}
+
+func (o ImportOptions) Validate() error {
+	if o.Mode != ConflictSkip && o.Mode != ConflictUpsert {
+		return ErrInvalid("mode must be %s or %s", ConflictSkip, ConflictUpsert)
+	}
+	return nil
+}
+
+// ImportError is the error of a single record.
+type ImportError struct {
+	// Row is the 1-based record number.
+	Row   int    `json:"row"`
+	Kind  string `json:"kind,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportReport is the result of the import, in dry run it is what the
+// import would do.
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Skipped int           `json:"skipped"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// AddErrors adds the errors to the report keeping them ordered by row.
+func (r *ImportReport) AddErrors(errs ...ImportError) {
+	r.Errors = append(r.Errors, errs...)
+	sort.SliceStable(r.Errors, func(i, j int) bool {
+		return r.Errors[i].Row < r.Errors[j].Row
+	})
+}
+
+// csvHeader are the CSV columns. Roles and permissions are separated by
+// ';', a permission on a resource is written as permission:resource.
+var csvHeader = []string{
+	"kind", "name", "email", "full_name", "active", "is_admin", "date_joined",
+	"password_hash", "password", "roles", "permissions",
+}
+
+// EncodeRecords writes the records in the format.
+func EncodeRecords(w io.Writer, format string, records []TransferRecord) error {
+	switch format {
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, r := range records {
+			row := []string{
+				r.Kind, r.Name, r.Email.String(), r.FullName, "", "", "",
+				r.PasswordHash, r.Password.String(),
+				strings.Join(r.Roles, ";"), formatPermissions(r.Permissions),
+			}
+			if r.Kind == RecordUser {
+				row[4] = strconv.FormatBool(r.Active)
+				row[5] = strconv.FormatBool(r.IsAdmin)
+			}
+			if r.DateJoined != 0 {
+				row[6] = strconv.FormatInt(r.DateJoined, 10)
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return ErrInvalid("unsupported format %q", format)
+	}
+}
+
+// DecodeRecords reads records in the format. Records that can't be parsed
+// are returned as errors, add them to the import report with AddErrors.
+func DecodeRecords(r io.Reader, format string) ([]TransferRecord, []ImportError, error) {
+	switch format {
+	case FormatNDJSON:
+		return decodeNDJSON(r)
+	case FormatCSV:
+		return decodeCSV(r)
+	default:
+		return nil, nil, ErrInvalid("unsupported format %q", format)
+	}
+}
+
+func decodeNDJSON(r io.Reader) ([]TransferRecord, []ImportError, error) {
+	var (
+		records []TransferRecord
+		errs    []ImportError
+		row     int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+
+		record := TransferRecord{Row: row}
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&record); err != nil {
+			errs = append(errs, ImportError{Row: row, Error: err.Error()})
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, ErrInvalid("failed to read records", err)
+	}
+	return records, errs, nil
+}
+
+func decodeCSV(r io.Reader) ([]TransferRecord, []ImportError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, ErrInvalid("failed to read csv header", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["kind"]; !ok {
+		return nil, nil, ErrInvalid("csv header must have the kind column")
+	}
+
+	var (
+		records []TransferRecord
+		errs    []ImportError
+	)
+	for row := 1; ; row++ {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, ErrInvalid("failed to read csv", err)
+		}
+
+		record, err := parseCSVRecord(columns, fields)
+		if err != nil {
+			errs = append(errs, ImportError{Row: row, Error: err.Error()})
+			continue
+		}
+		record.Row = row
+		records = append(records, record)
+	}
+	return records, errs, nil
+}
+
+func parseCSVRecord(columns map[string]int, fields []string) (TransferRecord, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+
+	record := TransferRecord{
+		Kind:         get("kind"),
+		Name:         get("name"),
+		Email:        Email(get("email")),
+		FullName:     get("full_name"),
+		PasswordHash: get("password_hash"),
+		Password:     Password(get("password")),
+		Permissions:  parsePermissions(get("permissions")),
+	}
+	if roles := get("roles"); roles != "" {
+		record.Roles = strings.Split(roles, ";")
+	}
+
+	var err error
+	for _, b := range []struct {
+		column string
+		dst    *bool
+	}{
+		{"active", &record.Active},
+		{"is_admin", &record.IsAdmin},
+	} {
+		if v := get(b.column); v != "" {
+			if *b.dst, err = strconv.ParseBool(v); err != nil {
+				return record, fmt.Errorf("%s must be true or false", b.column)
+			}
+		}
+	}
+	if v := get("date_joined"); v != "" {
+		if record.DateJoined, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return record, fmt.Errorf("date_joined must be an integer value")
+		}
+	}
+	return record, nil
+}
+
+func formatPermissions(permissions []PermissionCheck) string {
+	values := make([]string, len(permissions))
+	for i, p := range permissions {
+		values[i] = p.Permission
+		if p.ResourceID != nil {
+			values[i] += ":" + *p.ResourceID
+		}
+	}
+	return strings.Join(values, ";")
+}
+
+func parsePermissions(s string) []PermissionCheck {
+	if s == "" {
+		return nil
+	}
+
+	values := strings.Split(s, ";")
+	permissions := make([]PermissionCheck, len(values))
+	for i, v := range values {
+		permission, resource, ok := strings.Cut(v, ":")
+		permissions[i].Permission = permission
+		if ok {
+			permissions[i].ResourceID = &resource
+		}
+	}
+	return permissions
+}
@@ -1,9 +1,4 @@
 package app
 
-import "os"
-
+// Debug enables debug mode, it is the debug setting of the server config.
 var Debug bool
-
-func init() {
-	Debug = os.Getenv("DEBUG_APP") == "true"
-}
@@ -0,0 +1,361 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/enverbisevac/go-project/app"
+	"github.com/rs/zerolog/log"
+)
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const signaturePrefix = "sha256="
+
+// Sign returns the signature of the body sent at the unix timestamp, it is
+// the hex encoded HMAC-SHA256 of "timestamp.body" keyed with the secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature matches the timestamp and body.
+// Receivers should also reject old timestamps to prevent replays.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Config configures the webhook sender.
+type Config struct {
+	// MaxRetries of a failed delivery before the event is given up.
+	MaxRetries uint64
+	// InitialInterval between retries, it grows exponentially with every
+	// retry, randomized to spread retries of failed webhooks.
+	InitialInterval time.Duration
+	// MaxInterval caps the interval between retries.
+	MaxInterval time.Duration
+	// MaxFailures is the number of events in a row the webhook fails to
+	// receive before it is deactivated.
+	MaxFailures int
+	// Timeout of a single request.
+	Timeout time.Duration
+	// Interval between polls of the delivery queue.
+	Interval time.Duration
+	// BatchSize is the number of deliveries read from the queue at once.
+	BatchSize int
+	// Concurrency is the number of requests sent at once.
+	Concurrency int
+}
+
+// Sender delivers events to subscribed webhooks, it is an event sink. Events
+// are queued as deliveries and sent by the worker run by Start.
+type Sender struct {
+	store  app.Storage
+	client *http.Client
+	config Config
+}
+
+// NewSender returns the sender, when client is nil a client with the
+// configured timeout is used.
+func NewSender(store app.Storage, client *http.Client, config Config) *Sender {
+	if config.InitialInterval <= 0 {
+		config.InitialInterval = time.Second
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = time.Minute
+	}
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = 10
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 8
+	}
+	if client == nil {
+		client = &http.Client{Timeout: config.Timeout}
+	}
+	return &Sender{
+		store:  store,
+		client: client,
+		config: config,
+	}
+}
+
+func (s *Sender) Name() string {
+	return "webhooks"
+}
+
+// Publish queues a delivery of the event for all active webhooks subscribed
+// to it. It fails only when the deliveries can't be queued, slow or failing
+// webhooks don't hold back the dispatcher.
+func (s *Sender) Publish(ctx context.Context, event app.Event) error {
+	webhooks, err := s.store.FindWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return app.ErrInternal("failed to encode event %d", event.ID, err)
+	}
+
+	now := time.Now().Unix()
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhook.Events.Match(event.Type) {
+			continue
+		}
+
+		delivery := app.WebhookDelivery{
+			WebhookID:   webhook.ID,
+			EventID:     event.ID,
+			EventType:   event.Type,
+			Attempt:     1,
+			Request:     body,
+			NextAttempt: &now,
+		}
+		err = s.store.AddWebhookDelivery(ctx, &delivery)
+		// the webhook was deleted in the meantime
+		if err != nil && app.ErrorStatus(err) != app.StatusNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start runs the worker sending queued deliveries in the task until ctx is
+// done.
+func (s *Sender) Start(ctx context.Context, task *app.Task) {
+	task.Background(func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := s.Deliver(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Err(err).Msg("Failed to deliver webhooks")
+			}
+			// a full batch means more deliveries are due
+			if n == s.config.BatchSize && ctx.Err() == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Deliver sends a batch of due deliveries and returns how many it sent.
+// Failed deliveries are queued again until the retries run out, then they
+// count against the webhook.
+func (s *Sender) Deliver(ctx context.Context) (int, error) {
+	due, err := s.store.DueWebhookDeliveries(ctx, time.Now().Unix(), s.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, s.config.Concurrency)
+	)
+	for _, delivery := range due {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(delivery app.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(due), ctx.Err()
+}
+
+// attempt makes the queued attempt and queues the next one when it failed
+// and retries are left. Deliveries to inactive webhooks are not sent.
+func (s *Sender) attempt(ctx context.Context, delivery app.WebhookDelivery) {
+	webhook, err := s.store.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		// deleted webhooks take their deliveries with them
+		if app.ErrorStatus(err) != app.StatusNotFound {
+			log.Err(err).Str("webhook", delivery.WebhookID).Msg("Failed to get webhook")
+		}
+		return
+	}
+
+	if webhook.Active {
+		delivery = s.send(ctx, webhook, delivery)
+		if ctx.Err() != nil {
+			// it stays queued and is sent once the worker runs again
+			return
+		}
+	} else {
+		delivery.Error = "webhook is inactive"
+	}
+	delivery.NextAttempt = nil
+	if err = s.store.UpdateWebhookDelivery(ctx, &delivery); err != nil {
+		log.Err(err).Str("webhook", webhook.ID).Msg("Failed to log webhook delivery")
+		return
+	}
+	if !webhook.Active {
+		return
+	}
+
+	if retryable(delivery) && uint64(delivery.Attempt) <= s.config.MaxRetries {
+		next := time.Now().Add(s.retryInterval(delivery.Attempt)).Unix()
+		retry := app.WebhookDelivery{
+			WebhookID:   webhook.ID,
+			EventID:     delivery.EventID,
+			EventType:   delivery.EventType,
+			Attempt:     delivery.Attempt + 1,
+			Request:     delivery.Request,
+			NextAttempt: &next,
+		}
+		if err = s.store.AddWebhookDelivery(ctx, &retry); err == nil {
+			return
+		}
+		log.Err(err).Str("webhook", webhook.ID).Msg("Failed to queue webhook delivery retry")
+	}
+
+	s.record(ctx, webhook.ID, delivery.Succeeded())
+}
+
+// retryInterval returns the interval before the retry of the attempt, the
+// backoff is replayed up to the attempt since retries are queued.
+func (s *Sender) retryInterval(attempt int) time.Duration {
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = s.config.InitialInterval
+	policy.MaxInterval = s.config.MaxInterval
+	policy.MaxElapsedTime = 0
+	policy.Reset()
+
+	interval := policy.NextBackOff()
+	for i := 1; i < attempt; i++ {
+		interval = policy.NextBackOff()
+	}
+	return interval
+}
+
+// Redeliver sends the request of the delivery again, inactive webhooks get
+// it too.
+func (s *Sender) Redeliver(ctx context.Context, delivery app.WebhookDelivery) (app.WebhookDelivery, error) {
+	webhook, err := s.store.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return app.WebhookDelivery{}, err
+	}
+
+	redelivery := s.send(ctx, webhook, app.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   delivery.EventID,
+		EventType: delivery.EventType,
+		Attempt:   1,
+		Request:   delivery.Request,
+	})
+	if err = s.store.AddWebhookDelivery(ctx, &redelivery); err != nil {
+		return app.WebhookDelivery{}, err
+	}
+
+	s.record(ctx, webhook.ID, redelivery.Succeeded())
+	return redelivery, nil
+}
+
+// send makes a single request and returns the delivery with its outcome.
+func (s *Sender) send(ctx context.Context, webhook app.Webhook, delivery app.WebhookDelivery) app.WebhookDelivery {
+	start := time.Now()
+	status, err := s.post(ctx, webhook, delivery, start)
+	delivery.Duration = time.Since(start).Milliseconds()
+	delivery.StatusCode = status
+
+	switch {
+	case err != nil:
+		delivery.Error = err.Error()
+	case !delivery.Succeeded():
+		delivery.Error = fmt.Sprintf("unexpected status %d %s", status, http.StatusText(status))
+	}
+	return delivery
+}
+
+func (s *Sender) post(ctx context.Context, webhook app.Webhook, delivery app.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Request))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(delivery.EventID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Request))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
+
+// record counts the result against the webhook.
+func (s *Sender) record(ctx context.Context, id string, succeeded bool) {
+	webhook, err := s.store.RecordWebhookResult(ctx, id, succeeded, s.config.MaxFailures)
+	if err != nil {
+		log.Err(err).Str("webhook", id).Msg("Failed to record webhook result")
+		return
+	}
+	if !succeeded && webhook.Failures == s.config.MaxFailures {
+		log.Warn().Str("webhook", id).Int("failures", webhook.Failures).
+			Msg("Webhook deactivated after repeated failures")
+	}
+}
+
+// retryable reports whether the failed delivery should be retried. Client
+// errors other than timeouts and rate limits are not retried.
+func retryable(delivery app.WebhookDelivery) bool {
+	if delivery.Succeeded() {
+		return false
+	}
+
+	switch code := delivery.StatusCode; {
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests:
+		return true
+	case code >= 400 && code < 500:
+		return false
+	}
+	return true
+}
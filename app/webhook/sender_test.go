@@ -0,0 +1,373 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/enverbisevac/go-project/app/sql/sqlite"
+)
+
+const testSecret = "0123456789abcdef"
+
+// receiver is a local webhook endpoint, it verifies signatures and answers
+// with the queued status codes, then with 200.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	events   []app.Event
+	invalid  int
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(rcv.serveHTTP))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if !Verify(testSecret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+		rcv.invalid++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	status := http.StatusOK
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var event app.Event
+		_ = json.Unmarshal(body, &event)
+		if event.Type != r.Header.Get(HeaderEvent) {
+			status = http.StatusBadRequest
+		} else {
+			rcv.events = append(rcv.events, event)
+		}
+	}
+	w.WriteHeader(status)
+}
+
+func (rcv *receiver) received() []app.Event {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]app.Event(nil), rcv.events...)
+}
+
+func setupTest(t *testing.T) *sql.DB {
+	t.Helper()
+	dbtx, err := sqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening db, err: %v", err)
+	}
+	db, err := sql.New(dbtx, true)
+	if err != nil {
+		t.Fatalf("error initializing db, err: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func addWebhook(t *testing.T, db *sql.DB, url string, events ...string) app.Webhook {
+	t.Helper()
+	webhook := app.Webhook{
+		URL:    url,
+		Secret: testSecret,
+		Events: events,
+		Active: true,
+	}
+	if err := db.AddWebhook(context.Background(), &webhook); err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+func newTestSender(db *sql.DB) *Sender {
+	return NewSender(db, nil, Config{
+		MaxRetries:      3,
+		InitialInterval: time.Millisecond,
+		MaxFailures:     2,
+		Timeout:         time.Second,
+	})
+}
+
+// deliverAll runs the worker until the queue is empty.
+func deliverAll(t *testing.T, db *sql.DB, sender *Sender) {
+	t.Helper()
+	ctx := context.Background()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		n, err := sender.Deliver(ctx)
+		if err != nil {
+			t.Fatalf("Sender.Deliver() error = %v", err)
+		}
+		if n > 0 {
+			continue
+		}
+
+		// retries are due at the next second at the latest
+		queued, err := db.DueWebhookDeliveries(ctx, time.Now().Add(time.Second).Unix(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queued) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("deliveries are still queued")
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signature := Sign(testSecret, "1700000000", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		want      bool
+	}{
+		{"valid", testSecret, "1700000000", body, true},
+		{"wrong secret", "fedcba9876543210", "1700000000", body, false},
+		{"changed timestamp", testSecret, "1700000001", body, false},
+		{"changed body", testSecret, "1700000000", []byte(`{"id":2}`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.body, signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSender_Publish(t *testing.T) {
+	tests := []struct {
+		name         string
+		events       []string
+		statuses     []int
+		eventType    string
+		wantReceived int
+		wantAttempts int
+		wantFailures int
+	}{
+		{"delivered", nil, nil, app.EventUserCreated, 1, 1, 0},
+		{"filtered by type", []string{app.EventRoleCreated}, nil, app.EventUserCreated, 0, 0, 0},
+		{"filtered by prefix", []string{"user.*"}, nil, app.EventUserCreated, 1, 1, 0},
+		{"retried after server errors", nil, []int{500, 503}, app.EventUserCreated, 1, 3, 0},
+		{"client error not retried", nil, []int{400}, app.EventUserCreated, 0, 1, 1},
+		{"retries exhausted", nil, []int{500, 500, 500, 500}, app.EventUserCreated, 0, 4, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := setupTest(t)
+			rcv := newReceiver(t, tt.statuses...)
+			webhook := addWebhook(t, db, rcv.URL, tt.events...)
+
+			event := app.Event{
+				ID:            7,
+				Type:          tt.eventType,
+				AggregateType: app.AggregateUser,
+				AggregateID:   "user1",
+				Payload:       app.EventPayload(`{"id":"user1"}`),
+			}
+			sender := newTestSender(db)
+			if err := sender.Publish(ctx, event); err != nil {
+				t.Fatalf("Sender.Publish() error = %v", err)
+			}
+			deliverAll(t, db, sender)
+
+			if got := len(rcv.received()); got != tt.wantReceived {
+				t.Errorf("received %d events, want %d", got, tt.wantReceived)
+			}
+			if rcv.invalid != 0 {
+				t.Errorf("received %d requests with invalid signature", rcv.invalid)
+			}
+
+			deliveries, err := db.FindWebhookDeliveries(ctx, app.WebhookDeliveryFilter{
+				WebhookID: webhook.ID,
+				Limit:     10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(deliveries) != tt.wantAttempts {
+				t.Fatalf("logged %d deliveries, want %d", len(deliveries), tt.wantAttempts)
+			}
+			for i, delivery := range deliveries {
+				if delivery.Attempt != tt.wantAttempts-i || delivery.EventID != event.ID || delivery.StatusCode == 0 {
+					t.Errorf("delivery %d = %+v", i, delivery)
+				}
+			}
+
+			got, err := db.GetWebhook(ctx, webhook.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Failures != tt.wantFailures || !got.Active {
+				t.Errorf("webhook failures = %d, active = %v, want %d, true", got.Failures, got.Active, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestSender_Disable(t *testing.T) {
+	ctx := context.Background()
+	db := setupTest(t)
+	rcv := newReceiver(t, 410, 410, 410)
+	webhook := addWebhook(t, db, rcv.URL)
+	sender := newTestSender(db)
+
+	for i := 1; i <= 3; i++ {
+		if err := sender.Publish(ctx, app.Event{ID: int64(i), Type: app.EventRoleCreated}); err != nil {
+			t.Fatal(err)
+		}
+		deliverAll(t, db, sender)
+	}
+
+	got, err := db.GetWebhook(ctx, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Active || got.Failures != 2 {
+		t.Fatalf("webhook active = %v, failures = %d, want deactivated after 2 failures", got.Active, got.Failures)
+	}
+
+	deliveries, err := db.FindWebhookDeliveries(ctx, app.WebhookDeliveryFilter{WebhookID: webhook.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("logged %d deliveries, inactive webhook must not get events", len(deliveries))
+	}
+
+	// activating the webhook resets the failure counter
+	got.Active = true
+	if err = db.UpdateWebhook(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Active || got.Failures != 0 {
+		t.Fatalf("activated webhook active = %v, failures = %d", got.Active, got.Failures)
+	}
+}
+
+func TestSender_Redeliver(t *testing.T) {
+	ctx := context.Background()
+	db := setupTest(t)
+	rcv := newReceiver(t, 400)
+	webhook := addWebhook(t, db, rcv.URL)
+	sender := newTestSender(db)
+
+	event := app.Event{ID: 3, Type: app.EventUserDeleted, Payload: app.EventPayload(`{"id":"user1"}`)}
+	if err := sender.Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	deliverAll(t, db, sender)
+
+	deliveries, err := db.FindWebhookDeliveries(ctx, app.WebhookDeliveryFilter{WebhookID: webhook.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Succeeded() || deliveries[0].Error == "" {
+		t.Fatalf("deliveries = %+v, want one failed", deliveries)
+	}
+
+	delivery, err := db.GetWebhookDelivery(ctx, webhook.ID, deliveries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redelivery, err := sender.Redeliver(ctx, delivery)
+	if err != nil {
+		t.Fatalf("Sender.Redeliver() error = %v", err)
+	}
+	if !redelivery.Succeeded() || redelivery.ID == delivery.ID || redelivery.EventID != event.ID {
+		t.Fatalf("Sender.Redeliver() = %+v", redelivery)
+	}
+
+	received := rcv.received()
+	if len(received) != 1 || received[0].ID != event.ID || string(received[0].Payload) != `{"id":"user1"}` {
+		t.Fatalf("received = %+v", received)
+	}
+
+	got, err := db.GetWebhook(ctx, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Failures != 0 {
+		t.Errorf("webhook failures = %d after successful redelivery", got.Failures)
+	}
+
+	if _, err = db.GetWebhookDelivery(ctx, "other", delivery.ID); app.ErrorStatus(err) != app.StatusNotFound {
+		t.Errorf("GetWebhookDelivery() of other webhook error = %v", err)
+	}
+}
+
+func TestSender_PublishQueues(t *testing.T) {
+	ctx := context.Background()
+	db := setupTest(t)
+
+	// the receiver doesn't answer until the test ends
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	webhook := addWebhook(t, db, slow.URL)
+
+	sender := newTestSender(db)
+	start := time.Now()
+	if err := sender.Publish(ctx, app.Event{ID: 1, Type: app.EventUserCreated}); err != nil {
+		t.Fatalf("Sender.Publish() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Sender.Publish() took %v, it must not wait for the receiver", elapsed)
+	}
+
+	deliveries, err := db.FindWebhookDeliveries(ctx, app.WebhookDeliveryFilter{WebhookID: webhook.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].NextAttempt == nil || deliveries[0].StatusCode != 0 {
+		t.Fatalf("deliveries = %+v, want one queued", deliveries)
+	}
+}
+
+func TestSender_retryInterval(t *testing.T) {
+	sender := NewSender(nil, nil, Config{InitialInterval: time.Second, MaxInterval: time.Minute})
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 1500 * time.Millisecond},
+		{4, 3375 * time.Millisecond},
+		{20, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		// randomized by half of the interval either way
+		got := sender.retryInterval(tt.attempt)
+		if got < tt.want/2 || got > tt.want*3/2 {
+			t.Errorf("retryInterval(%d) = %v, want %v ± 50%%", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const minWebhookSecretLength = 16
+
+// EventTypes are all event types webhooks can subscribe to.
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserDeleted,
+	EventUserRestored,
+	EventRoleCreated,
+	EventRoleUpdated,
+	EventRoleDeleted,
+	EventRoleRestored,
+	EventLoginSucceeded,
+	EventLoginFailed,
+}
+
+type Webhook struct {
+	ID       string        `db:"webhook_id" json:"id"`
+	URL      string        `db:"webhook_url" json:"url"`
+	Secret   string        `db:"webhook_secret" json:"secret,writeOnly"`
+	Events   EventPatterns `db:"webhook_events" json:"events"`
+	Active   bool          `db:"webhook_active" json:"active"`
+	Failures int           `db:"webhook_failures" json:"failures,readOnly" readOnly:"true"`
+	Created  int64         `db:"webhook_created" json:"created,readOnly" readOnly:"true"`
+	Modified *int64        `db:"webhook_modified" json:"modified,readOnly" readOnly:"true"`
+}
+
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalid("url must be an absolute http or https url")
+	}
+
+	if len(w.Secret) < minWebhookSecretLength {
+		return ErrInvalid("secret must be at least %d characters long", minWebhookSecretLength)
+	}
+
+	return w.Events.Validate()
+}
+
+func (w *Webhook) SetID(id any) {
+	w.ID = id.(string)
+}
+
+func (w *Webhook) GetID() any {
+	return w.ID
+}
+
+func (w *Webhook) SetCreated(val int64) {
+	w.Created = val
+}
+
+func (w *Webhook) SetModified(val int64) {
+	w.Modified = &val
+}
+
+func (w *Webhook) Generator() (func() any, error) {
+	return generator()
+}
+
+// EventPatterns filter events by type, a pattern is an event type or a
+// prefix ending with '*' like user.*. No patterns match all events.
+type EventPatterns []string
+
+// Match reports whether the event type matches any of the patterns.
+func (p EventPatterns) Match(eventType string) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, pattern := range p {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) ||
+			pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p EventPatterns) Validate() error {
+	for _, pattern := range p {
+		matches := false
+		for _, eventType := range EventTypes {
+			if (EventPatterns{pattern}).Match(eventType) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return ErrInvalid("event pattern %q doesn't match any event", pattern)
+		}
+	}
+	return nil
+}
+
+func (p EventPatterns) Value() (driver.Value, error) {
+	return strings.Join(p, ","), nil
+}
+
+func (p *EventPatterns) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into event patterns", src)
+	}
+
+	*p = EventPatterns{}
+	if s != "" {
+		*p = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// WebhookDelivery is a record of one attempt to deliver an event to the
+// webhook. Attempts waiting in the queue have NextAttempt set.
+type WebhookDelivery struct {
+	ID         int64        `db:"delivery_id" json:"id"`
+	WebhookID  string       `db:"delivery_webhook_id" json:"webhook_id"`
+	EventID    int64        `db:"delivery_event_id" json:"event_id"`
+	EventType  string       `db:"delivery_event_type" json:"event_type"`
+	Attempt    int          `db:"delivery_attempt" json:"attempt"`
+	Request    EventPayload `db:"delivery_request" json:"request"`
+	StatusCode int          `db:"delivery_status_code" json:"status_code"`
+	Error      string       `db:"delivery_error" json:"error,omitempty"`
+	// Duration of the request in milliseconds.
+	Duration int64 `db:"delivery_duration" json:"duration"`
+	// NextAttempt is when the queued attempt is due in unix seconds, nil
+	// once it was made.
+	NextAttempt *int64 `db:"delivery_next_attempt" json:"next_attempt,omitempty"`
+	Created     int64  `db:"delivery_created" json:"created"`
+}
+
+// Succeeded reports whether the receiver accepted the delivery.
+func (d *WebhookDelivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+// WebhookSender delivers events to webhooks.
+type WebhookSender interface {
+	// Redeliver sends the request of the delivery again and returns the
+	// new delivery.
+	Redeliver(ctx context.Context, delivery WebhookDelivery) (WebhookDelivery, error)
+}
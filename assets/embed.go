@@ -3,11 +3,12 @@ package assets
 import (
 	"embed"
 	"io/fs"
+	"sync/atomic"
 	"text/template"
 )
 
 const (
-	layoutsDir   = "templates/layouts"
+	layoutsDir   = "layouts"
 	templatesDir = "templates"
 	extension    = "/*.html"
 )
@@ -19,35 +20,70 @@ var (
 	//go:embed migration
 	MigrationFS embed.FS
 
-	Templates map[string]*template.Template
+	// templates in use, they are replaced when reloaded.
+	templates atomic.Pointer[Templates]
 )
 
 func init() {
-	err := LoadTemplates()
+	err := LoadTemplates(EmbeddedTemplates())
 	if err != nil {
 		panic(err)
 	}
 }
 
-func LoadTemplates() error {
-	if Templates == nil {
-		Templates = make(map[string]*template.Template)
+// EmbeddedTemplates returns the templates built into the binary.
+func EmbeddedTemplates() fs.FS {
+	sub, err := fs.Sub(Files, templatesDir)
+	if err != nil {
+		panic(err)
 	}
-	tmplFiles, err := fs.ReadDir(Files, templatesDir)
+	return sub
+}
+
+// Template returns the template with the name, like index.html.
+func Template(name string) (*template.Template, bool) {
+	t, ok := (*templates.Load())[name]
+	return t, ok
+}
+
+// Templates are parsed templates by name.
+type Templates map[string]*template.Template
+
+// LoadTemplates parses the templates in fsys and uses them when all of them
+// parse.
+func LoadTemplates(fsys fs.FS) error {
+	parsed, err := ParseTemplates(fsys)
 	if err != nil {
 		return err
 	}
+	UseTemplates(parsed)
+	return nil
+}
+
+// ParseTemplates parses the templates in the root of fsys, each with the
+// layouts in its layouts dir. The templates in use are left as they are.
+func ParseTemplates(fsys fs.FS) (Templates, error) {
+	parsed := make(Templates)
+	tmplFiles, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
 	for _, tmpl := range tmplFiles {
 		if tmpl.IsDir() {
 			continue
 		}
 
-		pt, err := template.ParseFS(Files, templatesDir+"/"+tmpl.Name(), layoutsDir+extension)
+		pt, err := template.ParseFS(fsys, tmpl.Name(), layoutsDir+extension)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		Templates[tmpl.Name()] = pt
+		parsed[tmpl.Name()] = pt
 	}
-	return nil
+	return parsed, nil
+}
+
+// UseTemplates replaces the templates in use.
+func UseTemplates(t Templates) {
+	templates.Store(&t)
 }
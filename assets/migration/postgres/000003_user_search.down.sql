@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ndx_user_search;
+ALTER TABLE users DROP COLUMN IF EXISTS user_search;
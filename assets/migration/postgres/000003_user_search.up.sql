@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN user_search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple',
+        user_full_name || ' ' ||
+        regexp_replace(COALESCE(user_email, ''), '[^[:alnum:]]+', ' ', 'g'))
+) STORED;
+CREATE INDEX IF NOT EXISTS ndx_user_search ON users USING GIN (user_search);
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN user_deleted_at BIGINT;
+ALTER TABLE roles ADD COLUMN role_deleted_at BIGINT;
+DROP INDEX IF EXISTS ndx_user_email;
+CREATE UNIQUE INDEX ndx_user_email ON users(LOWER(user_email)) WHERE user_deleted_at IS NULL;
+DROP INDEX IF EXISTS ndx_role_name;
+CREATE UNIQUE INDEX ndx_role_name ON roles(LOWER(role_name)) WHERE role_deleted_at IS NULL;
+CREATE INDEX ndx_user_deleted_at ON users(user_deleted_at) WHERE user_deleted_at IS NOT NULL;
+CREATE INDEX ndx_role_deleted_at ON roles(role_deleted_at) WHERE role_deleted_at IS NOT NULL;
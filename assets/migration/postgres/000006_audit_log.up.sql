@@ -0,0 +1,29 @@
+CREATE TABLE audit_log (
+    audit_id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    audit_created BIGINT NOT NULL,
+    audit_actor_id TEXT NOT NULL DEFAULT '',
+    audit_request_id TEXT NOT NULL DEFAULT '',
+    audit_ip TEXT NOT NULL DEFAULT '',
+    audit_action TEXT NOT NULL,
+    audit_target_type TEXT NOT NULL DEFAULT '',
+    audit_target_id TEXT NOT NULL DEFAULT '',
+    audit_changes TEXT NOT NULL DEFAULT '{}',
+    audit_prev_hash TEXT NOT NULL,
+    audit_hash TEXT NOT NULL
+);
+CREATE INDEX ndx_audit_target ON audit_log(audit_target_type, audit_target_id);
+CREATE INDEX ndx_audit_actor_id ON audit_log(audit_actor_id);
+CREATE INDEX ndx_audit_created ON audit_log(audit_created);
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER trg_audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+CREATE TABLE audit_head (
+    head_id INTEGER PRIMARY KEY CHECK (head_id = 1),
+    head_entry_id BIGINT NOT NULL,
+    head_hash TEXT NOT NULL,
+    head_mac TEXT NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE outbox (
+    event_id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    event_aggregate_type TEXT NOT NULL,
+    event_aggregate_id TEXT NOT NULL,
+    event_payload TEXT NOT NULL,
+    event_created BIGINT NOT NULL,
+    event_dispatched BIGINT
+);
+CREATE INDEX ndx_outbox_pending ON outbox(event_id) WHERE event_dispatched IS NULL;
+CREATE INDEX ndx_outbox_dispatched ON outbox(event_dispatched) WHERE event_dispatched IS NOT NULL;
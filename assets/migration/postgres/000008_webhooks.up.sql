@@ -0,0 +1,26 @@
+CREATE TABLE webhooks (
+    webhook_id TEXT PRIMARY KEY,
+    webhook_url TEXT NOT NULL,
+    webhook_secret TEXT NOT NULL,
+    webhook_events TEXT NOT NULL DEFAULT '',
+    webhook_active BOOLEAN NOT NULL DEFAULT true,
+    webhook_failures INTEGER NOT NULL DEFAULT 0,
+    webhook_created BIGINT NOT NULL,
+    webhook_modified BIGINT
+);
+CREATE TABLE webhook_deliveries (
+    delivery_id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    delivery_webhook_id TEXT NOT NULL,
+    delivery_event_id BIGINT NOT NULL,
+    delivery_event_type TEXT NOT NULL,
+    delivery_attempt INTEGER NOT NULL,
+    delivery_request TEXT NOT NULL,
+    delivery_status_code INTEGER NOT NULL DEFAULT 0,
+    delivery_error TEXT NOT NULL DEFAULT '',
+    delivery_duration BIGINT NOT NULL DEFAULT 0,
+    delivery_next_attempt BIGINT,
+    delivery_created BIGINT NOT NULL,
+    CONSTRAINT fk_delivery_webhook FOREIGN KEY (delivery_webhook_id) REFERENCES webhooks(webhook_id) ON DELETE CASCADE
+);
+CREATE INDEX ndx_delivery_webhook_id ON webhook_deliveries(delivery_webhook_id, delivery_id);
+CREATE INDEX ndx_delivery_next_attempt ON webhook_deliveries(delivery_next_attempt) WHERE delivery_next_attempt IS NOT NULL;
@@ -0,0 +1,17 @@
+-- encrypted users must be decrypted first with rotate-keys --decrypt
+ALTER TABLE webhook_deliveries DROP COLUMN delivery_key_id;
+ALTER TABLE outbox DROP COLUMN event_key_id;
+DROP INDEX IF EXISTS ndx_user_search;
+ALTER TABLE users DROP COLUMN IF EXISTS user_search;
+ALTER TABLE users ADD COLUMN user_search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple',
+        user_full_name || ' ' ||
+        regexp_replace(COALESCE(user_email, ''), '[^[:alnum:]]+', ' ', 'g'))
+) STORED;
+CREATE INDEX ndx_user_search ON users USING GIN (user_search);
+DROP INDEX IF EXISTS ndx_user_key_id;
+DROP INDEX IF EXISTS ndx_user_email;
+CREATE UNIQUE INDEX ndx_user_email ON users(LOWER(user_email)) WHERE user_deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN user_search_terms;
+ALTER TABLE users DROP COLUMN user_key_id;
+ALTER TABLE users DROP COLUMN user_email_index;
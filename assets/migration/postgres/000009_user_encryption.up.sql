@@ -0,0 +1,28 @@
+-- emails are looked up and kept unique by their blind index, encrypted
+-- emails can't be compared by the database
+ALTER TABLE users ADD COLUMN user_email_index TEXT;
+ALTER TABLE users ADD COLUMN user_key_id TEXT;
+-- blind tokens of the words of encrypted users, they are searched instead
+-- of the ciphertext
+ALTER TABLE users ADD COLUMN user_search_terms TEXT;
+UPDATE users SET user_email_index = LOWER(user_email);
+DROP INDEX IF EXISTS ndx_user_email;
+CREATE UNIQUE INDEX ndx_user_email ON users(user_email_index) WHERE user_deleted_at IS NULL;
+CREATE INDEX ndx_user_key_id ON users(user_key_id);
+-- the search vector holds the full name and email of plaintext users and
+-- the search terms of encrypted ones, never ciphertext
+DROP INDEX IF EXISTS ndx_user_search;
+ALTER TABLE users DROP COLUMN IF EXISTS user_search;
+ALTER TABLE users ADD COLUMN user_search tsvector GENERATED ALWAYS AS (
+    CASE WHEN user_key_id IS NULL THEN
+        to_tsvector('simple',
+            user_full_name || ' ' ||
+            regexp_replace(COALESCE(user_email, ''), '[^[:alnum:]]+', ' ', 'g'))
+    ELSE
+        to_tsvector('simple', COALESCE(user_search_terms, ''))
+    END
+) STORED;
+CREATE INDEX ndx_user_search ON users USING GIN (user_search);
+-- events and webhook deliveries carry users, they are encrypted with them
+ALTER TABLE outbox ADD COLUMN event_key_id TEXT;
+ALTER TABLE webhook_deliveries ADD COLUMN delivery_key_id TEXT;
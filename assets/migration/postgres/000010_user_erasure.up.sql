@@ -0,0 +1,3 @@
+-- erased users are kept without personal data, so audit entries still
+-- refer to an existing user
+ALTER TABLE users ADD COLUMN user_erased_at BIGINT;
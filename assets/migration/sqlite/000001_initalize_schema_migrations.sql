@@ -1 +0,0 @@
--- This file is deliberately empty. Don't edit or remove it.
\ No newline at end of file
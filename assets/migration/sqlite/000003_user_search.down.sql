@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_users_fts_ai;
+DROP TRIGGER IF EXISTS trg_users_fts_ad;
+DROP TRIGGER IF EXISTS trg_users_fts_au;
+DROP TABLE IF EXISTS users_fts;
@@ -0,0 +1,22 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+    user_full_name,
+    user_email,
+    content='users',
+    tokenize='unicode61',
+    prefix='2 3'
+);
+CREATE TRIGGER IF NOT EXISTS trg_users_fts_ai AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, user_full_name, user_email)
+    VALUES (new.rowid, new.user_full_name, new.user_email);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_users_fts_ad AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, user_full_name, user_email)
+    VALUES ('delete', old.rowid, old.user_full_name, old.user_email);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_users_fts_au AFTER UPDATE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, user_full_name, user_email)
+    VALUES ('delete', old.rowid, old.user_full_name, old.user_email);
+    INSERT INTO users_fts(rowid, user_full_name, user_email)
+    VALUES (new.rowid, new.user_full_name, new.user_email);
+END;
+INSERT INTO users_fts(users_fts) VALUES ('rebuild');
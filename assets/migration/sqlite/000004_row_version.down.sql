@@ -0,0 +1,2 @@
+ALTER TABLE roles DROP COLUMN role_version;
+ALTER TABLE users DROP COLUMN user_version;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN user_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE roles ADD COLUMN role_version INTEGER NOT NULL DEFAULT 1;
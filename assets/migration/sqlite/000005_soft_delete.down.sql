@@ -0,0 +1,11 @@
+-- soft deleted rows can't be kept, they may break the unique indexes
+DELETE FROM users WHERE user_deleted_at IS NOT NULL;
+DELETE FROM roles WHERE role_deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS ndx_role_deleted_at;
+DROP INDEX IF EXISTS ndx_user_deleted_at;
+DROP INDEX IF EXISTS ndx_role_name;
+CREATE UNIQUE INDEX ndx_role_name ON roles(LOWER(role_name));
+DROP INDEX IF EXISTS ndx_user_email;
+CREATE UNIQUE INDEX ndx_user_email ON users(LOWER(user_email));
+ALTER TABLE roles DROP COLUMN role_deleted_at;
+ALTER TABLE users DROP COLUMN user_deleted_at;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_head;
+DROP TRIGGER IF EXISTS trg_audit_log_no_delete;
+DROP TRIGGER IF EXISTS trg_audit_log_no_update;
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,30 @@
+CREATE TABLE audit_log (
+    audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    audit_created INTEGER NOT NULL,
+    audit_actor_id TEXT NOT NULL DEFAULT '',
+    audit_request_id TEXT NOT NULL DEFAULT '',
+    audit_ip TEXT NOT NULL DEFAULT '',
+    audit_action TEXT NOT NULL,
+    audit_target_type TEXT NOT NULL DEFAULT '',
+    audit_target_id TEXT NOT NULL DEFAULT '',
+    audit_changes TEXT NOT NULL DEFAULT '{}',
+    audit_prev_hash TEXT NOT NULL,
+    audit_hash TEXT NOT NULL
+);
+CREATE INDEX ndx_audit_target ON audit_log(audit_target_type, audit_target_id);
+CREATE INDEX ndx_audit_actor_id ON audit_log(audit_actor_id);
+CREATE INDEX ndx_audit_created ON audit_log(audit_created);
+CREATE TRIGGER trg_audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER trg_audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TABLE audit_head (
+    head_id INTEGER PRIMARY KEY CHECK (head_id = 1),
+    head_entry_id INTEGER NOT NULL,
+    head_hash TEXT NOT NULL,
+    head_mac TEXT NOT NULL
+);
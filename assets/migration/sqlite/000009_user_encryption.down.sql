@@ -0,0 +1,36 @@
+-- encrypted users must be decrypted first with rotate-keys --decrypt
+ALTER TABLE webhook_deliveries DROP COLUMN delivery_key_id;
+ALTER TABLE outbox DROP COLUMN event_key_id;
+DROP TRIGGER IF EXISTS trg_users_fts_ai;
+DROP TRIGGER IF EXISTS trg_users_fts_ad;
+DROP TRIGGER IF EXISTS trg_users_fts_au;
+DROP TABLE IF EXISTS users_fts;
+DROP VIEW IF EXISTS users_search;
+CREATE VIRTUAL TABLE users_fts USING fts5(
+    user_full_name,
+    user_email,
+    content='users',
+    tokenize='unicode61',
+    prefix='2 3'
+);
+CREATE TRIGGER trg_users_fts_ai AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, user_full_name, user_email)
+    VALUES (new.rowid, new.user_full_name, new.user_email);
+END;
+CREATE TRIGGER trg_users_fts_ad AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, user_full_name, user_email)
+    VALUES ('delete', old.rowid, old.user_full_name, old.user_email);
+END;
+CREATE TRIGGER trg_users_fts_au AFTER UPDATE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, user_full_name, user_email)
+    VALUES ('delete', old.rowid, old.user_full_name, old.user_email);
+    INSERT INTO users_fts(rowid, user_full_name, user_email)
+    VALUES (new.rowid, new.user_full_name, new.user_email);
+END;
+INSERT INTO users_fts(users_fts) VALUES ('rebuild');
+DROP INDEX IF EXISTS ndx_user_key_id;
+DROP INDEX IF EXISTS ndx_user_email;
+CREATE UNIQUE INDEX ndx_user_email ON users(LOWER(user_email)) WHERE user_deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN user_search_terms;
+ALTER TABLE users DROP COLUMN user_key_id;
+ALTER TABLE users DROP COLUMN user_email_index;
@@ -0,0 +1,73 @@
+-- emails are looked up and kept unique by their blind index, encrypted
+-- emails can't be compared by the database
+ALTER TABLE users ADD COLUMN user_email_index TEXT;
+ALTER TABLE users ADD COLUMN user_key_id TEXT;
+-- blind tokens of the words of encrypted users, they are searched instead
+-- of the ciphertext
+ALTER TABLE users ADD COLUMN user_search_terms TEXT;
+UPDATE users SET user_email_index = LOWER(user_email);
+DROP INDEX IF EXISTS ndx_user_email;
+CREATE UNIQUE INDEX ndx_user_email ON users(user_email_index) WHERE user_deleted_at IS NULL;
+CREATE INDEX ndx_user_key_id ON users(user_key_id);
+-- the full-text index holds the full name and email of plaintext users and
+-- the search terms of encrypted ones, never ciphertext
+DROP TRIGGER IF EXISTS trg_users_fts_ai;
+DROP TRIGGER IF EXISTS trg_users_fts_ad;
+DROP TRIGGER IF EXISTS trg_users_fts_au;
+DROP TABLE IF EXISTS users_fts;
+CREATE VIEW users_search AS
+SELECT
+    rowid AS user_rowid,
+    CASE WHEN user_key_id IS NULL THEN user_full_name END AS user_full_name,
+    CASE WHEN user_key_id IS NULL THEN user_email END AS user_email,
+    user_search_terms
+FROM users;
+CREATE VIRTUAL TABLE users_fts USING fts5(
+    user_full_name,
+    user_email,
+    user_search_terms,
+    content='users_search',
+    content_rowid='user_rowid',
+    tokenize='unicode61',
+    prefix='2 3'
+);
+CREATE TRIGGER trg_users_fts_ai AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, user_full_name, user_email, user_search_terms)
+    VALUES (
+        new.rowid,
+        CASE WHEN new.user_key_id IS NULL THEN new.user_full_name END,
+        CASE WHEN new.user_key_id IS NULL THEN new.user_email END,
+        new.user_search_terms
+    );
+END;
+CREATE TRIGGER trg_users_fts_ad AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, user_full_name, user_email, user_search_terms)
+    VALUES (
+        'delete',
+        old.rowid,
+        CASE WHEN old.user_key_id IS NULL THEN old.user_full_name END,
+        CASE WHEN old.user_key_id IS NULL THEN old.user_email END,
+        old.user_search_terms
+    );
+END;
+CREATE TRIGGER trg_users_fts_au AFTER UPDATE OF user_full_name, user_email, user_key_id, user_search_terms ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, user_full_name, user_email, user_search_terms)
+    VALUES (
+        'delete',
+        old.rowid,
+        CASE WHEN old.user_key_id IS NULL THEN old.user_full_name END,
+        CASE WHEN old.user_key_id IS NULL THEN old.user_email END,
+        old.user_search_terms
+    );
+    INSERT INTO users_fts(rowid, user_full_name, user_email, user_search_terms)
+    VALUES (
+        new.rowid,
+        CASE WHEN new.user_key_id IS NULL THEN new.user_full_name END,
+        CASE WHEN new.user_key_id IS NULL THEN new.user_email END,
+        new.user_search_terms
+    );
+END;
+INSERT INTO users_fts(users_fts) VALUES ('rebuild');
+-- events and webhook deliveries carry users, they are encrypted with them
+ALTER TABLE outbox ADD COLUMN event_key_id TEXT;
+ALTER TABLE webhook_deliveries ADD COLUMN delivery_key_id TEXT;
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN user_erased_at;
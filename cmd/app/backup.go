@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/sql/sqlite"
+	"github.com/jxskiss/mcli"
+	"github.com/rs/zerolog/log"
+)
+
+type BackupFlags struct {
+	Dir  string `cli:"--backup-dir   Directory backups are written to" default:"./backups" yaml:"dir"`
+	Gzip bool   `cli:"--backup-gzip  Compress backups with gzip" yaml:"gzip"`
+	Keep int    `cli:"--backup-keep  Number of most recent backups to keep, 0 keeps all" default:"7" yaml:"keep" minimum:"0"`
+}
+
+func (f BackupFlags) config() sqlite.BackupConfig {
+	return sqlite.BackupConfig{
+		Dir:      f.Dir,
+		Compress: f.Gzip,
+		Keep:     f.Keep,
+	}
+}
+
+func backupCmd() error {
+	var flags struct {
+		BackupFlags
+		DSN    string `cli:"--dsn     SQLite data source name" default:"./app.db"`
+		Output string `cli:"--output  Write the backup to the file instead of the backup dir, .gz files are compressed"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	db, err := sqlite.New(flags.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if flags.Output != "" {
+		if err = db.BackupTo(ctx, flags.Output); err != nil {
+			return err
+		}
+		fmt.Println("created", flags.Output)
+		return nil
+	}
+
+	backup, err := sqlite.NewBackups(db, flags.config()).Backup(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("created", backup.Path)
+	return nil
+}
+
+func restoreCmd() error {
+	var flags struct {
+		DSN  string `cli:"--dsn   SQLite data source name" default:"./app.db"`
+		File string `cli:"#R, file, Backup file to restore, .gz files are decompressed"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	if err := sqlite.Restore(context.Background(), flags.File, flags.DSN); err != nil {
+		return err
+	}
+	fmt.Println("restored", flags.File, "into", flags.DSN)
+	return nil
+}
+
+// backupDatabase takes a backup every interval until ctx is done.
+func backupDatabase(ctx context.Context, backups app.BackupService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		backup, err := backups.Backup(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to back up database")
+			continue
+		}
+		log.Info().Str("path", backup.Path).Int64("size", backup.Size).Msg("Database backed up")
+	}
+}
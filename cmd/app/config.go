@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/config"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/jxskiss/mcli"
+	"github.com/rs/zerolog/log"
+)
+
+// ServerConfig is the configuration of the server command. Every setting can
+// be set in the config file, by an APP_* environment variable and by a flag,
+// see package config. Settings tagged reload are applied by SIGHUP and
+// POST /admin/reload, the others on restart.
+type ServerConfig struct {
+	File   string `cli:"--config      Config file, config.yaml or config.toml in the config dir by default" env:"APP_CONFIG" yaml:"-"`
+	Detach bool   `cli:"-d, --detach  Detach process" yaml:"-"`
+	Debug  bool   `cli:"--debug       Enable debug mode" yaml:"debug"`
+
+	HTTP     HTTPConfig     `yaml:"http"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Purge    PurgeConfig    `yaml:"purge"`
+	Events   EventsConfig   `yaml:"events"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Backup   BackupConfig   `yaml:"backup"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+type HTTPConfig struct {
+	BaseURL string `cli:"--base-url  Base url for application" default:"http://localhost" yaml:"base_url"`
+	Port    int    `cli:"-p, --port  Port to listen on for HTTP requests" default:"4444" yaml:"port" minimum:"1" maximum:"65535"`
+
+	IdleTimeout     time.Duration `cli:"--idle-timeout      How long a keep-alive connection waits for the next request" default:"1m" yaml:"idle_timeout"`
+	ReadTimeout     time.Duration `cli:"--read-timeout      Timeout of reading a request" default:"10s" yaml:"read_timeout"`
+	WriteTimeout    time.Duration `cli:"--write-timeout     Timeout of writing a response" default:"30s" yaml:"write_timeout"`
+	ShutdownTimeout time.Duration `cli:"--shutdown-timeout  How long requests in flight are waited for on shutdown" default:"20s" yaml:"shutdown_timeout"`
+	DrainDelay      time.Duration `cli:"--drain-delay       How long requests are served after /readyz starts failing on shutdown" default:"0s" yaml:"drain_delay"`
+
+	TemplatesDir string `cli:"--templates-dir  Directory of HTML templates with their layouts dir, empty uses the built-in templates" yaml:"templates_dir" reload:"true"`
+}
+
+type DatabaseConfig struct {
+	DBFlags   `yaml:",inline"`
+	Migrate   bool          `cli:"--migrate     Run auto migration" default:"true" yaml:"migrate"`
+	SlowQuery time.Duration `cli:"--slow-query  Log database statements slower than this, 0 disables the log" default:"200ms" yaml:"slow_query" reload:"true"`
+	KeyFlags  `yaml:",inline"`
+}
+
+type AuthConfig struct {
+	TokenLifetime time.Duration `cli:"--token-lifetime  How long tokens issued at login are valid" default:"24h" yaml:"token_lifetime" reload:"true"`
+	PasswordCost  int           `cli:"--password-cost   bcrypt cost of password hashes" default:"12" yaml:"password_cost" minimum:"4" maximum:"31" reload:"true"`
+}
+
+type PurgeConfig struct {
+	Retention time.Duration `cli:"--purge-retention  Keep deleted users and roles for, 0 keeps them forever" default:"720h" yaml:"retention"`
+	Interval  time.Duration `cli:"--purge-interval   How often deleted users and roles are purged" default:"1h" yaml:"interval"`
+}
+
+type EventsConfig struct {
+	Interval  time.Duration `cli:"--events-interval   How often the outbox is polled for events to dispatch" default:"1s" yaml:"interval"`
+	Retention time.Duration `cli:"--events-retention  Keep dispatched events for, 0 keeps them forever" default:"168h" yaml:"retention"`
+	Buffer    int           `cli:"--events-buffer     Events kept for resuming /events streams" default:"1000" yaml:"buffer" minimum:"1"`
+	Heartbeat time.Duration `cli:"--events-heartbeat  Interval of /events keep-alive messages" default:"15s" yaml:"heartbeat"`
+}
+
+type MetricsConfig struct {
+	Port     int    `cli:"--metrics-port      Port serving /metrics, 0 serves it on --port guarded by --metrics-password" default:"0" yaml:"port" minimum:"0" maximum:"65535"`
+	User     string `cli:"--metrics-user      Basic auth user of /metrics served on --port" default:"metrics" yaml:"user"`
+	Password string `cli:"--metrics-password  Basic auth password of /metrics served on --port, empty doesn't serve it" yaml:"password" secret:"true"`
+}
+
+type TracingConfig struct {
+	Exporter string  `cli:"--trace-exporter  Exporter of traces (none, otlp, stdout)" default:"none" yaml:"exporter" enum:"none,otlp,stdout"`
+	Endpoint string  `cli:"--trace-endpoint  URL of the OTLP/HTTP collector, empty uses OTEL_EXPORTER_OTLP_* variables" yaml:"endpoint"`
+	File     string  `cli:"--trace-file      File the stdout exporter writes to instead of stdout" yaml:"file"`
+	Sample   float64 `cli:"--trace-sample    Ratio of traces started by the app which are recorded" default:"1" yaml:"sample" minimum:"0" maximum:"1"`
+}
+
+type BackupConfig struct {
+	BackupFlags `yaml:",inline"`
+	Interval    time.Duration `cli:"--backup-interval  How often the SQLite database is backed up, 0 disables scheduled backups" default:"0" yaml:"interval"`
+}
+
+type WebhooksConfig struct {
+	Retries     uint64        `cli:"--webhook-retries       Retries of a failed webhook delivery" default:"5" yaml:"retries"`
+	Timeout     time.Duration `cli:"--webhook-timeout       Timeout of a webhook request" default:"10s" yaml:"timeout"`
+	MaxFailures int           `cli:"--webhook-max-failures  Events in a row a webhook can fail to receive before it is deactivated" default:"10" yaml:"max_failures" minimum:"1"`
+}
+
+type LogConfig struct {
+	Level      string             `cli:"--log-level  Least level of logged messages (trace, debug, info, warn, error)" default:"info" yaml:"level" enum:"trace,debug,info,warn,error" reload:"true"`
+	Components LogComponentConfig `yaml:"components"`
+	Format     string             `cli:"--log-format  Format of logs (json, console)" default:"json" yaml:"format" enum:"json,console"`
+	Dir        string             `cli:"--log-dir     Directory of the log file, empty logs to stderr" yaml:"dir"`
+
+	MaxSize        int           `cli:"--log-max-size         Megabytes of the log file before it is rotated" default:"100" yaml:"max_size" minimum:"1"`
+	MaxBackups     int           `cli:"--log-max-backups      Rotated log files kept, 0 keeps all" default:"10" yaml:"max_backups" minimum:"0"`
+	MaxAge         time.Duration `cli:"--log-max-age          Keep rotated log files for, rounded up to days, 0 keeps them forever" default:"720h" yaml:"max_age"`
+	RotateInterval time.Duration `cli:"--log-rotate-interval  How often the log file is rotated besides by size, 0 rotates by size only" default:"0" yaml:"rotate_interval"`
+	Compress       bool          `cli:"--log-compress         Compress rotated log files" yaml:"compress"`
+
+	AccessSample int `cli:"--log-access-sample  Log 1 of N successful requests, failed requests are always logged" default:"1" yaml:"access_sample" minimum:"1"`
+}
+
+// LogComponentConfig are the levels of the components, empty uses log.level.
+type LogComponentConfig struct {
+	HTTP string `cli:"--log-level-http  Least level of logged messages of the http server, empty uses --log-level" yaml:"http" enum:",trace,debug,info,warn,error" reload:"true"`
+	SQL  string `cli:"--log-level-sql   Least level of logged messages of the database, empty uses --log-level" yaml:"sql" enum:",trace,debug,info,warn,error" reload:"true"`
+	JWT  string `cli:"--log-level-jwt   Least level of logged messages of tokens, empty uses --log-level" yaml:"jwt" enum:",trace,debug,info,warn,error" reload:"true"`
+}
+
+// levels returns the levels by component.
+func (c LogComponentConfig) levels() map[string]string {
+	return map[string]string{
+		logging.HTTP: c.HTTP,
+		logging.SQL:  c.SQL,
+		logging.JWT:  c.JWT,
+	}
+}
+
+func (c LogConfig) logging() logging.Config {
+	return logging.Config{
+		Level:          c.Level,
+		Levels:         c.Components.levels(),
+		Format:         c.Format,
+		Dir:            c.Dir,
+		MaxSize:        c.MaxSize,
+		MaxBackups:     c.MaxBackups,
+		MaxAge:         c.MaxAge,
+		RotateInterval: c.RotateInterval,
+		Compress:       c.Compress,
+	}
+}
+
+// Validate checks the rules the tags of the settings can't express.
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	durations := []struct {
+		key      string
+		value    time.Duration
+		positive bool
+	}{
+		{"http.idle_timeout", c.HTTP.IdleTimeout, false},
+		{"http.read_timeout", c.HTTP.ReadTimeout, false},
+		{"http.write_timeout", c.HTTP.WriteTimeout, false},
+		{"http.shutdown_timeout", c.HTTP.ShutdownTimeout, false},
+		{"http.drain_delay", c.HTTP.DrainDelay, false},
+		{"database.slow_query", c.Database.SlowQuery, false},
+		{"auth.token_lifetime", c.Auth.TokenLifetime, true},
+		{"purge.retention", c.Purge.Retention, false},
+		{"purge.interval", c.Purge.Interval, c.Purge.Retention > 0},
+		{"events.interval", c.Events.Interval, true},
+		{"events.retention", c.Events.Retention, false},
+		{"events.heartbeat", c.Events.Heartbeat, true},
+		{"backup.interval", c.Backup.Interval, false},
+		{"webhooks.timeout", c.Webhooks.Timeout, true},
+		{"log.max_age", c.Log.MaxAge, false},
+		{"log.rotate_interval", c.Log.RotateInterval, false},
+	}
+	for _, d := range durations {
+		switch {
+		case d.positive && d.value <= 0:
+			errs = append(errs, fmt.Errorf("%s: must be positive, got %s", d.key, d.value))
+		case d.value < 0:
+			errs = append(errs, fmt.Errorf("%s: must not be negative, got %s", d.key, d.value))
+		}
+	}
+
+	if c.Backup.Interval > 0 && c.Database.Driver != driverSQLite {
+		errs = append(errs, fmt.Errorf("backup.interval: scheduled backups are supported only by the %s driver", driverSQLite))
+	}
+	if c.Database.Driver == driverPostgres && c.Database.DSN == "" {
+		errs = append(errs, fmt.Errorf("database.dsn: required by the %s driver", driverPostgres))
+	}
+	if c.Metrics.Port > 0 && c.Metrics.Port == c.HTTP.Port {
+		errs = append(errs, fmt.Errorf("metrics.port: must differ from http.port %d", c.HTTP.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// configLoader reads the server config. The flags are parsed once and
+// layered over the file and the environment on every read.
+type configLoader struct {
+	flags ServerConfig
+	fs    *flag.FlagSet
+}
+
+func newConfigLoader() (*configLoader, error) {
+	l := new(configLoader)
+	fs, err := mcli.Parse(&l.flags)
+	if err != nil {
+		return nil, err
+	}
+	l.fs = fs
+	return l, nil
+}
+
+// Load reads the config from the defaults, the config file, the environment
+// and the flags.
+func (l *configLoader) Load() (*ServerConfig, error) {
+	file := l.flags.File
+	if file == "" {
+		dir, err := app.ConfigDir()
+		if err != nil {
+			// containers often run without a home dir, there is no
+			// config file to find then
+			log.Warn().Err(err).Msg("config dir not found, config file skipped")
+		} else if file, err = config.Find(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var cfg ServerConfig
+	if err := config.Load(&cfg, file, os.LookupEnv, &l.flags, l.fs); err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	cfg.File = file
+	return &cfg, nil
+}
+
+func configPrintCmd() error {
+	loader, err := newConfigLoader()
+	if err != nil {
+		return err
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		return err
+	}
+
+	data, err := config.Marshal(config.Redact(cfg))
+	if err != nil {
+		return err
+	}
+	if cfg.File == "" {
+		fmt.Println("# no config file")
+	} else {
+		fmt.Printf("# config file: %s\n", cfg.File)
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+func configSchemaCmd() error {
+	schema, err := config.Schema(new(ServerConfig))
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(schema))
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/enverbisevac/go-project/app/sql/postgres"
+	"github.com/enverbisevac/go-project/app/sql/sqlite"
+)
+
+const (
+	driverSQLite   = "sqlite"
+	driverPostgres = "postgres"
+
+	defaultSQLiteDSN = "./app.db"
+)
+
+type DBFlags struct {
+	Driver string `cli:"--driver  Database driver (sqlite, postgres)" default:"sqlite" yaml:"driver" enum:"sqlite,postgres"`
+	DSN    string `cli:"--dsn     Data source name" yaml:"dsn" secret:"dsn"`
+}
+
+// openDB connects to the database with driver and dsn and returns storage
+// layer on top of it.
+func openDB(driver, dsn string, migrate bool) (*sql.DB, error) {
+	var (
+		dbtx sql.DBTX
+		err  error
+	)
+
+	switch driver {
+	case driverSQLite, "":
+		if dsn == "" {
+			dsn = defaultSQLiteDSN
+		}
+		dbtx, err = sqlite.New(dsn)
+	case driverPostgres:
+		if dsn == "" {
+			return nil, fmt.Errorf("dsn is required for %s driver", driver)
+		}
+		dbtx, err = postgres.New(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.New(dbtx, migrate)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/enverbisevac/go-project/app/keyring"
+	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/jxskiss/mcli"
+	"github.com/rs/zerolog/log"
+)
+
+type KeyFlags struct {
+	KeyFile      string `cli:"--key-file        Encrypt emails and full names of users, and events carrying them, with keys from the file" yaml:"key_file"`
+	AuditKeyFile string `cli:"--audit-key-file  Key of the audit log hash chain, created when missing, keep it away from those who can write the database" default:"./audit.key" yaml:"audit_key_file"`
+}
+
+// apply sets the audit log key of db and enables encryption when the key
+// file is set, users stored in plaintext until then are encrypted.
+func (f KeyFlags) apply(db *sql.DB) error {
+	auditKey, err := keyring.LoadKey(f.AuditKeyFile)
+	if err != nil {
+		return fmt.Errorf("audit key: %w", err)
+	}
+	db.SetAuditKey(auditKey)
+
+	if f.KeyFile == "" {
+		return nil
+	}
+
+	keys, err := keyring.Load(f.KeyFile)
+	if err != nil {
+		return err
+	}
+	db.SetKeyring(keys)
+
+	n, err := db.EncryptUsers(context.Background())
+	if err != nil {
+		return fmt.Errorf("encrypt users: %w", err)
+	}
+	if n > 0 {
+		log.Info().Int64("users", n).Msg("Users stored in plaintext encrypted")
+	}
+	return nil
+}
+
+func rotateKeysCmd() error {
+	var flags struct {
+		DBFlags
+		KeyFlags
+		NewKey  bool `cli:"--new-key  Add a new current key to the key file first, the file is created when missing"`
+		Decrypt bool `cli:"--decrypt  Store users in plaintext again, before the key file is dropped"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	if flags.KeyFile == "" {
+		return errors.New("key file is required")
+	}
+	if flags.NewKey && flags.Decrypt {
+		return errors.New("new key and decrypt can't be used together")
+	}
+
+	if flags.NewKey {
+		keys, err := keyring.Rotate(flags.KeyFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("new key %s added to %s\n", keys.CurrentID(), flags.KeyFile)
+	}
+
+	db, err := openDB(flags.Driver, flags.DSN, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = flags.apply(db); err != nil {
+		return err
+	}
+
+	n, err := db.RotateKeys(context.Background(), flags.Decrypt)
+	if err != nil {
+		return err
+	}
+
+	if flags.Decrypt {
+		fmt.Printf("%d users decrypted\n", n)
+		return nil
+	}
+	fmt.Printf("%d users encrypted\n", n)
+	return nil
+}
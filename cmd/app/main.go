@@ -15,6 +15,73 @@ func main() {
 			log.Fatal().Err(err).Msg("Error while running the http services")
 		}
 	}, "Run http server")
+	mcli.AddGroup("config", "Inspect the configuration of the server")
+	mcli.Add("config print", func() {
+		if err := configPrintCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while loading the config")
+		}
+	}, "Print the config the server runs with, secrets are redacted; takes the flags of server")
+	mcli.Add("config schema", func() {
+		if err := configSchemaCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while generating the config schema")
+		}
+	}, "Print the JSON schema of the config file")
+	mcli.AddGroup("migrate", "Manage database migrations")
+	mcli.Add("migrate up", func() {
+		if err := migrateUpCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while applying migrations")
+		}
+	}, "Apply all pending migrations")
+	mcli.Add("migrate down", func() {
+		if err := migrateDownCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while reverting migrations")
+		}
+	}, "Revert N most recent migrations")
+	mcli.Add("migrate status", func() {
+		if err := migrateStatusCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while reading migrations status")
+		}
+	}, "Show migrations status")
+	mcli.Add("migrate goto", func() {
+		if err := migrateGotoCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while migrating to version")
+		}
+	}, "Migrate up or down to VERSION")
+	mcli.Add("migrate create", func() {
+		if err := migrateCreateCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while creating migration")
+		}
+	}, "Create up and down files for a new migration NAME")
+	mcli.Add("backup", func() {
+		if err := backupCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while backing up the database")
+		}
+	}, "Back up the SQLite database while it is in use")
+	mcli.Add("restore", func() {
+		if err := restoreCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while restoring the database")
+		}
+	}, "Restore the SQLite database from backup FILE, the server must be stopped")
+	mcli.Add("export", func() {
+		if err := exportCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while exporting users and roles")
+		}
+	}, "Export users and roles as NDJSON or CSV")
+	mcli.Add("import", func() {
+		if err := importCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while importing users and roles")
+		}
+	}, "Import users and roles from NDJSON or CSV FILE")
+	mcli.Add("rotate-keys", func() {
+		if err := rotateKeysCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while rotating keys")
+		}
+	}, "Encrypt users with the current key of the key file")
+	mcli.Add("profile", func() {
+		if err := profileCmd(); err != nil {
+			log.Fatal().Err(err).Msg("Error while capturing the CPU profile")
+		}
+	}, "Capture CPU profiles of a running server and merge them into default.pgo")
 	mcli.Add("version", func() {
 		fmt.Printf("version: %s\n", version.Get())
 	}, "Show app version")
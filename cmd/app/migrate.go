@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/jxskiss/mcli"
+)
+
+type MigrateFlags struct {
+	DBFlags
+	DryRun bool `cli:"--dry-run  Print SQL statements without executing them"`
+}
+
+func openMigrator(flags MigrateFlags) (*sql.DB, *sql.Migrator, error) {
+	db, err := openDB(flags.Driver, flags.DSN, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := db.Migrator()
+	m.DryRun = flags.DryRun
+	return db, m, nil
+}
+
+func migrateUpCmd() error {
+	var flags MigrateFlags
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	db, m, err := openMigrator(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return m.Up(context.Background())
+}
+
+func migrateDownCmd() error {
+	var flags struct {
+		MigrateFlags
+		N int `cli:"#R, n, Number of migrations to revert"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	db, m, err := openMigrator(flags.MigrateFlags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return m.Down(context.Background(), flags.N)
+}
+
+func migrateGotoCmd() error {
+	var flags struct {
+		MigrateFlags
+		// string, so version 0 isn't rejected as a missing argument
+		Version string `cli:"#R, version, Version to migrate up or down to"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	version, err := strconv.ParseInt(flags.Version, 10, 64)
+	if err != nil || version < 0 {
+		return fmt.Errorf("invalid version %q", flags.Version)
+	}
+
+	db, m, err := openMigrator(flags.MigrateFlags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return m.Goto(context.Background(), version)
+}
+
+func migrateStatusCmd() error {
+	var flags DBFlags
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	db, err := openDB(flags.Driver, flags.DSN, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statuses, err := db.Migrator().Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tSTATE")
+	for _, status := range statuses {
+		appliedAt, state := "-", "pending"
+		if status.AppliedAt != nil {
+			appliedAt = time.Unix(*status.AppliedAt, 0).Format(time.RFC3339)
+			state = "applied"
+		}
+		switch {
+		case status.Missing:
+			state = "missing"
+		case status.Modified:
+			state = "modified"
+		}
+		fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", status.Version, status.Name, appliedAt, state)
+	}
+	return w.Flush()
+}
+
+func migrateCreateCmd() error {
+	var flags struct {
+		Driver string `cli:"--driver  Database driver (sqlite, postgres)" default:"sqlite"`
+		Dir    string `cli:"--dir     Migrations directory, defaults to assets/migration/<driver>"`
+		Name   string `cli:"#R, name, Migration name"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	if flags.Dir == "" {
+		flags.Dir = filepath.Join("assets", "migration", flags.Driver)
+	}
+
+	files, err := sql.CreateMigration(flags.Dir, flags.Name)
+	for _, file := range files {
+		fmt.Println("created", file)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/http"
+	"github.com/enverbisevac/libs/httputil"
+	"github.com/google/pprof/profile"
+	"github.com/jxskiss/mcli"
+)
+
+func profileCmd() error {
+	var flags struct {
+		URL          string `cli:"--url            Base URL of the running server" default:"http://localhost:4444"`
+		Email        string `cli:"--email          Email of an administrator"`
+		PasswordFile string `cli:"--password-file  File with the password of the administrator, - reads it from stdin, by default it is read from APP_ADMIN_PASSWORD"`
+		Token        string `cli:"--token          Token of an administrator, instead of email and password" env:"APP_ADMIN_TOKEN"`
+		Seconds      int    `cli:"--seconds        Duration of a capture" default:"30"`
+		Count        int    `cli:"--count          Number of captures taken one after another" default:"1"`
+		Output       string `cli:"--output         Profile the captures are merged into, profiles already in it are kept" default:"default.pgo"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+	if flags.Seconds <= 0 || flags.Count <= 0 {
+		return fmt.Errorf("seconds and count must be positive")
+	}
+
+	ctx := context.Background()
+	token := flags.Token
+	if token == "" {
+		password, err := adminPassword(flags.PasswordFile)
+		if err != nil {
+			return err
+		}
+		token, err = http.NewClient(httputil.NewClient(flags.URL)).Login(ctx, &app.Credentials{
+			Email:    app.Email(flags.Email),
+			Password: app.Password(password),
+		})
+		if err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+	}
+
+	profiles, err := readProfile(flags.Output)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < flags.Count; i++ {
+		fmt.Printf("capturing CPU profile %d of %d for %ds\n", i+1, flags.Count, flags.Seconds)
+		p, err := captureProfile(ctx, flags.URL, token, flags.Seconds)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return fmt.Errorf("merge profiles: %w", err)
+	}
+	if err = writeProfile(flags.Output, merged); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s merged from %d profiles\n", flags.Output, len(profiles))
+	return nil
+}
+
+// adminPassword returns the password of the administrator read from the
+// file, - reads it from stdin, or from APP_ADMIN_PASSWORD without a file. It
+// isn't taken as a flag, which would show it in ps and the shell history.
+func adminPassword(file string) (string, error) {
+	if file == "" {
+		password := os.Getenv("APP_ADMIN_PASSWORD")
+		if password == "" {
+			return "", errors.New("password is required, set APP_ADMIN_PASSWORD or use --password-file")
+		}
+		return password, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readProfile returns the profile in the file, none when the file is missing
+// or empty, like the default.pgo in the repo.
+func readProfile(name string) ([]*profile.Profile, error) {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil || info.Size() == 0 {
+		return nil, err
+	}
+	p, err := profile.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return []*profile.Profile{p}, nil
+}
+
+// captureProfile takes a CPU profile of the server.
+func captureProfile(ctx context.Context, baseURL, token string, seconds int) (*profile.Profile, error) {
+	uri, err := url.JoinPath(baseURL, "/debug/pprof/profile")
+	if err != nil {
+		return nil, err
+	}
+	req, err := stdhttp.NewRequestWithContext(ctx, stdhttp.MethodGet, uri+"?seconds="+strconv.Itoa(seconds), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := stdhttp.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != stdhttp.StatusOK {
+		return nil, fmt.Errorf("capture profile: %s", resp.Status)
+	}
+
+	p, err := profile.Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse captured profile: %w", err)
+	}
+	return p, nil
+}
+
+// writeProfile replaces the file with the profile, a failed write leaves the
+// old profile in place.
+func writeProfile(name string, p *profile.Profile) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = p.Write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
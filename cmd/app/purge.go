@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/rs/zerolog/log"
+)
+
+// purgeDeleted permanently removes users and roles deleted longer than
+// retention ago, every interval until ctx is done.
+func purgeDeleted(ctx context.Context, store app.Storage, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := store.PurgeDeleted(ctx, time.Now().Add(-retention))
+		switch {
+		case err != nil:
+			log.Err(err).Msg("Failed to purge deleted users and roles")
+		case n > 0:
+			log.Info().Int64("rows", n).Msg("Purged deleted users and roles")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/config"
+	"github.com/enverbisevac/go-project/app/jwt"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/enverbisevac/go-project/assets"
+	"github.com/rs/zerolog/log"
+)
+
+// reloader applies the settings of the server config tagged reload while the
+// server runs.
+type reloader struct {
+	loader *configLoader
+	jwt    *jwt.Manager
+	db     *sql.DB
+
+	mu sync.Mutex
+	// running is the config in effect, settings which need a restart keep
+	// the values the server started with.
+	running *ServerConfig
+}
+
+func newReloader(loader *configLoader, cfg *ServerConfig, jwt *jwt.Manager, db *sql.DB) *reloader {
+	return &reloader{
+		loader:  loader,
+		jwt:     jwt,
+		db:      db,
+		running: cfg,
+	}
+}
+
+// apply applies the reloadable settings of cfg. Templates and log levels
+// are parsed first, nothing changes when either fails.
+func (r *reloader) apply(cfg *ServerConfig) error {
+	fsys := assets.EmbeddedTemplates()
+	if cfg.HTTP.TemplatesDir != "" {
+		fsys = os.DirFS(cfg.HTTP.TemplatesDir)
+	}
+	templates, err := assets.ParseTemplates(fsys)
+	if err != nil {
+		return app.ErrInvalid("load templates from %s: %s", cfg.HTTP.TemplatesDir, err.Error(), err)
+	}
+	levels, err := logging.ParseLevels(cfg.Log.Level, cfg.Log.Components.levels())
+	if err != nil {
+		return app.ErrInvalid("log levels: %s", err.Error(), err)
+	}
+
+	assets.UseTemplates(templates)
+	levels.Apply()
+	r.jwt.SetDuration(cfg.Auth.TokenLifetime)
+	r.db.SetPasswordCost(cfg.Auth.PasswordCost)
+	r.db.QueryMetrics().SetSlowQuery(cfg.Database.SlowQuery)
+	return nil
+}
+
+// Reload reads the config again and applies the reloadable settings, the
+// changes are logged. Changed settings which need a restart are reported on
+// every reload until the server restarts.
+func (r *reloader) Reload(ctx context.Context) (app.ConfigReload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.loader.Load()
+	if err != nil {
+		return app.ConfigReload{}, app.ErrInvalid("%s", err.Error(), err)
+	}
+	if err = r.apply(cfg); err != nil {
+		return app.ConfigReload{}, err
+	}
+
+	reload := app.ConfigReload{
+		File:    cfg.File,
+		Changes: []app.ConfigChange{},
+	}
+	for _, change := range config.Diff(r.running, cfg) {
+		reload.Changes = append(reload.Changes, app.ConfigChange{
+			Key:     change.Key,
+			Old:     change.Old,
+			New:     change.New,
+			Applied: change.Reloadable,
+		})
+
+		event, msg := log.Info(), "Config setting reloaded"
+		if !change.Reloadable {
+			event, msg = log.Warn(), "Config setting changed, restart to apply"
+		}
+		event.Str("setting", change.Key).Str("old", change.Old).Str("new", change.New).Msg(msg)
+	}
+	config.CopyReloadable(r.running, cfg)
+
+	log.Info().Str("file", cfg.File).Int("changes", len(reload.Changes)).Msg("Config reloaded")
+	return reload, nil
+}
+
+// reloadOnSignal reloads the config whenever a signal is received on
+// signals, until ctx is done.
+func reloadOnSignal(ctx context.Context, signals <-chan os.Signal, r app.ConfigReloader) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if _, err := r.Reload(ctx); err != nil {
+				log.Err(err).Msg("Failed to reload config, the running config is kept")
+			}
+		}
+	}
+}
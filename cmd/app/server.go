@@ -10,32 +10,31 @@ import (
 	"time"
 
 	"github.com/enverbisevac/go-project/app"
+	"github.com/enverbisevac/go-project/app/health"
 	"github.com/enverbisevac/go-project/app/http"
 	"github.com/enverbisevac/go-project/app/jwt"
-	"github.com/enverbisevac/go-project/app/sql"
+	"github.com/enverbisevac/go-project/app/logging"
+	"github.com/enverbisevac/go-project/app/metrics"
 	"github.com/enverbisevac/go-project/app/sql/sqlite"
-	"github.com/jxskiss/mcli"
+	"github.com/enverbisevac/go-project/app/tracing"
+	"github.com/enverbisevac/go-project/app/webhook"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 func serverCmd() error {
-	var flags struct {
-		BaseURL string `cli:"--base-url    Base url for application" default:"http://localhost"`
-		Port    int    `cli:"-p, --port    Port to listen on for HTTP requests" default:"4444"`
-		Detach  bool   `cli:"-d, --detach  Detach process"`
-		DSN     string `cli:"--dsn         Data source name"`
-		Migrate bool   `cli:"--migrate     Run auto migration" default:"true"`
-		LogDir  string `cli:"--log-dir     Set log dir"`
+	loader, err := newConfigLoader()
+	if err != nil {
+		return err
 	}
-
-	_, err := mcli.Parse(&flags)
+	cfg, err := loader.Load()
 	if err != nil {
 		return err
 	}
+	app.Debug = cfg.Debug
 
 	// detach application
-	if flags.Detach {
+	if cfg.Detach {
 		args := make([]string, 0, len(os.Args))
 		for _, arg := range os.Args[1:] {
 			if arg != "-d" && arg != "--detach" {
@@ -50,22 +49,34 @@ func serverCmd() error {
 
 	// setup logs
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	closeLogs, err := logging.Setup(cfg.Log.logging())
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
 
 	log.Info().Msg("Application started")
 
-	if flags.DSN == "" {
-		flags.DSN = "./app.db"
-	}
-	sqlt, err := sqlite.New(flags.DSN)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		File:        cfg.Tracing.File,
+		SampleRatio: cfg.Tracing.Sample,
+	})
 	if err != nil {
 		return err
 	}
-	db, err := sql.New(sqlt, flags.Migrate)
+
+	db, err := openDB(cfg.Database.Driver, cfg.Database.DSN, cfg.Database.Migrate)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
+	if err = cfg.Database.apply(db); err != nil {
+		return err
+	}
+
 	db.AddUser(context.Background(), &app.UserAggregate{
 		User: app.User{
 			Active:     true,
@@ -78,15 +89,81 @@ func serverCmd() error {
 	})
 
 	// initialize services
-	jwtService := jwt.NewManager(flags.BaseURL, 24*time.Hour, db)
+	jwtService := jwt.NewManager(cfg.HTTP.BaseURL, cfg.Auth.TokenLifetime, db)
+	reloader := newReloader(loader, cfg, jwtService, db)
+	if err = reloader.apply(cfg); err != nil {
+		return err
+	}
+	webhookSender := webhook.NewSender(db, nil, webhook.Config{
+		MaxRetries:  cfg.Webhooks.Retries,
+		MaxFailures: cfg.Webhooks.MaxFailures,
+		Timeout:     cfg.Webhooks.Timeout,
+	})
+	var backups app.BackupService
+	if sqliteDB, ok := db.DBTX.(*sqlite.DB); ok {
+		backups = sqlite.NewBackups(sqliteDB, cfg.Backup.config())
+	}
+
+	registry := metrics.NewRegistry()
+	registry.Collect(metrics.WriteBuildInfo)
+	registry.Collect(metrics.WriteRuntime)
+	registry.Collect(db.CollectMetrics)
+
+	checks := health.NewRegistry()
+	checks.Register(db.Checks()...)
+
 	httpService := http.New(http.Config{
-		BaseURL: flags.BaseURL,
-		Port:    flags.Port,
-	}, jwtService, db, db, db)
+		BaseURL:         cfg.HTTP.BaseURL,
+		Port:            cfg.HTTP.Port,
+		EventBuffer:     cfg.Events.Buffer,
+		EventHeartbeat:  cfg.Events.Heartbeat,
+		MetricsPort:     cfg.Metrics.Port,
+		MetricsUsername: cfg.Metrics.User,
+		MetricsPassword: cfg.Metrics.Password,
+		DrainDelay:      cfg.HTTP.DrainDelay,
+		IdleTimeout:     cfg.HTTP.IdleTimeout,
+		ReadTimeout:     cfg.HTTP.ReadTimeout,
+		WriteTimeout:    cfg.HTTP.WriteTimeout,
+		ShutdownTimeout: cfg.HTTP.ShutdownTimeout,
+		AccessLogSample: cfg.Log.AccessSample,
+	}, jwtService, db, db, db, webhookSender, backups, reloader, registry, checks)
+
+	// background jobs
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	task := app.NewTask()
+	if cfg.Purge.Retention > 0 {
+		task.Background(func() {
+			purgeDeleted(ctx, db, cfg.Purge.Retention, cfg.Purge.Interval)
+		})
+	}
+
+	if cfg.Backup.Interval > 0 {
+		task.Background(func() {
+			backupDatabase(ctx, backups, cfg.Backup.Interval)
+		})
+	}
+
+	// sinks get every event in turn, the in-process ones go first so a
+	// failing webhook queue doesn't hold back the event stream
+	dispatcher := app.NewDispatcher(db, app.DispatcherConfig{
+		Interval:  cfg.Events.Interval,
+		Retention: cfg.Events.Retention,
+	}, app.LogEventSink{}, httpService.Events(), webhookSender)
+	dispatcher.Start(ctx, task)
+	webhookSender.Start(ctx, task)
+	checks.Register(health.Check{Name: "event_dispatcher", Probe: dispatcher.Check})
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	task.Background(func() {
+		reloadOnSignal(ctx, hangup, reloader)
+	})
+
 	go func() {
 		if err := httpService.Start(); err != nil {
 			log.Fatal().Msgf("error while starting http server, err: %v", err)
@@ -100,6 +177,14 @@ func serverCmd() error {
 		log.Fatal().Msgf("Server Shutdown Failed:%+v", err)
 	}
 
+	cancel()
+	task.Wait()
+
+	// spans of background jobs end when they stop
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Err(err).Msg("failed to flush traces")
+	}
+
 	log.Info().Msg("Server stopped properly")
 
 	return nil
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/enverbisevac/go-project/app"
+	"github.com/jxskiss/mcli"
+)
+
+func exportCmd() error {
+	var flags struct {
+		DBFlags
+		KeyFlags
+		Format string `cli:"--format  Export format (ndjson, csv)" default:"ndjson"`
+		Output string `cli:"--output  Write to the file instead of stdout"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	db, err := openDB(flags.Driver, flags.DSN, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = flags.apply(db); err != nil {
+		return err
+	}
+
+	records, err := db.ExportRecords(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if flags.Output != "" {
+		f, err := os.OpenFile(flags.Output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return app.EncodeRecords(w, flags.Format, records)
+}
+
+func importCmd() error {
+	var flags struct {
+		DBFlags
+		KeyFlags
+		Format string `cli:"--format   Import format (ndjson, csv), inferred from the file extension"`
+		Mode   string `cli:"--mode     What to do with existing roles and users (skip, upsert)" default:"skip"`
+		DryRun bool   `cli:"--dry-run  Validate the file without importing it"`
+		File   string `cli:"#R, file, File to import, - reads stdin"`
+	}
+
+	if _, err := mcli.Parse(&flags); err != nil {
+		return err
+	}
+
+	format := flags.Format
+	if format == "" {
+		format = app.FormatNDJSON
+		if filepath.Ext(flags.File) == ".csv" {
+			format = app.FormatCSV
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.File != "-" {
+		f, err := os.Open(flags.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	records, errs, err := app.DecodeRecords(r, format)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(flags.Driver, flags.DSN, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = flags.apply(db); err != nil {
+		return err
+	}
+
+	report, err := db.ImportRecords(context.Background(), records, app.ImportOptions{
+		Mode:   flags.Mode,
+		DryRun: flags.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+	report.AddErrors(errs...)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return err
+	}
+
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("import has %d invalid records", len(report.Errors))
+	}
+	return nil
+}
@@ -3,26 +3,50 @@ module github.com/enverbisevac/go-project
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/enverbisevac/libs v0.1.0
+	github.com/evanphx/json-patch/v5 v5.6.0
 	github.com/goccy/go-json v0.10.2
+	github.com/google/pprof v0.0.0-20240424215950-a892ee059fd6
+	github.com/jackc/pgx/v5 v5.4.3
 	github.com/jxskiss/mcli v0.7.1
 	github.com/rs/xid v1.4.0
 	github.com/rs/zerolog v1.29.1
 	github.com/swaggest/jsonschema-go v0.3.50
 	github.com/swaggest/swgui v1.6.3
-	golang.org/x/text v0.11.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.28.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+	golang.org/x/text v0.16.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/kr/pretty v0.3.1 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.20.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/pkg/errors v0.9.1 // indirect
 	github.com/swaggest/refl v1.1.0 // indirect
 	github.com/vearutop/statigz v1.2.0 // indirect
-	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.28.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	go.opentelemetry.io/proto/otlp v1.3.1 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240701130421-f6361c86f094 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240701130421-f6361c86f094 // indirect
+	google.golang.org/grpc v1.64.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
 require (
-	github.com/cenkalti/backoff/v4 v4.2.1
+	github.com/cenkalti/backoff/v4 v4.3.0
 	github.com/dchest/uniuri v1.2.0
 	github.com/jaevor/go-nanoid v1.3.0
 	github.com/jmoiron/sqlx v1.3.5
@@ -32,9 +56,9 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/pascaldekloe/jwt v1.12.0
 	github.com/swaggest/openapi-go v0.2.30
-	golang.org/x/crypto v0.9.0
+	golang.org/x/crypto v0.24.0
 	golang.org/x/exp v0.0.0-20230801115018-d63ba01acd4b
-	golang.org/x/sys v0.9.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
 
 replace github.com/goccy/go-json => github.com/enverbisevac/go-json v0.0.0-20230602114245-b43a13ce794e